@@ -0,0 +1,376 @@
+package alerting
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/compliance"
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/format"
+	"github.com/anupcshan/hsadmin/internal/logging"
+	"github.com/anupcshan/hsadmin/internal/models"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+)
+
+var logger = logging.For("alerts")
+
+// resolvedCapacity is the number of recently resolved alerts kept for display
+const resolvedCapacity = 50
+
+// State is the lifecycle state of an alert
+type State string
+
+// Alert states
+const (
+	StatePending  State = "pending"  // Condition holds, but not yet for the rule's duration
+	StateFiring   State = "firing"   // Condition has held for the rule's duration
+	StateResolved State = "resolved" // Condition no longer holds
+)
+
+// Alert is a single rule violation for one subject (a machine or a route)
+// Alerts are identified by their fingerprint, so a condition that keeps holding across
+// evaluations stays a single alert rather than producing a new one on every poll.
+type Alert struct {
+	Fingerprint string // Rule name and subject key
+	Rule        string
+	Kind        string
+	Subject     string
+	MachineID   uint64 // 0 if the alert is not about a single machine
+	Summary     string
+	State       State
+	ActiveSince time.Time // When the condition started holding
+	FiredAt     time.Time // Zero while pending
+	ResolvedAt  time.Time // Zero until resolved
+	Silenced    bool      // Whether a silence matched when the alert was last read or changed state
+
+	notified bool // Whether alert.firing was sent, so alert.resolved is only sent for announced alerts
+}
+
+// Event returns the alert.firing or alert.resolved event for the alert's current state
+func (a Alert) Event() watcher.Event {
+	eventType, at := watcher.AlertFiring, a.FiredAt
+	if a.State == StateResolved {
+		eventType, at = watcher.AlertResolved, a.ResolvedAt
+	}
+
+	e := watcher.NewEvent(eventType, at)
+	e.Alert = &watcher.AlertState{
+		Rule:        a.Rule,
+		Kind:        a.Kind,
+		Subject:     a.Subject,
+		MachineID:   a.MachineID,
+		Summary:     a.Summary,
+		ActiveSince: a.ActiveSince,
+	}
+	return e
+}
+
+// ActiveForText returns how long the condition has held (until resolution, if resolved)
+func (a Alert) ActiveForText() string {
+	until := time.Now()
+	if a.State == StateResolved {
+		until = a.ResolvedAt
+	}
+	return format.Duration(until.Sub(a.ActiveSince))
+}
+
+// RuleInfo describes a configured rule for display
+type RuleInfo struct {
+	Name        string
+	Kind        string
+	Description string
+}
+
+// Engine evaluates alert rules against the tailnet and tracks alert state
+type Engine struct {
+	rules        []*rule
+	silencesFile string // Empty if silences are only kept in memory
+
+	mu        sync.RWMutex
+	active    map[string]*Alert // Pending and firing alerts, by fingerprint
+	resolved  []Alert           // Recently resolved alerts, newest first
+	silences  []Silence
+	evaluated time.Time // Time of the last successful evaluation
+	listeners []func([]watcher.Event)
+}
+
+// NewEngine creates an alert engine for the configured rules, loading saved silences
+// policy is checked by noncompliant rules.
+func NewEngine(cfg *config.AlertsConfig, policy compliance.Policy) (*Engine, error) {
+	e := &Engine{
+		silencesFile: cfg.SilencesFile,
+		active:       make(map[string]*Alert),
+	}
+
+	for _, ruleCfg := range cfg.Rules {
+		r, err := compileRule(ruleCfg, policy)
+		if err != nil {
+			return nil, err
+		}
+		e.rules = append(e.rules, r)
+	}
+
+	if e.silencesFile != "" {
+		silences, err := loadSilences(e.silencesFile, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load silences: %w", err)
+		}
+		e.silences = silences
+	}
+
+	return e, nil
+}
+
+// OnChange registers fn to be called with the alert.firing and alert.resolved events of alerts
+// that are not silenced. fn is called on the watcher's goroutine and must not block.
+func (e *Engine) OnChange(fn func([]watcher.Event)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners = append(e.listeners, fn)
+}
+
+// Observe evaluates rules against a watcher update, logs alerts that fire or resolve and notifies listeners
+// A failed fetch produces no update, so alert state is left untouched rather than resolving everything.
+func (e *Engine) Observe(u watcher.Update) {
+	var events []watcher.Event
+	for _, a := range e.Evaluate(u.Machines, u.Snapshot.At) {
+		logger.Info("Alert", "state", a.State, "rule", a.Rule, "summary", a.Summary, "silenced", a.Silenced)
+		if a.Silenced || (a.State == StateResolved && !a.notified) {
+			continue
+		}
+		events = append(events, a.Event())
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	e.mu.RLock()
+	listeners := e.listeners
+	e.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(events)
+	}
+}
+
+// Evaluate applies every rule to machines and updates alert state
+// Returns the alerts that started firing or were resolved by this evaluation.
+func (e *Engine) Evaluate(machines []*models.Machine, now time.Time) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var changed []Alert
+	seen := make(map[string]bool)
+
+	for _, r := range e.rules {
+		for _, c := range r.evaluate(machines) {
+			fingerprint := r.Name + "/" + c.key
+			seen[fingerprint] = true
+
+			a, exists := e.active[fingerprint]
+			if !exists {
+				a = &Alert{
+					Fingerprint: fingerprint,
+					Rule:        r.Name,
+					Kind:        r.Kind,
+					State:       StatePending,
+					ActiveSince: now,
+				}
+				e.active[fingerprint] = a
+			}
+			a.Subject = c.subject
+			a.MachineID = c.machineID
+			a.Summary = c.summary
+			if !c.since.IsZero() && c.since.Before(a.ActiveSince) {
+				a.ActiveSince = c.since
+			}
+
+			if a.State == StatePending && now.Sub(a.ActiveSince) >= r.For {
+				a.State = StateFiring
+				a.FiredAt = now
+				a.Silenced = e.silencedLocked(*a, now)
+				a.notified = !a.Silenced
+				changed = append(changed, *a)
+			}
+		}
+	}
+
+	for _, fingerprint := range sortedFingerprints(e.active) {
+		if seen[fingerprint] {
+			continue
+		}
+		a := e.active[fingerprint]
+		delete(e.active, fingerprint)
+
+		// A pending alert that clears never fired, so there is nothing to resolve
+		if a.State != StateFiring {
+			continue
+		}
+		a.State = StateResolved
+		a.ResolvedAt = now
+		a.Silenced = e.silencedLocked(*a, now)
+		changed = append(changed, *a)
+
+		e.resolved = append([]Alert{*a}, e.resolved...)
+		if len(e.resolved) > resolvedCapacity {
+			e.resolved = e.resolved[:resolvedCapacity]
+		}
+	}
+
+	e.evaluated = now
+	return changed
+}
+
+// Active returns firing alerts followed by pending alerts, oldest first within each state
+func (e *Engine) Active() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]Alert, 0, len(e.active))
+	for _, a := range e.active {
+		alert := *a
+		alert.Silenced = e.silencedLocked(alert, now)
+		result = append(result, alert)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].State != result[j].State {
+			return result[i].State == StateFiring
+		}
+		if !result[i].ActiveSince.Equal(result[j].ActiveSince) {
+			return result[i].ActiveSince.Before(result[j].ActiveSince)
+		}
+		return result[i].Fingerprint < result[j].Fingerprint
+	})
+	return result
+}
+
+// Resolved returns recently resolved alerts, newest first
+func (e *Engine) Resolved() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return append([]Alert(nil), e.resolved...)
+}
+
+// LastEvaluated returns the time of the last successful evaluation, zero if none yet
+func (e *Engine) LastEvaluated() time.Time {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.evaluated
+}
+
+// Rules describes the configured rules, in configuration order
+func (e *Engine) Rules() []RuleInfo {
+	result := make([]RuleInfo, 0, len(e.rules))
+	for _, r := range e.rules {
+		result = append(result, RuleInfo{
+			Name:        r.Name,
+			Kind:        r.Kind,
+			Description: r.Description(),
+		})
+	}
+	return result
+}
+
+// Silences returns silences that have not yet ended, ordered by end time
+func (e *Engine) Silences() []Silence {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	now := time.Now()
+	var result []Silence
+	for _, s := range e.silences {
+		if now.Before(s.End) {
+			result = append(result, s)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].End.Before(result[j].End) })
+	return result
+}
+
+// AddSilence adds a silence, assigning its ID, drops silences that have ended and saves the rest
+func (e *Engine) AddSilence(s Silence) (Silence, error) {
+	if !s.End.After(s.Start) {
+		return Silence{}, fmt.Errorf("silence must end after it starts")
+	}
+	if !e.hasRule(s.Rule) {
+		return Silence{}, fmt.Errorf("unknown alert rule %q", s.Rule)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	var kept []Silence
+	for _, existing := range e.silences {
+		if now.Before(existing.End) {
+			kept = append(kept, existing)
+		}
+	}
+
+	s.ID = newSilenceID()
+	if err := e.setSilencesLocked(append(kept, s)); err != nil {
+		return Silence{}, err
+	}
+	return s, nil
+}
+
+// ExpireSilence ends a silence immediately
+func (e *Engine) ExpireSilence(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, s := range e.silences {
+		if s.ID == id {
+			return e.setSilencesLocked(slices.Delete(slices.Clone(e.silences), i, i+1))
+		}
+	}
+	return fmt.Errorf("unknown silence %q", id)
+}
+
+// setSilencesLocked saves silences and makes them current, leaving the current ones if saving fails
+// e.mu must be held.
+func (e *Engine) setSilencesLocked(silences []Silence) error {
+	if e.silencesFile != "" {
+		if err := saveSilences(e.silencesFile, silences); err != nil {
+			return fmt.Errorf("failed to save silences: %w", err)
+		}
+	}
+	e.silences = silences
+	return nil
+}
+
+// hasRule returns true if a rule with the given name is configured
+func (e *Engine) hasRule(name string) bool {
+	for _, r := range e.rules {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// silencedLocked returns true if an active silence matches the alert; e.mu must be held
+func (e *Engine) silencedLocked(a Alert, now time.Time) bool {
+	for _, s := range e.silences {
+		if s.ActiveAt(now) && s.Matches(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedFingerprints returns the keys of alerts in ascending order
+func sortedFingerprints(alerts map[string]*Alert) []string {
+	keys := make([]string, 0, len(alerts))
+	for k := range alerts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,302 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/compliance"
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/models"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"tailscale.com/tailcfg"
+)
+
+// machine builds a test machine
+func machine(id uint64, name string, online bool, modify func(*headscale.Node)) *models.Machine {
+	node := &headscale.Node{
+		Id:        id,
+		GivenName: name,
+		User:      &headscale.User{Name: "alice"},
+	}
+	if modify != nil {
+		modify(node)
+	}
+	return &models.Machine{Node: node, Online: online}
+}
+
+// withVersion sets the Tailscale version reported by a machine
+func withVersion(m *models.Machine, v string) *models.Machine {
+	m.WhoIsNode = &tailcfg.Node{Hostinfo: (&tailcfg.Hostinfo{IPNVersion: v}).View()}
+	return m
+}
+
+// newTestEngine creates an engine for the given rules, with a policy requiring 1.70.0 and auto-update
+func newTestEngine(t *testing.T, rules ...config.AlertRule) *Engine {
+	t.Helper()
+	policy := compliance.Policy{MinVersion: &models.Version{1, 70, 0}, RequireAutoUpdate: true}
+	e, err := NewEngine(&config.AlertsConfig{Rules: rules}, policy)
+	require.NoError(t, err)
+	return e
+}
+
+// states returns the fingerprint and state of each alert
+func states(alerts []Alert) map[string]State {
+	result := make(map[string]State)
+	for _, a := range alerts {
+		result[a.Fingerprint] = a.State
+	}
+	return result
+}
+
+// TestEngine_OfflineLifecycle tests pending, firing, deduplication and resolution
+func TestEngine_OfflineLifecycle(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	e := newTestEngine(t, config.AlertRule{
+		Name: "servers", Kind: config.AlertKindOffline, Tag: "tag:server", For: 5 * time.Minute,
+	})
+
+	server := func(online bool) []*models.Machine {
+		return []*models.Machine{
+			machine(1, "db", online, func(n *headscale.Node) { n.ForcedTags = []string{"tag:server"} }),
+			machine(2, "laptop", false, nil), // Not selected by the rule
+		}
+	}
+
+	// Offline, but not yet for 5 minutes: pending
+	changed := e.Evaluate(server(false), base)
+	assert.Empty(t, changed)
+	assert.Equal(t, map[string]State{"servers/1": StatePending}, states(e.Active()))
+
+	// Still offline after 5 minutes: fires once
+	changed = e.Evaluate(server(false), base.Add(5*time.Minute))
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateFiring, changed[0].State)
+	assert.Equal(t, "Machine db (alice) is offline", changed[0].Summary)
+	assert.Equal(t, uint64(1), changed[0].MachineID)
+
+	// Still offline: deduplicated
+	changed = e.Evaluate(server(false), base.Add(6*time.Minute))
+	assert.Empty(t, changed)
+	assert.Len(t, e.Active(), 1)
+
+	// Back online: resolved and moved to history
+	changed = e.Evaluate(server(true), base.Add(7*time.Minute))
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateResolved, changed[0].State)
+	assert.Empty(t, e.Active())
+	require.Len(t, e.Resolved(), 1)
+	assert.Equal(t, base.Add(7*time.Minute), e.Resolved()[0].ResolvedAt)
+}
+
+// TestEngine_PendingClears tests that a pending alert that clears is dropped without resolving
+func TestEngine_PendingClears(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	e := newTestEngine(t, config.AlertRule{Name: "any", Kind: config.AlertKindOffline, For: 5 * time.Minute})
+
+	e.Evaluate([]*models.Machine{machine(1, "db", false, nil)}, base)
+	changed := e.Evaluate([]*models.Machine{machine(1, "db", true, nil)}, base.Add(time.Minute))
+
+	assert.Empty(t, changed)
+	assert.Empty(t, e.Active())
+	assert.Empty(t, e.Resolved())
+}
+
+// TestEngine_LastSeen tests that a machine already offline for longer than the rule fires immediately
+func TestEngine_LastSeen(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	e := newTestEngine(t, config.AlertRule{Name: "any", Kind: config.AlertKindOffline, For: 5 * time.Minute})
+
+	m := machine(1, "db", false, func(n *headscale.Node) {
+		n.LastSeen = timestamppb.New(base.Add(-time.Hour))
+	})
+	changed := e.Evaluate([]*models.Machine{m}, base)
+
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateFiring, changed[0].State)
+	assert.Equal(t, base.Add(-time.Hour), changed[0].ActiveSince)
+}
+
+// TestEngine_Rules tests each rule kind against a small tailnet
+func TestEngine_Rules(t *testing.T) {
+	exitNode := func(n *headscale.Node) {
+		n.AvailableRoutes = []string{"0.0.0.0/0", "::/0"}
+		n.ApprovedRoutes = []string{"0.0.0.0/0", "::/0"}
+	}
+	router := func(n *headscale.Node) {
+		n.AvailableRoutes = []string{"10.0.0.0/8"}
+		n.ApprovedRoutes = []string{"10.0.0.0/8"}
+	}
+
+	tests := []struct {
+		name     string
+		rule     config.AlertRule
+		machines []*models.Machine
+		want     map[string]State
+	}{
+		{
+			name:     "exit node offline",
+			rule:     config.AlertRule{Name: "exit", Kind: config.AlertKindExitNodeOffline},
+			machines: []*models.Machine{machine(1, "exit", false, exitNode), machine(2, "laptop", false, nil)},
+			want:     map[string]State{"exit/1": StateFiring},
+		},
+		{
+			name:     "route served by an online router",
+			rule:     config.AlertRule{Name: "corp", Kind: config.AlertKindRouteUnavailable, Route: "10.0.0.0/8"},
+			machines: []*models.Machine{machine(1, "r1", false, router), machine(2, "r2", true, router)},
+			want:     map[string]State{},
+		},
+		{
+			name:     "all routers offline",
+			rule:     config.AlertRule{Name: "corp", Kind: config.AlertKindRouteUnavailable, Route: "10.0.0.0/8"},
+			machines: []*models.Machine{machine(1, "r1", false, router), machine(2, "r2", false, router)},
+			want:     map[string]State{"corp/10.0.0.0/8": StateFiring},
+		},
+		{
+			name:     "route never approved",
+			rule:     config.AlertRule{Name: "corp", Kind: config.AlertKindRouteUnavailable, Route: "192.168.0.0/16"},
+			machines: []*models.Machine{machine(1, "r1", true, router)},
+			want:     map[string]State{"corp/192.168.0.0/16": StateFiring},
+		},
+		{
+			name: "old clients",
+			rule: config.AlertRule{Name: "old", Kind: config.AlertKindVersionBelow, MinVersion: "1.60.0"},
+			machines: []*models.Machine{
+				withVersion(machine(1, "old", true, nil), "1.58.2-t1234abcd-g5678"),
+				withVersion(machine(2, "new", true, nil), "1.76.1"),
+				machine(3, "unknown", true, nil),
+			},
+			want: map[string]State{"old/1": StateFiring},
+		},
+		{
+			name: "noncompliant clients",
+			rule: config.AlertRule{Name: "policy", Kind: config.AlertKindNoncompliant},
+			machines: []*models.Machine{
+				withVersion(machine(1, "old", true, nil), "1.68.0"),
+				machine(2, "unknown", true, nil),
+			},
+			want: map[string]State{"policy/1": StateFiring},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, tt.rule)
+			e.Evaluate(tt.machines, time.Now())
+			assert.Equal(t, tt.want, states(e.Active()))
+		})
+	}
+}
+
+// TestEngine_Silences tests that silences mark matching alerts and can be expired
+func TestEngine_Silences(t *testing.T) {
+	e := newTestEngine(t, config.AlertRule{Name: "any", Kind: config.AlertKindOffline})
+	now := time.Now()
+
+	_, err := e.AddSilence(Silence{Rule: "missing", Start: now, End: now.Add(time.Hour)})
+	assert.Error(t, err)
+	_, err = e.AddSilence(Silence{Rule: "any", Start: now, End: now})
+	assert.Error(t, err)
+
+	s, err := e.AddSilence(Silence{Rule: "any", Subject: "db", Start: now.Add(-time.Minute), End: now.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.NotEmpty(t, s.ID)
+
+	changed := e.Evaluate([]*models.Machine{machine(1, "db", false, nil), machine(2, "web", false, nil)}, now)
+	require.Len(t, changed, 2)
+	assert.True(t, changed[0].Silenced)
+	assert.False(t, changed[1].Silenced)
+
+	require.NoError(t, e.ExpireSilence(s.ID))
+	assert.Empty(t, e.Silences())
+	for _, a := range e.Active() {
+		assert.False(t, a.Silenced)
+	}
+	assert.Error(t, e.ExpireSilence(s.ID))
+}
+
+// TestEngine_Notify tests that listeners receive events for alerts that fire and resolve, except silenced ones
+func TestEngine_Notify(t *testing.T) {
+	e := newTestEngine(t, config.AlertRule{Name: "any", Kind: config.AlertKindOffline})
+	var received []watcher.Event
+	e.OnChange(func(events []watcher.Event) { received = append(received, events...) })
+
+	now := time.Now()
+	observe := func(dbOnline, webOnline bool) {
+		e.Observe(watcher.Update{
+			Machines: []*models.Machine{machine(1, "db", dbOnline, nil), machine(2, "web", webOnline, nil)},
+			Snapshot: &watcher.Snapshot{At: now},
+		})
+	}
+	s, err := e.AddSilence(Silence{Rule: "any", Subject: "db", Start: now.Add(-time.Minute), End: now.Add(time.Hour)})
+	require.NoError(t, err)
+
+	observe(false, false)
+	require.Len(t, received, 1, "silenced alerts should not be sent")
+	assert.Equal(t, watcher.AlertFiring, received[0].Type)
+	require.NotNil(t, received[0].Alert)
+	assert.Equal(t, "web", received[0].Alert.Subject)
+	assert.Equal(t, uint64(2), received[0].Alert.MachineID)
+	assert.Equal(t, "Alert any is firing: Machine web (alice) is offline", received[0].Message())
+
+	// The silence ends before db recovers: its resolution is not sent, since its firing never was
+	require.NoError(t, e.ExpireSilence(s.ID))
+	received = nil
+	observe(true, true)
+	require.Len(t, received, 1)
+	assert.Equal(t, watcher.AlertResolved, received[0].Type)
+	assert.Equal(t, "web", received[0].Alert.Subject)
+
+	received = nil
+	observe(false, true)
+	require.Len(t, received, 1)
+	assert.Equal(t, "db", received[0].Alert.Subject)
+}
+
+// TestEngine_SilencesPersisted tests that silences survive a restart and that ended silences are dropped
+func TestEngine_SilencesPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "silences.json")
+	cfg := &config.AlertsConfig{
+		Rules:        []config.AlertRule{{Name: "any", Kind: config.AlertKindOffline}},
+		SilencesFile: path,
+	}
+	now := time.Now()
+
+	e, err := NewEngine(cfg, compliance.Policy{})
+	require.NoError(t, err)
+	assert.Empty(t, e.Silences(), "a missing file holds no silences")
+	kept, err := e.AddSilence(Silence{Rule: "any", Start: now, End: now.Add(time.Hour), Comment: "maintenance"})
+	require.NoError(t, err)
+	expired, err := e.AddSilence(Silence{Rule: "any", Subject: "db", Start: now, End: now.Add(time.Hour)})
+	require.NoError(t, err)
+	require.NoError(t, e.ExpireSilence(expired.ID))
+
+	restarted, err := NewEngine(cfg, compliance.Policy{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{kept.ID}, silenceIDs(restarted.Silences()))
+	assert.Equal(t, "maintenance", restarted.Silences()[0].Comment)
+
+	// Silences that ended while hsadmin was down are dropped on load
+	require.NoError(t, saveSilences(path, []Silence{{ID: "old", Rule: "any", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)}}))
+	restarted, err = NewEngine(cfg, compliance.Policy{})
+	require.NoError(t, err)
+	assert.Empty(t, restarted.Silences())
+
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	_, err = NewEngine(cfg, compliance.Policy{})
+	assert.ErrorContains(t, err, "failed to load silences")
+}
+
+// silenceIDs returns the IDs of silences, in order
+func silenceIDs(silences []Silence) []string {
+	var ids []string
+	for _, s := range silences {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
@@ -0,0 +1,223 @@
+package alerting
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/compliance"
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/format"
+	"github.com/anupcshan/hsadmin/internal/models"
+)
+
+// condition is a rule violation observed in a single evaluation
+type condition struct {
+	key       string // Identifies the subject within its rule
+	subject   string
+	machineID uint64 // 0 if the condition is not about a single machine
+	summary   string
+	since     time.Time // When the condition started, if known from the machine state
+}
+
+// rule is an alert rule with its parameters parsed
+type rule struct {
+	config.AlertRule
+	route      netip.Prefix      // route_unavailable only
+	minVersion models.Version    // version_below only
+	policy     compliance.Policy // noncompliant only
+}
+
+// compileRule parses the parameters of a configured rule
+func compileRule(cfg config.AlertRule, policy compliance.Policy) (*rule, error) {
+	r := &rule{AlertRule: cfg}
+
+	switch cfg.Kind {
+	case config.AlertKindRouteUnavailable:
+		route, err := netip.ParsePrefix(cfg.Route)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %q: %w", cfg.Name, err)
+		}
+		r.route = route.Masked()
+
+	case config.AlertKindVersionBelow:
+		minVersion, err := models.ParseVersion(cfg.MinVersion)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %q: %w", cfg.Name, err)
+		}
+		r.minVersion = minVersion
+
+	case config.AlertKindNoncompliant:
+		r.policy = policy
+	}
+
+	return r, nil
+}
+
+// Description returns a one-line human readable description of the rule
+func (r *rule) Description() string {
+	var desc string
+	switch r.Kind {
+	case config.AlertKindOffline:
+		desc = "Machine offline"
+	case config.AlertKindExitNodeOffline:
+		desc = "Exit node offline"
+	case config.AlertKindRouteUnavailable:
+		desc = fmt.Sprintf("No online machine serves %s", r.route)
+	case config.AlertKindVersionBelow:
+		desc = "Tailscale older than " + r.minVersion.String()
+	case config.AlertKindNoncompliant:
+		desc = "Client out of compliance"
+	}
+
+	var scope []string
+	if r.Tag != "" {
+		scope = append(scope, r.Tag)
+	}
+	if r.User != "" {
+		scope = append(scope, "user "+r.User)
+	}
+	if len(scope) > 0 && r.Kind != config.AlertKindRouteUnavailable {
+		desc += " (" + strings.Join(scope, ", ") + ")"
+	}
+	if r.For > 0 {
+		desc += " for more than " + format.Duration(r.For)
+	}
+	return desc
+}
+
+// selects returns true if the rule's tag and user filters match the machine
+func (r *rule) selects(m *models.Machine) bool {
+	if r.Tag != "" && !slices.Contains(m.Tags(), r.Tag) {
+		return false
+	}
+	if r.User != "" && m.User() != r.User {
+		return false
+	}
+	return true
+}
+
+// evaluate returns the rule's current violations
+func (r *rule) evaluate(machines []*models.Machine) []condition {
+	switch r.Kind {
+	case config.AlertKindOffline:
+		return r.evaluateOffline(machines, func(m *models.Machine) bool { return true }, "Machine")
+	case config.AlertKindExitNodeOffline:
+		return r.evaluateOffline(machines, (*models.Machine).ExitNodeApproved, "Exit node")
+	case config.AlertKindRouteUnavailable:
+		return r.evaluateRoute(machines)
+	case config.AlertKindVersionBelow:
+		return r.evaluateVersion(machines)
+	case config.AlertKindNoncompliant:
+		return r.evaluateCompliance(machines)
+	}
+	return nil
+}
+
+// evaluateOffline reports selected machines that are offline
+func (r *rule) evaluateOffline(machines []*models.Machine, include func(*models.Machine) bool, noun string) []condition {
+	var conditions []condition
+	for _, m := range machines {
+		if m.Online || !r.selects(m) || !include(m) {
+			continue
+		}
+
+		c := machineCondition(m)
+		c.summary = fmt.Sprintf("%s %s (%s) is offline", noun, m.Hostname(), m.User())
+		if m.Node != nil && m.Node.LastSeen != nil {
+			c.since = m.Node.LastSeen.AsTime()
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions
+}
+
+// evaluateRoute reports the rule's route when no online machine has it approved
+func (r *rule) evaluateRoute(machines []*models.Machine) []condition {
+	var routers []string
+	for _, m := range machines {
+		if m.Node == nil || !servesRoute(m.Node.ApprovedRoutes, r.route) {
+			continue
+		}
+		if m.Online {
+			return nil
+		}
+		routers = append(routers, m.Hostname())
+	}
+
+	c := condition{
+		key:     r.route.String(),
+		subject: r.route.String(),
+	}
+	if len(routers) == 0 {
+		c.summary = fmt.Sprintf("No machine has route %s approved", r.route)
+	} else {
+		c.summary = fmt.Sprintf("All routers for %s are offline: %s", r.route, strings.Join(routers, ", "))
+	}
+	return []condition{c}
+}
+
+// evaluateVersion reports selected machines running a client older than the minimum version
+// Machines whose version is unknown are skipped.
+func (r *rule) evaluateVersion(machines []*models.Machine) []condition {
+	var conditions []condition
+	for _, m := range machines {
+		if !r.selects(m) {
+			continue
+		}
+		v, err := models.ParseVersion(m.TailscaleVersion())
+		if err != nil || !v.Less(r.minVersion) {
+			continue
+		}
+
+		c := machineCondition(m)
+		c.summary = fmt.Sprintf("Machine %s (%s) runs Tailscale %s, older than %s", m.Hostname(), m.User(), v, r.minVersion)
+		conditions = append(conditions, c)
+	}
+	return conditions
+}
+
+// evaluateCompliance reports selected machines that violate the compliance policy
+func (r *rule) evaluateCompliance(machines []*models.Machine) []condition {
+	var conditions []condition
+	for _, m := range machines {
+		if !r.selects(m) {
+			continue
+		}
+		issues := r.policy.Check(m)
+		if len(issues) == 0 {
+			continue
+		}
+
+		var messages []string
+		for _, issue := range issues {
+			messages = append(messages, issue.Message)
+		}
+		c := machineCondition(m)
+		c.summary = fmt.Sprintf("Machine %s (%s) is out of compliance: %s", m.Hostname(), m.User(), strings.Join(messages, ", "))
+		conditions = append(conditions, c)
+	}
+	return conditions
+}
+
+// machineCondition returns a condition keyed on a machine
+func machineCondition(m *models.Machine) condition {
+	return condition{
+		key:       strconv.FormatUint(m.ID(), 10),
+		subject:   m.Hostname(),
+		machineID: m.ID(),
+	}
+}
+
+// servesRoute returns true if any of routes is exactly the given prefix
+func servesRoute(routes []string, prefix netip.Prefix) bool {
+	for _, route := range routes {
+		if p, err := netip.ParsePrefix(route); err == nil && p.Masked() == prefix {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package alerting
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Silence suppresses notifications for matching alerts during a time window
+// Silenced alerts are still evaluated and listed, so nothing is lost when the silence ends.
+type Silence struct {
+	ID        string    `json:"id"`
+	Rule      string    `json:"rule"`              // Rule name to match
+	Subject   string    `json:"subject,omitempty"` // Alert subject to match; empty matches every alert of the rule
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+// Matches returns true if the silence applies to the alert
+func (s Silence) Matches(a Alert) bool {
+	return s.Rule == a.Rule && (s.Subject == "" || s.Subject == a.Subject)
+}
+
+// ActiveAt returns true if the silence window contains t
+func (s Silence) ActiveAt(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+// loadSilences reads silences saved by saveSilences, dropping those that have ended
+// A missing file holds no silences.
+func loadSilences(path string, now time.Time) ([]Silence, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var silences []Silence
+	if err := json.Unmarshal(b, &silences); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	kept := silences[:0]
+	for _, s := range silences {
+		if now.Before(s.End) {
+			kept = append(kept, s)
+		}
+	}
+	return kept, nil
+}
+
+// saveSilences replaces the silences file, so a crash leaves either the old or the new list
+func saveSilences(path string, silences []Silence) error {
+	if silences == nil {
+		silences = []Silence{}
+	}
+	b, err := json.MarshalIndent(silences, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// newSilenceID returns a random identifier for a silence
+func newSilenceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -2,21 +2,28 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/logging"
 	"tailscale.com/client/local"
 )
 
+var logger = logging.For("auth")
+
 // contextKey is a custom type for context keys to avoid collisions
 type contextKey string
 
 const (
 	// UserContextKey is the context key for storing authenticated user info
 	UserContextKey contextKey = "authenticated_user"
+
+	// listenerContextKey is the context key for the tailnet whose tsnet node received the request
+	listenerContextKey contextKey = "listener_tailnet"
 )
 
 // User represents an authenticated user
@@ -33,21 +40,29 @@ type Middleware struct {
 	config      *config.Config
 	tsnetClient *local.Client
 	oidcAuth    *OIDCAuthenticator // Will implement in next step
+	tailnet     string             // Set when serving one of several tailnets
 }
 
 // NewMiddleware creates a new auth middleware
 func NewMiddleware(cfg *config.Config, tsnetClient *local.Client) *Middleware {
+	return NewTailnetMiddleware(cfg, "", tsnetClient)
+}
+
+// NewTailnetMiddleware creates an auth middleware for one of several tailnets, with cfg from
+// config.Config.ForTailnet. WhoIs is only trusted for requests received by that tailnet's own node
+// (see WithListener), since other tailnets reuse its addresses for different machines and users.
+func NewTailnetMiddleware(cfg *config.Config, tailnet string, tsnetClient *local.Client) *Middleware {
 	m := &Middleware{
 		config:      cfg,
 		tsnetClient: tsnetClient,
+		tailnet:     tailnet,
 	}
 
 	// Initialize OIDC authenticator if HTTP listener with OIDC is configured
 	if cfg.Listeners.HTTP != nil && cfg.Listeners.HTTP.OIDC != nil {
 		oidc, err := NewOIDCAuthenticator(cfg)
 		if err != nil {
-			log.Printf("Warning: Failed to initialize OIDC authenticator: %v", err)
-			log.Printf("OIDC authentication will not be available")
+			logger.Warn("Failed to initialize OIDC authenticator, OIDC authentication will not be available", "error", err)
 		} else {
 			m.oidcAuth = oidc
 		}
@@ -71,30 +86,10 @@ func (m *Middleware) RequireAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		var user *User
-		var err error
-
-		// Try WhoIs authentication first (if Tailscale listener configured)
-		if m.config.Listeners.Tailscale != nil {
-			user, err = m.authenticateWithWhoIs(r)
-			if err == nil && user != nil {
-				// WhoIs auth succeeded
-				ctx := context.WithValue(r.Context(), UserContextKey, user)
-				next.ServeHTTP(w, r.WithContext(ctx))
-				return
-			}
-			// WhoIs failed or returned nil, try OIDC if available
-		}
-
-		// Try OIDC authentication (if HTTP listener configured and WhoIs failed)
-		if m.oidcAuth != nil {
-			user, err = m.oidcAuth.AuthenticateFromSession(r)
-			if err == nil && user != nil {
-				// OIDC auth succeeded
-				ctx := context.WithValue(r.Context(), UserContextKey, user)
-				next.ServeHTTP(w, r.WithContext(ctx))
-				return
-			}
+		if user := m.Authenticate(r); user != nil {
+			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
 		}
 
 		// Both auth methods failed
@@ -102,8 +97,32 @@ func (m *Middleware) RequireAuth(next http.Handler) http.Handler {
 	})
 }
 
+// Authenticate returns the admin making the request, or nil if it is not authenticated
+// WhoIs is tried first (if Tailscale listener configured), then the OIDC session cookie.
+func (m *Middleware) Authenticate(r *http.Request) *User {
+	if m.config.Listeners.Tailscale != nil {
+		if user, err := m.authenticateWithWhoIs(r); err == nil && user != nil {
+			logging.SetActor(r.Context(), user.Name)
+			return user
+		}
+	}
+
+	if m.oidcAuth != nil {
+		if user, err := m.oidcAuth.AuthenticateFromSession(r); err == nil && user != nil {
+			logging.SetActor(r.Context(), user.Email)
+			return user
+		}
+	}
+
+	return nil
+}
+
 // authenticateWithWhoIs attempts to authenticate using Tailscale WhoIs
 func (m *Middleware) authenticateWithWhoIs(r *http.Request) (*User, error) {
+	if listener, _ := r.Context().Value(listenerContextKey).(string); m.tailnet != "" && listener != m.tailnet {
+		return nil, fmt.Errorf("request was not received by the %s tailnet's node", m.tailnet)
+	}
+
 	// Get the remote address (connection peer)
 	remoteAddr := r.RemoteAddr
 	if remoteAddr == "" {
@@ -155,7 +174,7 @@ func (m *Middleware) authenticateWithWhoIs(r *http.Request) (*User, error) {
 		Tags:   tags,
 	}
 
-	log.Printf("WhoIs auth successful: user_id=%d, hostname=%s", userID, user.Name)
+	logger.DebugContext(r.Context(), "WhoIs auth successful", "user_id", userID, "hostname", user.Name)
 	return user, nil
 }
 
@@ -244,6 +263,64 @@ func (m *Middleware) handleUnauthorized(w http.ResponseWriter, r *http.Request)
 	`))
 }
 
+// WithListener marks requests to next as received by the named tailnet's tsnet node
+func WithListener(tailnet string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), listenerContextKey, tailnet)))
+	})
+}
+
+// RequireAnyAuth allows requests from admins of any of several tailnets, for pages that are not
+// part of one tailnet
+func RequireAnyAuth(tailnets []*Middleware, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range tailnets {
+			if user := m.Authenticate(r); user != nil {
+				ctx := context.WithValue(r.Context(), UserContextKey, user)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+		}
+		tailnets[0].handleUnauthorized(w, r)
+	})
+}
+
+// RequireBearerToken allows only requests with an "Authorization: Bearer <token>" header
+// It protects machine-to-machine endpoints such as /metrics that scrapers cannot log in to.
+func RequireBearerToken(token string, next http.Handler) http.Handler {
+	return NewBearerToken(token).Require(next)
+}
+
+// BearerToken is a token for RequireBearerToken that can be replaced while requests are served
+type BearerToken struct {
+	token atomic.Pointer[string]
+}
+
+// NewBearerToken creates a bearer token
+func NewBearerToken(token string) *BearerToken {
+	t := &BearerToken{}
+	t.Set(token)
+	return t
+}
+
+// Set replaces the token, e.g. after the configuration is reloaded
+func (t *BearerToken) Set(token string) {
+	t.token.Store(&token)
+}
+
+// Require allows only requests with an "Authorization: Bearer <token>" header for the current token
+func (t *BearerToken) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(*t.token.Load())) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="hsadmin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // GetUser retrieves the authenticated user from the request context
 func GetUser(r *http.Request) *User {
 	user, ok := r.Context().Value(UserContextKey).(*User)
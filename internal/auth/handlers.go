@@ -4,8 +4,9 @@ import (
 	"context"
 	"fmt"
 	"html/template"
-	"log"
 	"net/http"
+
+	"github.com/anupcshan/hsadmin/internal/logging"
 )
 
 // AuthHandlers handles OIDC authentication HTTP endpoints
@@ -65,7 +66,7 @@ func (h *AuthHandlers) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	// Get state from query params
 	state := r.URL.Query().Get("state")
 	if state == "" {
-		log.Printf("OIDC callback failed: missing state parameter")
+		logger.WarnContext(r.Context(), "OIDC callback failed: missing state parameter")
 		http.Error(w, "Missing state parameter", http.StatusBadRequest)
 		return
 	}
@@ -73,13 +74,13 @@ func (h *AuthHandlers) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	// Validate CSRF state
 	stateCookie, err := r.Cookie("oidc_state")
 	if err != nil {
-		log.Printf("OIDC callback failed: state cookie not found - possible CSRF attack")
+		logger.WarnContext(r.Context(), "OIDC callback failed: state cookie not found, possible CSRF attack")
 		http.Error(w, "Invalid state parameter - possible CSRF attack", http.StatusBadRequest)
 		return
 	}
 
 	if stateCookie.Value != state {
-		log.Printf("OIDC callback failed: state mismatch - possible CSRF attack")
+		logger.WarnContext(r.Context(), "OIDC callback failed: state mismatch, possible CSRF attack")
 		http.Error(w, "Invalid state parameter - possible CSRF attack", http.StatusBadRequest)
 		return
 	}
@@ -90,7 +91,7 @@ func (h *AuthHandlers) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	if err == nil {
 		verifier = verifierCookie.Value
 	} else {
-		log.Printf("OIDC callback: warning - no PKCE verifier cookie found")
+		logger.WarnContext(r.Context(), "OIDC callback: no PKCE verifier cookie found")
 	}
 
 	// Clear state and verifier cookies
@@ -123,7 +124,7 @@ func (h *AuthHandlers) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	// Check for error from provider
 	if errParam := r.URL.Query().Get("error"); errParam != "" {
 		errDesc := r.URL.Query().Get("error_description")
-		log.Printf("OIDC error: %s - %s", errParam, errDesc)
+		logger.WarnContext(r.Context(), "OIDC provider returned an error", "error", errParam, "description", errDesc)
 		http.Error(w, fmt.Sprintf("Authentication failed: %s", errDesc), http.StatusUnauthorized)
 		return
 	}
@@ -131,7 +132,7 @@ func (h *AuthHandlers) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	// Exchange code for token and create session (with PKCE verifier if available)
 	session, err := h.authenticator.HandleCallback(ctx, code, verifier)
 	if err != nil {
-		log.Printf("OIDC callback failed: %v", err)
+		logger.WarnContext(r.Context(), "OIDC callback failed", "error", err)
 		http.Error(w, "Authentication failed: "+err.Error(), http.StatusUnauthorized)
 		return
 	}
@@ -139,13 +140,14 @@ func (h *AuthHandlers) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	// Create session cookie
 	sessionCookie, err := h.authenticator.CreateSessionCookie(session)
 	if err != nil {
-		log.Printf("Failed to create session cookie: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to create session cookie", "error", err)
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
 
 	// Set session cookie
 	http.SetCookie(w, sessionCookie)
+	logging.SetActor(r.Context(), session.Email)
 
 	// Redirect to main page
 	http.Redirect(w, r, "/machines", http.StatusSeeOther)
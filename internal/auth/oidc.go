@@ -9,8 +9,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/anupcshan/hsadmin/internal/config"
@@ -20,11 +20,15 @@ import (
 
 // OIDCAuthenticator handles OIDC authentication
 type OIDCAuthenticator struct {
-	config       *config.Config
-	provider     *oidc.Provider
-	oauth2Config oauth2.Config
-	verifier     *oidc.IDTokenVerifier
-	sessions     *SessionStore
+	config   *config.Config
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+
+	// Guards the client secret, redirect URL and session key, which can be replaced while serving
+	mu            sync.RWMutex
+	oauth2Config  oauth2.Config
+	sessions      *SessionStore
+	sessionSecret string
 }
 
 // SessionData holds session information
@@ -64,14 +68,42 @@ func NewOIDCAuthenticator(cfg *config.Config) (*OIDCAuthenticator, error) {
 	})
 
 	return &OIDCAuthenticator{
-		config:       cfg,
-		provider:     provider,
-		oauth2Config: oauth2Config,
-		verifier:     verifier,
-		sessions:     NewSessionStore(oidcCfg.SessionSecret),
+		config:        cfg,
+		provider:      provider,
+		oauth2Config:  oauth2Config,
+		verifier:      verifier,
+		sessions:      NewSessionStore(oidcCfg.SessionSecret),
+		sessionSecret: oidcCfg.SessionSecret,
 	}, nil
 }
 
+// SetSecrets replaces the client secret and session secret, e.g. after the configuration is reloaded
+// A new session secret signs everyone out, since existing session cookies can no longer be decrypted.
+func (o *OIDCAuthenticator) SetSecrets(clientSecret, sessionSecret string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.oauth2Config.ClientSecret = clientSecret
+	if sessionSecret != o.sessionSecret {
+		o.sessions = NewSessionStore(sessionSecret)
+		o.sessionSecret = sessionSecret
+		logger.Info("OIDC session secret replaced, existing sessions are signed out")
+	}
+}
+
+// oauth2 returns a copy of the current OAuth2 configuration
+func (o *OIDCAuthenticator) oauth2() oauth2.Config {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.oauth2Config
+}
+
+// sessionStore returns the store for the current session secret
+func (o *OIDCAuthenticator) sessionStore() *SessionStore {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.sessions
+}
+
 // AuthenticateFromSession checks if the request has a valid OIDC session
 func (o *OIDCAuthenticator) AuthenticateFromSession(r *http.Request) (*User, error) {
 	// Get session cookie
@@ -81,7 +113,7 @@ func (o *OIDCAuthenticator) AuthenticateFromSession(r *http.Request) (*User, err
 	}
 
 	// Verify and decode session
-	session, err := o.sessions.Decode(cookie.Value)
+	session, err := o.sessionStore().Decode(cookie.Value)
 	if err != nil {
 		return nil, fmt.Errorf("invalid session: %w", err)
 	}
@@ -109,6 +141,8 @@ func (o *OIDCAuthenticator) AuthenticateFromSession(r *http.Request) (*User, err
 // UpdateRedirectURL updates the OAuth2 redirect URL after initialization
 // This is useful for testing where the server URL is not known until after startup
 func (o *OIDCAuthenticator) UpdateRedirectURL(redirectURL string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	o.oauth2Config.RedirectURL = redirectURL
 }
 
@@ -121,7 +155,8 @@ func (o *OIDCAuthenticator) GetAuthURLWithVerifier(state string) (string, string
 
 	// Use PKCE (Proof Key for Code Exchange) for enhanced security
 	// S256ChallengeOption automatically computes SHA-256 challenge from verifier
-	authURL := o.oauth2Config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+	oauth2Config := o.oauth2()
+	authURL := oauth2Config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
 
 	return authURL, verifier
 }
@@ -129,14 +164,15 @@ func (o *OIDCAuthenticator) GetAuthURLWithVerifier(state string) (string, string
 // HandleCallback processes the OIDC callback and creates a session
 func (o *OIDCAuthenticator) HandleCallback(ctx context.Context, code string, verifier string) (*SessionData, error) {
 	// Exchange code for token (with PKCE verifier if provided)
+	oauth2Config := o.oauth2()
 	var oauth2Token *oauth2.Token
 	var err error
 	if verifier != "" {
 		// Use PKCE verifier in token exchange
-		oauth2Token, err = o.oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+		oauth2Token, err = oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
 	} else {
 		// No PKCE
-		oauth2Token, err = o.oauth2Config.Exchange(ctx, code)
+		oauth2Token, err = oauth2Config.Exchange(ctx, code)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange token: %w", err)
@@ -175,13 +211,13 @@ func (o *OIDCAuthenticator) HandleCallback(ctx context.Context, code string, ver
 		ExpiresAt: time.Now().Add(o.config.Listeners.HTTP.OIDC.SessionDuration),
 	}
 
-	log.Printf("OIDC auth successful: email=%s, name=%s", claims.Email, claims.Name)
+	logger.InfoContext(ctx, "OIDC auth successful", "email", claims.Email, "name", claims.Name)
 	return session, nil
 }
 
 // CreateSessionCookie creates a session cookie
 func (o *OIDCAuthenticator) CreateSessionCookie(session *SessionData) (*http.Cookie, error) {
-	encoded, err := o.sessions.Encode(session)
+	encoded, err := o.sessionStore().Encode(session)
 	if err != nil {
 		return nil, err
 	}
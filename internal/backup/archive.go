@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// FormatVersion is the bundle format written by Write; Read rejects newer versions
+	FormatVersion = 1
+
+	// bundleFile and policyFile are the archive entries; the policy is kept verbatim so it stays readable
+	bundleFile = "bundle.json"
+	policyFile = "policy.hujson"
+
+	// maxEntrySize bounds each decompressed entry, since bundles are uploaded from browsers
+	maxEntrySize = 32 << 20
+)
+
+// Filename returns the name of a bundle created at the given time
+func Filename(at time.Time) string {
+	return "hsadmin-backup-" + at.UTC().Format("20060102-150405") + ".tar.gz"
+}
+
+// Write writes the bundle as a gzipped tar archive
+func Write(w io.Writer, b *Bundle) error {
+	manifest, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, entry := range []struct {
+		name    string
+		content []byte
+	}{
+		{bundleFile, append(manifest, '\n')},
+		{policyFile, []byte(b.Policy)},
+	} {
+		hdr := &tar.Header{
+			Name:    entry.name,
+			Mode:    0o600,
+			Size:    int64(len(entry.content)),
+			ModTime: b.CreatedAt,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Read reads a bundle written by Write
+func Read(r io.Reader) (*Bundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup bundle: %w", err)
+	}
+	defer gz.Close()
+
+	var b *Bundle
+	var policy []byte
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a backup bundle: %w", err)
+		}
+		if hdr.Size > maxEntrySize {
+			return nil, fmt.Errorf("%s is too large", hdr.Name)
+		}
+
+		switch hdr.Name {
+		case bundleFile:
+			b = &Bundle{}
+			if err := json.NewDecoder(tr).Decode(b); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", bundleFile, err)
+			}
+		case policyFile:
+			if policy, err = io.ReadAll(tr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if b == nil {
+		return nil, fmt.Errorf("not a backup bundle: missing %s", bundleFile)
+	}
+	if b.Version < 1 || b.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d (this hsadmin reads up to %d)", b.Version, FormatVersion)
+	}
+	b.Policy = string(policy)
+	return b, nil
+}
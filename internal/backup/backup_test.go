@@ -0,0 +1,177 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var at = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+// fakeHeadscale serves users, nodes, keys and a policy, and records the calls that change them
+type fakeHeadscale struct {
+	users  []*headscale.User
+	nodes  []*headscale.Node
+	keys   map[uint64][]*headscale.PreAuthKey
+	policy string
+	calls  []string
+	err    error
+}
+
+func (f *fakeHeadscale) ListUsers(ctx context.Context, in *headscale.ListUsersRequest, opts ...grpc.CallOption) (*headscale.ListUsersResponse, error) {
+	return &headscale.ListUsersResponse{Users: f.users}, nil
+}
+
+func (f *fakeHeadscale) CreateUser(ctx context.Context, in *headscale.CreateUserRequest, opts ...grpc.CallOption) (*headscale.CreateUserResponse, error) {
+	f.calls = append(f.calls, fmt.Sprintf("CreateUser %s %s", in.Name, in.Email))
+	return &headscale.CreateUserResponse{}, nil
+}
+
+func (f *fakeHeadscale) ListNodes(ctx context.Context, in *headscale.ListNodesRequest, opts ...grpc.CallOption) (*headscale.ListNodesResponse, error) {
+	return &headscale.ListNodesResponse{Nodes: f.nodes}, nil
+}
+
+func (f *fakeHeadscale) SetTags(ctx context.Context, in *headscale.SetTagsRequest, opts ...grpc.CallOption) (*headscale.SetTagsResponse, error) {
+	f.calls = append(f.calls, fmt.Sprintf("SetTags %d %v", in.NodeId, in.Tags))
+	return &headscale.SetTagsResponse{}, f.err
+}
+
+func (f *fakeHeadscale) SetApprovedRoutes(ctx context.Context, in *headscale.SetApprovedRoutesRequest, opts ...grpc.CallOption) (*headscale.SetApprovedRoutesResponse, error) {
+	f.calls = append(f.calls, fmt.Sprintf("SetApprovedRoutes %d %v", in.NodeId, in.Routes))
+	return &headscale.SetApprovedRoutesResponse{}, nil
+}
+
+func (f *fakeHeadscale) ListPreAuthKeys(ctx context.Context, in *headscale.ListPreAuthKeysRequest, opts ...grpc.CallOption) (*headscale.ListPreAuthKeysResponse, error) {
+	return &headscale.ListPreAuthKeysResponse{PreAuthKeys: f.keys[in.User]}, nil
+}
+
+func (f *fakeHeadscale) GetPolicy(ctx context.Context, in *headscale.GetPolicyRequest, opts ...grpc.CallOption) (*headscale.GetPolicyResponse, error) {
+	return &headscale.GetPolicyResponse{Policy: f.policy}, nil
+}
+
+func (f *fakeHeadscale) SetPolicy(ctx context.Context, in *headscale.SetPolicyRequest, opts ...grpc.CallOption) (*headscale.SetPolicyResponse, error) {
+	f.calls = append(f.calls, "SetPolicy")
+	return &headscale.SetPolicyResponse{}, nil
+}
+
+// testServer returns a server with two users, a tagged subnet router and a reusable key
+func testServer() *fakeHeadscale {
+	alice := &headscale.User{Id: 1, Name: "alice", Email: "alice@example.com"}
+	bob := &headscale.User{Id: 2, Name: "bob"}
+	return &fakeHeadscale{
+		users: []*headscale.User{alice, bob},
+		nodes: []*headscale.Node{
+			{
+				Id: 1, GivenName: "router", MachineKey: "mkey:1", User: alice,
+				ForcedTags:      []string{"tag:router", "tag:infra"},
+				AvailableRoutes: []string{"10.0.0.0/8", "0.0.0.0/0", "::/0"},
+				ApprovedRoutes:  []string{"10.0.0.0/8"},
+			},
+			{Id: 2, GivenName: "laptop", MachineKey: "mkey:2", User: bob},
+		},
+		keys: map[uint64][]*headscale.PreAuthKey{
+			1: {{Id: 7, Key: "secret", Reusable: true, AclTags: []string{"tag:router"}, Expiration: timestamppb.New(at.Add(24 * time.Hour))}},
+		},
+		policy: `{"acls": []}`,
+	}
+}
+
+// TestBundle_RoundTrip tests collecting a bundle and reading back its archive, without key secrets
+func TestBundle_RoundTrip(t *testing.T) {
+	b, err := Collect(context.Background(), testServer(), at)
+	require.NoError(t, err)
+	assert.Equal(t, FormatVersion, b.Version)
+	require.Len(t, b.Nodes, 2)
+	assert.Equal(t, []string{"tag:infra", "tag:router"}, b.Nodes[0].Tags)
+	assert.Equal(t, "alice", b.Nodes[0].User)
+	require.Len(t, b.PreAuthKeys, 1)
+	assert.Equal(t, "alice", b.PreAuthKeys[0].User)
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, b))
+	assert.NotContains(t, buf.String(), "secret")
+
+	read, err := Read(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, b, read)
+
+	_, err = Read(bytes.NewReader([]byte("not a bundle")))
+	assert.ErrorContains(t, err, "not a backup bundle")
+
+	b.Version = FormatVersion + 1
+	buf.Reset()
+	require.NoError(t, Write(&buf, b))
+	_, err = Read(&buf)
+	assert.ErrorContains(t, err, "unsupported bundle version")
+}
+
+// TestDiff tests comparing a bundle with a server that has drifted, and restoring it
+func TestDiff(t *testing.T) {
+	server := testServer()
+	bundle, err := Collect(context.Background(), server, at)
+	require.NoError(t, err)
+
+	// The server was rebuilt: alice is gone, the router re-registered with a new ID and lost its
+	// tags and routes, the policy was reset and a new machine joined
+	carol := &headscale.User{Id: 3, Name: "carol"}
+	server.users = []*headscale.User{server.users[1], carol}
+	server.nodes = []*headscale.Node{
+		{Id: 10, GivenName: "router", MachineKey: "mkey:1", User: server.users[0], AvailableRoutes: []string{"10.0.0.0/8"}},
+		server.nodes[1],
+		{Id: 11, GivenName: "phone", MachineKey: "mkey:3", User: carol},
+	}
+	server.keys = nil
+	server.policy = ""
+	live, err := Collect(context.Background(), server, at.Add(time.Hour))
+	require.NoError(t, err)
+
+	changes := Diff(bundle, live)
+	var got []string
+	for _, c := range changes {
+		got = append(got, fmt.Sprintf("%s %s %q->%q %v", c.Kind, c.Subject, c.Live, c.Bundle, c.Restorable))
+	}
+	assert.Equal(t, []string{
+		`user alice ""->"alice <alice@example.com>" true`,
+		`policy Policy ""->"{\"acls\": []}" true`,
+		`tags router ""->"tag:infra, tag:router" true`,
+		`routes router ""->"10.0.0.0/8" true`,
+		`user carol "carol"->"" false`,
+		`node router "Owned by bob"->"Owned by alice" false`,
+		`node phone "Owned by carol"->"" false`,
+		`pre-auth key alice #7 ""->"reusable · tag:router · expires 2026-10-19" false`,
+	}, got)
+
+	applied, err := Apply(context.Background(), server, changes, []string{KindUser, KindTags, KindRoutes})
+	require.NoError(t, err)
+	assert.Len(t, applied, 3)
+	assert.Equal(t, []string{
+		"CreateUser alice alice@example.com",
+		"SetTags 10 [tag:infra tag:router]",
+		"SetApprovedRoutes 10 [10.0.0.0/8]",
+	}, server.calls)
+
+	assert.Empty(t, Diff(bundle, bundle))
+}
+
+// TestApply_Error tests that restoring stops at the first failure and reports what was applied
+func TestApply_Error(t *testing.T) {
+	server := testServer()
+	changes := []Change{
+		{Kind: KindTags, Subject: "router", Restorable: true, nodeID: 1, values: []string{"tag:a"}},
+		{Kind: KindTags, Subject: "laptop", Restorable: true, nodeID: 2, values: []string{"tag:b"}},
+	}
+	server.err = fmt.Errorf("invalid tag")
+
+	applied, err := Apply(context.Background(), server, changes, RestorableKinds)
+	assert.ErrorContains(t, err, "failed to restore tags of router: invalid tag")
+	assert.Empty(t, applied)
+	assert.Len(t, server.calls, 1)
+}
@@ -0,0 +1,140 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"google.golang.org/grpc"
+)
+
+// Client is the part of the Headscale client used to back up and restore a tailnet
+type Client interface {
+	ListUsers(ctx context.Context, in *headscale.ListUsersRequest, opts ...grpc.CallOption) (*headscale.ListUsersResponse, error)
+	CreateUser(ctx context.Context, in *headscale.CreateUserRequest, opts ...grpc.CallOption) (*headscale.CreateUserResponse, error)
+	ListNodes(ctx context.Context, in *headscale.ListNodesRequest, opts ...grpc.CallOption) (*headscale.ListNodesResponse, error)
+	SetTags(ctx context.Context, in *headscale.SetTagsRequest, opts ...grpc.CallOption) (*headscale.SetTagsResponse, error)
+	SetApprovedRoutes(ctx context.Context, in *headscale.SetApprovedRoutesRequest, opts ...grpc.CallOption) (*headscale.SetApprovedRoutesResponse, error)
+	ListPreAuthKeys(ctx context.Context, in *headscale.ListPreAuthKeysRequest, opts ...grpc.CallOption) (*headscale.ListPreAuthKeysResponse, error)
+	GetPolicy(ctx context.Context, in *headscale.GetPolicyRequest, opts ...grpc.CallOption) (*headscale.GetPolicyResponse, error)
+	SetPolicy(ctx context.Context, in *headscale.SetPolicyRequest, opts ...grpc.CallOption) (*headscale.SetPolicyResponse, error)
+}
+
+// Bundle is the state of a tailnet that can be restored through the Headscale API
+// Pre-auth keys are recorded without their secrets, so they cannot be restored.
+type Bundle struct {
+	Version     int          `json:"version"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Users       []User       `json:"users"`
+	Nodes       []Node       `json:"nodes"`
+	PreAuthKeys []PreAuthKey `json:"pre_auth_keys"`
+	Policy      string       `json:"-"` // Stored as policy.hujson
+}
+
+// User is a Headscale user; users are matched by name
+type User struct {
+	ID          uint64 `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Provider    string `json:"provider,omitempty"`
+}
+
+// Node is a Headscale node; nodes are matched by machine key, which survives re-registration
+type Node struct {
+	ID              uint64   `json:"id"`
+	Name            string   `json:"name"`
+	MachineKey      string   `json:"machine_key"`
+	User            string   `json:"user"`
+	Tags            []string `json:"tags"` // Forced tags, set through the API
+	ApprovedRoutes  []string `json:"approved_routes"`
+	AvailableRoutes []string `json:"available_routes"`
+}
+
+// PreAuthKey is the metadata of a pre-auth key
+type PreAuthKey struct {
+	ID         uint64     `json:"id"`
+	User       string     `json:"user"`
+	Reusable   bool       `json:"reusable"`
+	Ephemeral  bool       `json:"ephemeral"`
+	Used       bool       `json:"used"`
+	Tags       []string   `json:"tags"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	Expiration *time.Time `json:"expiration,omitempty"`
+}
+
+// Collect reads the current state of the tailnet
+func Collect(ctx context.Context, client Client, at time.Time) (*Bundle, error) {
+	b := &Bundle{Version: FormatVersion, CreatedAt: at.UTC()}
+
+	usersResp, err := client.ListUsers(ctx, &headscale.ListUsersRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	for _, u := range usersResp.GetUsers() {
+		b.Users = append(b.Users, User{
+			ID:          u.GetId(),
+			Name:        u.GetName(),
+			DisplayName: u.GetDisplayName(),
+			Email:       u.GetEmail(),
+			Provider:    u.GetProvider(),
+		})
+
+		keysResp, err := client.ListPreAuthKeys(ctx, &headscale.ListPreAuthKeysRequest{User: u.GetId()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pre-auth keys of %s: %w", u.GetName(), err)
+		}
+		for _, k := range keysResp.GetPreAuthKeys() {
+			key := PreAuthKey{
+				ID:        k.GetId(),
+				User:      u.GetName(),
+				Reusable:  k.GetReusable(),
+				Ephemeral: k.GetEphemeral(),
+				Used:      k.GetUsed(),
+				Tags:      sorted(k.GetAclTags()),
+			}
+			if k.CreatedAt != nil {
+				t := k.CreatedAt.AsTime()
+				key.CreatedAt = &t
+			}
+			if k.Expiration != nil {
+				t := k.Expiration.AsTime()
+				key.Expiration = &t
+			}
+			b.PreAuthKeys = append(b.PreAuthKeys, key)
+		}
+	}
+
+	nodesResp, err := client.ListNodes(ctx, &headscale.ListNodesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for _, n := range nodesResp.GetNodes() {
+		b.Nodes = append(b.Nodes, Node{
+			ID:              n.GetId(),
+			Name:            n.GetGivenName(),
+			MachineKey:      n.GetMachineKey(),
+			User:            n.GetUser().GetName(),
+			Tags:            sorted(n.GetForcedTags()),
+			ApprovedRoutes:  sorted(n.GetApprovedRoutes()),
+			AvailableRoutes: sorted(n.GetAvailableRoutes()),
+		})
+	}
+
+	policyResp, err := client.GetPolicy(ctx, &headscale.GetPolicyRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %w", err)
+	}
+	b.Policy = policyResp.GetPolicy()
+
+	return b, nil
+}
+
+// sorted returns a sorted copy of items, or an empty slice so bundles contain [] instead of null
+func sorted(items []string) []string {
+	result := append([]string{}, items...)
+	slices.Sort(result)
+	return result
+}
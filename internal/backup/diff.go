@@ -0,0 +1,189 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+)
+
+// Kinds of difference between a bundle and the live server
+const (
+	KindUser       = "user"
+	KindNode       = "node"
+	KindTags       = "tags"
+	KindRoutes     = "routes"
+	KindPolicy     = "policy"
+	KindPreAuthKey = "pre-auth key"
+)
+
+// RestorableKinds are the kinds Apply can re-apply, in the order it applies them
+// Users come first, since the policy and tags may refer to them.
+var RestorableKinds = []string{KindUser, KindPolicy, KindTags, KindRoutes}
+
+// Change is a difference between a bundle and the live server
+type Change struct {
+	Kind       string
+	Subject    string // The user, node or key that differs
+	Bundle     string // The value in the bundle, or "" if absent
+	Live       string // The value on the server, or "" if absent
+	Restorable bool   // Apply makes the server match the bundle; Apply never deletes anything
+
+	user   User     // User to create, for KindUser
+	nodeID uint64   // Live node to update, for KindTags and KindRoutes
+	values []string // Tags or routes to set
+}
+
+// Diff returns the differences between a bundle and the live state, ordered by RestorableKinds
+// followed by changes that can only be made by hand
+func Diff(bundle, live *Bundle) []Change {
+	var changes []Change
+
+	liveUsers := make(map[string]User)
+	for _, u := range live.Users {
+		liveUsers[u.Name] = u
+	}
+	bundleUsers := make(map[string]bool)
+	for _, u := range bundle.Users {
+		bundleUsers[u.Name] = true
+		if _, ok := liveUsers[u.Name]; !ok {
+			changes = append(changes, Change{Kind: KindUser, Subject: u.Name, Bundle: describeUser(u), Restorable: true, user: u})
+		}
+	}
+
+	if strings.TrimSpace(bundle.Policy) != strings.TrimSpace(live.Policy) {
+		changes = append(changes, Change{
+			Kind:       KindPolicy,
+			Subject:    "Policy",
+			Bundle:     bundle.Policy,
+			Live:       live.Policy,
+			Restorable: strings.TrimSpace(bundle.Policy) != "",
+		})
+	}
+
+	liveNodes := make(map[string]Node)
+	for _, n := range live.Nodes {
+		liveNodes[nodeKey(n)] = n
+	}
+	bundleNodes := make(map[string]bool)
+	var nodeChanges []Change
+	for _, n := range bundle.Nodes {
+		bundleNodes[nodeKey(n)] = true
+		ln, ok := liveNodes[nodeKey(n)]
+		if !ok {
+			nodeChanges = append(nodeChanges, Change{Kind: KindNode, Subject: n.Name, Bundle: "Owned by " + n.User})
+			continue
+		}
+		if !slices.Equal(n.Tags, ln.Tags) {
+			changes = append(changes, Change{
+				Kind: KindTags, Subject: ln.Name, Bundle: strings.Join(n.Tags, ", "), Live: strings.Join(ln.Tags, ", "),
+				Restorable: true, nodeID: ln.ID, values: n.Tags,
+			})
+		}
+		if !slices.Equal(n.ApprovedRoutes, ln.ApprovedRoutes) {
+			changes = append(changes, Change{
+				Kind: KindRoutes, Subject: ln.Name, Bundle: strings.Join(n.ApprovedRoutes, ", "), Live: strings.Join(ln.ApprovedRoutes, ", "),
+				Restorable: true, nodeID: ln.ID, values: n.ApprovedRoutes,
+			})
+		}
+		if n.User != ln.User {
+			nodeChanges = append(nodeChanges, Change{Kind: KindNode, Subject: ln.Name, Bundle: "Owned by " + n.User, Live: "Owned by " + ln.User})
+		}
+	}
+	slices.SortStableFunc(changes, func(a, b Change) int {
+		return slices.Index(RestorableKinds, a.Kind) - slices.Index(RestorableKinds, b.Kind)
+	})
+
+	// Changes Apply does not make: restoring never deletes, and nodes and keys cannot be recreated through the API
+	for _, u := range live.Users {
+		if !bundleUsers[u.Name] {
+			changes = append(changes, Change{Kind: KindUser, Subject: u.Name, Live: describeUser(u)})
+		}
+	}
+	changes = append(changes, nodeChanges...)
+	for _, n := range live.Nodes {
+		if !bundleNodes[nodeKey(n)] {
+			changes = append(changes, Change{Kind: KindNode, Subject: n.Name, Live: "Owned by " + n.User})
+		}
+	}
+	liveKeys := make(map[string]bool)
+	for _, k := range live.PreAuthKeys {
+		liveKeys[fmt.Sprintf("%s/%d", k.User, k.ID)] = true
+	}
+	for _, k := range bundle.PreAuthKeys {
+		usable := (k.Reusable || !k.Used) && (k.Expiration == nil || k.Expiration.After(bundle.CreatedAt))
+		if usable && !liveKeys[fmt.Sprintf("%s/%d", k.User, k.ID)] {
+			changes = append(changes, Change{Kind: KindPreAuthKey, Subject: fmt.Sprintf("%s #%d", k.User, k.ID), Bundle: describeKey(k)})
+		}
+	}
+
+	return changes
+}
+
+// nodeKey identifies a node across servers by its machine key, falling back to its ID
+func nodeKey(n Node) string {
+	if n.MachineKey != "" {
+		return n.MachineKey
+	}
+	return fmt.Sprintf("id:%d", n.ID)
+}
+
+// describeUser summarises a user for the diff
+func describeUser(u User) string {
+	parts := []string{u.Name}
+	if u.DisplayName != "" {
+		parts = append(parts, u.DisplayName)
+	}
+	if u.Email != "" {
+		parts = append(parts, "<"+u.Email+">")
+	}
+	return strings.Join(parts, " ")
+}
+
+// describeKey summarises a pre-auth key for the diff
+func describeKey(k PreAuthKey) string {
+	var parts []string
+	if k.Reusable {
+		parts = append(parts, "reusable")
+	}
+	if k.Ephemeral {
+		parts = append(parts, "ephemeral")
+	}
+	if len(k.Tags) > 0 {
+		parts = append(parts, strings.Join(k.Tags, ", "))
+	}
+	if k.Expiration != nil {
+		parts = append(parts, "expires "+k.Expiration.UTC().Format("2006-01-02"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// Apply makes the restorable changes of the given kinds, in order, stopping at the first error
+// It returns the changes made.
+func Apply(ctx context.Context, client Client, changes []Change, kinds []string) ([]Change, error) {
+	var applied []Change
+	for _, c := range changes {
+		if !c.Restorable || !slices.Contains(kinds, c.Kind) {
+			continue
+		}
+
+		var err error
+		switch c.Kind {
+		case KindUser:
+			_, err = client.CreateUser(ctx, &headscale.CreateUserRequest{Name: c.user.Name, DisplayName: c.user.DisplayName, Email: c.user.Email})
+		case KindPolicy:
+			_, err = client.SetPolicy(ctx, &headscale.SetPolicyRequest{Policy: c.Bundle})
+		case KindTags:
+			_, err = client.SetTags(ctx, &headscale.SetTagsRequest{NodeId: c.nodeID, Tags: c.values})
+		case KindRoutes:
+			_, err = client.SetApprovedRoutes(ctx, &headscale.SetApprovedRoutesRequest{NodeId: c.nodeID, Routes: c.values})
+		}
+		if err != nil {
+			return applied, fmt.Errorf("failed to restore %s of %s: %w", c.Kind, c.Subject, err)
+		}
+		applied = append(applied, c)
+	}
+	return applied, nil
+}
@@ -0,0 +1,68 @@
+package compliance
+
+import (
+	"fmt"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/models"
+)
+
+// Issue kinds
+const (
+	IssueOutdated      = "outdated"             // Older than the policy's minimum version
+	IssueAutoUpdateOff = "auto_update_disabled" // Auto-update is required but turned off
+)
+
+// Issue is a way a machine violates the policy
+type Issue struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Policy is the client version policy machines are checked against
+// The zero Policy flags nothing, so the report only groups machines by version.
+type Policy struct {
+	MinVersion        *models.Version // nil if any version is allowed
+	RequireAutoUpdate bool
+}
+
+// NewPolicy parses the configured policy; cfg may be nil
+func NewPolicy(cfg *config.ComplianceConfig) (Policy, error) {
+	var p Policy
+	if cfg == nil {
+		return p, nil
+	}
+
+	if cfg.MinVersion != "" {
+		v, err := models.ParseVersion(cfg.MinVersion)
+		if err != nil {
+			return p, fmt.Errorf("compliance.min_version: %w", err)
+		}
+		p.MinVersion = &v
+	}
+	p.RequireAutoUpdate = cfg.RequireAutoUpdate
+	return p, nil
+}
+
+// Enabled returns true if the policy flags anything
+func (p Policy) Enabled() bool {
+	return p.MinVersion != nil || p.RequireAutoUpdate
+}
+
+// Check returns the ways m violates the policy
+// Machines whose version or auto-update setting is unknown are not flagged for it.
+func (p Policy) Check(m *models.Machine) []Issue {
+	var issues []Issue
+	if p.MinVersion != nil {
+		if v, err := models.ParseVersion(m.TailscaleVersion()); err == nil && v.Less(*p.MinVersion) {
+			issues = append(issues, Issue{
+				Kind:    IssueOutdated,
+				Message: fmt.Sprintf("Tailscale %s is older than %s", v, p.MinVersion),
+			})
+		}
+	}
+	if p.RequireAutoUpdate && m.AutoUpdate() == "false" {
+		issues = append(issues, Issue{Kind: IssueAutoUpdateOff, Message: "auto-update disabled"})
+	}
+	return issues
+}
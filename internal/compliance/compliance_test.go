@@ -0,0 +1,111 @@
+package compliance
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/models"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+)
+
+// machine returns a machine reporting a client version and auto-update setting
+// An empty version leaves Hostinfo unset, as for machines hsadmin cannot WhoIs.
+func machine(id uint64, name, version string, autoUpdate bool) *models.Machine {
+	m := &models.Machine{Node: &headscale.Node{
+		Id:        id,
+		GivenName: name,
+		User:      &headscale.User{Name: "alice"},
+	}}
+	if version != "" {
+		hostinfo := &tailcfg.Hostinfo{OS: "linux", IPNVersion: version, AllowsUpdate: autoUpdate}
+		m.WhoIsNode = &tailcfg.Node{Hostinfo: hostinfo.View()}
+	}
+	return m
+}
+
+// TestNewPolicy tests parsing the configured policy
+func TestNewPolicy(t *testing.T) {
+	p, err := NewPolicy(nil)
+	require.NoError(t, err)
+	assert.False(t, p.Enabled())
+
+	p, err = NewPolicy(&config.ComplianceConfig{MinVersion: "1.70", RequireAutoUpdate: true})
+	require.NoError(t, err)
+	assert.True(t, p.Enabled())
+	assert.Equal(t, &models.Version{1, 70, 0}, p.MinVersion)
+
+	_, err = NewPolicy(&config.ComplianceConfig{MinVersion: "latest"})
+	assert.ErrorContains(t, err, "compliance.min_version")
+}
+
+// TestPolicy_Check tests flagging old clients and clients with auto-update disabled
+func TestPolicy_Check(t *testing.T) {
+	p := Policy{MinVersion: &models.Version{1, 70, 0}, RequireAutoUpdate: true}
+
+	tests := []struct {
+		name    string
+		machine *models.Machine
+		want    []string
+	}{
+		{name: "compliant", machine: machine(1, "a", "1.80.2", true)},
+		{name: "outdated", machine: machine(2, "b", "1.68.1", true), want: []string{IssueOutdated}},
+		{name: "auto-update off", machine: machine(3, "c", "1.80.2", false), want: []string{IssueAutoUpdateOff}},
+		{name: "both", machine: machine(4, "d", "1.60.0-t1234", false), want: []string{IssueOutdated, IssueAutoUpdateOff}},
+		{name: "unknown", machine: machine(5, "e", "", false)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var kinds []string
+			for _, issue := range p.Check(tt.machine) {
+				kinds = append(kinds, issue.Kind)
+			}
+			assert.Equal(t, tt.want, kinds)
+		})
+	}
+
+	assert.Empty(t, Policy{}.Check(machine(6, "f", "1.2.3", false)))
+}
+
+// TestBuild tests grouping by version, newest first, and the CSV export
+func TestBuild(t *testing.T) {
+	p := Policy{MinVersion: &models.Version{1, 70, 0}}
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	r := Build([]*models.Machine{
+		machine(1, "nas", "1.68.1", true),
+		machine(2, "laptop", "1.80.2", true),
+		machine(3, "unknown", "", false),
+		machine(4, "desktop", "1.80.2-t0f0b2c4a1", false),
+		machine(5, "canary", "1.81.44", true),
+	}, p, at)
+
+	assert.Equal(t, 5, r.Total)
+	assert.Equal(t, 1, r.NonCompliant)
+	assert.Equal(t, "1.70.0", r.MinVersion)
+	assert.Equal(t, map[string]int{models.TrackStable: 3, models.TrackUnstable: 1, "-": 1}, r.Tracks)
+
+	var versions []string
+	for _, g := range r.Groups {
+		versions = append(versions, g.Version)
+	}
+	assert.Equal(t, []string{"1.81.44", "1.80.2", "1.68.1", "-"}, versions)
+	assert.Equal(t, models.TrackUnstable, r.Groups[0].Track)
+	require.Len(t, r.Groups[1].Nodes, 2)
+	assert.Equal(t, "desktop", r.Groups[1].Nodes[0].Name)
+	assert.Equal(t, 1, r.Groups[2].NonCompliant)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, r))
+	assert.Equal(t, `id,name,user,os,online,version,track,auto_update,compliant,issues
+5,canary,alice,linux,false,1.81.44,unstable,true,true,
+4,desktop,alice,linux,false,1.80.2,stable,false,true,
+2,laptop,alice,linux,false,1.80.2,stable,true,true,
+1,nas,alice,linux,false,1.68.1,stable,true,false,Tailscale 1.68.1 is older than 1.70.0
+3,unknown,alice,-,false,-,-,-,true,
+`, buf.String())
+}
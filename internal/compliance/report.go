@@ -0,0 +1,147 @@
+package compliance
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/models"
+)
+
+// Node is a machine's entry in the report
+type Node struct {
+	ID         uint64  `json:"id"`
+	Name       string  `json:"name"`
+	User       string  `json:"user"`
+	OS         string  `json:"os"`
+	Online     bool    `json:"online"`
+	Version    string  `json:"version"`     // "-" if unknown
+	Track      string  `json:"track"`       // stable, unstable or "-" if unknown
+	AutoUpdate string  `json:"auto_update"` // "true", "false" or "-" if unknown
+	Issues     []Issue `json:"issues,omitempty"`
+}
+
+// Compliant returns true if the node has no issues
+func (n Node) Compliant() bool {
+	return len(n.Issues) == 0
+}
+
+// Group is the machines running one client version
+type Group struct {
+	Version      string `json:"version"` // major.minor.patch, or "-" if unknown
+	Track        string `json:"track"`
+	Nodes        []Node `json:"nodes"`
+	NonCompliant int    `json:"non_compliant"`
+}
+
+// Report groups machines by client version and flags those violating the policy
+type Report struct {
+	GeneratedAt       time.Time      `json:"generated_at"`
+	MinVersion        string         `json:"min_version,omitempty"` // Empty if any version is allowed
+	RequireAutoUpdate bool           `json:"require_auto_update"`
+	Total             int            `json:"total"`
+	NonCompliant      int            `json:"non_compliant"`
+	Tracks            map[string]int `json:"tracks"` // Machines per release track
+	Groups            []Group        `json:"groups"` // Newest version first, unknown last
+}
+
+// Build returns the report for machines at the given time
+func Build(machines []*models.Machine, p Policy, at time.Time) Report {
+	r := Report{
+		GeneratedAt:       at,
+		RequireAutoUpdate: p.RequireAutoUpdate,
+		Total:             len(machines),
+		Tracks:            make(map[string]int),
+		Groups:            []Group{},
+	}
+	if p.MinVersion != nil {
+		r.MinVersion = p.MinVersion.String()
+	}
+
+	groups := make(map[string]*Group)
+	versions := make(map[string]models.Version)
+	for _, m := range machines {
+		node := Node{
+			ID:         m.ID(),
+			Name:       m.Hostname(),
+			User:       m.User(),
+			OS:         m.OS(),
+			Online:     m.Online,
+			Version:    "-",
+			Track:      m.ReleaseTrack(),
+			AutoUpdate: m.AutoUpdate(),
+			Issues:     p.Check(m),
+		}
+		if v, err := models.ParseVersion(m.TailscaleVersion()); err == nil {
+			node.Version = v.String()
+			versions[node.Version] = v
+		}
+
+		r.Tracks[node.Track]++
+
+		g, ok := groups[node.Version]
+		if !ok {
+			g = &Group{Version: node.Version, Track: node.Track}
+			groups[node.Version] = g
+		}
+		g.Nodes = append(g.Nodes, node)
+		if !node.Compliant() {
+			g.NonCompliant++
+			r.NonCompliant++
+		}
+	}
+
+	for _, g := range groups {
+		sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Name < g.Nodes[j].Name })
+		r.Groups = append(r.Groups, *g)
+	}
+	sort.Slice(r.Groups, func(i, j int) bool {
+		vi, knownI := versions[r.Groups[i].Version]
+		vj, knownJ := versions[r.Groups[j].Version]
+		if knownI != knownJ {
+			return knownI
+		}
+		return vj.Less(vi)
+	})
+
+	return r
+}
+
+// csvHeader is the header row of the CSV export
+var csvHeader = []string{"id", "name", "user", "os", "online", "version", "track", "auto_update", "compliant", "issues"}
+
+// WriteCSV writes one row per machine, in report order
+func WriteCSV(w io.Writer, r Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, g := range r.Groups {
+		for _, n := range g.Nodes {
+			var issues []string
+			for _, issue := range n.Issues {
+				issues = append(issues, issue.Message)
+			}
+			err := cw.Write([]string{
+				strconv.FormatUint(n.ID, 10),
+				n.Name,
+				n.User,
+				n.OS,
+				strconv.FormatBool(n.Online),
+				n.Version,
+				n.Track,
+				n.AutoUpdate,
+				strconv.FormatBool(n.Compliant()),
+				strings.Join(issues, "; "),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
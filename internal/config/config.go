@@ -2,8 +2,13 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/netip"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -11,17 +16,221 @@ import (
 )
 
 type Config struct {
-	Headscale struct {
-		AgentTags   []string `yaml:"agent_tags"`
-		AgentUserID uint64   `yaml:"agent_userid"`
-		APIHostPort string   `yaml:"api_hostport"`
-		APIKey      string   `yaml:"api_key"`
-		ServerURL   string   `yaml:"server_url"`
-	} `yaml:"headscale"`
+	Headscale HeadscaleConfig `yaml:"headscale"`
+
+	Tailnets []TailnetConfig `yaml:"tailnets,omitempty"` // Several Headscale servers, instead of headscale
 
 	Listeners ListenersConfig `yaml:"listeners"`
+
+	Watcher WatcherConfig `yaml:"watcher,omitempty"`
+
+	History *HistoryConfig `yaml:"history,omitempty"`
+
+	Webhooks *WebhooksConfig `yaml:"webhooks,omitempty"`
+
+	Alerts *AlertsConfig `yaml:"alerts,omitempty"`
+
+	Compliance *ComplianceConfig `yaml:"compliance,omitempty"`
+
+	Inventory *InventoryConfig `yaml:"inventory,omitempty"`
+
+	Email *EmailConfig `yaml:"email,omitempty"`
+
+	Metrics *MetricsConfig `yaml:"metrics,omitempty"`
+
+	Tracing *TracingConfig `yaml:"tracing,omitempty"`
+
+	Logging LoggingConfig `yaml:"logging,omitempty"`
 }
 
+// HeadscaleConfig configures the Headscale server and the connection to its gRPC API
+type HeadscaleConfig struct {
+	AgentTags   []string            `yaml:"agent_tags"`
+	AgentUserID uint64              `yaml:"agent_userid"`
+	APIHostPort string              `yaml:"api_hostport"`
+	APISocket   string              `yaml:"api_socket,omitempty"` // Unix socket path, instead of api_hostport
+	APIKey      string              `yaml:"api_key"`              // Optional with api_socket, which Headscale does not authenticate
+	APIKeyFile  string              `yaml:"api_key_file,omitempty"`
+	Insecure    bool                `yaml:"insecure,omitempty"` // Plaintext gRPC, only to a loopback api_hostport
+	TLS         *HeadscaleTLSConfig `yaml:"tls,omitempty"`
+	ServerURL   string              `yaml:"server_url"`
+}
+
+// TailnetConfig is one of several Headscale servers, served at /t/{name}/ with its own tsnet node
+// Admins default to those of listeners.tailscale and listeners.http.oidc.
+type TailnetConfig struct {
+	Name          string          `yaml:"name"` // Required, unique: lowercase letters, digits and dashes
+	Headscale     HeadscaleConfig `yaml:"headscale"`
+	AdminUserIDs  []uint64        `yaml:"admin_user_ids,omitempty"`  // Users of this Headscale server, through its tsnet node
+	AdminUserTags []string        `yaml:"admin_user_tags,omitempty"` // Tags on this tailnet, through its tsnet node
+	AdminEmails   []string        `yaml:"admin_emails,omitempty"`    // OIDC admins, from listeners.http.oidc.admin_emails
+}
+
+// HeadscaleTLSConfig customises TLS to api_hostport, e.g. for a self-signed certificate
+type HeadscaleTLSConfig struct {
+	CACert     string `yaml:"ca_cert,omitempty"`     // PEM CA bundle trusted instead of the system roots
+	ClientCert string `yaml:"client_cert,omitempty"` // PEM client certificate, requires client_key
+	ClientKey  string `yaml:"client_key,omitempty"`
+	ServerName string `yaml:"server_name,omitempty"` // Name verified in the certificate instead of the api_hostport host
+}
+
+// WatcherConfig configures the background watcher that detects tailnet changes
+// Live page updates, history, alerts and notifications are all driven by its polls.
+type WatcherConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"` // Default: 1s
+}
+
+// HistoryConfig configures the background recorder that persists machine history
+type HistoryConfig struct {
+	Dir            string        `yaml:"dir"`                       // Required if history configured
+	SampleInterval time.Duration `yaml:"sample_interval,omitempty"` // Default: 5m (DERP latency and connection path)
+	Retention      time.Duration `yaml:"retention,omitempty"`       // Default: 720h (30 days)
+}
+
+// WebhooksConfig configures outbound webhook notifications for tailnet events
+type WebhooksConfig struct {
+	MaxAttempts int               `yaml:"max_attempts,omitempty"` // Default: 5
+	Endpoints   []WebhookEndpoint `yaml:"endpoints"`              // Required if webhooks configured
+}
+
+// WebhookEndpoint is a single webhook destination
+type WebhookEndpoint struct {
+	Name   string   `yaml:"name"`             // Required, unique
+	URL    string   `yaml:"url"`              // Required
+	Format string   `yaml:"format,omitempty"` // Default: "json" (also "slack", "matrix")
+	Events []string `yaml:"events,omitempty"` // Event types to deliver; empty delivers all
+	Secret string   `yaml:"secret,omitempty"` // Signs payloads with HMAC-SHA256 when set
+
+	URLFile    string `yaml:"url_file,omitempty"`
+	SecretFile string `yaml:"secret_file,omitempty"`
+}
+
+// Webhook payload formats
+const (
+	WebhookFormatJSON   = "json"
+	WebhookFormatSlack  = "slack"
+	WebhookFormatMatrix = "matrix"
+)
+
+// AlertsConfig configures alert rules evaluated against the tailnet
+type AlertsConfig struct {
+	Rules        []AlertRule `yaml:"rules"`                   // Required if alerts configured
+	SilencesFile string      `yaml:"silences_file,omitempty"` // Default: silences.json in history.dir; without either, silences are lost on restart
+}
+
+// AlertRule is a single alert rule
+// Tag and User restrict the machines considered by all kinds except route_unavailable.
+type AlertRule struct {
+	Name       string        `yaml:"name"`                  // Required, unique
+	Kind       string        `yaml:"kind"`                  // Required: offline, exit_node_offline, route_unavailable, version_below, noncompliant
+	Tag        string        `yaml:"tag,omitempty"`         // Only machines with this tag
+	User       string        `yaml:"user,omitempty"`        // Only machines owned by this user
+	For        time.Duration `yaml:"for,omitempty"`         // How long the condition must hold before firing
+	Route      string        `yaml:"route,omitempty"`       // route_unavailable: required prefix, e.g. 10.0.0.0/8
+	MinVersion string        `yaml:"min_version,omitempty"` // version_below: required, e.g. 1.60.0
+}
+
+// Alert rule kinds
+const (
+	AlertKindOffline          = "offline"
+	AlertKindExitNodeOffline  = "exit_node_offline"
+	AlertKindRouteUnavailable = "route_unavailable"
+	AlertKindVersionBelow     = "version_below"
+	AlertKindNoncompliant     = "noncompliant" // Machine violates the compliance policy
+)
+
+// ComplianceConfig is the client version policy checked by the compliance report and noncompliant alerts
+type ComplianceConfig struct {
+	MinVersion        string `yaml:"min_version,omitempty"`         // Oldest allowed client version, e.g. 1.70.0
+	RequireAutoUpdate bool   `yaml:"require_auto_update,omitempty"` // Flag clients with auto-update disabled
+}
+
+// InventoryConfig configures scheduled exports of the machine inventory to a local directory
+type InventoryConfig struct {
+	Dir      string        `yaml:"dir"`                // Required if inventory configured
+	Interval time.Duration `yaml:"interval,omitempty"` // Default: 24h
+	Formats  []string      `yaml:"formats,omitempty"`  // Default: csv (also "json", "xlsx")
+	Keep     int           `yaml:"keep,omitempty"`     // Exports kept per format; 0 keeps all
+}
+
+// Inventory export formats
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatJSON = "json"
+	ExportFormatXLSX = "xlsx"
+)
+
+// EmailConfig configures email notifications for tailnet events
+type EmailConfig struct {
+	SMTP           SMTPConfig    `yaml:"smtp"`
+	From           string        `yaml:"from"`                      // Required
+	To             []string      `yaml:"to,omitempty"`              // Default: listeners.http.oidc.admin_emails
+	Events         []string      `yaml:"events,omitempty"`          // Default: node.routes_pending, node.added, node.key_expiring, alert.firing, alert.resolved
+	DigestInterval time.Duration `yaml:"digest_interval,omitempty"` // Default: 5m
+}
+
+// SMTPConfig holds SMTP server connection settings
+type SMTPConfig struct {
+	Host     string `yaml:"host"`               // Required
+	Port     int    `yaml:"port,omitempty"`     // Default: 587, or 465 with implicit TLS
+	TLS      string `yaml:"tls,omitempty"`      // Default: "starttls" (also "implicit", "none")
+	Username string `yaml:"username,omitempty"` // Authenticates with PLAIN when set
+	Password string `yaml:"password,omitempty"`
+
+	PasswordFile string `yaml:"password_file,omitempty"`
+}
+
+// SMTP TLS modes
+const (
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "implicit"
+	SMTPTLSNone     = "none"
+)
+
+// MetricsConfig configures the Prometheus /metrics endpoint
+type MetricsConfig struct {
+	Auth        string `yaml:"auth,omitempty"`         // Default: "admin" (also "bearer", "none")
+	BearerToken string `yaml:"bearer_token,omitempty"` // Required with bearer auth
+
+	BearerTokenFile string `yaml:"bearer_token_file,omitempty"`
+}
+
+// Metrics endpoint authentication modes
+const (
+	MetricsAuthAdmin  = "admin"  // Same authentication as the web UI
+	MetricsAuthBearer = "bearer" // Authorization: Bearer <bearer_token>, for Prometheus scrapers
+	MetricsAuthNone   = "none"
+)
+
+// TracingConfig configures OpenTelemetry tracing, exported to a collector over OTLP
+type TracingConfig struct {
+	Endpoint    string            `yaml:"endpoint"`               // Required: collector host:port
+	Protocol    string            `yaml:"protocol,omitempty"`     // Default: "grpc" (also "http")
+	Insecure    bool              `yaml:"insecure,omitempty"`     // Connect to the collector without TLS
+	Headers     map[string]string `yaml:"headers,omitempty"`      // Sent with every export, e.g. for authentication
+	SampleRatio float64           `yaml:"sample_ratio,omitempty"` // Default: 1 (fraction of new traces recorded)
+	ServiceName string            `yaml:"service_name,omitempty"` // Default: "hsadmin"
+}
+
+// OTLP exporter protocols
+const (
+	TracingProtocolGRPC = "grpc"
+	TracingProtocolHTTP = "http" // HTTP with protobuf payloads
+)
+
+// LoggingConfig configures structured log output
+type LoggingConfig struct {
+	Format string            `yaml:"format,omitempty"` // Default: "text" (also "json")
+	Level  string            `yaml:"level,omitempty"`  // Default: "info" (also "debug", "warn", "error")
+	Levels map[string]string `yaml:"levels,omitempty"` // Per-subsystem level overrides, e.g. sse: debug
+}
+
+// Log output formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
 // ListenersConfig holds all listener configurations
 type ListenersConfig struct {
 	Tailscale *TailscaleListener `yaml:"tailscale,omitempty"`
@@ -51,6 +260,9 @@ type OIDCConfig struct {
 	Scopes          []string      `yaml:"scopes,omitempty"`           // Default: ["openid", "profile", "email"]
 	SessionSecret   string        `yaml:"session_secret"`             // Required
 	SessionDuration time.Duration `yaml:"session_duration,omitempty"` // Default: 24h
+
+	ClientSecretFile  string `yaml:"client_secret_file,omitempty"`
+	SessionSecretFile string `yaml:"session_secret_file,omitempty"`
 }
 
 // Load reads and parses the configuration file
@@ -65,8 +277,22 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	// Read secrets from files and the environment
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
 	// Set defaults for listener config
 	cfg.setListenerDefaults()
+	cfg.setWatcherDefaults()
+	cfg.setHistoryDefaults()
+	cfg.setAlertsDefaults()
+	cfg.setWebhookDefaults()
+	cfg.setInventoryDefaults()
+	cfg.setEmailDefaults()
+	cfg.setMetricsDefaults()
+	cfg.setTracingDefaults()
+	cfg.setLoggingDefaults()
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
@@ -103,50 +329,526 @@ func (c *Config) setListenerDefaults() {
 	}
 }
 
+// setWatcherDefaults sets reasonable defaults for the change watcher
+func (c *Config) setWatcherDefaults() {
+	if c.Watcher.PollInterval == 0 {
+		c.Watcher.PollInterval = time.Second
+	}
+}
+
+// setHistoryDefaults sets reasonable defaults for history configuration
+func (c *Config) setHistoryDefaults() {
+	if c.History == nil {
+		return
+	}
+	if c.History.SampleInterval == 0 {
+		c.History.SampleInterval = 5 * time.Minute
+	}
+	if c.History.Retention == 0 {
+		c.History.Retention = 30 * 24 * time.Hour
+	}
+}
+
+// setAlertsDefaults keeps silences next to the recorded history, if there is any
+func (c *Config) setAlertsDefaults() {
+	if c.Alerts == nil || c.Alerts.SilencesFile != "" || c.History == nil || c.History.Dir == "" {
+		return
+	}
+	c.Alerts.SilencesFile = filepath.Join(c.History.Dir, "silences.json")
+}
+
+// setWebhookDefaults sets reasonable defaults for webhook configuration
+func (c *Config) setWebhookDefaults() {
+	if c.Webhooks == nil {
+		return
+	}
+	if c.Webhooks.MaxAttempts == 0 {
+		c.Webhooks.MaxAttempts = 5
+	}
+	for i := range c.Webhooks.Endpoints {
+		if c.Webhooks.Endpoints[i].Format == "" {
+			c.Webhooks.Endpoints[i].Format = WebhookFormatJSON
+		}
+	}
+}
+
+// setInventoryDefaults sets reasonable defaults for scheduled inventory exports
+func (c *Config) setInventoryDefaults() {
+	if c.Inventory == nil {
+		return
+	}
+	if c.Inventory.Interval == 0 {
+		c.Inventory.Interval = 24 * time.Hour
+	}
+	if len(c.Inventory.Formats) == 0 {
+		c.Inventory.Formats = []string{ExportFormatCSV}
+	}
+}
+
+// setEmailDefaults sets reasonable defaults for email configuration
+// Recipients default to the OIDC admin emails, so they must be set after listener defaults.
+func (c *Config) setEmailDefaults() {
+	if c.Email == nil {
+		return
+	}
+	if c.Email.SMTP.TLS == "" {
+		c.Email.SMTP.TLS = SMTPTLSStartTLS
+	}
+	if c.Email.SMTP.Port == 0 {
+		c.Email.SMTP.Port = 587
+		if c.Email.SMTP.TLS == SMTPTLSImplicit {
+			c.Email.SMTP.Port = 465
+		}
+	}
+	if len(c.Email.To) == 0 && c.Listeners.HTTP != nil && c.Listeners.HTTP.OIDC != nil {
+		c.Email.To = c.Listeners.HTTP.OIDC.AdminEmails
+	}
+	if len(c.Email.Events) == 0 {
+		c.Email.Events = []string{"node.routes_pending", "node.added", "node.key_expiring", "alert.firing", "alert.resolved"}
+	}
+	if c.Email.DigestInterval == 0 {
+		c.Email.DigestInterval = 5 * time.Minute
+	}
+}
+
+// setMetricsDefaults sets reasonable defaults for the metrics endpoint
+func (c *Config) setMetricsDefaults() {
+	if c.Metrics == nil {
+		return
+	}
+	if c.Metrics.Auth == "" {
+		c.Metrics.Auth = MetricsAuthAdmin
+	}
+}
+
+// setLoggingDefaults sets reasonable defaults for log output
+func (c *Config) setLoggingDefaults() {
+	if c.Logging.Format == "" {
+		c.Logging.Format = LogFormatText
+	}
+	if c.Logging.Level == "" {
+		c.Logging.Level = "info"
+	}
+}
+
+// setTracingDefaults sets reasonable defaults for tracing
+func (c *Config) setTracingDefaults() {
+	if c.Tracing == nil {
+		return
+	}
+	if c.Tracing.Protocol == "" {
+		c.Tracing.Protocol = TracingProtocolGRPC
+	}
+	if c.Tracing.SampleRatio == 0 {
+		c.Tracing.SampleRatio = 1
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "hsadmin"
+	}
+}
+
 // Validate checks that all required configuration fields are present and valid
 func (c *Config) Validate() error {
-	// Check agent_userid
-	if c.Headscale.AgentUserID == 0 {
-		return fmt.Errorf("headscale.agent_userid is required and must be greater than 0")
+	// Validate the Headscale server, or each of several tailnets
+	if len(c.Tailnets) > 0 {
+		if err := c.validateTailnets(); err != nil {
+			return err
+		}
+	} else if err := validateHeadscale("headscale", c.Headscale); err != nil {
+		return err
 	}
 
-	// Check api_hostport
-	if c.Headscale.APIHostPort == "" {
-		return fmt.Errorf("headscale.api_hostport is required (e.g., 'localhost:50443')")
+	// Validate listener configuration
+	if err := c.validateListeners(); err != nil {
+		return err
 	}
-	// Basic validation: should contain a colon for host:port format
-	if !strings.Contains(c.Headscale.APIHostPort, ":") {
-		return fmt.Errorf("headscale.api_hostport must be in 'host:port' format (got: %q)", c.Headscale.APIHostPort)
+
+	// Validate watcher configuration (zero means the default)
+	if c.Watcher.PollInterval != 0 && c.Watcher.PollInterval < 100*time.Millisecond {
+		return fmt.Errorf("watcher.poll_interval must be at least 100ms (got: %v)", c.Watcher.PollInterval)
+	}
+
+	// Validate history configuration
+	if err := c.validateHistory(); err != nil {
+		return err
 	}
 
-	// Check api_key
-	if c.Headscale.APIKey == "" {
-		return fmt.Errorf("headscale.api_key is required")
+	// Validate webhook configuration
+	if err := c.validateWebhooks(); err != nil {
+		return err
+	}
+
+	// Validate alert configuration
+	if err := c.validateAlerts(); err != nil {
+		return err
+	}
+
+	// Validate inventory export configuration
+	if err := c.validateInventory(); err != nil {
+		return err
+	}
+
+	// Validate email configuration
+	if err := c.validateEmail(); err != nil {
+		return err
+	}
+
+	// Validate metrics configuration
+	if err := c.validateMetrics(); err != nil {
+		return err
+	}
+
+	// Validate tracing configuration
+	if err := c.validateTracing(); err != nil {
+		return err
+	}
+
+	// Validate logging configuration
+	if err := c.validateLogging(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateHeadscale validates a headscale block; name is its setting name in errors, e.g. headscale
+func validateHeadscale(name string, hs HeadscaleConfig) error {
+	// Check agent_userid
+	if hs.AgentUserID == 0 {
+		return fmt.Errorf("%s.agent_userid is required and must be greater than 0", name)
+	}
+
+	// Check api_hostport and the connection options
+	if err := validateHeadscaleConnection(name, hs); err != nil {
+		return err
+	}
+
+	// Check api_key (Headscale does not authenticate its unix socket)
+	if hs.APIKey == "" && hs.APISocket == "" {
+		return fmt.Errorf("%s.api_key is required", name)
 	}
 
 	// Check server_url
-	if c.Headscale.ServerURL == "" {
-		return fmt.Errorf("headscale.server_url is required (e.g., 'https://headscale.example.com')")
+	if hs.ServerURL == "" {
+		return fmt.Errorf("%s.server_url is required (e.g., 'https://headscale.example.com')", name)
 	}
 	// Validate URL format
-	parsedURL, err := url.Parse(c.Headscale.ServerURL)
+	parsedURL, err := url.Parse(hs.ServerURL)
 	if err != nil {
-		return fmt.Errorf("headscale.server_url is not a valid URL: %w", err)
+		return fmt.Errorf("%s.server_url is not a valid URL: %w", name, err)
 	}
 	// URL should have a scheme (http/https)
 	if parsedURL.Scheme == "" {
-		return fmt.Errorf("headscale.server_url must include a scheme (http:// or https://)")
+		return fmt.Errorf("%s.server_url must include a scheme (http:// or https://)", name)
 	}
 	// URL should have a host
 	if parsedURL.Host == "" {
-		return fmt.Errorf("headscale.server_url must include a host")
+		return fmt.Errorf("%s.server_url must include a host", name)
 	}
 
 	// agent_tags is optional - no validation needed
+	return nil
+}
 
-	// Validate listener configuration
-	if err := c.validateListeners(); err != nil {
-		return err
+// validateHeadscaleConnection validates how hsadmin connects to Headscale's gRPC API:
+// TLS to api_hostport (the default), plaintext to a loopback api_hostport, or a unix socket
+func validateHeadscaleConnection(name string, hs HeadscaleConfig) error {
+	if hs.APISocket != "" {
+		if hs.APIHostPort != "" {
+			return fmt.Errorf("%[1]s.api_hostport and %[1]s.api_socket are mutually exclusive", name)
+		}
+		if hs.Insecure || hs.TLS != nil {
+			return fmt.Errorf("%[1]s.insecure and %[1]s.tls do not apply to %[1]s.api_socket", name)
+		}
+		return nil
+	}
+
+	if hs.APIHostPort == "" {
+		return fmt.Errorf("%[1]s.api_hostport is required (e.g., 'localhost:50443'), or set %[1]s.api_socket", name)
+	}
+	// Basic validation: should contain a colon for host:port format
+	host, _, err := net.SplitHostPort(hs.APIHostPort)
+	if err != nil {
+		return fmt.Errorf("%s.api_hostport must be in 'host:port' format (got: %q)", name, hs.APIHostPort)
+	}
+
+	if hs.Insecure {
+		if hs.TLS != nil {
+			return fmt.Errorf("%[1]s.insecure and %[1]s.tls are mutually exclusive", name)
+		}
+		// The API key is sent in the clear, so only allow connections that never leave the host
+		if addr, err := netip.ParseAddr(host); host != "localhost" && (err != nil || !addr.IsLoopback()) {
+			return fmt.Errorf("%[1]s.insecure is only allowed with a loopback %[1]s.api_hostport such as 127.0.0.1:50443 (got: %[2]q)", name, hs.APIHostPort)
+		}
+		return nil
+	}
+
+	if hs.TLS != nil {
+		if (hs.TLS.ClientCert == "") != (hs.TLS.ClientKey == "") {
+			return fmt.Errorf("%[1]s.tls.client_cert and %[1]s.tls.client_key must be set together", name)
+		}
+		for _, f := range []struct{ name, path string }{
+			{"ca_cert", hs.TLS.CACert},
+			{"client_cert", hs.TLS.ClientCert},
+			{"client_key", hs.TLS.ClientKey},
+		} {
+			if f.path == "" {
+				continue
+			}
+			if _, err := os.Stat(f.path); err != nil {
+				return fmt.Errorf("%s.tls.%s: %w", name, f.name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateHistory validates the history configuration
+func (c *Config) validateHistory() error {
+	if c.History == nil {
+		return nil // History recording is optional
+	}
+
+	if c.History.Dir == "" {
+		return fmt.Errorf("history.dir is required when history is configured")
+	}
+	if c.History.SampleInterval < 0 {
+		return fmt.Errorf("history.sample_interval must not be negative")
+	}
+	if c.History.Retention < 0 {
+		return fmt.Errorf("history.retention must not be negative")
+	}
+	if c.History.Retention != 0 && c.History.Retention < 24*time.Hour {
+		return fmt.Errorf("history.retention must be at least 24h (got: %v)", c.History.Retention)
+	}
+
+	return nil
+}
+
+// validateWebhooks validates the webhook configuration
+// Event type names are checked when the webhook dispatcher is created
+func (c *Config) validateWebhooks() error {
+	if c.Webhooks == nil {
+		return nil // Webhooks are optional
+	}
+
+	if len(c.Webhooks.Endpoints) == 0 {
+		return fmt.Errorf("webhooks.endpoints must contain at least one endpoint when webhooks is configured")
+	}
+	if c.Webhooks.MaxAttempts < 0 {
+		return fmt.Errorf("webhooks.max_attempts must not be negative")
+	}
+
+	names := make(map[string]bool)
+	for i, endpoint := range c.Webhooks.Endpoints {
+		if endpoint.Name == "" {
+			return fmt.Errorf("webhooks.endpoints[%d].name is required", i)
+		}
+		if names[endpoint.Name] {
+			return fmt.Errorf("webhooks.endpoints[%d].name %q is used more than once", i, endpoint.Name)
+		}
+		names[endpoint.Name] = true
+
+		// The URL is not echoed, since chat webhook URLs contain credentials
+		parsedURL, err := url.Parse(endpoint.URL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return fmt.Errorf("webhooks.endpoints[%d].url must be an http:// or https:// URL", i)
+		}
+
+		switch endpoint.Format {
+		case WebhookFormatJSON, WebhookFormatSlack, WebhookFormatMatrix:
+		default:
+			return fmt.Errorf("webhooks.endpoints[%d].format must be one of json, slack, matrix (got: %q)", i, endpoint.Format)
+		}
+	}
+
+	return nil
+}
+
+// validateAlerts validates the alert configuration
+// Minimum versions are parsed when the alert engine is created
+func (c *Config) validateAlerts() error {
+	if c.Alerts == nil {
+		return nil // Alerts are optional
+	}
+
+	if len(c.Alerts.Rules) == 0 {
+		return fmt.Errorf("alerts.rules must contain at least one rule when alerts is configured")
+	}
+
+	names := make(map[string]bool)
+	for i, rule := range c.Alerts.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("alerts.rules[%d].name is required", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("alerts.rules[%d].name %q is used more than once", i, rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.For < 0 {
+			return fmt.Errorf("alerts.rules[%d].for must not be negative", i)
+		}
+
+		switch rule.Kind {
+		case AlertKindOffline, AlertKindExitNodeOffline:
+		case AlertKindRouteUnavailable:
+			if _, err := netip.ParsePrefix(rule.Route); err != nil {
+				return fmt.Errorf("alerts.rules[%d].route must be a CIDR prefix for route_unavailable rules (got: %q)", i, rule.Route)
+			}
+		case AlertKindVersionBelow:
+			if rule.MinVersion == "" {
+				return fmt.Errorf("alerts.rules[%d].min_version is required for version_below rules", i)
+			}
+		case AlertKindNoncompliant:
+			if c.Compliance == nil || (c.Compliance.MinVersion == "" && !c.Compliance.RequireAutoUpdate) {
+				return fmt.Errorf("alerts.rules[%d]: noncompliant rules require compliance.min_version or compliance.require_auto_update", i)
+			}
+		default:
+			return fmt.Errorf("alerts.rules[%d].kind must be one of offline, exit_node_offline, route_unavailable, version_below, noncompliant (got: %q)", i, rule.Kind)
+		}
+	}
+
+	return nil
+}
+
+// validateInventory validates the scheduled inventory export configuration
+func (c *Config) validateInventory() error {
+	if c.Inventory == nil {
+		return nil // Scheduled exports are optional
+	}
+
+	if c.Inventory.Dir == "" {
+		return fmt.Errorf("inventory.dir is required when inventory is configured")
+	}
+	if c.Inventory.Interval < time.Minute {
+		return fmt.Errorf("inventory.interval must be at least 1m (got: %v)", c.Inventory.Interval)
+	}
+	seen := make(map[string]bool)
+	for i, format := range c.Inventory.Formats {
+		switch format {
+		case ExportFormatCSV, ExportFormatJSON, ExportFormatXLSX:
+		default:
+			return fmt.Errorf("inventory.formats[%d] must be one of csv, json, xlsx (got: %q)", i, format)
+		}
+		if seen[format] {
+			return fmt.Errorf("inventory.formats[%d] %q is listed more than once", i, format)
+		}
+		seen[format] = true
+	}
+	if c.Inventory.Keep < 0 {
+		return fmt.Errorf("inventory.keep must not be negative")
+	}
+
+	return nil
+}
+
+// validateEmail validates the email configuration
+// Event type names are checked when the email notifier is created
+func (c *Config) validateEmail() error {
+	if c.Email == nil {
+		return nil // Email is optional
+	}
+
+	if c.Email.SMTP.Host == "" {
+		return fmt.Errorf("email.smtp.host is required when email is configured")
+	}
+	if c.Email.SMTP.Port < 0 || c.Email.SMTP.Port > 65535 {
+		return fmt.Errorf("email.smtp.port must be between 1 and 65535 (got: %d)", c.Email.SMTP.Port)
+	}
+	switch c.Email.SMTP.TLS {
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		return fmt.Errorf("email.smtp.tls must be one of starttls, implicit, none (got: %q)", c.Email.SMTP.TLS)
+	}
+	if c.Email.SMTP.Username != "" && c.Email.SMTP.Password == "" {
+		return fmt.Errorf("email.smtp.password is required when email.smtp.username is set")
+	}
+
+	if c.Email.From == "" {
+		return fmt.Errorf("email.from is required when email is configured")
+	}
+	if _, err := mail.ParseAddress(c.Email.From); err != nil {
+		return fmt.Errorf("email.from must be an address like hsadmin@example.com or \"hsadmin <hsadmin@example.com>\" (got: %q)", c.Email.From)
+	}
+	if len(c.Email.To) == 0 {
+		return fmt.Errorf("email.to is required when listeners.http.oidc.admin_emails is not configured")
+	}
+	for i, to := range c.Email.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("email.to[%d] must be an address like admin@example.com (got: %q)", i, to)
+		}
+	}
+	if c.Email.DigestInterval < 10*time.Second {
+		return fmt.Errorf("email.digest_interval must be at least 10s (got: %v)", c.Email.DigestInterval)
+	}
+
+	return nil
+}
+
+// validateMetrics validates the metrics endpoint configuration
+func (c *Config) validateMetrics() error {
+	if c.Metrics == nil {
+		return nil // Metrics are optional
+	}
+
+	switch c.Metrics.Auth {
+	case MetricsAuthAdmin, MetricsAuthNone:
+	case MetricsAuthBearer:
+		if len(c.Metrics.BearerToken) < 16 {
+			return fmt.Errorf("metrics.bearer_token must be at least 16 characters with bearer auth")
+		}
+	default:
+		return fmt.Errorf("metrics.auth must be one of admin, bearer, none (got: %q)", c.Metrics.Auth)
+	}
+
+	return nil
+}
+
+// validateTracing validates the tracing configuration
+func (c *Config) validateTracing() error {
+	if c.Tracing == nil {
+		return nil // Tracing is optional
+	}
+
+	if c.Tracing.Endpoint == "" {
+		return fmt.Errorf("tracing.endpoint is required when tracing is configured (e.g., 'localhost:4317')")
+	}
+	if strings.Contains(c.Tracing.Endpoint, "://") {
+		return fmt.Errorf("tracing.endpoint must be in 'host:port' format without a scheme (got: %q)", c.Tracing.Endpoint)
+	}
+	switch c.Tracing.Protocol {
+	case TracingProtocolGRPC, TracingProtocolHTTP:
+	default:
+		return fmt.Errorf("tracing.protocol must be one of grpc, http (got: %q)", c.Tracing.Protocol)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1 (got: %v)", c.Tracing.SampleRatio)
+	}
+
+	return nil
+}
+
+// validateLogging validates the log format and levels
+// Subsystem names in logging.levels are checked when logging is set up.
+func (c *Config) validateLogging() error {
+	switch c.Logging.Format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("logging.format must be one of text, json (got: %q)", c.Logging.Format)
+	}
+	if c.Logging.Level != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+			return fmt.Errorf("logging.level must be one of debug, info, warn, error (got: %q)", c.Logging.Level)
+		}
+	}
+	for subsystem, l := range c.Logging.Levels {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(l)); err != nil {
+			return fmt.Errorf("logging.levels.%s must be one of debug, info, warn, error (got: %q)", subsystem, l)
+		}
 	}
 
 	return nil
@@ -159,8 +861,8 @@ func (c *Config) validateListeners() error {
 		return nil // No listeners configured - that's okay (no auth)
 	}
 
-	// Validate Tailscale listener
-	if c.Listeners.Tailscale != nil {
+	// Validate Tailscale listener (tailnets may each have their own admins instead)
+	if c.Listeners.Tailscale != nil && len(c.Tailnets) == 0 {
 		if len(c.Listeners.Tailscale.AdminUserIDs) == 0 && len(c.Listeners.Tailscale.AdminUserTags) == 0 {
 			return fmt.Errorf("listeners.tailscale is configured but neither admin_user_ids nor admin_user_tags is set")
 		}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestConfig_Validate(t *testing.T) {
@@ -17,13 +18,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "valid config",
 			config: Config{
-				Headscale: struct {
-					AgentTags   []string `yaml:"agent_tags"`
-					AgentUserID uint64   `yaml:"agent_userid"`
-					APIHostPort string   `yaml:"api_hostport"`
-					APIKey      string   `yaml:"api_key"`
-					ServerURL   string   `yaml:"server_url"`
-				}{
+				Headscale: HeadscaleConfig{
 					AgentUserID: 1,
 					APIHostPort: "localhost:50443",
 					APIKey:      "test-api-key",
@@ -36,13 +31,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "valid config without tags",
 			config: Config{
-				Headscale: struct {
-					AgentTags   []string `yaml:"agent_tags"`
-					AgentUserID uint64   `yaml:"agent_userid"`
-					APIHostPort string   `yaml:"api_hostport"`
-					APIKey      string   `yaml:"api_key"`
-					ServerURL   string   `yaml:"server_url"`
-				}{
+				Headscale: HeadscaleConfig{
 					AgentUserID: 1,
 					APIHostPort: "localhost:50443",
 					APIKey:      "test-api-key",
@@ -54,13 +43,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "missing agent_userid",
 			config: Config{
-				Headscale: struct {
-					AgentTags   []string `yaml:"agent_tags"`
-					AgentUserID uint64   `yaml:"agent_userid"`
-					APIHostPort string   `yaml:"api_hostport"`
-					APIKey      string   `yaml:"api_key"`
-					ServerURL   string   `yaml:"server_url"`
-				}{
+				Headscale: HeadscaleConfig{
 					AgentUserID: 0, // Invalid!
 					APIHostPort: "localhost:50443",
 					APIKey:      "test-api-key",
@@ -73,13 +56,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "missing api_hostport",
 			config: Config{
-				Headscale: struct {
-					AgentTags   []string `yaml:"agent_tags"`
-					AgentUserID uint64   `yaml:"agent_userid"`
-					APIHostPort string   `yaml:"api_hostport"`
-					APIKey      string   `yaml:"api_key"`
-					ServerURL   string   `yaml:"server_url"`
-				}{
+				Headscale: HeadscaleConfig{
 					AgentUserID: 1,
 					APIHostPort: "", // Invalid!
 					APIKey:      "test-api-key",
@@ -92,13 +69,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid api_hostport format",
 			config: Config{
-				Headscale: struct {
-					AgentTags   []string `yaml:"agent_tags"`
-					AgentUserID uint64   `yaml:"agent_userid"`
-					APIHostPort string   `yaml:"api_hostport"`
-					APIKey      string   `yaml:"api_key"`
-					ServerURL   string   `yaml:"server_url"`
-				}{
+				Headscale: HeadscaleConfig{
 					AgentUserID: 1,
 					APIHostPort: "localhost", // Invalid - missing port!
 					APIKey:      "test-api-key",
@@ -111,13 +82,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "missing api_key",
 			config: Config{
-				Headscale: struct {
-					AgentTags   []string `yaml:"agent_tags"`
-					AgentUserID uint64   `yaml:"agent_userid"`
-					APIHostPort string   `yaml:"api_hostport"`
-					APIKey      string   `yaml:"api_key"`
-					ServerURL   string   `yaml:"server_url"`
-				}{
+				Headscale: HeadscaleConfig{
 					AgentUserID: 1,
 					APIHostPort: "localhost:50443",
 					APIKey:      "", // Invalid!
@@ -130,13 +95,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "missing server_url",
 			config: Config{
-				Headscale: struct {
-					AgentTags   []string `yaml:"agent_tags"`
-					AgentUserID uint64   `yaml:"agent_userid"`
-					APIHostPort string   `yaml:"api_hostport"`
-					APIKey      string   `yaml:"api_key"`
-					ServerURL   string   `yaml:"server_url"`
-				}{
+				Headscale: HeadscaleConfig{
 					AgentUserID: 1,
 					APIHostPort: "localhost:50443",
 					APIKey:      "test-api-key",
@@ -149,13 +108,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid server_url - no scheme",
 			config: Config{
-				Headscale: struct {
-					AgentTags   []string `yaml:"agent_tags"`
-					AgentUserID uint64   `yaml:"agent_userid"`
-					APIHostPort string   `yaml:"api_hostport"`
-					APIKey      string   `yaml:"api_key"`
-					ServerURL   string   `yaml:"server_url"`
-				}{
+				Headscale: HeadscaleConfig{
 					AgentUserID: 1,
 					APIHostPort: "localhost:50443",
 					APIKey:      "test-api-key",
@@ -280,3 +233,1274 @@ func TestLoad_InvalidYAML(t *testing.T) {
 		t.Fatal("Load() expected error with invalid YAML, got nil")
 	}
 }
+
+func TestLoad_WatcherConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	base := `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  api_key: test-api-key
+  server_url: https://headscale.example.com
+`
+
+	// Watcher with defaults
+	err := os.WriteFile(configPath, []byte(base), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with default watcher config: %v", err)
+	}
+	if cfg.Watcher.PollInterval != time.Second {
+		t.Errorf("Watcher.PollInterval = %v, want 1s", cfg.Watcher.PollInterval)
+	}
+
+	// Poll interval too short
+	err = os.WriteFile(configPath, []byte(base+`watcher:
+  poll_interval: 10ms
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	_, err = Load(configPath)
+	if err == nil || !strings.Contains(err.Error(), "watcher.poll_interval must be at least 100ms") {
+		t.Errorf("Load() error = %v, want error containing 'watcher.poll_interval must be at least 100ms'", err)
+	}
+}
+
+func TestLoad_HistoryConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	base := `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  api_key: test-api-key
+  server_url: https://headscale.example.com
+`
+
+	// History with defaults
+	err := os.WriteFile(configPath, []byte(base+`history:
+  dir: /var/lib/hsadmin
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with valid history config: %v", err)
+	}
+	if cfg.History.SampleInterval != 5*time.Minute {
+		t.Errorf("History.SampleInterval = %v, want 5m", cfg.History.SampleInterval)
+	}
+	if cfg.History.Retention != 30*24*time.Hour {
+		t.Errorf("History.Retention = %v, want 720h", cfg.History.Retention)
+	}
+
+	// History without a directory
+	err = os.WriteFile(configPath, []byte(base+`history:
+  sample_interval: 10m
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	_, err = Load(configPath)
+	if err == nil || !strings.Contains(err.Error(), "history.dir is required") {
+		t.Errorf("Load() error = %v, want error containing 'history.dir is required'", err)
+	}
+
+	// Retention shorter than the smallest history window
+	err = os.WriteFile(configPath, []byte(base+`history:
+  dir: /var/lib/hsadmin
+  retention: 1h
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	_, err = Load(configPath)
+	if err == nil || !strings.Contains(err.Error(), "history.retention must be at least 24h") {
+		t.Errorf("Load() error = %v, want error containing 'history.retention must be at least 24h'", err)
+	}
+}
+
+func TestLoad_WebhooksConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	base := `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  api_key: test-api-key
+  server_url: https://headscale.example.com
+`
+
+	// Webhooks with defaults
+	err := os.WriteFile(configPath, []byte(base+`webhooks:
+  endpoints:
+    - name: ops
+      url: https://hooks.example.com/hsadmin
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with valid webhooks config: %v", err)
+	}
+	if cfg.Webhooks.MaxAttempts != 5 {
+		t.Errorf("Webhooks.MaxAttempts = %d, want 5", cfg.Webhooks.MaxAttempts)
+	}
+	if cfg.Webhooks.Endpoints[0].Format != WebhookFormatJSON {
+		t.Errorf("Webhooks.Endpoints[0].Format = %q, want %q", cfg.Webhooks.Endpoints[0].Format, WebhookFormatJSON)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "no endpoints",
+			yaml: `webhooks:
+  max_attempts: 3
+`,
+			wantErr: "webhooks.endpoints must contain at least one endpoint",
+		},
+		{
+			name: "duplicate name",
+			yaml: `webhooks:
+  endpoints:
+    - name: ops
+      url: https://a.example.com/
+    - name: ops
+      url: https://b.example.com/
+`,
+			wantErr: `webhooks.endpoints[1].name "ops" is used more than once`,
+		},
+		{
+			name: "non-http url",
+			yaml: `webhooks:
+  endpoints:
+    - name: ops
+      url: ftp://a.example.com/
+`,
+			wantErr: "webhooks.endpoints[0].url must be an http:// or https:// URL",
+		},
+		{
+			name: "unknown format",
+			yaml: `webhooks:
+  endpoints:
+    - name: ops
+      url: https://a.example.com/
+      format: teams
+`,
+			wantErr: "webhooks.endpoints[0].format must be one of json, slack, matrix",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(base+tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_AlertsConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	base := `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  api_key: test-api-key
+  server_url: https://headscale.example.com
+`
+
+	// Alerts with defaults
+	err := os.WriteFile(configPath, []byte(base+`alerts:
+  rules:
+    - name: servers
+      kind: offline
+      tag: tag:server
+      for: 5m
+    - name: corp
+      kind: route_unavailable
+      route: 10.0.0.0/8
+    - name: compliance
+      kind: noncompliant
+compliance:
+  min_version: 1.70.0
+  require_auto_update: true
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with valid alerts config: %v", err)
+	}
+	if cfg.Alerts.Rules[0].For != 5*time.Minute {
+		t.Errorf("Alerts.Rules[0].For = %v, want 5m", cfg.Alerts.Rules[0].For)
+	}
+	if cfg.Compliance.MinVersion != "1.70.0" || !cfg.Compliance.RequireAutoUpdate {
+		t.Errorf("Compliance = %+v, want min_version 1.70.0 with auto-update required", cfg.Compliance)
+	}
+	if cfg.Alerts.SilencesFile != "" {
+		t.Errorf("Alerts.SilencesFile = %q, want empty without history", cfg.Alerts.SilencesFile)
+	}
+
+	// Silences are kept in the history directory by default
+	err = os.WriteFile(configPath, []byte(base+`history:
+  dir: /var/lib/hsadmin/history
+alerts:
+  rules:
+    - name: servers
+      kind: offline
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	cfg, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with alerts and history: %v", err)
+	}
+	if cfg.Alerts.SilencesFile != "/var/lib/hsadmin/history/silences.json" {
+		t.Errorf("Alerts.SilencesFile = %q, want silences.json in the history directory", cfg.Alerts.SilencesFile)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "no rules",
+			yaml: `alerts:
+  rules: []
+`,
+			wantErr: "alerts.rules must contain at least one rule",
+		},
+		{
+			name: "unknown kind",
+			yaml: `alerts:
+  rules:
+    - name: a
+      kind: cpu_high
+`,
+			wantErr: "alerts.rules[0].kind must be one of",
+		},
+		{
+			name: "invalid route",
+			yaml: `alerts:
+  rules:
+    - name: a
+      kind: route_unavailable
+      route: 10.0.0.0
+`,
+			wantErr: "alerts.rules[0].route must be a CIDR prefix",
+		},
+		{
+			name: "missing min version",
+			yaml: `alerts:
+  rules:
+    - name: a
+      kind: version_below
+`,
+			wantErr: "alerts.rules[0].min_version is required",
+		},
+		{
+			name: "noncompliant without policy",
+			yaml: `alerts:
+  rules:
+    - name: a
+      kind: noncompliant
+compliance:
+  min_version: ""
+`,
+			wantErr: "noncompliant rules require compliance.min_version or compliance.require_auto_update",
+		},
+		{
+			name: "duplicate name",
+			yaml: `alerts:
+  rules:
+    - name: a
+      kind: offline
+    - name: a
+      kind: exit_node_offline
+`,
+			wantErr: `alerts.rules[1].name "a" is used more than once`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(base+tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_InventoryConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	base := `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  api_key: test-api-key
+  server_url: https://headscale.example.com
+`
+
+	// Inventory with defaults
+	err := os.WriteFile(configPath, []byte(base+`inventory:
+  dir: /var/lib/hsadmin/inventory
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with valid inventory config: %v", err)
+	}
+	if cfg.Inventory.Interval != 24*time.Hour {
+		t.Errorf("Inventory.Interval = %v, want 24h", cfg.Inventory.Interval)
+	}
+	if len(cfg.Inventory.Formats) != 1 || cfg.Inventory.Formats[0] != ExportFormatCSV {
+		t.Errorf("Inventory.Formats = %v, want [csv]", cfg.Inventory.Formats)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "no directory",
+			yaml: `inventory:
+  interval: 1h
+`,
+			wantErr: "inventory.dir is required",
+		},
+		{
+			name: "interval too short",
+			yaml: `inventory:
+  dir: /tmp
+  interval: 10s
+`,
+			wantErr: "inventory.interval must be at least 1m",
+		},
+		{
+			name: "unknown format",
+			yaml: `inventory:
+  dir: /tmp
+  formats: [csv, ods]
+`,
+			wantErr: `inventory.formats[1] must be one of csv, json, xlsx (got: "ods")`,
+		},
+		{
+			name: "duplicate format",
+			yaml: `inventory:
+  dir: /tmp
+  formats: [xlsx, xlsx]
+`,
+			wantErr: `inventory.formats[1] "xlsx" is listed more than once`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(base+tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_EmailConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	base := `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  api_key: test-api-key
+  server_url: https://headscale.example.com
+`
+	oidc := `listeners:
+  http:
+    oidc:
+      provider_url: https://accounts.example.com
+      client_id: client
+      client_secret: secret
+      redirect_url: https://hsadmin.example.com/auth/callback
+      admin_emails: [admin@example.com]
+      session_secret: 0123456789abcdef0123456789abcdef
+`
+
+	// Recipients default to the OIDC admin emails
+	err := os.WriteFile(configPath, []byte(base+oidc+`email:
+  smtp:
+    host: smtp.example.com
+  from: hsadmin@example.com
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with valid email config: %v", err)
+	}
+	if cfg.Email.SMTP.TLS != SMTPTLSStartTLS || cfg.Email.SMTP.Port != 587 {
+		t.Errorf("Email.SMTP TLS/port = %q/%d, want starttls/587", cfg.Email.SMTP.TLS, cfg.Email.SMTP.Port)
+	}
+	if len(cfg.Email.To) != 1 || cfg.Email.To[0] != "admin@example.com" {
+		t.Errorf("Email.To = %v, want [admin@example.com]", cfg.Email.To)
+	}
+	if len(cfg.Email.Events) != 5 {
+		t.Errorf("Email.Events = %v, want 5 default events", cfg.Email.Events)
+	}
+	if cfg.Email.DigestInterval != 5*time.Minute {
+		t.Errorf("Email.DigestInterval = %v, want 5m", cfg.Email.DigestInterval)
+	}
+
+	// Implicit TLS defaults to port 465
+	err = os.WriteFile(configPath, []byte(base+`email:
+  smtp:
+    host: smtp.example.com
+    tls: implicit
+  from: "hsadmin <hsadmin@example.com>"
+  to: [ops@example.com, "Admin <admin@example.com>"]
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with valid email config: %v", err)
+	}
+	if cfg.Email.SMTP.Port != 465 {
+		t.Errorf("Email.SMTP.Port = %d, want 465", cfg.Email.SMTP.Port)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "no recipients",
+			yaml: `email:
+  smtp:
+    host: smtp.example.com
+  from: hsadmin@example.com
+`,
+			wantErr: "email.to is required",
+		},
+		{
+			name: "no host",
+			yaml: `email:
+  from: hsadmin@example.com
+  to: [ops@example.com]
+`,
+			wantErr: "email.smtp.host is required",
+		},
+		{
+			name: "unknown tls mode",
+			yaml: `email:
+  smtp:
+    host: smtp.example.com
+    tls: ssl
+  from: hsadmin@example.com
+  to: [ops@example.com]
+`,
+			wantErr: "email.smtp.tls must be one of",
+		},
+		{
+			name: "username without password",
+			yaml: `email:
+  smtp:
+    host: smtp.example.com
+    username: hsadmin
+  from: hsadmin@example.com
+  to: [ops@example.com]
+`,
+			wantErr: "email.smtp.password is required",
+		},
+		{
+			name: "digest interval too short",
+			yaml: `email:
+  smtp:
+    host: smtp.example.com
+  from: hsadmin@example.com
+  to: [ops@example.com]
+  digest_interval: 1s
+`,
+			wantErr: "email.digest_interval must be at least 10s",
+		},
+		{
+			name: "invalid from",
+			yaml: `email:
+  smtp:
+    host: smtp.example.com
+  from: hsadmin <hsadmin@example.com
+  to: [ops@example.com]
+`,
+			wantErr: "email.from must be an address",
+		},
+		{
+			name: "invalid to",
+			yaml: `email:
+  smtp:
+    host: smtp.example.com
+  from: hsadmin@example.com
+  to: [ops@example.com, ops]
+`,
+			wantErr: "email.to[1] must be an address",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(base+tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_MetricsConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	base := `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  api_key: test-api-key
+  server_url: https://headscale.example.com
+`
+
+	// Auth defaults to the web UI's
+	err := os.WriteFile(configPath, []byte(base+"metrics: {}\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with valid metrics config: %v", err)
+	}
+	if cfg.Metrics.Auth != MetricsAuthAdmin {
+		t.Errorf("Metrics.Auth = %q, want %q", cfg.Metrics.Auth, MetricsAuthAdmin)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "bearer without token",
+			yaml: `metrics:
+  auth: bearer
+`,
+			wantErr: "metrics.bearer_token must be at least 16 characters",
+		},
+		{
+			name: "bearer with short token",
+			yaml: `metrics:
+  auth: bearer
+  bearer_token: secret
+`,
+			wantErr: "metrics.bearer_token must be at least 16 characters",
+		},
+		{
+			name: "unknown auth mode",
+			yaml: `metrics:
+  auth: basic
+`,
+			wantErr: "metrics.auth must be one of",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(base+tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_TracingConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	base := `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  api_key: test-api-key
+  server_url: https://headscale.example.com
+`
+
+	err := os.WriteFile(configPath, []byte(base+`tracing:
+  endpoint: otel-collector:4317
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with valid tracing config: %v", err)
+	}
+	if cfg.Tracing.Protocol != TracingProtocolGRPC {
+		t.Errorf("Tracing.Protocol = %q, want %q", cfg.Tracing.Protocol, TracingProtocolGRPC)
+	}
+	if cfg.Tracing.SampleRatio != 1 {
+		t.Errorf("Tracing.SampleRatio = %v, want 1", cfg.Tracing.SampleRatio)
+	}
+	if cfg.Tracing.ServiceName != "hsadmin" {
+		t.Errorf("Tracing.ServiceName = %q, want hsadmin", cfg.Tracing.ServiceName)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "no endpoint",
+			yaml: `tracing:
+  insecure: true
+`,
+			wantErr: "tracing.endpoint is required",
+		},
+		{
+			name: "endpoint with scheme",
+			yaml: `tracing:
+  endpoint: http://otel-collector:4318
+`,
+			wantErr: "tracing.endpoint must be in 'host:port' format",
+		},
+		{
+			name: "unknown protocol",
+			yaml: `tracing:
+  endpoint: otel-collector:4317
+  protocol: thrift
+`,
+			wantErr: "tracing.protocol must be one of",
+		},
+		{
+			name: "sample ratio above 1",
+			yaml: `tracing:
+  endpoint: otel-collector:4317
+  sample_ratio: 10
+`,
+			wantErr: "tracing.sample_ratio must be between 0 and 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(base+tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_LoggingConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	base := `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  api_key: test-api-key
+  server_url: https://headscale.example.com
+`
+
+	err := os.WriteFile(configPath, []byte(base), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed without logging config: %v", err)
+	}
+	if cfg.Logging.Format != LogFormatText {
+		t.Errorf("Logging.Format = %q, want %q", cfg.Logging.Format, LogFormatText)
+	}
+	if cfg.Logging.Level != "info" {
+		t.Errorf("Logging.Level = %q, want info", cfg.Logging.Level)
+	}
+
+	err = os.WriteFile(configPath, []byte(base+`logging:
+  format: json
+  level: warn
+  levels:
+    sse: debug
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with valid logging config: %v", err)
+	}
+	if cfg.Logging.Format != LogFormatJSON || cfg.Logging.Level != "warn" || cfg.Logging.Levels["sse"] != "debug" {
+		t.Errorf("Logging = %+v, want json output at warn with sse at debug", cfg.Logging)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "unknown format",
+			yaml: `logging:
+  format: logfmt
+`,
+			wantErr: "logging.format must be one of",
+		},
+		{
+			name: "unknown level",
+			yaml: `logging:
+  level: verbose
+`,
+			wantErr: "logging.level must be one of",
+		},
+		{
+			name: "unknown subsystem level",
+			yaml: `logging:
+  levels:
+    auth: trace
+`,
+			wantErr: "logging.levels.auth must be one of",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(base+tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_HeadscaleConnection(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	caPath := filepath.Join(tmpDir, "ca.pem")
+	if err := os.WriteFile(caPath, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to write test CA: %v", err)
+	}
+
+	base := `headscale:
+  agent_userid: 1
+  server_url: https://headscale.example.com
+`
+
+	valid := []struct {
+		name string
+		yaml string
+	}{
+		{
+			name: "unix socket without api key",
+			yaml: `  api_socket: /var/run/headscale/headscale.sock
+`,
+		},
+		{
+			name: "insecure loopback",
+			yaml: `  api_hostport: 127.0.0.1:50443
+  api_key: test-api-key
+  insecure: true
+`,
+		},
+		{
+			name: "insecure localhost",
+			yaml: `  api_hostport: localhost:50443
+  api_key: test-api-key
+  insecure: true
+`,
+		},
+		{
+			name: "custom CA and server name",
+			yaml: `  api_hostport: 10.0.0.5:50443
+  api_key: test-api-key
+  tls:
+    ca_cert: ` + caPath + `
+    server_name: headscale.internal
+`,
+		},
+	}
+
+	for _, tt := range valid {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(base+tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+			if _, err := Load(configPath); err != nil {
+				t.Errorf("Load() failed: %v", err)
+			}
+		})
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "socket and hostport",
+			yaml: `  api_socket: /var/run/headscale/headscale.sock
+  api_hostport: localhost:50443
+`,
+			wantErr: "headscale.api_hostport and headscale.api_socket are mutually exclusive",
+		},
+		{
+			name: "socket with tls",
+			yaml: `  api_socket: /var/run/headscale/headscale.sock
+  tls:
+    server_name: headscale.internal
+`,
+			wantErr: "do not apply to headscale.api_socket",
+		},
+		{
+			name: "insecure remote host",
+			yaml: `  api_hostport: headscale.example.com:50443
+  api_key: test-api-key
+  insecure: true
+`,
+			wantErr: "headscale.insecure is only allowed with a loopback headscale.api_hostport",
+		},
+		{
+			name: "insecure with tls",
+			yaml: `  api_hostport: 127.0.0.1:50443
+  api_key: test-api-key
+  insecure: true
+  tls:
+    ca_cert: ` + caPath + `
+`,
+			wantErr: "headscale.insecure and headscale.tls are mutually exclusive",
+		},
+		{
+			name: "client cert without key",
+			yaml: `  api_hostport: localhost:50443
+  api_key: test-api-key
+  tls:
+    client_cert: ` + caPath + `
+`,
+			wantErr: "client_cert and headscale.tls.client_key must be set together",
+		},
+		{
+			name: "missing CA file",
+			yaml: `  api_hostport: localhost:50443
+  api_key: test-api-key
+  tls:
+    ca_cert: ` + filepath.Join(tmpDir, "missing.pem") + `
+`,
+			wantErr: "headscale.tls.ca_cert:",
+		},
+		{
+			name: "api key still required over tcp",
+			yaml: `  api_hostport: 127.0.0.1:50443
+  insecure: true
+`,
+			wantErr: "headscale.api_key is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(base+tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_Tailnets(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	apiKeyPath := filepath.Join(tmpDir, "lab_api_key")
+	if err := os.WriteFile(apiKeyPath, []byte("lab-api-key\n"), 0600); err != nil {
+		t.Fatalf("Failed to write test API key: %v", err)
+	}
+
+	listeners := `listeners:
+  tailscale:
+    admin_user_tags: ["tag:admin"]
+  http:
+    oidc:
+      provider_url: https://accounts.example.com
+      client_id: hsadmin
+      client_secret: client-secret
+      redirect_url: https://hsadmin.example.com/auth/callback
+      admin_emails: ["alice@example.com", "bob@example.com"]
+      session_secret: 0123456789abcdef0123456789abcdef
+`
+	valid := listeners + `tailnets:
+  - name: prod
+    headscale:
+      agent_userid: 1
+      api_hostport: headscale.example.com:50443
+      api_key: prod-api-key
+      server_url: https://headscale.example.com
+    admin_user_ids: [3]
+    admin_emails: ["alice@example.com"]
+  - name: lab
+    headscale:
+      agent_userid: 2
+      api_hostport: lab.example.com:50443
+      api_key_file: ` + apiKeyPath + `
+      server_url: https://lab.example.com
+history:
+  dir: /var/lib/hsadmin/history
+alerts:
+  rules:
+    - name: offline
+      kind: offline
+inventory:
+  dir: /var/lib/hsadmin/inventory
+`
+	if err := os.WriteFile(configPath, []byte(valid), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(cfg.Tailnets) != 2 {
+		t.Fatalf("Tailnets = %d, want 2", len(cfg.Tailnets))
+	}
+
+	prod := cfg.ForTailnet(cfg.Tailnets[0])
+	if prod.Headscale.APIKey != "prod-api-key" || len(prod.Tailnets) != 0 {
+		t.Errorf("prod headscale = %+v, tailnets = %d", prod.Headscale, len(prod.Tailnets))
+	}
+	if ids := prod.Listeners.Tailscale.AdminUserIDs; len(ids) != 1 || ids[0] != 3 || len(prod.Listeners.Tailscale.AdminUserTags) != 0 {
+		t.Errorf("prod Tailscale admins = %v %v, want [3] and no tags", ids, prod.Listeners.Tailscale.AdminUserTags)
+	}
+	if emails := prod.Listeners.HTTP.OIDC.AdminEmails; len(emails) != 1 || emails[0] != "alice@example.com" {
+		t.Errorf("prod admin emails = %v, want [alice@example.com]", emails)
+	}
+	if prod.History.Dir != "/var/lib/hsadmin/history/prod" {
+		t.Errorf("prod history.dir = %q", prod.History.Dir)
+	}
+	if prod.Alerts.SilencesFile != "/var/lib/hsadmin/history/prod/silences.json" {
+		t.Errorf("prod alerts.silences_file = %q", prod.Alerts.SilencesFile)
+	}
+	if prod.Inventory.Dir != "/var/lib/hsadmin/inventory/prod" {
+		t.Errorf("prod inventory.dir = %q", prod.Inventory.Dir)
+	}
+
+	// The lab tailnet inherits the listeners' admins, and the shared configuration is untouched
+	lab := cfg.ForTailnet(cfg.Tailnets[1])
+	if lab.Headscale.APIKey != "lab-api-key" {
+		t.Errorf("lab api_key = %q, want it read from api_key_file", lab.Headscale.APIKey)
+	}
+	if tags := lab.Listeners.Tailscale.AdminUserTags; len(tags) != 1 || tags[0] != "tag:admin" {
+		t.Errorf("lab Tailscale admin tags = %v, want [tag:admin]", tags)
+	}
+	if emails := lab.Listeners.HTTP.OIDC.AdminEmails; len(emails) != 2 {
+		t.Errorf("lab admin emails = %v, want both OIDC admins", emails)
+	}
+	if cfg.History.Dir != "/var/lib/hsadmin/history" || len(cfg.Listeners.HTTP.OIDC.AdminEmails) != 2 {
+		t.Errorf("ForTailnet() modified the shared configuration")
+	}
+
+	tailnet := func(name, extra string) string {
+		return `  - name: ` + name + `
+    headscale:
+      agent_userid: 1
+      api_hostport: headscale.example.com:50443
+      api_key: api-key
+      server_url: https://headscale.example.com
+` + extra
+	}
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "headscale and tailnets",
+			yaml: `headscale:
+  agent_userid: 1
+tailnets:
+` + tailnet("prod", ""),
+			wantErr: "headscale and tailnets are mutually exclusive",
+		},
+		{
+			name:    "invalid name",
+			yaml:    "tailnets:\n" + tailnet("Prod/EU", ""),
+			wantErr: `tailnets[0].name must be lowercase letters, digits and dashes (got: "Prod/EU")`,
+		},
+		{
+			name:    "duplicate name",
+			yaml:    "tailnets:\n" + tailnet("prod", "") + tailnet("prod", ""),
+			wantErr: `tailnets[1].name "prod" is used more than once`,
+		},
+		{
+			name: "invalid headscale block",
+			yaml: `tailnets:
+` + tailnet("prod", "") + `  - name: lab
+    headscale:
+      agent_userid: 1
+      api_hostport: lab.example.com:50443
+      server_url: https://lab.example.com
+`,
+			wantErr: "tailnets[1].headscale.api_key is required",
+		},
+		{
+			name:    "admin email that cannot sign in",
+			yaml:    listeners + "tailnets:\n" + tailnet("prod", "    admin_emails: [\"mallory@example.com\"]\n"),
+			wantErr: "tailnets[0].admin_emails: mallory@example.com is not in listeners.http.oidc.admin_emails",
+		},
+		{
+			name:    "admin user IDs without the Tailscale listener",
+			yaml:    "tailnets:\n" + tailnet("prod", "    admin_user_ids: [3]\n"),
+			wantErr: "tailnets[0].admin_user_ids and admin_user_tags require listeners.tailscale",
+		},
+		{
+			name: "no Tailscale admins",
+			yaml: `listeners:
+  tailscale:
+    port: 80
+tailnets:
+` + tailnet("prod", "    admin_user_ids: [3]\n") + tailnet("lab", ""),
+			wantErr: "tailnets[1] has no Tailscale admins",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_Secrets(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	secretPath := func(name, content string) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write secret: %v", err)
+		}
+		return path
+	}
+	t.Setenv("HSADMIN_TEST_SESSION_SECRET", "0123456789abcdef0123456789abcdef")
+	t.Setenv("HSADMIN_TEST_TOKEN", "metrics-token-from-env")
+
+	base := `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  server_url: https://headscale.example.com
+`
+
+	err := os.WriteFile(configPath, []byte(base+`  api_key_file: `+secretPath("api-key", "key-from-file\n")+`
+listeners:
+  http:
+    oidc:
+      provider_url: https://accounts.google.com
+      client_id: hsadmin
+      client_secret_file: `+secretPath("client-secret", "client-secret-from-file")+`
+      redirect_url: https://hsadmin.example.com/auth/callback
+      admin_emails: [admin@example.com]
+      session_secret: ${HSADMIN_TEST_SESSION_SECRET}
+metrics:
+  auth: bearer
+  bearer_token: prefix-${HSADMIN_TEST_TOKEN}
+webhooks:
+  endpoints:
+    - name: slack
+      url_file: `+secretPath("slack-url", "https://hooks.slack.com/services/T000/B000/XXXX\n")+`
+      format: slack
+tracing:
+  endpoint: otel-collector:4317
+  headers:
+    authorization: Bearer ${HSADMIN_TEST_TOKEN}
+`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed with secrets from files and environment: %v", err)
+	}
+	if cfg.Headscale.APIKey != "key-from-file" {
+		t.Errorf("Headscale.APIKey = %q, want key-from-file without the trailing newline", cfg.Headscale.APIKey)
+	}
+	oidc := cfg.Listeners.HTTP.OIDC
+	if oidc.ClientSecret != "client-secret-from-file" || oidc.SessionSecret != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("OIDC secrets = %q, %q, want values from file and environment", oidc.ClientSecret, oidc.SessionSecret)
+	}
+	if cfg.Metrics.BearerToken != "prefix-metrics-token-from-env" {
+		t.Errorf("Metrics.BearerToken = %q, want prefix-metrics-token-from-env", cfg.Metrics.BearerToken)
+	}
+	if cfg.Webhooks.Endpoints[0].URL != "https://hooks.slack.com/services/T000/B000/XXXX" {
+		t.Errorf("Webhooks.Endpoints[0].URL = %q, want the URL from file", cfg.Webhooks.Endpoints[0].URL)
+	}
+	if cfg.Tracing.Headers["authorization"] != "Bearer metrics-token-from-env" {
+		t.Errorf("Tracing.Headers = %v, want the expanded authorization header", cfg.Tracing.Headers)
+	}
+
+	// A bare $ is kept, since secrets may contain it
+	err = os.WriteFile(configPath, []byte(base+"  api_key: pa$$word$HOME\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	cfg, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.Headscale.APIKey != "pa$$word$HOME" {
+		t.Errorf("Headscale.APIKey = %q, want it unchanged", cfg.Headscale.APIKey)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "inline and file",
+			yaml: `  api_key: super-secret-value
+  api_key_file: ` + secretPath("other-key", "other") + `
+`,
+			wantErr: "headscale.api_key and headscale.api_key_file are mutually exclusive",
+		},
+		{
+			name: "missing file",
+			yaml: `  api_key_file: ` + filepath.Join(tmpDir, "missing") + `
+`,
+			wantErr: "failed to read headscale.api_key_file",
+		},
+		{
+			name: "empty file",
+			yaml: `  api_key_file: ` + secretPath("empty", "\n") + `
+`,
+			wantErr: "is empty",
+		},
+		{
+			name: "unset variable",
+			yaml: `  api_key: super-secret-${HSADMIN_TEST_UNSET}
+`,
+			wantErr: "headscale.api_key: environment variable HSADMIN_TEST_UNSET is not set",
+		},
+		{
+			name: "invalid webhook url",
+			yaml: `  api_key: test-api-key
+webhooks:
+  endpoints:
+    - name: slack
+      url: hooks.slack.com/services/super-secret-value
+`,
+			wantErr: "webhooks.endpoints[0].url must be an http:// or https:// URL",
+		},
+		{
+			name: "short session secret from environment",
+			yaml: `  api_key: test-api-key
+listeners:
+  http:
+    oidc:
+      provider_url: https://accounts.google.com
+      client_id: hsadmin
+      client_secret: super-secret-value
+      redirect_url: https://hsadmin.example.com/auth/callback
+      admin_emails: [admin@example.com]
+      session_secret: ${HSADMIN_TEST_TOKEN}
+`,
+			wantErr: "session_secret must be at least 32 characters",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(base+tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write test config: %v", err)
+			}
+
+			_, err := Load(configPath)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			// Errors are logged at startup, so they must never contain secrets
+			for _, secret := range []string{"super-secret", "metrics-token-from-env"} {
+				if err != nil && strings.Contains(err.Error(), secret) {
+					t.Errorf("Load() error = %v, contains a secret", err)
+				}
+			}
+		})
+	}
+}
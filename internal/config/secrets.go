@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// secretField is a secret setting, which may be given inline with ${ENV} references or read from a file
+type secretField struct {
+	name  string  // Setting name used in errors, e.g. headscale.api_key
+	value *string // Inline value
+	file  *string // Path of the <name>_file variant
+}
+
+// secretFields returns the secret settings present in the configuration
+func (c *Config) secretFields() []secretField {
+	fields := []secretField{
+		{"headscale.api_key", &c.Headscale.APIKey, &c.Headscale.APIKeyFile},
+	}
+	for i := range c.Tailnets {
+		hs := &c.Tailnets[i].Headscale
+		fields = append(fields, secretField{fmt.Sprintf("tailnets[%d].headscale.api_key", i), &hs.APIKey, &hs.APIKeyFile})
+	}
+	if c.Listeners.HTTP != nil && c.Listeners.HTTP.OIDC != nil {
+		oidc := c.Listeners.HTTP.OIDC
+		fields = append(fields,
+			secretField{"listeners.http.oidc.client_secret", &oidc.ClientSecret, &oidc.ClientSecretFile},
+			secretField{"listeners.http.oidc.session_secret", &oidc.SessionSecret, &oidc.SessionSecretFile},
+		)
+	}
+	if c.Metrics != nil {
+		fields = append(fields, secretField{"metrics.bearer_token", &c.Metrics.BearerToken, &c.Metrics.BearerTokenFile})
+	}
+	if c.Email != nil {
+		fields = append(fields, secretField{"email.smtp.password", &c.Email.SMTP.Password, &c.Email.SMTP.PasswordFile})
+	}
+	if c.Webhooks != nil {
+		for i := range c.Webhooks.Endpoints {
+			endpoint := &c.Webhooks.Endpoints[i]
+			// Chat webhook URLs contain credentials
+			fields = append(fields,
+				secretField{fmt.Sprintf("webhooks.endpoints[%d].url", i), &endpoint.URL, &endpoint.URLFile},
+				secretField{fmt.Sprintf("webhooks.endpoints[%d].secret", i), &endpoint.Secret, &endpoint.SecretFile},
+			)
+		}
+	}
+	return fields
+}
+
+// resolveSecrets reads secrets given as files and expands ${ENV} references in inline secrets,
+// so they are picked up afresh every time the configuration is loaded.
+// Errors name the setting, file or variable, never the secret itself.
+func (c *Config) resolveSecrets() error {
+	for _, f := range c.secretFields() {
+		if *f.file != "" {
+			if *f.value != "" {
+				return fmt.Errorf("%s and %s_file are mutually exclusive", f.name, f.name)
+			}
+			b, err := os.ReadFile(*f.file)
+			if err != nil {
+				return fmt.Errorf("failed to read %s_file: %w", f.name, err)
+			}
+			// Files written by editors, echo and secret managers often end with a newline
+			*f.value = strings.TrimRight(string(b), "\r\n")
+			if *f.value == "" {
+				return fmt.Errorf("%s_file %s is empty", f.name, *f.file)
+			}
+			continue
+		}
+
+		expanded, err := expandEnv(*f.value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+		*f.value = expanded
+	}
+
+	// Tracing headers typically carry collector credentials
+	if c.Tracing != nil {
+		for name, value := range c.Tracing.Headers {
+			expanded, err := expandEnv(value)
+			if err != nil {
+				return fmt.Errorf("tracing.headers.%s: %w", name, err)
+			}
+			c.Tracing.Headers[name] = expanded
+		}
+	}
+
+	return nil
+}
+
+// envRef matches ${NAME} references; a bare $ is left alone, since secrets may contain it
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} references in s with the values of environment variables
+// Unset variables are an error rather than silently becoming empty secrets.
+func expandEnv(s string) (string, error) {
+	var missing string
+	expanded := envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRef.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s is not set", missing)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+)
+
+// tailnetName matches tailnet names, which appear in URLs and directory names
+var tailnetName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// validateTailnets validates several tailnets, which replace the headscale block
+func (c *Config) validateTailnets() error {
+	if !reflect.ValueOf(c.Headscale).IsZero() {
+		return fmt.Errorf("headscale and tailnets are mutually exclusive: move the headscale block into a tailnet")
+	}
+
+	names := make(map[string]bool)
+	for i, t := range c.Tailnets {
+		if !tailnetName.MatchString(t.Name) {
+			return fmt.Errorf("tailnets[%d].name must be lowercase letters, digits and dashes (got: %q)", i, t.Name)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("tailnets[%d].name %q is used more than once", i, t.Name)
+		}
+		names[t.Name] = true
+
+		if err := validateHeadscale(fmt.Sprintf("tailnets[%d].headscale", i), t.Headscale); err != nil {
+			return err
+		}
+
+		if len(t.AdminUserIDs) > 0 || len(t.AdminUserTags) > 0 {
+			if c.Listeners.Tailscale == nil {
+				return fmt.Errorf("tailnets[%d].admin_user_ids and admin_user_tags require listeners.tailscale", i)
+			}
+		} else if c.Listeners.Tailscale != nil && len(c.Listeners.Tailscale.AdminUserIDs) == 0 && len(c.Listeners.Tailscale.AdminUserTags) == 0 {
+			return fmt.Errorf("tailnets[%d] has no Tailscale admins: set admin_user_ids or admin_user_tags here or in listeners.tailscale", i)
+		}
+
+		if len(t.AdminEmails) > 0 {
+			if c.Listeners.HTTP == nil || c.Listeners.HTTP.OIDC == nil {
+				return fmt.Errorf("tailnets[%d].admin_emails requires listeners.http.oidc", i)
+			}
+			// Only the OIDC admins can sign in, so other addresses could never reach the tailnet
+			for _, email := range t.AdminEmails {
+				if !slices.Contains(c.Listeners.HTTP.OIDC.AdminEmails, email) {
+					return fmt.Errorf("tailnets[%d].admin_emails: %s is not in listeners.http.oidc.admin_emails", i, email)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ForTailnet returns the configuration of one of c.Tailnets: c with the tailnet's headscale block and
+// admins, and with history, silences and inventory exports kept in a directory per tailnet
+func (c *Config) ForTailnet(t TailnetConfig) *Config {
+	tc := *c
+	tc.Headscale = t.Headscale
+	tc.Tailnets = nil
+
+	if c.Listeners.Tailscale != nil && (len(t.AdminUserIDs) > 0 || len(t.AdminUserTags) > 0) {
+		tailscale := *c.Listeners.Tailscale
+		tailscale.AdminUserIDs, tailscale.AdminUserTags = t.AdminUserIDs, t.AdminUserTags
+		tc.Listeners.Tailscale = &tailscale
+	}
+	if c.Listeners.HTTP != nil && c.Listeners.HTTP.OIDC != nil && len(t.AdminEmails) > 0 {
+		http, oidc := *c.Listeners.HTTP, *c.Listeners.HTTP.OIDC
+		oidc.AdminEmails = t.AdminEmails
+		http.OIDC = &oidc
+		tc.Listeners.HTTP = &http
+	}
+
+	if c.History != nil {
+		history := *c.History
+		history.Dir = filepath.Join(history.Dir, t.Name)
+		tc.History = &history
+	}
+	if c.Alerts != nil && c.Alerts.SilencesFile != "" {
+		alerts := *c.Alerts
+		alerts.SilencesFile = filepath.Join(filepath.Dir(alerts.SilencesFile), t.Name, filepath.Base(alerts.SilencesFile))
+		tc.Alerts = &alerts
+	}
+	if c.Inventory != nil {
+		inventory := *c.Inventory
+		inventory.Dir = filepath.Join(inventory.Dir, t.Name)
+		tc.Inventory = &inventory
+	}
+
+	return &tc
+}
@@ -0,0 +1,166 @@
+package email
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNotifier creates a notifier that sends through a test SMTP server
+func newTestNotifier(t *testing.T, tlsMode string, implicitTLS, noStartTLS bool) (*Notifier, *smtpServer) {
+	t.Helper()
+
+	server, clientTLS := startSMTPServer(t, implicitTLS, noStartTLS)
+	n, err := New(&config.EmailConfig{
+		SMTP: config.SMTPConfig{
+			Host:     "127.0.0.1",
+			Port:     server.port(),
+			TLS:      tlsMode,
+			Username: "hsadmin",
+			Password: "s3cret",
+		},
+		From:           "hsadmin <hsadmin@example.com>",
+		To:             []string{"admin@example.com", "Ops <ops@example.com>"},
+		Events:         []string{"node.added", "node.routes_pending"},
+		DigestInterval: time.Minute,
+	})
+	require.NoError(t, err)
+	n.sender.tlsConfig = clientTLS
+	return n, server
+}
+
+// nodeEvent returns an event about a test machine
+func nodeEvent(eventType watcher.EventType, name string, at time.Time) watcher.Event {
+	e := watcher.NewEvent(eventType, at)
+	e.Node = &watcher.NodeState{ID: 1, Name: name, User: "alice"}
+	return e
+}
+
+// parts returns the decoded text and HTML bodies of a multipart/alternative message
+func parts(t *testing.T, msg *mail.Message) (string, string) {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	bodies := make(map[string]string)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part) // quoted-printable is decoded by NextPart
+		require.NoError(t, err)
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		bodies[partType] = string(body)
+	}
+	return bodies["text/plain"], bodies["text/html"]
+}
+
+// TestNotifier_Digest tests that filtered events are batched into one email over STARTTLS with auth
+func TestNotifier_Digest(t *testing.T) {
+	n, server := newTestNotifier(t, config.SMTPTLSStartTLS, false, false)
+	at := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	pending := nodeEvent(watcher.NodeRoutesPending, "router", at)
+	pending.Routes = []string{"10.0.0.0/24"}
+	n.Notify([]watcher.Event{
+		nodeEvent(watcher.NodeAdded, "<script>laptop", at),
+		nodeEvent(watcher.NodeOffline, "laptop", at), // Not selected
+		pending,
+	})
+	require.NoError(t, n.Flush(context.Background()))
+
+	messages := server.received()
+	require.Len(t, messages, 1)
+	got := messages[0]
+	assert.True(t, got.TLS)
+	assert.Equal(t, "hsadmin", got.Username)
+	assert.Equal(t, "s3cret", got.Password)
+	// The envelope carries bare addresses; display names are only in the headers
+	assert.Equal(t, "<hsadmin@example.com>", got.From)
+	assert.Equal(t, []string{"<admin@example.com>", "<ops@example.com>"}, got.To)
+
+	msg, err := mail.ReadMessage(strings.NewReader(got.Data))
+	require.NoError(t, err)
+	assert.Equal(t, "[hsadmin] 2 tailnet changes", msg.Header.Get("Subject"))
+	assert.Equal(t, "hsadmin <hsadmin@example.com>", msg.Header.Get("From"))
+	assert.Equal(t, "admin@example.com, Ops <ops@example.com>", msg.Header.Get("To"))
+
+	text, html := parts(t, msg)
+	assert.Contains(t, text, "Routes awaiting approval\n- Machine router (alice) advertised routes awaiting approval: 10.0.0.0/24")
+	assert.Contains(t, text, "New machines\n- Machine <script>laptop (alice) was added")
+	assert.NotContains(t, text, "offline")
+	assert.Contains(t, html, "Machine &lt;script&gt;laptop (alice) was added")
+	assert.NotContains(t, html, "<script>")
+
+	// Nothing pending: no email
+	require.NoError(t, n.Flush(context.Background()))
+	assert.Len(t, server.received(), 1)
+}
+
+// TestNotifier_ImplicitTLS tests sending over an implicit TLS connection with a single-event subject
+func TestNotifier_ImplicitTLS(t *testing.T) {
+	n, server := newTestNotifier(t, config.SMTPTLSImplicit, true, false)
+
+	n.Notify([]watcher.Event{nodeEvent(watcher.NodeAdded, "laptop", time.Now())})
+	require.NoError(t, n.Flush(context.Background()))
+
+	messages := server.received()
+	require.Len(t, messages, 1)
+	assert.True(t, messages[0].TLS)
+
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0].Data))
+	require.NoError(t, err)
+	assert.Equal(t, "[hsadmin] Machine laptop (alice) was added", msg.Header.Get("Subject"))
+}
+
+// TestNotifier_RetryAfterFailure tests that events are kept when sending fails
+func TestNotifier_RetryAfterFailure(t *testing.T) {
+	n, server := newTestNotifier(t, config.SMTPTLSStartTLS, false, true)
+
+	n.Notify([]watcher.Event{nodeEvent(watcher.NodeAdded, "laptop", time.Now())})
+	err := n.Flush(context.Background())
+	assert.ErrorContains(t, err, "does not support STARTTLS")
+	assert.Empty(t, server.received())
+	assert.Equal(t, 1, n.pendingCount())
+
+	// Once the server offers STARTTLS the kept event is delivered
+	server.noStartTLS = false
+	require.NoError(t, n.Flush(context.Background()))
+	assert.Len(t, server.received(), 1)
+	assert.Equal(t, 0, n.pendingCount())
+}
+
+// TestNotifier_SetSMTPPassword tests that a replaced password is used for the next digest
+func TestNotifier_SetSMTPPassword(t *testing.T) {
+	n, server := newTestNotifier(t, config.SMTPTLSStartTLS, false, false)
+
+	n.SetSMTPPassword("rotated")
+	n.Notify([]watcher.Event{nodeEvent(watcher.NodeAdded, "laptop", time.Now())})
+	require.NoError(t, n.Flush(context.Background()))
+
+	msgs := server.received()
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "hsadmin", msgs[0].Username)
+	assert.Equal(t, "rotated", msgs[0].Password)
+}
+
+// TestNew_UnknownEventType tests that unknown event names are rejected
+func TestNew_UnknownEventType(t *testing.T) {
+	_, err := New(&config.EmailConfig{Events: []string{"node.exploded"}})
+	assert.ErrorContains(t, err, `unknown event type "node.exploded"`)
+}
@@ -0,0 +1,237 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"net/mail"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/logging"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+)
+
+var logger = logging.For("email")
+
+// maxPending bounds the events held for the next digest; the oldest are dropped beyond this
+const maxPending = 500
+
+//go:embed templates/*
+var templatesFS embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templatesFS, "templates/digest.html"))
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templatesFS, "templates/digest.txt"))
+)
+
+// sectionTitles are the digest section headings, in display order
+var sectionTitles = []struct {
+	Type  watcher.EventType
+	Title string
+}{
+	{watcher.AlertFiring, "Alerts firing"},
+	{watcher.AlertResolved, "Alerts resolved"},
+	{watcher.NodeRoutesPending, "Routes awaiting approval"},
+	{watcher.NodeKeyExpiring, "Keys expiring soon"},
+	{watcher.NodeAdded, "New machines"},
+	{watcher.NodeRemoved, "Removed machines"},
+	{watcher.NodeOffline, "Machines offline"},
+	{watcher.NodeOnline, "Machines online"},
+	{watcher.NodeTagsChanged, "Tag changes"},
+	{watcher.NodeRoutesChanged, "Route changes"},
+	{watcher.NodeRenamed, "Renamed machines"},
+	{watcher.NodeUserChanged, "Machines moved between users"},
+	{watcher.UserCreated, "New users"},
+	{watcher.UserRenamed, "Renamed users"},
+	{watcher.UserDeleted, "Deleted users"},
+	{watcher.Test, "Test notifications"},
+}
+
+// digest is the template data for a digest email
+type digest struct {
+	Subject  string
+	Count    int
+	Since    time.Time
+	Until    time.Time
+	Sections []digestSection
+}
+
+// digestSection groups the events of one type
+type digestSection struct {
+	Title  string
+	Events []watcher.Event
+}
+
+// Notifier batches tailnet events and emails them to administrators as periodic digests
+type Notifier struct {
+	cfg    *config.EmailConfig
+	sender *Sender
+	events map[watcher.EventType]bool
+
+	// Envelope addresses for MAIL FROM and RCPT TO, without the display names kept in the headers
+	envelopeFrom string
+	envelopeTo   []string
+
+	mu      sync.Mutex
+	pending []watcher.Event
+}
+
+// New creates a notifier for the configured SMTP server and recipients
+func New(cfg *config.EmailConfig) (*Notifier, error) {
+	n := &Notifier{
+		cfg:    cfg,
+		sender: NewSender(cfg.SMTP),
+		events: make(map[watcher.EventType]bool),
+	}
+
+	for _, eventType := range cfg.Events {
+		if !watcher.IsValidEventType(eventType) {
+			return nil, fmt.Errorf("email: unknown event type %q", eventType)
+		}
+		n.events[watcher.EventType(eventType)] = true
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("email: invalid from address %q: %w", cfg.From, err)
+	}
+	n.envelopeFrom = from.Address
+	for _, to := range cfg.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("email: invalid to address %q: %w", to, err)
+		}
+		n.envelopeTo = append(n.envelopeTo, addr.Address)
+	}
+
+	return n, nil
+}
+
+// SetSMTPPassword replaces the SMTP password, e.g. after the configuration is reloaded
+func (n *Notifier) SetSMTPPassword(password string) {
+	n.sender.SetPassword(password)
+}
+
+// Run sends a digest of pending events every digest interval until ctx is cancelled
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.cfg.DigestInterval)
+	defer ticker.Stop()
+
+	logger.Info("Sending digests", "recipients", len(n.cfg.To),
+		"smtp_host", n.cfg.SMTP.Host, "smtp_port", n.cfg.SMTP.Port, "interval", n.cfg.DigestInterval)
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := n.Flush(ctx); err != nil {
+				logger.Warn("Failed to send digest, will retry", "error", err)
+			}
+
+		case <-ctx.Done():
+			if pending := n.pendingCount(); pending > 0 {
+				logger.Warn("Stopped with unsent events", "events", pending)
+			} else {
+				logger.Info("Stopped")
+			}
+			return
+		}
+	}
+}
+
+// Notify queues the events selected by the email.events setting for the next digest
+func (n *Notifier) Notify(events []watcher.Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, e := range events {
+		if n.events[e.Type] {
+			n.pending = append(n.pending, e)
+		}
+	}
+	if dropped := len(n.pending) - maxPending; dropped > 0 {
+		logger.Warn("Dropping oldest events from the pending digest", "events", dropped)
+		n.pending = n.pending[dropped:]
+	}
+}
+
+// Flush sends pending events as one digest, keeping them for the next attempt if sending fails
+func (n *Notifier) Flush(ctx context.Context) error {
+	n.mu.Lock()
+	events := n.pending
+	n.pending = nil
+	n.mu.Unlock()
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	msg, err := n.render(events, time.Now())
+	if err == nil {
+		err = n.sender.Send(ctx, n.envelopeFrom, n.envelopeTo, msg)
+	}
+	if err != nil {
+		// Put the events back ahead of any that arrived while sending
+		n.mu.Lock()
+		n.pending = append(events, n.pending...)
+		n.mu.Unlock()
+		return err
+	}
+
+	logger.Info("Sent digest", "events", len(events))
+	return nil
+}
+
+// render builds the digest email for events
+func (n *Notifier) render(events []watcher.Event, now time.Time) ([]byte, error) {
+	d := digest{
+		Count: len(events),
+		Since: events[0].Time,
+		Until: events[len(events)-1].Time,
+	}
+	if len(events) == 1 {
+		d.Subject = "[hsadmin] " + events[0].Message()
+	} else {
+		d.Subject = fmt.Sprintf("[hsadmin] %d tailnet changes", len(events))
+	}
+
+	for _, section := range sectionTitles {
+		var matching []watcher.Event
+		for _, e := range events {
+			if e.Type == section.Type {
+				matching = append(matching, e)
+			}
+		}
+		if len(matching) > 0 {
+			d.Sections = append(d.Sections, digestSection{Title: section.Title, Events: matching})
+		}
+	}
+
+	var html, text bytes.Buffer
+	if err := htmlTemplate.ExecuteTemplate(&html, "digest.html", d); err != nil {
+		return nil, err
+	}
+	if err := textTemplate.ExecuteTemplate(&text, "digest.txt", d); err != nil {
+		return nil, err
+	}
+
+	return message{
+		From:    n.cfg.From,
+		To:      n.cfg.To,
+		Subject: d.Subject,
+		Date:    now,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}.bytes()
+}
+
+// pendingCount returns the number of events waiting for the next digest
+func (n *Notifier) pendingCount() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.pending)
+}
@@ -0,0 +1,113 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+)
+
+// sendTimeout bounds a whole SMTP exchange, from dial to QUIT
+const sendTimeout = 30 * time.Second
+
+// Sender delivers messages through an SMTP server
+type Sender struct {
+	cfg       config.SMTPConfig
+	tlsConfig *tls.Config
+
+	mu       sync.Mutex
+	password string // Replaced when secrets are reloaded
+}
+
+// NewSender creates a sender for the configured SMTP server
+func NewSender(cfg config.SMTPConfig) *Sender {
+	return &Sender{
+		cfg:       cfg,
+		tlsConfig: &tls.Config{ServerName: cfg.Host},
+		password:  cfg.Password,
+	}
+}
+
+// SetPassword replaces the SMTP password used by later sends
+func (s *Sender) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+// Send delivers msg, a complete RFC 5322 message, from and to bare envelope addresses (no display names)
+func (s *Sender) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{}
+
+	var conn net.Conn
+	var err error
+	if s.cfg.TLS == config.SMTPTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("starting SMTP session: %w", err)
+	}
+	defer c.Close()
+
+	if s.cfg.TLS == config.SMTPTLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		if err := c.StartTLS(s.tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS: %w", err)
+		}
+	}
+
+	// PlainAuth refuses to send credentials over an unencrypted connection, except to localhost
+	if s.cfg.Username != "" {
+		s.mu.Lock()
+		password := s.password
+		s.mu.Unlock()
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, password, s.cfg.Host)); err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return fmt.Errorf("MAIL FROM: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("RCPT TO %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("sending message: %w", err)
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,187 @@
+package email
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// received is a message accepted by the test SMTP server
+type received struct {
+	From     string   // MAIL FROM argument as sent, e.g. <hsadmin@example.com>
+	To       []string // RCPT TO arguments as sent
+	Data     string
+	TLS      bool
+	Username string
+	Password string
+}
+
+// smtpServer is a minimal SMTP stand-in supporting STARTTLS, implicit TLS and AUTH PLAIN
+type smtpServer struct {
+	ln          net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	noStartTLS  bool
+
+	mu       sync.Mutex
+	messages []received
+}
+
+// startSMTPServer starts a test SMTP server on a random local port
+// Returns the server and a client TLS config that trusts its certificate.
+func startSMTPServer(t *testing.T, implicitTLS, noStartTLS bool) (*smtpServer, *tls.Config) {
+	t.Helper()
+
+	cert, pool := selfSignedCert(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &smtpServer{
+		ln:          ln,
+		tlsConfig:   &tls.Config{Certificates: []tls.Certificate{cert}},
+		implicitTLS: implicitTLS,
+		noStartTLS:  noStartTLS,
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s, &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+}
+
+// port returns the port the server listens on
+func (s *smtpServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// received returns the messages accepted so far
+func (s *smtpServer) received() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]received(nil), s.messages...)
+}
+
+// serve handles one SMTP session
+func (s *smtpServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	isTLS := false
+	if s.implicitTLS {
+		conn = tls.Server(conn, s.tlsConfig)
+		isTLS = true
+	}
+	tp := textproto.NewConn(conn)
+
+	var msg received
+	tp.PrintfLine("220 127.0.0.1 ESMTP test")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-127.0.0.1")
+			if !isTLS && !s.noStartTLS {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+
+		case "STARTTLS":
+			tp.PrintfLine("220 Ready to start TLS")
+			conn = tls.Server(conn, s.tlsConfig)
+			tp = textproto.NewConn(conn)
+			isTLS = true
+
+		case "AUTH":
+			_, initial, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(initial)
+			parts := strings.Split(string(decoded), "\x00")
+			if len(parts) == 3 {
+				msg.Username, msg.Password = parts[1], parts[2]
+			}
+			tp.PrintfLine("235 Authenticated")
+
+		case "MAIL":
+			msg.From = strings.TrimPrefix(arg, "FROM:")
+			tp.PrintfLine("250 OK")
+
+		case "RCPT":
+			msg.To = append(msg.To, strings.TrimPrefix(arg, "TO:"))
+			tp.PrintfLine("250 OK")
+
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			msg.TLS = isTLS
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = received{Username: msg.Username, Password: msg.Password}
+			tp.PrintfLine("250 OK")
+
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// selfSignedCert returns a certificate for 127.0.0.1 and a pool that trusts it
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "smtp test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	parsed, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
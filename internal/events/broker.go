@@ -2,97 +2,202 @@ package events
 
 import (
 	"sync"
+	"time"
+)
+
+// Buffer sizes
+const (
+	clientBuffer = 5   // Events queued per client before it has to catch up from the replay buffer
+	replaySize   = 256 // Recent events kept for clients that fall behind or reconnect with Last-Event-ID
 )
 
 // Event represents an SSE event to be sent to clients
 type Event struct {
-	Type string // Event type (e.g., "machineStatus", "machineAdded", "userChanged")
-	HTML string // HTML content to be sent in the SSE data field
+	ID    uint64 // Assigned by Broadcast; increases with every event across all topics
+	Topic string // Only clients subscribed to the topic receive the event
+	Type  string // Event type (e.g., "machineStatus", "machineAdded", "userChanged")
+	HTML  string // HTML content to be sent in the SSE data field
+}
+
+// Subscription is a client's stream of events
+type Subscription struct {
+	Events chan Event    // Closed when the client is unsubscribed or the broker is closed
+	Missed chan struct{} // Signalled when an event did not fit in Events; catch up with Since
+	Start  uint64        // ID of the last event broadcast before the client subscribed
+	topics map[string]bool
 }
 
-// Broker manages SSE connections and broadcasts events to all connected clients
+// Subscribed returns true if the subscription includes topic
+func (s *Subscription) Subscribed(topic string) bool {
+	return s.topics[topic]
+}
+
+// Broker manages SSE connections and broadcasts events to the clients subscribed to their topics
+// Recent events are kept so clients that fall behind or reconnect can catch up without reloading.
 type Broker struct {
-	clients    map[chan Event]bool
 	mu         sync.RWMutex
-	register   chan chan Event
-	unregister chan chan Event
-	broadcast  chan Event
-	done       chan struct{}
+	clients    map[*Subscription]bool
+	lastID     uint64
+	replay     []Event           // Oldest first, at most replaySize
+	replayFrom uint64            // Every event after this ID is still in replay
+	skipped    uint64            // ID given to the last change on all topics that was not broadcast, see Skip
+	skippedOn  map[string]uint64 // ID given to the last change that was not broadcast, by topic
+	dropped    uint64            // Events that did not fit in a client's buffer
+	closed     bool
 }
 
-// NewBroker creates and starts a new event broker
+// NewBroker creates a new event broker
 func NewBroker() *Broker {
-	b := &Broker{
-		clients:    make(map[chan Event]bool),
-		register:   make(chan chan Event),
-		unregister: make(chan chan Event),
-		broadcast:  make(chan Event, 10), // Buffer up to 10 events
-		done:       make(chan struct{}),
+	// IDs start from the startup time so they keep increasing across restarts, and a
+	// Last-Event-ID from a previous run is never mistaken for one of this run's events
+	start := uint64(time.Now().UnixMicro())
+	return &Broker{
+		clients:    make(map[*Subscription]bool),
+		lastID:     start,
+		replayFrom: start,
+		skippedOn:  make(map[string]uint64),
 	}
-	go b.run()
-	return b
 }
 
-// run is the main event loop for the broker
-func (b *Broker) run() {
-	for {
-		select {
-		case client := <-b.register:
-			b.mu.Lock()
-			b.clients[client] = true
-			b.mu.Unlock()
-
-		case client := <-b.unregister:
-			b.mu.Lock()
-			if _, ok := b.clients[client]; ok {
-				delete(b.clients, client)
-				close(client)
-			}
-			b.mu.Unlock()
-
-		case event := <-b.broadcast:
-			b.mu.RLock()
-			for client := range b.clients {
-				select {
-				case client <- event:
-				default:
-					// Client is slow or disconnected, skip
-				}
+// Subscribe registers a new client for events on the given topics
+func (b *Broker) Subscribe(topics ...string) *Subscription {
+	sub := &Subscription{
+		Events: make(chan Event, clientBuffer),
+		Missed: make(chan struct{}, 1),
+		topics: make(map[string]bool),
+	}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub.Start = b.lastID
+	if b.closed {
+		close(sub.Events)
+		return sub
+	}
+	b.clients[sub] = true
+	return sub
+}
+
+// Unsubscribe removes a client from the broker
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.clients[sub] {
+		delete(b.clients, sub)
+		close(sub.Events)
+	}
+}
+
+// Broadcast assigns the event the next ID, records it for replay and sends it to the clients subscribed to its topic
+// Clients whose buffers are full are signalled on Missed instead of blocking the broadcast.
+func (b *Broker) Broadcast(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event.ID = b.lastID
+	b.replay = append(b.replay, event)
+	if evicted := len(b.replay) - replaySize; evicted > 0 {
+		b.replayFrom = b.replay[evicted-1].ID
+		b.replay = b.replay[evicted:]
+
+		// Clients from before these skips resync for the evicted events anyway
+		for topic, id := range b.skippedOn {
+			if id <= b.replayFrom {
+				delete(b.skippedOn, topic)
 			}
-			b.mu.RUnlock()
+		}
+	}
 
-		case <-b.done:
-			// Cleanup: close all client channels
-			b.mu.Lock()
-			for client := range b.clients {
-				close(client)
+	for sub := range b.clients {
+		if !sub.topics[event.Topic] {
+			continue
+		}
+		select {
+		case sub.Events <- event:
+		default:
+			b.dropped++
+			select {
+			case sub.Missed <- struct{}{}:
+			default:
+				// Already signalled
 			}
-			b.clients = make(map[chan Event]bool)
-			b.mu.Unlock()
-			return
 		}
 	}
 }
 
-// Subscribe creates a new client channel and registers it with the broker
-func (b *Broker) Subscribe() chan Event {
-	client := make(chan Event, 5) // Buffer a few events per client
-	b.register <- client
-	return client
+// Skip records a change on the given topics, or on all topics if none are given, that was not
+// broadcast because no client was subscribed to receive it. It takes the next ID without an event,
+// so clients on those topics reconnecting with an earlier Last-Event-ID resync instead of being
+// told they are up to date.
+func (b *Broker) Skip(topics ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	if len(topics) == 0 {
+		b.skipped = b.lastID
+		clear(b.skippedOn)
+	}
+	for _, topic := range topics {
+		b.skippedOn[topic] = b.lastID
+	}
 }
 
-// Unsubscribe removes a client channel from the broker
-func (b *Broker) Unsubscribe(client chan Event) {
-	b.unregister <- client
+// Since returns the events on the subscription's topics broadcast after id, oldest first
+// Returns false if some events after id are no longer buffered, changes after id were skipped,
+// or id was not issued by this broker; the client then has to resync from current state.
+func (b *Broker) Since(sub *Subscription, id uint64) ([]Event, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if id > b.lastID || id < b.replayFrom || id < b.skipped {
+		return nil, false
+	}
+	for topic := range sub.topics {
+		if id < b.skippedOn[topic] {
+			return nil, false
+		}
+	}
+
+	var missed []Event
+	for _, event := range b.replay {
+		if event.ID > id && sub.topics[event.Topic] {
+			missed = append(missed, event)
+		}
+	}
+	return missed, true
 }
 
-// Broadcast sends an event to all connected clients
-func (b *Broker) Broadcast(event Event) {
-	select {
-	case b.broadcast <- event:
-	default:
-		// Broadcast channel is full, skip this event
+// LastID returns the ID of the most recently broadcast event
+func (b *Broker) LastID() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.lastID
+}
+
+// HasSubscribers returns true if any connected client is subscribed to topic
+// Publishers use it to skip rendering events that nobody would receive.
+func (b *Broker) HasSubscribers(topic string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.clients {
+		if sub.topics[topic] {
+			return true
+		}
 	}
+	return false
+}
+
+// Dropped returns the number of events that did not fit in a client's buffer since the broker was created
+// Clients catch up on dropped events from the replay buffer, or resync if they are gone.
+func (b *Broker) Dropped() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.dropped
 }
 
 // ClientCount returns the number of currently connected clients
@@ -104,5 +209,11 @@ func (b *Broker) ClientCount() int {
 
 // Close shuts down the broker and closes all client connections
 func (b *Broker) Close() {
-	close(b.done)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.clients {
+		close(sub.Events)
+	}
+	b.clients = make(map[*Subscription]bool)
 }
@@ -0,0 +1,188 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBroker_IDs verifies that broadcast events get increasing IDs following the subscriber's start
+func TestBroker_IDs(t *testing.T) {
+	b := NewBroker()
+	defer b.Close()
+
+	sub := b.Subscribe(TopicMachines)
+	b.Broadcast(Event{Topic: TopicMachines, Type: "a"})
+	b.Broadcast(Event{Topic: TopicMachines, Type: "b"})
+
+	first := <-sub.Events
+	second := <-sub.Events
+	assert.Equal(t, sub.Start+1, first.ID)
+	assert.Equal(t, sub.Start+2, second.ID)
+	assert.Equal(t, second.ID, b.LastID())
+}
+
+// TestBroker_Since verifies replay from the buffer and detection of gaps it cannot fill
+func TestBroker_Since(t *testing.T) {
+	b := NewBroker()
+	sub := b.Subscribe(TopicMachines)
+	start := b.LastID()
+	for i := 0; i < replaySize+10; i++ {
+		b.Broadcast(Event{Topic: TopicMachines, Type: "tick"})
+	}
+	last := b.LastID()
+
+	tests := []struct {
+		name      string
+		id        uint64
+		wantCount int
+		wantOK    bool
+	}{
+		{name: "up to date", id: last, wantCount: 0, wantOK: true},
+		{name: "recent", id: last - 3, wantCount: 3, wantOK: true},
+		{name: "oldest buffered", id: last - replaySize, wantCount: replaySize, wantOK: true},
+		{name: "evicted", id: start + 5, wantOK: false},
+		{name: "from the future", id: last + 1, wantOK: false},
+		{name: "from a previous run", id: 42, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missed, ok := b.Since(sub, tt.id)
+			assert.Equal(t, tt.wantOK, ok)
+			require.Len(t, missed, tt.wantCount)
+			for i, e := range missed {
+				assert.Equal(t, tt.id+uint64(i)+1, e.ID)
+			}
+		})
+	}
+}
+
+// TestBroker_Skip verifies that a skipped change makes clients from before it resync
+func TestBroker_Skip(t *testing.T) {
+	b := NewBroker()
+	sub := b.Subscribe(TopicMachines)
+	before := b.LastID()
+
+	b.Skip()
+	_, ok := b.Since(sub, before)
+	assert.False(t, ok, "a client from before the skip must resync")
+
+	b.Broadcast(Event{Topic: TopicMachines, Type: "tick"})
+	missed, ok := b.Since(sub, before+1)
+	require.True(t, ok, "a client that resynced at the skip can replay")
+	require.Len(t, missed, 1)
+	assert.Equal(t, before+2, missed[0].ID)
+}
+
+// TestBroker_SkipTopics verifies that a change skipped on some topics only resyncs clients on those topics
+func TestBroker_SkipTopics(t *testing.T) {
+	b := NewBroker()
+	machines := b.Subscribe(TopicMachines)
+	detail := b.Subscribe(TopicMachines, MachineTopic(7))
+	before := b.LastID()
+
+	b.Skip(MachineTopic(7))
+	_, ok := b.Since(detail, before)
+	assert.False(t, ok, "a client on the skipped topic must resync")
+	missed, ok := b.Since(machines, before)
+	assert.True(t, ok, "a client on other topics is still up to date")
+	assert.Empty(t, missed)
+	_, ok = b.Since(detail, before+1)
+	assert.True(t, ok)
+
+	// Skips are forgotten once evicting from the replay buffer forces a resync anyway
+	for i := 0; i < replaySize+1; i++ {
+		b.Broadcast(Event{Topic: TopicUsers, Type: "tick"})
+	}
+	assert.Empty(t, b.skippedOn)
+}
+
+// TestBroker_SlowClient verifies that a client with a full buffer is signalled instead of blocking the broadcast
+func TestBroker_SlowClient(t *testing.T) {
+	b := NewBroker()
+	defer b.Close()
+
+	sub := b.Subscribe(TopicMachines)
+	for i := 0; i < clientBuffer+3; i++ {
+		b.Broadcast(Event{Topic: TopicMachines, Type: "tick"})
+	}
+
+	select {
+	case <-sub.Missed:
+	default:
+		t.Fatal("expected the client to be signalled about missed events")
+	}
+	assert.Equal(t, uint64(3), b.Dropped())
+
+	// The events that did not fit are still available for replay
+	missed, ok := b.Since(sub, sub.Start+clientBuffer)
+	require.True(t, ok)
+	assert.Len(t, missed, 3)
+}
+
+// TestBroker_Topics verifies that clients only receive and replay events on their topics
+func TestBroker_Topics(t *testing.T) {
+	b := NewBroker()
+	defer b.Close()
+
+	machines := b.Subscribe(TopicMachines)
+	detail := b.Subscribe(MachineTopic(7))
+	assert.True(t, b.HasSubscribers(MachineTopic(7)))
+	assert.False(t, b.HasSubscribers(MachineTopic(8)))
+	assert.False(t, b.HasSubscribers(TopicUsers))
+
+	b.Broadcast(Event{Topic: TopicMachines, Type: "machineRows"})
+	b.Broadcast(Event{Topic: MachineTopic(7), Type: "machine"})
+
+	assert.Equal(t, "machineRows", (<-machines.Events).Type)
+	assert.Equal(t, "machine", (<-detail.Events).Type)
+	assert.Empty(t, machines.Events)
+	assert.Empty(t, detail.Events)
+
+	missed, ok := b.Since(detail, detail.Start)
+	require.True(t, ok)
+	require.Len(t, missed, 1)
+	assert.Equal(t, "machine", missed[0].Type)
+}
+
+// TestIsValidTopic verifies topic validation for fixed and per-object topics
+func TestIsValidTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  bool
+	}{
+		{TopicMachines, true},
+		{TopicUsers, true},
+		{TopicAlerts, true},
+		{TopicDashboard, true},
+		{MachineTopic(12), true},
+		{UserTopic(3), true},
+		{"machine/", false},
+		{"machine/abc", false},
+		{"user/-1", false},
+		{"nodes", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsValidTopic(tt.topic))
+		})
+	}
+}
+
+// TestBroker_Close verifies that closing the broker ends current and later subscriptions
+func TestBroker_Close(t *testing.T) {
+	b := NewBroker()
+	sub := b.Subscribe(TopicMachines)
+	b.Close()
+
+	_, ok := <-sub.Events
+	assert.False(t, ok)
+
+	_, ok = <-b.Subscribe(TopicMachines).Events
+	assert.False(t, ok)
+	assert.Equal(t, 0, b.ClientCount())
+}
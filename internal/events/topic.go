@@ -0,0 +1,40 @@
+package events
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Topics that pages subscribe to
+const (
+	TopicMachines  = "machines"  // Machines list
+	TopicUsers     = "users"     // Users list
+	TopicAlerts    = "alerts"    // Active alerts
+	TopicDashboard = "dashboard" // Dashboard tiles and recent events
+)
+
+// MachineTopic returns the topic for a single machine's detail page
+func MachineTopic(id uint64) string {
+	return "machine/" + strconv.FormatUint(id, 10)
+}
+
+// UserTopic returns the topic for a single user
+func UserTopic(id uint64) string {
+	return "user/" + strconv.FormatUint(id, 10)
+}
+
+// IsValidTopic returns true if topic is a known topic, or a per-machine or per-user topic
+func IsValidTopic(topic string) bool {
+	switch topic {
+	case TopicMachines, TopicUsers, TopicAlerts, TopicDashboard:
+		return true
+	}
+
+	for _, prefix := range []string{"machine/", "user/"} {
+		if id, ok := strings.CutPrefix(topic, prefix); ok {
+			_, err := strconv.ParseUint(id, 10, 64)
+			return err == nil
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/alerting"
+	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/events"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+)
+
+// silenceDuration is a selectable silence length
+type silenceDuration struct {
+	Value string
+	Label string
+}
+
+// silenceDurations are the selectable silence lengths, in display order
+var silenceDurations = []silenceDuration{
+	{"1h", "1 hour"},
+	{"4h", "4 hours"},
+	{"24h", "1 day"},
+	{"168h", "1 week"},
+}
+
+// maxSilenceDuration bounds silences created from the UI
+const maxSilenceDuration = 30 * 24 * time.Hour
+
+// AlertingHandler serves alert rule state and silences
+type AlertingHandler struct {
+	templates *template.Template
+	engine    *alerting.Engine // nil if alerts are not configured
+	broker    *events.Broker
+
+	lastLive string // Last alerts-live HTML rendered, owned by Observe
+}
+
+// NewAlertingHandler creates a new alerting handler
+// engine may be nil, in which case the page reports that alerts are disabled
+func NewAlertingHandler(tmpl *template.Template, engine *alerting.Engine, broker *events.Broker) *AlertingHandler {
+	return &AlertingHandler{
+		templates: tmpl,
+		engine:    engine,
+		broker:    broker,
+	}
+}
+
+// List handles GET /alerts - displays active alerts, silences and recently resolved alerts
+func (h *AlertingHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Active":           "alerts",
+		"Disabled":         h.engine == nil,
+		"SilenceDurations": silenceDurations,
+	}
+	if h.engine != nil {
+		maps.Copy(data, h.liveData())
+		data["Resolved"] = h.engine.Resolved()
+		data["Rules"] = h.engine.Rules()
+	}
+	data = auth.AddUserToTemplateData(r, data)
+
+	if err := executeTemplate(r.Context(), h.templates, w, "alerting.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Observe evaluates alert rules against a watcher update and pushes the alerts summary to
+// subscribed pages when it changed. It is subscribed to the watcher service in place of the engine.
+// A change with no alerts page open is skipped, so pages opened before it reload on reconnect.
+func (h *AlertingHandler) Observe(u watcher.Update) {
+	h.engine.Observe(u)
+
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, "alerts-live", h.liveData()); err != nil {
+		logger.Error("Error rendering alerts", "error", err)
+		return
+	}
+	if buf.String() == h.lastLive {
+		return
+	}
+	h.lastLive = buf.String()
+
+	if !h.broker.HasSubscribers(events.TopicAlerts) {
+		h.broker.Skip(events.TopicAlerts)
+		return
+	}
+
+	h.broker.Broadcast(events.Event{
+		Topic: events.TopicAlerts,
+		Type:  "alerts",
+		HTML:  h.lastLive,
+	})
+}
+
+// liveData returns the template data for the alerts-live partial
+func (h *AlertingHandler) liveData() map[string]interface{} {
+	active := h.engine.Active()
+	var firing int
+	for _, a := range active {
+		if a.State == alerting.StateFiring {
+			firing++
+		}
+	}
+
+	return map[string]interface{}{
+		"Alerts":           active,
+		"Firing":           firing,
+		"Pending":          len(active) - firing,
+		"Silences":         h.engine.Silences(),
+		"LastEvaluated":    h.engine.LastEvaluated(),
+		"SilenceDurations": silenceDurations,
+	}
+}
+
+// CreateSilence handles POST /alerts/silences - silences a rule, or one subject of a rule, for a duration
+func (h *AlertingHandler) CreateSilence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.engine == nil {
+		http.Error(w, "Alerts are not configured", http.StatusNotFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	duration, err := time.ParseDuration(r.FormValue("duration"))
+	if err != nil || duration <= 0 || duration > maxSilenceDuration {
+		http.Error(w, "Invalid silence duration", http.StatusBadRequest)
+		return
+	}
+
+	createdBy := ""
+	if user := auth.GetUser(r); user != nil {
+		createdBy = user.Name
+	}
+
+	now := time.Now()
+	_, err = h.engine.AddSilence(alerting.Silence{
+		Rule:      r.FormValue("rule"),
+		Subject:   strings.TrimSpace(r.FormValue("subject")),
+		Start:     now,
+		End:       now.Add(duration),
+		Comment:   strings.TrimSpace(r.FormValue("comment")),
+		CreatedBy: createdBy,
+	})
+	if err != nil {
+		http.Error(w, "Failed to create silence: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	redirect(w, r, "/alerts")
+}
+
+// ExpireSilence handles POST /alerts/silences/{id}/expire - ends a silence early
+func (h *AlertingHandler) ExpireSilence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.engine == nil {
+		http.Error(w, "Alerts are not configured", http.StatusNotFound)
+		return
+	}
+
+	// Extract silence ID from path: /alerts/silences/{id}/expire
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/alerts/silences/"), "/expire")
+	if err := h.engine.ExpireSilence(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	redirect(w, r, "/alerts")
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/backup"
+)
+
+// maxBundleUpload bounds uploaded backup bundles
+const maxBundleUpload = 32 << 20
+
+// BackupHandler exports the tailnet state as a backup bundle, and compares and restores bundles
+type BackupHandler struct {
+	templates *template.Template
+	client    backup.Client
+}
+
+// NewBackupHandler creates a new backup handler
+func NewBackupHandler(tmpl *template.Template, client backup.Client) *BackupHandler {
+	return &BackupHandler{
+		templates: tmpl,
+		client:    client,
+	}
+}
+
+// Show handles GET /backup - displays the backup and restore page
+func (h *BackupHandler) Show(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Active":      "backup",
+		"Version":     backup.FormatVersion,
+		"Restorables": backup.RestorableKinds,
+	}
+	data = auth.AddUserToTemplateData(r, data)
+
+	if err := executeTemplate(r.Context(), h.templates, w, "backup.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Download handles GET /backup/download - exports users, nodes, pre-auth key metadata and the policy
+func (h *BackupHandler) Download(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := backup.Collect(r.Context(), h.client, time.Now())
+	if err != nil {
+		http.Error(w, "Failed to back up: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Buffer the archive, so a failure is reported instead of sending a truncated download
+	var buf bytes.Buffer
+	if err := backup.Write(&buf, b); err != nil {
+		http.Error(w, "Failed to write backup: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", backup.Filename(b.CreatedAt)))
+	w.Write(buf.Bytes())
+}
+
+// Diff handles POST /backup/diff - shows what differs between an uploaded bundle and the server
+func (h *BackupHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RenderErrorWithStatus(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, changes, ok := h.compare(w, r)
+	if !ok {
+		return
+	}
+	h.renderResult(w, r, map[string]interface{}{
+		"Bundle":  b,
+		"Changes": changes,
+	})
+}
+
+// Restore handles POST /backup/restore - re-applies the selected kinds of change from an uploaded bundle
+func (h *BackupHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RenderErrorWithStatus(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, changes, ok := h.compare(w, r)
+	if !ok {
+		return
+	}
+	var kinds []string
+	for _, kind := range r.MultipartForm.Value["kind"] {
+		if !slices.Contains(backup.RestorableKinds, kind) {
+			RenderErrorWithStatus(w, "Invalid kind: "+template.HTMLEscapeString(kind), http.StatusBadRequest)
+			return
+		}
+		kinds = append(kinds, kind)
+	}
+	if len(kinds) == 0 {
+		RenderErrorWithStatus(w, "Select what to restore", http.StatusBadRequest)
+		return
+	}
+
+	applied, restoreErr := backup.Apply(r.Context(), h.client, changes, kinds)
+	logger.InfoContext(r.Context(), "Restored backup bundle", "created_at", b.CreatedAt, "kinds", kinds, "applied", len(applied), "error", restoreErr)
+
+	// Show what is left to restore
+	live, err := backup.Collect(r.Context(), h.client, time.Now())
+	if err != nil {
+		RenderErrorWithStatus(w, "Failed to read the server state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Bundle":   b,
+		"Changes":  backup.Diff(b, live),
+		"Restored": true,
+		"Applied":  applied,
+	}
+	if restoreErr != nil {
+		data["Error"] = restoreErr.Error()
+	}
+	h.renderResult(w, r, data)
+}
+
+// compare reads the uploaded bundle and diffs it against the server, writing an error response if either fails
+func (h *BackupHandler) compare(w http.ResponseWriter, r *http.Request) (*backup.Bundle, []backup.Change, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBundleUpload)
+	if err := r.ParseMultipartForm(maxBundleUpload); err != nil {
+		RenderErrorWithStatus(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	f, _, err := r.FormFile("bundle")
+	if err != nil {
+		RenderErrorWithStatus(w, "Choose a backup bundle", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	defer f.Close()
+
+	b, err := backup.Read(f)
+	if err != nil {
+		RenderErrorWithStatus(w, template.HTMLEscapeString(err.Error()), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	live, err := backup.Collect(r.Context(), h.client, time.Now())
+	if err != nil {
+		RenderErrorWithStatus(w, "Failed to read the server state: "+err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return b, backup.Diff(b, live), true
+}
+
+// renderResult renders the comparison shown below the restore form
+func (h *BackupHandler) renderResult(w http.ResponseWriter, r *http.Request, data map[string]interface{}) {
+	restorable := 0
+	for _, c := range data["Changes"].([]backup.Change) {
+		if c.Restorable {
+			restorable++
+		}
+	}
+	data["Restorable"] = restorable
+
+	if err := executeTemplate(r.Context(), h.templates, w, "backup-result", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
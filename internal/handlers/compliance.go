@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/compliance"
+)
+
+// ComplianceHandler serves the client version compliance report
+type ComplianceHandler struct {
+	templates       *template.Template
+	machinesHandler *MachinesHandler
+	policy          compliance.Policy
+}
+
+// NewComplianceHandler creates a new compliance handler
+func NewComplianceHandler(tmpl *template.Template, machinesHandler *MachinesHandler, policy compliance.Policy) *ComplianceHandler {
+	return &ComplianceHandler{
+		templates:       tmpl,
+		machinesHandler: machinesHandler,
+		policy:          policy,
+	}
+}
+
+// Report handles GET /compliance?format=csv|json - displays or exports machines grouped by client version
+func (h *ComplianceHandler) Report(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	machines, err := h.machinesHandler.FetchMachines(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to fetch machines: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	report := compliance.Build(machines, h.policy, now)
+	filename := fmt.Sprintf("hsadmin-compliance-%s", now.UTC().Format("20060102-150405"))
+
+	switch r.URL.Query().Get("format") {
+	case "":
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		if err := compliance.WriteCSV(w, report); err != nil {
+			logger.ErrorContext(r.Context(), "Error writing compliance CSV", "error", err)
+		}
+		return
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			logger.ErrorContext(r.Context(), "Error writing compliance JSON", "error", err)
+		}
+		return
+	default:
+		http.Error(w, "Invalid format: want csv or json", http.StatusBadRequest)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Active":        "compliance",
+		"Report":        report,
+		"PolicyEnabled": h.policy.Enabled(),
+	}
+	data = auth.AddUserToTemplateData(r, data)
+
+	if err := executeTemplate(r.Context(), h.templates, w, "compliance.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
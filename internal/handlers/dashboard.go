@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"sync"
+
+	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/events"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+)
+
+// dashboardRecentEvents is the number of recent tailnet changes shown on the dashboard
+const dashboardRecentEvents = 15
+
+// DashboardHandler serves the overview dashboard at /
+// Its state is kept up to date by the watcher service, so rendering it never calls Headscale.
+type DashboardHandler struct {
+	templates *template.Template
+	broker    *events.Broker
+
+	mu       sync.Mutex
+	summary  *watcher.Summary // nil until the first successful poll
+	status   watcher.Status
+	recent   []watcher.Event // Newest first
+	lastLive string          // Last dashboard-live HTML rendered
+}
+
+// NewDashboardHandler creates a new dashboard handler
+func NewDashboardHandler(tmpl *template.Template, broker *events.Broker) *DashboardHandler {
+	return &DashboardHandler{
+		templates: tmpl,
+		broker:    broker,
+	}
+}
+
+// Show handles GET / - displays tailnet counts, connection status and recent changes
+func (h *DashboardHandler) Show(w http.ResponseWriter, r *http.Request) {
+	// "/" matches every path no other route does
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.Lock()
+	data := h.liveData()
+	h.mu.Unlock()
+
+	data["Active"] = "dashboard"
+	data = auth.AddUserToTemplateData(r, data)
+
+	if err := executeTemplate(r.Context(), h.templates, w, "dashboard.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Observe summarizes a watcher update and pushes the dashboard to subscribed pages when it changed
+func (h *DashboardHandler) Observe(u watcher.Update) {
+	summary := watcher.Summarize(&u)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.summary = &summary
+	for _, e := range u.Events {
+		h.recent = append([]watcher.Event{e}, h.recent...)
+	}
+	if len(h.recent) > dashboardRecentEvents {
+		h.recent = h.recent[:dashboardRecentEvents]
+	}
+
+	h.broadcast()
+}
+
+// ObserveStatus records the outcome of the watcher's polls and pushes the dashboard to subscribed pages
+// It is registered with the watcher service's OnStatusChange.
+func (h *DashboardHandler) ObserveStatus(status watcher.Status) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status = status
+	h.broadcast()
+}
+
+// broadcast renders the dashboard-live partial and sends it if it changed, with h.mu held
+// A change with no dashboard open is skipped, so dashboards opened before it reload on reconnect.
+func (h *DashboardHandler) broadcast() {
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, "dashboard-live", h.liveData()); err != nil {
+		logger.Error("Error rendering dashboard", "error", err)
+		return
+	}
+	if buf.String() == h.lastLive {
+		return
+	}
+	h.lastLive = buf.String()
+
+	if !h.broker.HasSubscribers(events.TopicDashboard) {
+		h.broker.Skip(events.TopicDashboard)
+		return
+	}
+
+	h.broker.Broadcast(events.Event{
+		Topic: events.TopicDashboard,
+		Type:  "dashboard",
+		HTML:  h.lastLive,
+	})
+}
+
+// liveData returns the template data for the dashboard-live partial, with h.mu held
+// It only contains absolute times, so identical state renders identically and is not rebroadcast.
+func (h *DashboardHandler) liveData() map[string]interface{} {
+	return map[string]interface{}{
+		"Summary": h.summary,
+		"Status":  h.status,
+		"Recent":  h.recent,
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/models"
+	"tailscale.com/client/local"
+)
+
+// DERPHandler serves the DERP map explorer
+type DERPHandler struct {
+	templates       *template.Template
+	tsnetClient     *local.Client
+	machinesHandler *MachinesHandler
+}
+
+// NewDERPHandler creates a new DERP map handler
+func NewDERPHandler(tmpl *template.Template, tsClient *local.Client, machinesHandler *MachinesHandler) *DERPHandler {
+	return &DERPHandler{
+		templates:       tmpl,
+		tsnetClient:     tsClient,
+		machinesHandler: machinesHandler,
+	}
+}
+
+// Map handles GET /derp - displays the DERP map with home region usage and latency distribution
+func (h *DERPHandler) Map(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	derpMap, err := h.tsnetClient.CurrentDERPMap(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch DERP map: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	machines, err := h.machinesHandler.FetchMachines(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch machines: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	regions := models.SummarizeDERPMap(derpMap, machines)
+
+	var customRegions, homed int
+	for _, region := range regions {
+		if region.Custom {
+			customRegions++
+		}
+		homed += region.HomeCount
+	}
+
+	data := map[string]interface{}{
+		"Active":        "derp",
+		"Regions":       regions,
+		"CustomRegions": customRegions,
+		"Machines":      len(machines),
+		"UnknownHome":   len(machines) - homed,
+	}
+	if derpMap != nil {
+		data["OmitDefaultRegions"] = derpMap.OmitDefaultRegions
+	}
+	data = auth.AddUserToTemplateData(r, data)
+
+	if err := executeTemplate(r.Context(), h.templates, w, "derp.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
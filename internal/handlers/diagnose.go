@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/models"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"tailscale.com/tailcfg"
+)
+
+// Diagnostic ping settings
+const (
+	pingAttempts = 3               // Pings sent per type
+	pingTimeout  = 5 * time.Second // Wait for each reply
+)
+
+// diagnosePingTypes are the ping types run by a diagnosis, in order
+var diagnosePingTypes = []tailcfg.PingType{tailcfg.PingDisco, tailcfg.PingTSMP, tailcfg.PingICMP}
+
+// Diagnose handles POST /machines/{id}/diagnose
+// Returns the diagnostics panel in its running state; the panel connects to DiagnoseStream for results
+func (h *MachineActionsHandler) Diagnose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	machineID, err := extractMachineID(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid machine ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := executeTemplate(r.Context(), h.templates, w, "machine-diagnose", map[string]interface{}{
+		"MachineID": machineID,
+		"Running":   true,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// DiagnoseStream handles GET /machines/{id}/diagnose/stream
+// Pings the machine from the hsadmin node and streams each attempt as an SSE "attempt" event,
+// followed by a "done" event carrying the completed diagnostics panel
+func (h *MachineActionsHandler) DiagnoseStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	machineID, err := extractMachineID(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid machine ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	nodeResp, err := h.headscaleClient.GetNode(ctx, &headscale.GetNodeRequest{
+		NodeId: machineID,
+	})
+	if err != nil {
+		http.Error(w, "Failed to fetch node: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(nodeResp.Node.IpAddresses) == 0 {
+		http.Error(w, "Machine has no Tailscale IP", http.StatusBadRequest)
+		return
+	}
+	ip, err := netip.ParseAddr(nodeResp.Node.IpAddresses[0])
+	if err != nil {
+		http.Error(w, "Invalid machine IP: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
+
+	// The panel is swapped out on "done", which closes the stream; a long retry keeps the
+	// browser from re-running the diagnosis if the connection drops before that happens
+	fmt.Fprintf(w, "retry: %d\n\n", time.Hour.Milliseconds())
+	flusher.Flush()
+
+	logger.InfoContext(ctx, "Pinging machine", "machine_id", machineID, "ip", ip)
+
+	attempts := h.runPings(ctx, ip, func(attempt models.PingAttempt) {
+		var buf bytes.Buffer
+		if err := h.templates.ExecuteTemplate(&buf, "machine-diagnose-attempt", attempt); err != nil {
+			logger.ErrorContext(ctx, "Error rendering ping attempt", "error", err)
+			return
+		}
+		writeSSEEvent(w, 0, "attempt", buf.String())
+		flusher.Flush()
+	})
+	if ctx.Err() != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, "machine-diagnose", map[string]interface{}{
+		"MachineID": machineID,
+		"IP":        ip.String(),
+		"Attempts":  attempts,
+		"Summaries": models.SummarizePings(attempts),
+		"Finished":  time.Now(),
+	}); err != nil {
+		logger.ErrorContext(ctx, "Error rendering diagnosis", "error", err)
+		return
+	}
+	writeSSEEvent(w, 0, "done", buf.String())
+	flusher.Flush()
+}
+
+// runPings sends each diagnostic ping type in turn, reporting attempts as they complete.
+// Remaining attempts of a type are skipped after a timeout, since the peer is unlikely to answer them either.
+func (h *MachineActionsHandler) runPings(ctx context.Context, ip netip.Addr, report func(models.PingAttempt)) []models.PingAttempt {
+	var attempts []models.PingAttempt
+	for _, pingType := range diagnosePingTypes {
+		for seq := 1; seq <= pingAttempts; seq++ {
+			pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+			result, err := h.tsnetClient.Ping(pingCtx, ip, pingType)
+			timedOut := pingCtx.Err() == context.DeadlineExceeded
+			cancel()
+
+			if ctx.Err() != nil {
+				return attempts
+			}
+
+			attempt := models.NewPingAttempt(pingType, seq, result, err)
+			if timedOut {
+				attempt.Err = "timed out after " + pingTimeout.String()
+			}
+			attempts = append(attempts, attempt)
+			report(attempt)
+
+			if timedOut {
+				break
+			}
+		}
+	}
+	return attempts
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/models"
+	"tailscale.com/client/local"
+	"tailscale.com/ipn"
+	"tailscale.com/tailcfg"
+)
+
+// netMapTimeout bounds how long to wait for the initial netmap from the IPN bus
+const netMapTimeout = 5 * time.Second
+
+// DiagnosticsHandler serves the hsadmin node's own network report
+type DiagnosticsHandler struct {
+	templates   *template.Template
+	tsnetClient *local.Client
+}
+
+// NewDiagnosticsHandler creates a new diagnostics handler
+func NewDiagnosticsHandler(tmpl *template.Template, tsClient *local.Client) *DiagnosticsHandler {
+	return &DiagnosticsHandler{
+		templates:   tmpl,
+		tsnetClient: tsClient,
+	}
+}
+
+// Netcheck handles GET /diagnostics - displays the hsadmin node's network report
+// Only local tsnet state is used, so the page still works when Headscale is unreachable
+func (h *DiagnosticsHandler) Netcheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+
+	status, err := h.tsnetClient.StatusWithoutPeers(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch tsnet status: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Present the hsadmin node the same way as any other machine, so the report uses
+	// the same connectivity and latency fields as the machine detail page
+	self := &models.Machine{
+		PeerStatus: status.Self,
+		Online:     status.Self != nil && status.Self.Online,
+	}
+	selfNode, netMapErr := h.selfNode(ctx)
+	if selfNode != nil {
+		self.WhoIsNode = selfNode
+	}
+
+	// Fetch DERP map for region name lookups
+	derpMap, err := h.tsnetClient.CurrentDERPMap(ctx)
+	if err != nil {
+		// Continue - we'll show region IDs instead of names
+		derpMap = nil
+	}
+
+	var preferredDERP string
+	if id := self.HomeDERPRegionID(derpMap); id != 0 {
+		preferredDERP = derpRegionName(derpMap, id)
+	}
+
+	data := map[string]interface{}{
+		"Active":        "diagnostics",
+		"Status":        status,
+		"Self":          self,
+		"NetMapError":   netMapErr,
+		"PreferredDERP": preferredDERP,
+		"DERPLatencies": self.ProcessedDERPLatencies(derpMap),
+	}
+	if selfNode != nil && selfNode.Hostinfo.Valid() && selfNode.Hostinfo.NetInfo().Valid() {
+		netInfo := selfNode.Hostinfo.NetInfo()
+		data["HasNetInfo"] = true
+		data["LinkType"] = netInfo.LinkType()
+		data["HavePortMap"] = netInfo.HavePortMap()
+	}
+	data = auth.AddUserToTemplateData(r, data)
+
+	if err := executeTemplate(r.Context(), h.templates, w, "diagnostics.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// selfNode returns the hsadmin node as last reported in the netmap from the control server.
+// Returns nil without an error if no netmap has been received yet.
+func (h *DiagnosticsHandler) selfNode(ctx context.Context) (*tailcfg.Node, error) {
+	ctx, cancel := context.WithTimeout(ctx, netMapTimeout)
+	defer cancel()
+
+	watcher, err := h.tsnetClient.WatchIPNBus(ctx, ipn.NotifyInitialNetMap)
+	if err != nil {
+		return nil, err
+	}
+	defer watcher.Close()
+
+	// The first notification carries the current netmap, if there is one
+	n, err := watcher.Next()
+	if err != nil {
+		return nil, err
+	}
+	if n.NetMap == nil || !n.NetMap.SelfNode.Valid() {
+		return nil, nil
+	}
+	return n.NetMap.SelfNode.AsStruct(), nil
+}
+
+// derpRegionName returns a region's display name, falling back to its ID
+func derpRegionName(derpMap *tailcfg.DERPMap, id int) string {
+	if derpMap != nil {
+		if region, ok := derpMap.Regions[id]; ok && region.RegionName != "" {
+			return region.RegionName
+		}
+	}
+	return fmt.Sprintf("%d", id)
+}
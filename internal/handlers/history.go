@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/history"
+	"tailscale.com/client/local"
+)
+
+// historyWindow is a selectable time window for machine history
+type historyWindow struct {
+	Key      string
+	Label    string
+	Duration time.Duration
+}
+
+// historyWindows are the selectable time windows for machine history, in display order
+var historyWindows = []historyWindow{
+	{"24h", "24 hours", 24 * time.Hour},
+	{"7d", "7 days", 7 * 24 * time.Hour},
+	{"30d", "30 days", 30 * 24 * time.Hour},
+}
+
+// HistoryHandler serves recorded machine history
+type HistoryHandler struct {
+	templates      *template.Template
+	tsnetClient    *local.Client
+	store          *history.Store // nil if history recording is not configured
+	sampleInterval time.Duration  // Expected time between latency samples
+}
+
+// NewHistoryHandler creates a new history handler
+// store may be nil, in which case history endpoints report that history is disabled
+func NewHistoryHandler(tmpl *template.Template, tsClient *local.Client, store *history.Store, sampleInterval time.Duration) *HistoryHandler {
+	return &HistoryHandler{
+		templates:      tmpl,
+		tsnetClient:    tsClient,
+		store:          store,
+		sampleInterval: sampleInterval,
+	}
+}
+
+// Presence handles GET /machines/{id}/presence?window=24h|7d|30d
+// Returns an HTML fragment for HTMX requests and JSON when requested via the Accept header
+func (h *HistoryHandler) Presence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	machineID, err := extractMachineID(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid machine ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wantJSON := strings.Contains(r.Header.Get("Accept"), "application/json")
+
+	if h.store == nil {
+		if wantJSON {
+			http.Error(w, "History recording is not enabled", http.StatusNotFound)
+			return
+		}
+		h.render(w, r, "machine-presence", map[string]interface{}{
+			"MachineID": machineID,
+			"Disabled":  true,
+		})
+		return
+	}
+
+	window := selectHistoryWindow(r)
+	until := time.Now()
+	summary := h.store.Presence(machineID, until.Add(-window.Duration), until)
+
+	if wantJSON {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+		return
+	}
+
+	h.render(w, r, "machine-presence", map[string]interface{}{
+		"MachineID": machineID,
+		"Window":    window.Key,
+		"Windows":   historyWindows,
+		"Presence":  summary,
+	})
+}
+
+// Latency handles GET /machines/{id}/latency?window=24h|7d|30d
+// Returns DERP latency and connection path history as an HTML fragment, or JSON samples
+// when requested via the Accept header
+func (h *HistoryHandler) Latency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	machineID, err := extractMachineID(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid machine ID: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wantJSON := strings.Contains(r.Header.Get("Accept"), "application/json")
+
+	if h.store == nil {
+		if wantJSON {
+			http.Error(w, "History recording is not enabled", http.StatusNotFound)
+			return
+		}
+		h.render(w, r, "machine-latency", map[string]interface{}{
+			"MachineID": machineID,
+			"Disabled":  true,
+		})
+		return
+	}
+
+	window := selectHistoryWindow(r)
+	until := time.Now()
+	since := until.Add(-window.Duration)
+	samples := h.store.LatencySamples(machineID, since, until)
+
+	if wantJSON {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(samples)
+		return
+	}
+
+	// Fetch DERP map for region name lookups
+	// On error, fall back to showing region IDs
+	derpMap, err := h.tsnetClient.CurrentDERPMap(r.Context())
+	if err != nil {
+		derpMap = nil
+	}
+	regionName := func(id int) string { return derpRegionName(derpMap, id) }
+
+	summary := history.SummarizeLatency(machineID, samples, since, until, h.sampleInterval, regionName)
+
+	h.render(w, r, "machine-latency", map[string]interface{}{
+		"MachineID":   machineID,
+		"Window":      window.Key,
+		"Windows":     historyWindows,
+		"Latency":     summary,
+		"ChartWidth":  history.ChartWidth,
+		"ChartHeight": history.ChartHeight,
+	})
+}
+
+// selectHistoryWindow returns the window named by the "window" query parameter,
+// defaulting to the first (shortest) window
+func selectHistoryWindow(r *http.Request) historyWindow {
+	for _, candidate := range historyWindows {
+		if candidate.Key == r.URL.Query().Get("window") {
+			return candidate
+		}
+	}
+	return historyWindows[0]
+}
+
+// render executes a fragment template
+func (h *HistoryHandler) render(w http.ResponseWriter, r *http.Request, name string, data map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/html")
+	if err := executeTemplate(r.Context(), h.templates, w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
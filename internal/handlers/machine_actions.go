@@ -86,7 +86,7 @@ func (h *MachineActionsHandler) ApproveExitNode(w http.ResponseWriter, r *http.R
 	}
 
 	// Redirect back to machine detail page
-	http.Redirect(w, r, "/machines/"+strconv.FormatUint(machineID, 10), http.StatusSeeOther)
+	redirect(w, r, "/machines/"+strconv.FormatUint(machineID, 10))
 }
 
 // RejectExitNode handles POST /machines/{id}/routes/exit-node/reject
@@ -135,7 +135,7 @@ func (h *MachineActionsHandler) RejectExitNode(w http.ResponseWriter, r *http.Re
 	}
 
 	// Redirect back to machine detail page
-	http.Redirect(w, r, "/machines/"+strconv.FormatUint(machineID, 10), http.StatusSeeOther)
+	redirect(w, r, "/machines/"+strconv.FormatUint(machineID, 10))
 }
 
 // ApproveSubnetRoute handles POST /machines/{id}/routes/subnets/approve
@@ -219,7 +219,7 @@ func (h *MachineActionsHandler) ApproveSubnetRoute(w http.ResponseWriter, r *htt
 	}
 
 	// Redirect back to machine detail page
-	http.Redirect(w, r, "/machines/"+strconv.FormatUint(machineID, 10), http.StatusSeeOther)
+	redirect(w, r, "/machines/"+strconv.FormatUint(machineID, 10))
 }
 
 // RejectSubnetRoute handles POST /machines/{id}/routes/subnets/reject
@@ -280,7 +280,7 @@ func (h *MachineActionsHandler) RejectSubnetRoute(w http.ResponseWriter, r *http
 	}
 
 	// Redirect back to machine detail page
-	http.Redirect(w, r, "/machines/"+strconv.FormatUint(machineID, 10), http.StatusSeeOther)
+	redirect(w, r, "/machines/"+strconv.FormatUint(machineID, 10))
 }
 
 // MoveNode handles POST /machines/{id}/move - moves a machine to a different user
@@ -328,7 +328,7 @@ func (h *MachineActionsHandler) MoveNode(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Redirect back to machines list
-	http.Redirect(w, r, "/machines", http.StatusSeeOther)
+	redirect(w, r, "/machines")
 }
 
 // SetTags handles POST /machines/{id}/tags - sets tags on a machine
@@ -379,7 +379,7 @@ func (h *MachineActionsHandler) SetTags(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Redirect back to machines list
-	http.Redirect(w, r, "/machines", http.StatusSeeOther)
+	redirect(w, r, "/machines")
 }
 
 // DeleteNode handles POST /machines/{id}/delete - permanently deletes a machine
@@ -408,7 +408,7 @@ func (h *MachineActionsHandler) DeleteNode(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Redirect back to machines list
-	http.Redirect(w, r, "/machines", http.StatusSeeOther)
+	redirect(w, r, "/machines")
 }
 
 // ExpireNode handles POST /machines/{id}/expire - expires a machine's key
@@ -437,7 +437,7 @@ func (h *MachineActionsHandler) ExpireNode(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Redirect back to machines list
-	http.Redirect(w, r, "/machines", http.StatusSeeOther)
+	redirect(w, r, "/machines")
 }
 
 // Helper function to extract machine ID from URL path
@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/inventory"
 	"github.com/anupcshan/hsadmin/internal/models"
+	"github.com/anupcshan/hsadmin/internal/watcher"
 	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
 	"tailscale.com/client/local"
 )
@@ -29,7 +35,6 @@ func NewMachinesHandler(tmpl *template.Template, hsClient headscale.HeadscaleSer
 
 func (h *MachinesHandler) List(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	query := strings.ToLower(r.URL.Query().Get("query"))
 
 	// Fetch all machines
 	machines, err := h.FetchMachines(ctx)
@@ -45,8 +50,50 @@ func (h *MachinesHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	machines, err = filterMachines(machines, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Active":   "machines",
+		"Machines": machines,
+		"Users":    usersResp.Users,
+		"Query":    r.URL.Query().Get("query"),
+		"Filter":   r.URL.Query().Get("filter"),
+		"OS":       r.URL.Query().Get("os"),
+	}
+	data = auth.AddUserToTemplateData(r, data)
+
+	if err := executeTemplate(r.Context(), h.templates, w, "machines.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// filterMachines applies the machines list's query parameters: filter (a dashboard tile),
+// os, and the search query
+func filterMachines(machines []*models.Machine, params url.Values) ([]*models.Machine, error) {
+	// Filter by the dashboard tile before searching, so that "outdated" compares
+	// against the newest version in the whole tailnet
+	if filter := params.Get("filter"); filter != "" {
+		if !watcher.IsValidFilter(filter) {
+			return nil, fmt.Errorf("invalid filter: %s", filter)
+		}
+		machines = watcher.FilterMachines(machines, watcher.NewSnapshot(machines, nil, time.Now()), filter)
+	}
+	if osName := params.Get("os"); osName != "" {
+		filtered := []*models.Machine{}
+		for _, m := range machines {
+			if m.OS() == osName {
+				filtered = append(filtered, m)
+			}
+		}
+		machines = filtered
+	}
+
 	// Filter by search query
-	if query != "" {
+	if query := strings.ToLower(params.Get("query")); query != "" {
 		filtered := []*models.Machine{}
 		for _, m := range machines {
 			if strings.Contains(strings.ToLower(m.Hostname()), query) ||
@@ -57,17 +104,44 @@ func (h *MachinesHandler) List(w http.ResponseWriter, r *http.Request) {
 		}
 		machines = filtered
 	}
+	return machines, nil
+}
 
-	data := map[string]interface{}{
-		"Active":   "machines",
-		"Machines": machines,
-		"Users":    usersResp.Users,
+// Export handles GET /machines/export?format=csv|json|xlsx - downloads the machine inventory
+// The list's filter, os and query parameters apply, so the export matches what the list shows.
+func (h *MachinesHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
-	data = auth.AddUserToTemplateData(r, data)
 
-	if err := h.templates.ExecuteTemplate(w, "machines.html", data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	format := r.URL.Query().Get("format")
+	contentType := inventory.ContentType(format)
+	if contentType == "" {
+		http.Error(w, "Invalid format: want csv, json or xlsx", http.StatusBadRequest)
+		return
+	}
+
+	machines, err := h.FetchMachines(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to fetch machines: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	machines, err = filterMachines(machines, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Buffer the export, so a failure is reported instead of sending a truncated file
+	var buf bytes.Buffer
+	if err := inventory.Write(&buf, format, inventory.Records(machines)); err != nil {
+		http.Error(w, "Failed to export machines: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", inventory.Filename(time.Now(), format)))
+	w.Write(buf.Bytes())
 }
 
 // FetchMachines retrieves all machines from Headscale and enriches with tsnet data
@@ -195,7 +269,7 @@ func (h *MachinesHandler) Detail(w http.ResponseWriter, r *http.Request) {
 	}
 	data = auth.AddUserToTemplateData(r, data)
 
-	if err := h.templates.ExecuteTemplate(w, "machine_detail.html", data); err != nil {
+	if err := executeTemplate(r.Context(), h.templates, w, "machine_detail.html", data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
@@ -246,5 +320,5 @@ func (h *MachinesHandler) Rename(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Redirect back to machines list (HTMX will follow)
-	http.Redirect(w, r, "/machines", http.StatusSeeOther)
+	redirect(w, r, "/machines")
 }
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"io"
+
+	"github.com/anupcshan/hsadmin/internal/logging"
+	"github.com/anupcshan/hsadmin/internal/tracing"
+)
+
+var logger = logging.For("handlers")
+
+// executeTemplate renders the named template to w in its own span, so traces of slow pages
+// separate rendering from the Headscale and LocalAPI calls that fetched the data. Failures are logged.
+func executeTemplate(ctx context.Context, tmpl *template.Template, w io.Writer, name string, data any) error {
+	_, span := tracing.Start(ctx, "render "+name)
+	err := tmpl.ExecuteTemplate(w, name, data)
+	tracing.End(span, err)
+	if err != nil {
+		logger.ErrorContext(ctx, "Error rendering template", "template", name, "error", err)
+	}
+	return err
+}
+
+// TemplateFuncs returns the functions templates use to link within the tailnet being served and to
+// switch between tailnets, for a single tailnet served at /
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"base":     func() string { return "" }, // URL prefix of the tailnet's pages
+		"tailnet":  func() string { return "" },
+		"tailnets": func() []string { return nil }, // All tailnets, when there are several
+	}
+}
+
+// TailnetTemplates returns a copy of tmpl for one of several tailnets, linking within its pages and
+// listing every tailnet in the header. tmpl must not have been executed yet.
+func TailnetTemplates(tmpl *template.Template, name string, names []string) (*template.Template, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return clone.Funcs(template.FuncMap{
+		"base":     func() string { return TailnetPath(name) },
+		"tailnet":  func() string { return name },
+		"tailnets": func() []string { return names },
+	}), nil
+}
@@ -1,20 +1,53 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"strings"
 )
 
+// basePathKey is the context key for the URL prefix of the tailnet being served
+type basePathKey struct{}
+
+// TailnetPath returns the URL prefix of a tailnet's pages, when hsadmin serves several tailnets
+func TailnetPath(name string) string {
+	return "/t/" + name
+}
+
+// Mount serves a tailnet's routes under prefix
+// Handlers see paths without the prefix, and redirect to pages under it.
+func Mount(prefix string, h http.Handler) http.Handler {
+	h = http.StripPrefix(prefix, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), basePathKey{}, prefix)))
+	})
+}
+
+// redirect sends the client to path within the tailnet being served
+func redirect(w http.ResponseWriter, r *http.Request, path string) {
+	prefix, _ := r.Context().Value(basePathKey{}).(string)
+	http.Redirect(w, r, prefix+path, http.StatusSeeOther)
+}
+
 // SetupRoutes configures all HTTP routes for the application
 func SetupRoutes(
 	mux *http.ServeMux,
+	dashboardHandler *DashboardHandler,
 	machinesHandler *MachinesHandler,
 	machineActionsHandler *MachineActionsHandler,
 	usersHandler *UsersHandler,
 	sseHandler *SSEHandler,
+	historyHandler *HistoryHandler,
+	derpHandler *DERPHandler,
+	diagnosticsHandler *DiagnosticsHandler,
+	webhooksHandler *WebhooksHandler,
+	alertingHandler *AlertingHandler,
+	complianceHandler *ComplianceHandler,
+	backupHandler *BackupHandler,
 ) {
-	mux.HandleFunc("/", machinesHandler.List)
+	mux.HandleFunc("/", dashboardHandler.Show)
 	mux.HandleFunc("/machines", machinesHandler.List)
+	mux.HandleFunc("/machines/export", machinesHandler.Export)
 	mux.HandleFunc("/machines/", func(w http.ResponseWriter, r *http.Request) {
 		// Handle different machine actions based on URL path
 		path := r.URL.Path
@@ -28,6 +61,14 @@ func SetupRoutes(
 			machineActionsHandler.DeleteNode(w, r)
 		} else if strings.HasSuffix(path, "/expire") {
 			machineActionsHandler.ExpireNode(w, r)
+		} else if strings.HasSuffix(path, "/diagnose/stream") {
+			machineActionsHandler.DiagnoseStream(w, r)
+		} else if strings.HasSuffix(path, "/diagnose") {
+			machineActionsHandler.Diagnose(w, r)
+		} else if strings.HasSuffix(path, "/presence") {
+			historyHandler.Presence(w, r)
+		} else if strings.HasSuffix(path, "/latency") {
+			historyHandler.Latency(w, r)
 		} else if strings.HasSuffix(path, "/routes/exit-node/approve") {
 			machineActionsHandler.ApproveExitNode(w, r)
 		} else if strings.HasSuffix(path, "/routes/exit-node/reject") {
@@ -41,6 +82,30 @@ func SetupRoutes(
 		}
 	})
 	mux.HandleFunc("/events", sseHandler.HandleSSE)
+	mux.HandleFunc("/derp", derpHandler.Map)
+	mux.HandleFunc("/diagnostics", diagnosticsHandler.Netcheck)
+	mux.HandleFunc("/alerts", alertingHandler.List)
+	mux.HandleFunc("/alerts/silences", alertingHandler.CreateSilence)
+	mux.HandleFunc("/alerts/silences/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/expire") {
+			alertingHandler.ExpireSilence(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/compliance", complianceHandler.Report)
+	mux.HandleFunc("/backup", backupHandler.Show)
+	mux.HandleFunc("/backup/download", backupHandler.Download)
+	mux.HandleFunc("/backup/diff", backupHandler.Diff)
+	mux.HandleFunc("/backup/restore", backupHandler.Restore)
+	mux.HandleFunc("/webhooks", webhooksHandler.List)
+	mux.HandleFunc("/webhooks/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/test") {
+			webhooksHandler.SendTest(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+	})
 	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
 			usersHandler.Create(w, r)
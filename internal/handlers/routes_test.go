@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTemplates parses the web templates with the functions main provides
+func testTemplates(t *testing.T) *template.Template {
+	t.Helper()
+	funcMap := template.FuncMap{
+		"sub": func(a, b int) int { return a - b },
+		"mul": func(a, b float64) float64 { return a * b },
+	}
+	maps.Copy(funcMap, TemplateFuncs())
+	return template.Must(template.New("").Funcs(funcMap).ParseGlob("../../web/templates/*.html"))
+}
+
+// TestMount tests that a mounted tailnet's handlers see paths without its prefix and redirect
+// to pages under it
+func TestMount(t *testing.T) {
+	h := Mount(TailnetPath("office"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/users/1/delete", r.URL.Path)
+		redirect(w, r, "/users")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/t/office/users/1/delete", nil))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/t/office/users", rec.Header().Get("Location"))
+}
+
+// TestTailnetTemplates tests that a tailnet's templates link within its pages and show the
+// tailnet switcher, while the templates for a single tailnet do neither
+func TestTailnetTemplates(t *testing.T) {
+	tmpl := testTemplates(t)
+	office, err := TailnetTemplates(tmpl, "office", []string{"office", "lab"})
+	require.NoError(t, err)
+
+	data := map[string]any{"Active": "machines"}
+	var single, tailnet bytes.Buffer
+	require.NoError(t, tmpl.ExecuteTemplate(&single, "layout-header", data))
+	require.NoError(t, office.ExecuteTemplate(&tailnet, "layout-header", data))
+
+	assert.Contains(t, single.String(), `href="/machines"`)
+	assert.NotContains(t, single.String(), "tailnet-switcher")
+	assert.Contains(t, tailnet.String(), `href="/t/office/machines"`)
+	assert.Contains(t, tailnet.String(), `href="/t/lab/"`)
+	assert.Contains(t, tailnet.String(), "tailnet-switcher")
+}
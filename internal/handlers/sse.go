@@ -5,33 +5,23 @@ import (
 	"context"
 	"fmt"
 	"html/template"
-	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/anupcshan/hsadmin/internal/events"
+	"github.com/anupcshan/hsadmin/internal/logging"
 	"github.com/anupcshan/hsadmin/internal/models"
-	"github.com/anupcshan/hsadmin/internal/sets"
+	"github.com/anupcshan/hsadmin/internal/watcher"
 	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
 	"tailscale.com/client/local"
+	"tailscale.com/tailcfg"
 )
 
-// MachineState represents the state of a machine for change detection
-type MachineState struct {
-	ID              uint64
-	Online          bool
-	ApprovedRoutes  sets.Set[string]
-	ExitNodeEnabled bool
-	Tags            sets.Set[string]
-}
-
-// UserState represents the state of a user for change detection
-type UserState struct {
-	ID           uint64
-	Name         string
-	MachineCount int
-}
+var sseLogger = logging.For("sse")
 
 // SSEHandler handles Server-Sent Events for real-time updates
 type SSEHandler struct {
@@ -41,7 +31,12 @@ type SSEHandler struct {
 	broker          *events.Broker
 	machinesHandler *MachinesHandler
 	usersHandler    *UsersHandler
-	pollInterval    time.Duration
+
+	machineOrder []uint64          // Machine IDs in table order as of the last update, owned by HandleUpdate
+	detailHTML   map[uint64]string // Detail fragments last sent per viewed machine, owned by HandleUpdate
+
+	mu     sync.Mutex
+	latest *watcher.Update // Most recent update, rendered for clients that need a resync
 }
 
 // NewSSEHandler creates a new SSE handler
@@ -60,13 +55,14 @@ func NewSSEHandler(
 		broker:          broker,
 		machinesHandler: machinesHandler,
 		usersHandler:    usersHandler,
-		pollInterval:    500 * time.Millisecond,
 	}
 }
 
 // HandleSSE handles SSE connections
+// Every event carries its broker ID. A client reconnecting with Last-Event-ID, or falling behind,
+// is sent the events it missed from the broker's replay buffer, or a resync if they are gone.
 func (h *SSEHandler) HandleSSE(w http.ResponseWriter, r *http.Request) {
-	log.Printf("SSE: New client connected from %s", r.RemoteAddr)
+	sseLogger.InfoContext(r.Context(), "Client connected", "remote", r.RemoteAddr)
 
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -74,14 +70,26 @@ func (h *SSEHandler) HandleSSE(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
 
-	// Subscribe to events
-	clientChan := h.broker.Subscribe()
+	// Subscribe to the topics the page renders
+	topics := r.URL.Query()["topic"]
+	if len(topics) == 0 {
+		http.Error(w, "At least one topic is required", http.StatusBadRequest)
+		return
+	}
+	for _, topic := range topics {
+		if !events.IsValidTopic(topic) {
+			http.Error(w, "Unknown topic: "+topic, http.StatusBadRequest)
+			return
+		}
+	}
+
+	sub := h.broker.Subscribe(topics...)
 	defer func() {
-		h.broker.Unsubscribe(clientChan)
-		log.Printf("SSE: Client disconnected from %s", r.RemoteAddr)
+		h.broker.Unsubscribe(sub)
+		sseLogger.InfoContext(r.Context(), "Client disconnected", "remote", r.RemoteAddr)
 	}()
 
-	log.Printf("SSE: Client subscribed, total clients: %d", h.broker.ClientCount())
+	sseLogger.DebugContext(r.Context(), "Client subscribed", "topics", strings.Join(topics, ","), "clients", h.broker.ClientCount())
 
 	// Get flusher for streaming
 	flusher, ok := w.(http.Flusher)
@@ -93,191 +101,459 @@ func (h *SSEHandler) HandleSSE(w http.ResponseWriter, r *http.Request) {
 	// Send initial connection message
 	fmt.Fprintf(w, "data: {\"type\":\"connected\"}\n\n")
 	flusher.Flush()
-	log.Printf("SSE: Sent connection confirmation to client")
+	sseLogger.DebugContext(r.Context(), "Sent connection confirmation to client")
+
+	// lastID is the ID of the last event the client has seen
+	lastID := sub.Start
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			id = 0 // Never issued, so the client is resynced
+		}
+		lastID = h.catchUp(w, sub, id)
+		flusher.Flush()
+	}
 
 	// Stream events to client
 	for {
 		select {
-		case event := <-clientChan:
-			log.Printf("SSE: Broadcasting event type=%s to client", event.Type)
-			// Send event
-			fmt.Fprintf(w, "event: %s\n", event.Type)
-			// Split HTML into multiple data lines for proper SSE format
-			for _, line := range strings.Split(event.HTML, "\n") {
-				fmt.Fprintf(w, "data: %s\n", line)
+		case event, ok := <-sub.Events:
+			if !ok {
+				// Broker closed
+				return
+			}
+			if event.ID <= lastID {
+				// Already sent while catching up
+				continue
 			}
-			fmt.Fprintf(w, "\n")
+			writeSSEEvent(w, event.ID, event.Type, event.HTML)
+			lastID = event.ID
+			flusher.Flush()
+
+		case <-sub.Missed:
+			// Events did not fit in the client's buffer
+			lastID = h.catchUp(w, sub, lastID)
 			flusher.Flush()
-			log.Printf("SSE: Event sent and flushed")
 
 		case <-r.Context().Done():
 			// Client disconnected
-			log.Printf("SSE: Client context done")
+			sseLogger.DebugContext(r.Context(), "Client context done")
 			return
 		}
 	}
 }
 
-// StartPolling starts the polling loop for change detection
-// State is kept local to this function to prevent any possibility of concurrent access
-func (h *SSEHandler) StartPolling(ctx context.Context) {
-	ticker := time.NewTicker(h.pollInterval)
-	defer ticker.Stop()
+// catchUp sends the events on the client's topics broadcast after lastID, or a resync if they
+// are no longer buffered. Returns the ID of the last event the client has now seen.
+func (h *SSEHandler) catchUp(w http.ResponseWriter, sub *events.Subscription, lastID uint64) uint64 {
+	missed, ok := h.broker.Since(sub, lastID)
+	if !ok {
+		return h.resync(w, sub)
+	}
 
-	log.Printf("SSE: Starting polling loop (interval: %v)", h.pollInterval)
+	if len(missed) > 0 {
+		sseLogger.Debug("Replaying missed events to client", "events", len(missed))
+	}
+	for _, event := range missed {
+		writeSSEEvent(w, event.ID, event.Type, event.HTML)
+		lastID = event.ID
+	}
+	return lastID
+}
 
-	// State tracking for change detection - local to this goroutine
-	lastMachineStates := make(map[uint64]*MachineState)
-	lastUserStates := make(map[uint64]*UserState)
+// resync sends the full tables and machine details the client subscribed to, rendered from the latest watcher update,
+// followed by a resync event that pages showing other state can use to reload it. Returns the
+// broker's last event ID, which the resync event carries so the browser resumes from there.
+func (h *SSEHandler) resync(w http.ResponseWriter, sub *events.Subscription) uint64 {
+	sseLogger.Info("Client missed events that are no longer buffered, resyncing")
 
-	for {
-		select {
-		case <-ticker.C:
-			// Only poll if there are connected clients
-			clientCount := h.broker.ClientCount()
-			if clientCount == 0 {
-				continue
-			}
+	// Taken before rendering, so events broadcast meanwhile are still sent afterwards
+	lastID := h.broker.LastID()
 
-			// Fetch all data once
-			machines, err := h.machinesHandler.FetchMachines(ctx)
-			if err != nil {
-				log.Printf("SSE: Error fetching machines: %v", err)
-				continue
-			}
+	h.mu.Lock()
+	latest := h.latest
+	h.mu.Unlock()
 
-			usersResp, err := h.headscaleClient.ListUsers(ctx, &headscale.ListUsersRequest{})
-			if err != nil {
-				log.Printf("SSE: Error fetching users: %v", err)
+	if latest != nil && sub.Subscribed(events.TopicMachines) {
+		if event, err := h.renderMachinesTable(latest.Machines, latest.Users); err != nil {
+			sseLogger.Error("Error rendering machines table", "error", err)
+		} else {
+			writeSSEEvent(w, 0, event.Type, event.HTML)
+		}
+	}
+	if latest != nil && sub.Subscribed(events.TopicUsers) {
+		if event, err := h.renderUsersTable(latest.Machines, latest.Users); err != nil {
+			sseLogger.Error("Error rendering users table", "error", err)
+		} else {
+			writeSSEEvent(w, 0, event.Type, event.HTML)
+		}
+	}
+	if latest != nil {
+		for _, m := range latest.Machines {
+			if !sub.Subscribed(events.MachineTopic(m.ID())) {
 				continue
 			}
+			if html, err := h.renderMachineDetail(m, h.currentDERPMap()); err != nil {
+				sseLogger.Error("Error rendering machine detail", "error", err)
+			} else {
+				writeSSEEvent(w, 0, "machine", html)
+			}
+		}
+	}
 
-			// Derive machine counts per user
-			machineCounts := countMachinesPerUser(machines)
+	writeSSEEvent(w, lastID, "resync", "resync")
+	return lastID
+}
 
-			// Check for machine changes and update state
-			lastMachineStates = h.pollMachineChanges(ctx, machines, usersResp.Users, lastMachineStates)
+// writeSSEEvent writes a single named event, splitting HTML into multiple data lines for proper SSE format
+// An id of 0 omits the id field, leaving the browser's last event ID unchanged.
+func writeSSEEvent(w http.ResponseWriter, id uint64, eventType, html string) {
+	if id != 0 {
+		fmt.Fprintf(w, "id: %d\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\n", eventType)
+	for _, line := range strings.Split(html, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprintf(w, "\n")
+}
 
-			// Check for user changes and update state
-			lastUserStates = h.pollUserChanges(ctx, usersResp.Users, machineCounts, lastUserStates)
+// HandleUpdate broadcasts the table changes caused by a watcher update to connected clients
+// It is subscribed to the watcher service, so it is only ever called from one goroutine.
+func (h *SSEHandler) HandleUpdate(u watcher.Update) {
+	// Track row order even without clients, so the next row diff starts from the current table
+	h.mu.Lock()
+	h.latest = &u
+	h.mu.Unlock()
+
+	previousOrder := h.machineOrder
+	h.machineOrder = make([]uint64, len(u.Machines))
+	for i, m := range u.Machines {
+		h.machineOrder[i] = m.ID()
+	}
 
-		case <-ctx.Done():
-			log.Printf("SSE: Polling loop stopped")
-			return
+	// The first poll has nothing to compare against, and rendering is wasted without clients
+	if u.Baseline || h.broker.ClientCount() == 0 {
+		h.detailHTML = nil
+		if !u.Baseline && (len(u.Events) > 0 || len(u.ChangedNodes) > 0 || len(u.ChangedUsers) > 0) {
+			// Browsers reconnecting from before this change must resync rather than replay nothing
+			h.broker.Skip()
 		}
+		return
 	}
-}
 
-// detectMachineChanges compares states and returns true on first change detected
-func detectMachineChanges(current, previous map[uint64]*MachineState) bool {
-	// Check for new machines
-	for id := range current {
-		if _, exists := previous[id]; !exists {
-			log.Printf("SSE: Machine changes detected (new machine %d)", id)
-			return true
+	// Detail pages also show relay latencies, which change detection leaves out, so they are
+	// compared by rendered HTML instead
+	h.broadcastMachineDetailUpdates(u.Machines, u.ChangedNodes)
+
+	changedRows := make(map[uint64]bool)
+	changedUsers := make(map[string]bool) // By name; a user's row shows its machine count and status
+	var usersListChanged bool
+	for _, id := range u.ChangedNodes {
+		changedRows[id] = true
+		changedUsers[u.Snapshot.Nodes[id].User] = true
+	}
+	for _, id := range u.ChangedUsers {
+		changedUsers[u.Snapshot.Users[id].Name] = true
+	}
+	for _, e := range u.Events {
+		switch e.Type {
+		case watcher.NodeAdded, watcher.NodeRemoved:
+			// Rows are added and removed by diffing the row order; the user's machine count changes
+			changedUsers[e.Node.User] = true
+		case watcher.NodeUserChanged:
+			changedUsers[e.Previous] = true
+		case watcher.UserCreated, watcher.UserDeleted:
+			usersListChanged = true
 		}
 	}
 
-	// Check for deleted machines
-	for id := range previous {
-		if _, exists := current[id]; !exists {
-			log.Printf("SSE: Machine changes detected (deleted machine %d)", id)
-			return true
+	// Changes nobody is subscribed to are skipped, so pages opened before them resync on reconnect
+	if updates, ok := diffMachineRows(previousOrder, u.Machines, changedRows); !ok || len(updates) > 0 {
+		switch {
+		case !h.broker.HasSubscribers(events.TopicMachines):
+			h.broker.Skip(events.TopicMachines)
+		case !ok:
+			h.broadcastMachinesTableUpdate(u.Machines, u.Users)
+		default:
+			h.broadcastMachineRowUpdates(updates)
 		}
 	}
 
-	// Check for changes in existing machines
-	for id, curr := range current {
-		prev := previous[id] // Safe because new machines already returned above
-
-		if curr.Online != prev.Online {
-			log.Printf("SSE: Machine changes detected (machine %d online: %v -> %v)", id, prev.Online, curr.Online)
-			return true
+	if len(changedUsers) == 0 && !usersListChanged {
+		return
+	}
+	if h.broker.HasSubscribers(events.TopicUsers) {
+		h.broadcastUsersTableUpdate(u.Machines, u.Users)
+	} else {
+		h.broker.Skip(events.TopicUsers)
+	}
+	for _, user := range buildUserList(u.Users, u.Machines) {
+		if !changedUsers[user.Name()] {
+			continue
 		}
+		if topic := events.UserTopic(user.HeadscaleUser.Id); h.broker.HasSubscribers(topic) {
+			h.broadcastUserRowUpdate(user)
+		} else {
+			h.broker.Skip(topic)
+		}
+	}
+}
+
+// maxRowUpdates is the number of row updates above which the full machines table is sent instead
+const maxRowUpdates = 50
+
+// rowUpdateKind is the kind of change to a machines table row
+type rowUpdateKind int
+
+const (
+	rowAdded rowUpdateKind = iota
+	rowRemoved
+	rowChanged
+)
+
+// rowUpdate is a single change to the machines table
+type rowUpdate struct {
+	Kind    rowUpdateKind
+	ID      uint64
+	Machine *models.Machine // nil for removed rows
+	Before  uint64          // rowAdded: existing row to insert before, 0 to append
+}
+
+// diffMachineRows returns the row updates that turn a table showing previousOrder into one showing machines
+// Returns false if the table must be re-rendered instead: existing rows were reordered, the table became
+// or stopped being empty (it has no rows to patch), or there are more than maxRowUpdates updates.
+func diffMachineRows(previousOrder []uint64, machines []*models.Machine, changed map[uint64]bool) ([]rowUpdate, bool) {
+	if len(previousOrder) == 0 || len(machines) == 0 {
+		return nil, len(previousOrder) == len(machines)
+	}
 
-		if !curr.ApprovedRoutes.Equals(prev.ApprovedRoutes) ||
-			curr.ExitNodeEnabled != prev.ExitNodeEnabled {
-			log.Printf("SSE: Machine changes detected (machine %d routes changed)", id)
-			return true
+	previous := make(map[uint64]bool, len(previousOrder))
+	for _, id := range previousOrder {
+		previous[id] = true
+	}
+	current := make(map[uint64]bool, len(machines))
+	for _, m := range machines {
+		current[m.ID()] = true
+	}
+
+	// Rows present before and after must keep their relative order
+	var kept []uint64
+	for _, id := range previousOrder {
+		if current[id] {
+			kept = append(kept, id)
+		}
+	}
+	i := 0
+	for _, m := range machines {
+		if previous[m.ID()] {
+			if kept[i] != m.ID() {
+				return nil, false
+			}
+			i++
 		}
+	}
 
-		if !curr.Tags.Equals(prev.Tags) {
-			log.Printf("SSE: Machine changes detected (machine %d tags changed)", id)
-			return true
+	var updates []rowUpdate
+	for _, id := range previousOrder {
+		if !current[id] {
+			updates = append(updates, rowUpdate{Kind: rowRemoved, ID: id})
+		}
+	}
+	for i, m := range machines {
+		switch {
+		case !previous[m.ID()]:
+			// Insert before the next row that is already in the table
+			var before uint64
+			for _, next := range machines[i+1:] {
+				if previous[next.ID()] {
+					before = next.ID()
+					break
+				}
+			}
+			updates = append(updates, rowUpdate{Kind: rowAdded, ID: m.ID(), Machine: m, Before: before})
+		case changed[m.ID()]:
+			updates = append(updates, rowUpdate{Kind: rowChanged, ID: m.ID(), Machine: m})
 		}
 	}
 
-	return false
+	if len(updates) > maxRowUpdates {
+		return nil, false
+	}
+	return updates, true
 }
 
-// pollMachineChanges detects changes in machine state and broadcasts updates if changed
-// Returns the new state map to be used in the next poll cycle
-func (h *SSEHandler) pollMachineChanges(ctx context.Context, machines []*models.Machine, users []*headscale.User, previousStates map[uint64]*MachineState) map[uint64]*MachineState {
-	// Build current state map
-	currentStates := make(map[uint64]*MachineState)
-	for _, m := range machines {
-		currentStates[m.ID()] = &MachineState{
-			ID:              m.ID(),
-			Online:          m.Online,
-			ApprovedRoutes:  sets.FromSlice(m.ApprovedSubnets()),
-			ExitNodeEnabled: m.ExitNodeStatus() == "Approved",
-			Tags:            sets.FromSlice(m.Tags()),
+// broadcastMachineRowUpdates sends row updates as out-of-band swaps
+// Removed and changed rows are swapped by ID from a plain tbody in a machineRows event, which
+// filtered tables apply too, since they only touch rows already shown. Added rows go in a separate
+// machineRowsAdded event that only the unfiltered table listens to, each wrapped in its own tbody
+// whose children are inserted before the next existing row, or appended to the table.
+// Every element is a tbody so the fragment parses in table context.
+func (h *SSEHandler) broadcastMachineRowUpdates(updates []rowUpdate) {
+	sseLogger.Debug("Broadcasting machine row updates", "machines", len(updates))
+
+	var rows, added bytes.Buffer
+	for _, u := range updates {
+		switch u.Kind {
+		case rowRemoved:
+			fmt.Fprintf(&rows, `<tr id="machine-%d" hx-swap-oob="delete"></tr>`, u.ID)
+		case rowChanged:
+			if err := h.templates.ExecuteTemplate(&rows, "machine-row-oob", u.Machine); err != nil {
+				sseLogger.Error("Error rendering machine row", "error", err)
+				return
+			}
+		case rowAdded:
+			target := "beforeend:#machines-tbody"
+			if u.Before != 0 {
+				target = fmt.Sprintf("beforebegin:#machine-%d", u.Before)
+			}
+			fmt.Fprintf(&added, `<tbody hx-swap-oob="%s">`, target)
+			if err := h.templates.ExecuteTemplate(&added, "machine-row", u.Machine); err != nil {
+				sseLogger.Error("Error rendering machine row", "error", err)
+				return
+			}
+			added.WriteString("</tbody>")
 		}
 	}
 
-	// Detect and broadcast changes
-	if detectMachineChanges(currentStates, previousStates) {
-		h.broadcastMachinesTableUpdate(ctx, machines, users)
+	if rows.Len() > 0 {
+		h.broker.Broadcast(events.Event{
+			Topic: events.TopicMachines,
+			Type:  "machineRows",
+			HTML:  "<tbody>" + rows.String() + "</tbody>",
+		})
 	}
+	if added.Len() > 0 {
+		h.broker.Broadcast(events.Event{
+			Topic: events.TopicMachines,
+			Type:  "machineRowsAdded",
+			HTML:  added.String(),
+		})
+	}
+}
 
-	return currentStates
+// broadcastMachinesTableUpdate sends a full machine table update, used when rows cannot be patched in place
+func (h *SSEHandler) broadcastMachinesTableUpdate(machines []*models.Machine, users []*headscale.User) {
+	sseLogger.Debug("Broadcasting machines table update", "machines", len(machines))
+
+	event, err := h.renderMachinesTable(machines, users)
+	if err != nil {
+		sseLogger.Error("Error rendering machines table", "error", err)
+		return
+	}
+	h.broker.Broadcast(event)
 }
 
-// detectUserChanges compares states and returns true on first change detected
-func detectUserChanges(current, previous map[uint64]*UserState) bool {
-	// Check for new or deleted users
-	if len(current) != len(previous) {
-		log.Printf("SSE: User changes detected (count: %d -> %d)", len(previous), len(current))
-		return true
+// broadcastUsersTableUpdate sends a full user table update
+func (h *SSEHandler) broadcastUsersTableUpdate(machines []*models.Machine, users []*headscale.User) {
+	sseLogger.Debug("Broadcasting users table update", "users", len(users))
+
+	event, err := h.renderUsersTable(machines, users)
+	if err != nil {
+		sseLogger.Error("Error rendering users table", "error", err)
+		return
 	}
+	h.broker.Broadcast(event)
+}
 
-	// Check for changes in existing users
-	for id, curr := range current {
-		prev, exists := previous[id]
-		if !exists || curr.Name != prev.Name || curr.MachineCount != prev.MachineCount {
-			log.Printf("SSE: User changes detected (user %d)", id)
-			return true
-		}
+// broadcastUserRowUpdate sends a user's row to clients subscribed to that user
+func (h *SSEHandler) broadcastUserRowUpdate(user *models.User) {
+	var buf bytes.Buffer
+	if err := h.templates.ExecuteTemplate(&buf, "user-row", user); err != nil {
+		sseLogger.Error("Error rendering user row", "error", err)
+		return
 	}
 
-	return false
+	h.broker.Broadcast(events.Event{
+		Topic: events.UserTopic(user.HeadscaleUser.Id),
+		Type:  "user",
+		HTML:  buf.String(),
+	})
+}
+
+// detailFragments are the parts of the machine detail page that are replaced when the machine changes
+var detailFragments = []struct {
+	ID       string // Element ID on the page
+	Template string
+}{
+	{"machine-header", "machine-detail-header"},
+	{"machine-routes", "machine-detail-routes"},
+	{"machine-info", "machine-detail-info"},
 }
 
-// pollUserChanges detects changes in user state and broadcasts updates if changed
-// Returns the new state map to be used in the next poll cycle
-func (h *SSEHandler) pollUserChanges(ctx context.Context, users []*headscale.User, machineCounts map[string]int, previousStates map[uint64]*UserState) map[uint64]*UserState {
-	// Build current state map
-	currentStates := make(map[uint64]*UserState)
-	for _, user := range users {
-		currentStates[user.Id] = &UserState{
-			ID:           user.Id,
-			Name:         user.Name,
-			MachineCount: machineCounts[user.Name],
+// broadcastMachineDetailUpdates sends the detail fragments of each viewed machine whose rendering changed
+// Changes to machines nobody views are skipped, so their detail pages resync on reconnect.
+func (h *SSEHandler) broadcastMachineDetailUpdates(machines []*models.Machine, changed []uint64) {
+	previous := h.detailHTML
+	h.detailHTML = make(map[uint64]string)
+
+	var derpMap *tailcfg.DERPMap
+	var fetchedDERPMap bool
+	for _, m := range machines {
+		topic := events.MachineTopic(m.ID())
+		if !h.broker.HasSubscribers(topic) {
+			if slices.Contains(changed, m.ID()) {
+				h.broker.Skip(topic)
+			}
+			continue
+		}
+
+		// Fetch DERP map for region name lookups, once per update and only for viewed machines
+		if !fetchedDERPMap {
+			derpMap = h.currentDERPMap()
+			fetchedDERPMap = true
+		}
+
+		html, err := h.renderMachineDetail(m, derpMap)
+		if err != nil {
+			sseLogger.Error("Error rendering machine detail", "error", err)
+			continue
+		}
+		h.detailHTML[m.ID()] = html
+		if html == previous[m.ID()] {
+			continue
 		}
+
+		h.broker.Broadcast(events.Event{
+			Topic: topic,
+			Type:  "machine",
+			HTML:  html,
+		})
 	}
+}
 
-	// Detect and broadcast changes
-	if detectUserChanges(currentStates, previousStates) {
-		h.broadcastUsersTableUpdate(ctx, users)
+// renderMachineDetail renders a machine's detail fragments as out-of-band swaps of their page elements
+func (h *SSEHandler) renderMachineDetail(m *models.Machine, derpMap *tailcfg.DERPMap) (string, error) {
+	data := map[string]interface{}{
+		"Machine":       m,
+		"DERPLatencies": m.ProcessedDERPLatencies(derpMap),
 	}
 
-	return currentStates
+	var buf bytes.Buffer
+	for _, fragment := range detailFragments {
+		fmt.Fprintf(&buf, `<div id="%s" hx-swap-oob="true">`, fragment.ID)
+		if err := h.templates.ExecuteTemplate(&buf, fragment.Template, data); err != nil {
+			return "", err
+		}
+		buf.WriteString("</div>")
+	}
+	return buf.String(), nil
 }
 
-// broadcastMachinesTableUpdate sends a full machine table update
-func (h *SSEHandler) broadcastMachinesTableUpdate(ctx context.Context, machines []*models.Machine, users []*headscale.User) {
-	log.Printf("SSE: Broadcasting machines table update (%d machines)", len(machines))
+// currentDERPMap returns the DERP map, or nil if it is unavailable; region IDs are shown instead of names
+func (h *SSEHandler) currentDERPMap() *tailcfg.DERPMap {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
+	derpMap, err := h.tsnetClient.CurrentDERPMap(ctx)
+	if err != nil {
+		return nil
+	}
+	return derpMap
+}
+
+// renderMachinesTable renders the full machines table event
+func (h *SSEHandler) renderMachinesTable(machines []*models.Machine, users []*headscale.User) (events.Event, error) {
 	var buf bytes.Buffer
 	data := map[string]interface{}{
 		"Machines": machines,
@@ -285,49 +561,30 @@ func (h *SSEHandler) broadcastMachinesTableUpdate(ctx context.Context, machines
 	}
 
 	if err := h.templates.ExecuteTemplate(&buf, "machines-table", data); err != nil {
-		log.Printf("SSE: Error rendering machines table: %v", err)
-		return
+		return events.Event{}, err
 	}
 
-	html := buf.String()
-	log.Printf("SSE: Generated HTML update (%d bytes)", len(html))
-
-	h.broker.Broadcast(events.Event{
-		Type: "machinesTable",
-		HTML: html,
-	})
-
-	log.Printf("SSE: Broadcast complete")
+	return events.Event{
+		Topic: events.TopicMachines,
+		Type:  "machinesTable",
+		HTML:  buf.String(),
+	}, nil
 }
 
-// broadcastUsersTableUpdate sends a full user table update
-func (h *SSEHandler) broadcastUsersTableUpdate(ctx context.Context, users []*headscale.User) {
-	log.Printf("SSE: Broadcasting users table update (%d users)", len(users))
-
+// renderUsersTable renders the full users table event
+func (h *SSEHandler) renderUsersTable(machines []*models.Machine, users []*headscale.User) (events.Event, error) {
 	var buf bytes.Buffer
 	data := map[string]interface{}{
-		"Users": users,
+		"Users": buildUserList(users, machines),
 	}
 
 	if err := h.templates.ExecuteTemplate(&buf, "users-table", data); err != nil {
-		log.Printf("SSE: Error rendering users table: %v", err)
-		return
+		return events.Event{}, err
 	}
 
-	html := fmt.Sprintf(`<div id="users-table" hx-swap-oob="true">%s</div>`, buf.String())
-
-	h.broker.Broadcast(events.Event{
-		Type: "usersTable",
-		HTML: html,
-	})
-}
-
-// Helper functions
-
-func countMachinesPerUser(machines []*models.Machine) map[string]int {
-	counts := make(map[string]int)
-	for _, m := range machines {
-		counts[m.User()]++
-	}
-	return counts
+	return events.Event{
+		Topic: events.TopicUsers,
+		Type:  "usersTable",
+		HTML:  buf.String(),
+	}, nil
 }
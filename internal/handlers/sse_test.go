@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/anupcshan/hsadmin/internal/events"
+	"github.com/anupcshan/hsadmin/internal/models"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/client/local"
+)
+
+// testMachine returns a machine with just enough state to render its row
+func testMachine(id uint64, name string) *models.Machine {
+	return &models.Machine{Node: &headscale.Node{Id: id, GivenName: name, User: &headscale.User{Id: 1, Name: "alice"}}}
+}
+
+// TestBroadcastMachineRowUpdates tests that added rows are sent apart from changed and removed rows
+func TestBroadcastMachineRowUpdates(t *testing.T) {
+	broker := events.NewBroker()
+	defer broker.Close()
+	sub := broker.Subscribe(events.TopicMachines)
+	h := &SSEHandler{templates: testTemplates(t), broker: broker}
+
+	updates, ok := diffMachineRows([]uint64{1, 2}, []*models.Machine{testMachine(1, "router"), testMachine(3, "phone")}, map[uint64]bool{1: true})
+	require.True(t, ok)
+	h.broadcastMachineRowUpdates(updates)
+
+	rows := <-sub.Events
+	assert.Equal(t, "machineRows", rows.Type)
+	assert.Contains(t, rows.HTML, `<tr id="machine-2" hx-swap-oob="delete">`)
+	assert.Contains(t, rows.HTML, `id="machine-1"`)
+	assert.NotContains(t, rows.HTML, "machine-3", "added rows must not reach filtered tables")
+
+	added := <-sub.Events
+	assert.Equal(t, "machineRowsAdded", added.Type)
+	assert.Contains(t, added.HTML, `<tbody hx-swap-oob="beforeend:#machines-tbody">`)
+	assert.Contains(t, added.HTML, `id="machine-3"`)
+	assert.NotContains(t, added.HTML, "machine-1")
+
+	// Only removals: no empty machineRowsAdded event
+	h.broadcastMachineRowUpdates([]rowUpdate{{Kind: rowRemoved, ID: 3}})
+	assert.Equal(t, "machineRows", (<-sub.Events).Type)
+	assert.Empty(t, sub.Events)
+}
+
+// TestMachinesPage_LiveUpdateSubscriptions tests that a filtered or searched machines list does not take
+// added rows or full table updates, which would show machines that do not match
+func TestMachinesPage_LiveUpdateSubscriptions(t *testing.T) {
+	tmpl := testTemplates(t)
+	tests := []struct {
+		name      string
+		data      map[string]interface{}
+		wantAdded bool
+		wantTable bool
+	}{
+		{name: "unfiltered", data: map[string]interface{}{}, wantAdded: true, wantTable: true},
+		{name: "dashboard filter", data: map[string]interface{}{"Filter": "offline"}},
+		{name: "os", data: map[string]interface{}{"OS": "linux"}},
+		{name: "search", data: map[string]interface{}{"Query": "router"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.data["Machines"] = []*models.Machine{testMachine(1, "router")}
+
+			var buf bytes.Buffer
+			require.NoError(t, tmpl.ExecuteTemplate(&buf, "machines-content", tt.data))
+			page := buf.String()
+
+			assert.Equal(t, tt.wantAdded, strings.Contains(page, `sse-swap="machineRowsAdded"`))
+			assert.Equal(t, tt.wantTable, strings.Contains(page, `sse-swap="machinesTable"`))
+			assert.Contains(t, page, `sse-swap="machineRows"`, "rows already shown are always kept up to date")
+		})
+	}
+}
+
+// reconnect opens an SSE connection as a browser resuming from lastID and returns what it is sent
+// before the connection is closed
+func reconnect(h *SSEHandler, topic string, lastID uint64) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Return as soon as the catch up is written
+
+	req := httptest.NewRequest("GET", "/events?topic="+topic, nil).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(lastID, 10))
+	rec := httptest.NewRecorder()
+	h.HandleSSE(rec, req)
+	return rec.Body.String()
+}
+
+// TestHandleUpdate_ResyncAfterChangeWithoutClients tests that a change made while no browser was connected
+// resyncs browsers reconnecting from before it, and that an update without changes does not
+func TestHandleUpdate_ResyncAfterChangeWithoutClients(t *testing.T) {
+	broker := events.NewBroker()
+	defer broker.Close()
+	h := &SSEHandler{templates: testTemplates(t), broker: broker}
+	machines := []*models.Machine{testMachine(1, "router")}
+
+	h.HandleUpdate(watcher.Update{Machines: machines, Baseline: true})
+	lastID := broker.LastID()
+
+	h.HandleUpdate(watcher.Update{Machines: machines})
+	assert.NotContains(t, reconnect(h, events.TopicMachines, lastID), "event: resync")
+
+	h.HandleUpdate(watcher.Update{Machines: machines, ChangedNodes: []uint64{1}})
+	body := reconnect(h, events.TopicMachines, lastID)
+	assert.Contains(t, body, "event: resync")
+	assert.Contains(t, body, `id="machine-1"`)
+}
+
+// TestHandleUpdate_ResyncAfterChangeWithoutSubscribers tests that a change on a topic nobody was subscribed to
+// resyncs pages on that topic reconnecting from before it, while other pages replay as usual
+func TestHandleUpdate_ResyncAfterChangeWithoutSubscribers(t *testing.T) {
+	broker := events.NewBroker()
+	defer broker.Close()
+	// Without a LocalAPI, detail pages render relay region IDs
+	tsClient := &local.Client{Dial: func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("no LocalAPI")
+	}}
+	h := &SSEHandler{templates: testTemplates(t), tsnetClient: tsClient, broker: broker}
+	machines := []*models.Machine{testMachine(1, "router")}
+
+	h.HandleUpdate(watcher.Update{Machines: machines, Baseline: true})
+	sub := broker.Subscribe(events.TopicMachines)
+	defer broker.Unsubscribe(sub)
+	lastID := broker.LastID()
+
+	h.HandleUpdate(watcher.Update{
+		Snapshot:     &watcher.Snapshot{Nodes: map[uint64]watcher.NodeState{1: {ID: 1, User: "alice"}}},
+		Machines:     machines,
+		ChangedNodes: []uint64{1},
+	})
+
+	body := reconnect(h, events.TopicMachines, lastID)
+	assert.NotContains(t, body, "event: resync")
+	assert.Contains(t, body, "event: machineRows")
+	assert.Contains(t, reconnect(h, events.MachineTopic(1), lastID), "event: resync")
+	assert.Contains(t, reconnect(h, events.TopicUsers, lastID), "event: resync")
+	assert.NotContains(t, reconnect(h, events.MachineTopic(2), lastID), "event: resync")
+}
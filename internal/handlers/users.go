@@ -49,7 +49,7 @@ func (h *UsersHandler) List(w http.ResponseWriter, r *http.Request) {
 	}
 	data = auth.AddUserToTemplateData(r, data)
 
-	if err := h.templates.ExecuteTemplate(w, "users_list.html", data); err != nil {
+	if err := executeTemplate(r.Context(), h.templates, w, "users_list.html", data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
@@ -85,7 +85,7 @@ func (h *UsersHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Redirect back to users list
-	http.Redirect(w, r, "/users", http.StatusSeeOther)
+	redirect(w, r, "/users")
 }
 
 // Rename handles POST /users/{id}/rename - renames a user
@@ -134,7 +134,7 @@ func (h *UsersHandler) Rename(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Redirect back to users list (HTMX will follow)
-	http.Redirect(w, r, "/users", http.StatusSeeOther)
+	redirect(w, r, "/users")
 }
 
 // Delete handles DELETE /users/{id} - deletes a user
@@ -179,14 +179,14 @@ func (h *UsersHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		}
 		data = auth.AddUserToTemplateData(r, data)
 
-		if err := h.templates.ExecuteTemplate(w, "users_list.html", data); err != nil {
+		if err := executeTemplate(r.Context(), h.templates, w, "users_list.html", data); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 		return
 	}
 
 	// Redirect back to users list (HTMX will follow)
-	http.Redirect(w, r, "/users", http.StatusSeeOther)
+	redirect(w, r, "/users")
 }
 
 // CreatePreAuthKey handles POST /users/{id}/preauth-keys - creates a pre-auth key for a user
@@ -292,6 +292,12 @@ func (h *UsersHandler) fetchUsersWithMachineCounts(ctx context.Context) ([]*mode
 		return nil, err
 	}
 
+	return buildUserList(usersResp.Users, machines), nil
+}
+
+// buildUserList enriches Headscale users with machine counts and last seen info
+// Shared with the SSE handler, which renders the users table from watcher updates.
+func buildUserList(hsUsers []*headscale.User, machines []*models.Machine) []*models.User {
 	// Group machines by user name for efficient lookup
 	machinesByUser := make(map[string][]*models.Machine)
 	for _, m := range machines {
@@ -301,7 +307,7 @@ func (h *UsersHandler) fetchUsersWithMachineCounts(ctx context.Context) ([]*mode
 
 	// Build user list with machine counts and last seen info
 	var users []*models.User
-	for _, hsUser := range usersResp.Users {
+	for _, hsUser := range hsUsers {
 		user := &models.User{
 			HeadscaleUser:       hsUser,
 			MachineCount:        0,
@@ -332,7 +338,7 @@ func (h *UsersHandler) fetchUsersWithMachineCounts(ctx context.Context) ([]*mode
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users
 }
 
 // parseUserID parses a user ID string to uint64
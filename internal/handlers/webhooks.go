@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+	"github.com/anupcshan/hsadmin/internal/webhook"
+)
+
+// WebhooksHandler serves webhook endpoint status and the delivery log
+type WebhooksHandler struct {
+	templates  *template.Template
+	dispatcher *webhook.Dispatcher // nil if webhooks are not configured
+}
+
+// NewWebhooksHandler creates a new webhooks handler
+// dispatcher may be nil, in which case the page reports that webhooks are disabled
+func NewWebhooksHandler(tmpl *template.Template, dispatcher *webhook.Dispatcher) *WebhooksHandler {
+	return &WebhooksHandler{
+		templates:  tmpl,
+		dispatcher: dispatcher,
+	}
+}
+
+// List handles GET /webhooks - displays configured endpoints and recent deliveries
+func (h *WebhooksHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Active":     "webhooks",
+		"Disabled":   h.dispatcher == nil,
+		"EventTypes": slices.Concat(watcher.EventTypes, watcher.AlertEventTypes),
+	}
+	if h.dispatcher != nil {
+		data["Endpoints"] = h.dispatcher.Endpoints()
+		data["Deliveries"] = h.dispatcher.Log().Entries()
+	}
+	data = auth.AddUserToTemplateData(r, data)
+
+	if err := executeTemplate(r.Context(), h.templates, w, "webhooks.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// SendTest handles POST /webhooks/{name}/test - queues a test event for one endpoint
+func (h *WebhooksHandler) SendTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.dispatcher == nil {
+		RenderErrorWithStatus(w, "Webhooks are not configured", http.StatusNotFound)
+		return
+	}
+
+	// Extract endpoint name from path: /webhooks/{name}/test
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/webhooks/"), "/test")
+	if err := h.dispatcher.SendTest(name); err != nil {
+		RenderErrorWithStatus(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	RenderSuccess(w, "Test event queued for "+name+". Refresh to see the delivery result.")
+}
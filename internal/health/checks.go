@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/ipnstate"
+)
+
+// UserLister is the part of the Headscale client used by HeadscaleCheck
+type UserLister interface {
+	ListUsers(ctx context.Context, in *headscale.ListUsersRequest, opts ...grpc.CallOption) (*headscale.ListUsersResponse, error)
+}
+
+// StatusClient is the part of the tsnet LocalAPI client used by TailscaleCheck
+type StatusClient interface {
+	StatusWithoutPeers(ctx context.Context) (*ipnstate.Status, error)
+}
+
+// HeadscaleCheck checks that the Headscale gRPC API is reachable and accepts the API key,
+// by looking up the user hsadmin's tsnet node is registered under
+func HeadscaleCheck(client UserLister, agentUserID uint64) Check {
+	return Check{
+		Name: "headscale",
+		Run: func(ctx context.Context) (string, error) {
+			resp, err := client.ListUsers(ctx, &headscale.ListUsersRequest{Id: agentUserID})
+			switch status.Code(err) {
+			case codes.OK:
+			case codes.Unauthenticated, codes.PermissionDenied:
+				return "", fmt.Errorf("API key rejected: %s", status.Convert(err).Message())
+			default:
+				return "", fmt.Errorf("API unreachable: %w", err)
+			}
+			if len(resp.GetUsers()) == 0 {
+				return "", fmt.Errorf("agent user %d not found", agentUserID)
+			}
+			return "API key valid", nil
+		},
+	}
+}
+
+// TailscaleCheck checks that hsadmin's tsnet node is running and logged in to the tailnet
+// It is a live check: a node stuck logged out does not recover without a restart.
+func TailscaleCheck(client StatusClient) Check {
+	return Check{
+		Name: "tsnet",
+		Live: true,
+		Run: func(ctx context.Context) (string, error) {
+			st, err := client.StatusWithoutPeers(ctx)
+			if err != nil {
+				return "", fmt.Errorf("LocalAPI: %w", err)
+			}
+			if st.BackendState != ipn.Running.String() {
+				return "", fmt.Errorf("node is %s, not %s", st.BackendState, ipn.Running)
+			}
+			if st.Self == nil || len(st.Self.TailscaleIPs) == 0 {
+				return "", errors.New("node is not logged in")
+			}
+			return fmt.Sprintf("Running as %s (%s)", strings.TrimSuffix(st.Self.DNSName, "."), st.Self.TailscaleIPs[0]), nil
+		},
+	}
+}
+
+// OIDCCheck checks that the OIDC provider's discovery document can be fetched
+// initialized reports whether the authenticator was set up at startup; if not, OIDC logins
+// stay unavailable until hsadmin is restarted.
+func OIDCCheck(providerURL string, initialized bool) Check {
+	return Check{
+		Name: "oidc",
+		Run: func(ctx context.Context) (string, error) {
+			if !initialized {
+				return "", errors.New("authenticator failed to initialize at startup, restart hsadmin once the provider is reachable")
+			}
+			if _, err := oidc.NewProvider(ctx, providerURL); err != nil {
+				return "", fmt.Errorf("discovery failed: %w", err)
+			}
+			return "Discovered " + providerURL, nil
+		},
+	}
+}
@@ -0,0 +1,194 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// checkTimeout bounds each check, so a hung dependency fails the probe instead of stalling it
+	checkTimeout = 5 * time.Second
+
+	// cacheTTL is how long a report is reused, so frequent probes from several load balancers
+	// and orchestrators do not each call Headscale and the OIDC provider
+	cacheTTL = 5 * time.Second
+)
+
+// Check statuses
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Check is a single dependency check
+type Check struct {
+	Name string
+
+	// Live checks are also run by /healthz: failing them means hsadmin needs a restart,
+	// not just that a dependency is unavailable
+	Live bool
+
+	// Run returns a short description of the healthy state, or an error
+	Run func(ctx context.Context) (string, error)
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Message  string  `json:"message,omitempty"`
+	Duration float64 `json:"duration_ms"`
+	live     bool
+}
+
+// Report is the outcome of a set of checks
+type Report struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Result  `json:"checks"`
+}
+
+// Checker runs health checks for the /healthz and /readyz endpoints
+type Checker struct {
+	checks []Check
+	now    func() time.Time
+
+	mu     sync.Mutex
+	cached *Report
+}
+
+// NewChecker creates a checker that runs checks in order of the report
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{checks: checks, now: time.Now}
+}
+
+// Run runs all checks concurrently, or returns the previous report if it is recent enough
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached != nil && c.now().Sub(c.cached.CheckedAt) < cacheTTL {
+		return *c.cached
+	}
+
+	// The report is shared with other probes, so it must not fail because this one went away
+	ctx = context.WithoutCancel(ctx)
+
+	report := Report{
+		CheckedAt: c.now(),
+		Checks:    make([]Result, len(c.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report.Status = summarize(report.Checks)
+	c.cached = &report
+	return report
+}
+
+// run runs one check with its timeout
+func run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	message, err := check.Run(ctx)
+	result := Result{
+		Name:     check.Name,
+		Status:   StatusOK,
+		Message:  message,
+		Duration: float64(time.Since(start).Microseconds()) / 1000,
+		live:     check.Live,
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Message = err.Error()
+	}
+	return result
+}
+
+// summarize returns StatusFailing if any result is failing
+func summarize(results []Result) string {
+	for _, result := range results {
+		if result.Status != StatusOK {
+			return StatusFailing
+		}
+	}
+	return StatusOK
+}
+
+// Liveness returns the part of report covering live checks
+func Liveness(report Report) Report {
+	live := Report{CheckedAt: report.CheckedAt, Checks: []Result{}}
+	for _, result := range report.Checks {
+		if result.live {
+			live.Checks = append(live.Checks, result)
+		}
+	}
+	live.Status = summarize(live.Checks)
+	return live
+}
+
+// Healthz handles GET /healthz, failing only when hsadmin itself needs a restart
+// Requests for which detailed returns true get the JSON report; others only see "ok" or "failing".
+func (c *Checker) Healthz(detailed func(*http.Request) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r) {
+			return
+		}
+		write(w, Liveness(c.Run(r.Context())), detailed(r))
+	}
+}
+
+// Readyz handles GET /readyz, failing while Headscale, tsnet or the OIDC provider is unusable
+// Requests for which detailed returns true get the JSON report; others only see "ok" or "failing".
+func (c *Checker) Readyz(detailed func(*http.Request) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r) {
+			return
+		}
+		write(w, c.Run(r.Context()), detailed(r))
+	}
+}
+
+// allowMethod rejects requests other than GET and HEAD before any check runs
+func allowMethod(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// write sends report with 200 if healthy or 503 if not
+func write(w http.ResponseWriter, report Report, detailed bool) {
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	if detailed {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(report.Status + "\n"))
+}
@@ -0,0 +1,232 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"tailscale.com/ipn/ipnstate"
+)
+
+// check returns a check that reports err, counting its runs in calls
+func check(name string, live bool, err error, calls *int) Check {
+	return Check{
+		Name: name,
+		Live: live,
+		Run: func(ctx context.Context) (string, error) {
+			*calls++
+			return name + " healthy", err
+		},
+	}
+}
+
+// TestChecker_Run tests that reports cover every check and are cached briefly
+func TestChecker_Run(t *testing.T) {
+	var tsnetCalls, headscaleCalls int
+	checker := NewChecker(
+		check("headscale", false, errors.New("API unreachable"), &headscaleCalls),
+		check("tsnet", true, nil, &tsnetCalls),
+	)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	checker.now = func() time.Time { return now }
+
+	report := checker.Run(context.Background())
+	assert.Equal(t, StatusFailing, report.Status)
+	require.Len(t, report.Checks, 2)
+	assert.Equal(t, Result{Name: "headscale", Status: StatusFailing, Message: "API unreachable"}, withoutDuration(report.Checks[0]))
+	assert.Equal(t, Result{Name: "tsnet", Status: StatusOK, Message: "tsnet healthy", live: true}, withoutDuration(report.Checks[1]))
+
+	live := Liveness(report)
+	assert.Equal(t, StatusOK, live.Status)
+	require.Len(t, live.Checks, 1)
+	assert.Equal(t, "tsnet", live.Checks[0].Name)
+
+	// Cached within the TTL
+	now = now.Add(cacheTTL - time.Second)
+	checker.Run(context.Background())
+	assert.Equal(t, 1, headscaleCalls)
+
+	now = now.Add(time.Second)
+	checker.Run(context.Background())
+	assert.Equal(t, 2, headscaleCalls)
+	assert.Equal(t, 2, tsnetCalls)
+}
+
+// withoutDuration clears the measured duration so results can be compared
+func withoutDuration(r Result) Result {
+	r.Duration = 0
+	return r
+}
+
+// TestHandlers tests the probe status codes, and that only admins get the JSON breakdown
+func TestHandlers(t *testing.T) {
+	var headscaleCalls, tsnetCalls int
+	checker := NewChecker(
+		check("headscale", false, errors.New("API unreachable"), &headscaleCalls),
+		check("tsnet", true, nil, &tsnetCalls),
+	)
+	isAdmin := func(r *http.Request) bool { return r.Header.Get("X-Admin") != "" }
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		method   string
+		admin    bool
+		wantCode int
+		wantBody string // Plain text body; empty for JSON
+		wantJSON []string
+	}{
+		{name: "healthz", handler: checker.Healthz(isAdmin), method: "GET", wantCode: http.StatusOK, wantBody: "ok\n"},
+		{name: "readyz", handler: checker.Readyz(isAdmin), method: "GET", wantCode: http.StatusServiceUnavailable, wantBody: "failing\n"},
+		{name: "healthz admin", handler: checker.Healthz(isAdmin), method: "GET", admin: true, wantCode: http.StatusOK, wantJSON: []string{"tsnet"}},
+		{name: "readyz admin", handler: checker.Readyz(isAdmin), method: "GET", admin: true, wantCode: http.StatusServiceUnavailable, wantJSON: []string{"headscale", "tsnet"}},
+		{name: "post", handler: checker.Readyz(isAdmin), method: "POST", wantCode: http.StatusMethodNotAllowed, wantBody: "Method not allowed\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.admin {
+				req.Header.Set("X-Admin", "1")
+			}
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantJSON == nil {
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+				return
+			}
+
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			var report Report
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+			var names []string
+			for _, result := range report.Checks {
+				names = append(names, result.Name)
+			}
+			assert.Equal(t, tt.wantJSON, names)
+		})
+	}
+}
+
+// fakeHeadscale answers ListUsers with users or err
+type fakeHeadscale struct {
+	users []*headscale.User
+	err   error
+}
+
+func (f *fakeHeadscale) ListUsers(ctx context.Context, in *headscale.ListUsersRequest, opts ...grpc.CallOption) (*headscale.ListUsersResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &headscale.ListUsersResponse{Users: f.users}, nil
+}
+
+// TestHeadscaleCheck tests that unreachable servers, rejected API keys and missing agent users fail
+func TestHeadscaleCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  *fakeHeadscale
+		wantErr string
+	}{
+		{name: "healthy", client: &fakeHeadscale{users: []*headscale.User{{Id: 1, Name: "hsadmin"}}}},
+		{name: "unreachable", client: &fakeHeadscale{err: status.Error(codes.Unavailable, "connection refused")}, wantErr: "API unreachable"},
+		{name: "bad API key", client: &fakeHeadscale{err: status.Error(codes.Unauthenticated, "invalid token")}, wantErr: "API key rejected: invalid token"},
+		{name: "no agent user", client: &fakeHeadscale{}, wantErr: "agent user 1 not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := HeadscaleCheck(tt.client, 1).Run(context.Background())
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeStatus answers StatusWithoutPeers with st
+type fakeStatus struct {
+	st *ipnstate.Status
+}
+
+func (f *fakeStatus) StatusWithoutPeers(ctx context.Context) (*ipnstate.Status, error) {
+	return f.st, nil
+}
+
+// TestTailscaleCheck tests that the tsnet node must be running and logged in
+func TestTailscaleCheck(t *testing.T) {
+	self := &ipnstate.PeerStatus{
+		DNSName:      "hsadmin.tailnet.example.com.",
+		TailscaleIPs: []netip.Addr{netip.MustParseAddr("100.64.0.5")},
+	}
+
+	tests := []struct {
+		name        string
+		st          *ipnstate.Status
+		wantMessage string
+		wantErr     string
+	}{
+		{name: "running", st: &ipnstate.Status{BackendState: "Running", Self: self}, wantMessage: "Running as hsadmin.tailnet.example.com (100.64.0.5)"},
+		{name: "needs login", st: &ipnstate.Status{BackendState: "NeedsLogin"}, wantErr: "node is NeedsLogin, not Running"},
+		{name: "no addresses", st: &ipnstate.Status{BackendState: "Running", Self: &ipnstate.PeerStatus{}}, wantErr: "node is not logged in"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := TailscaleCheck(&fakeStatus{st: tt.st}).Run(context.Background())
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantMessage, message)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestOIDCCheck tests provider discovery, and that a failed startup is reported
+func TestOIDCCheck(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/keys",
+		})
+	}))
+	defer srv.Close()
+
+	_, err := OIDCCheck(srv.URL, true).Run(context.Background())
+	assert.NoError(t, err)
+
+	_, err = OIDCCheck(srv.URL+"/missing", true).Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "discovery failed")
+
+	_, err = OIDCCheck(srv.URL, false).Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to initialize at startup")
+}
@@ -0,0 +1,265 @@
+package history
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/format"
+	"github.com/anupcshan/hsadmin/internal/models"
+)
+
+// Latency chart dimensions in SVG user units
+const (
+	ChartWidth  = 600
+	ChartHeight = 120
+)
+
+// seriesColors is the palette used for per-region latency lines
+var seriesColors = []string{
+	"#60a5fa", // blue-400
+	"#34d399", // emerald-400
+	"#fbbf24", // amber-400
+	"#f472b6", // pink-400
+	"#a78bfa", // violet-400
+	"#f87171", // red-400
+	"#2dd4bf", // teal-400
+	"#fb923c", // orange-400
+}
+
+// LatencySample is a point-in-time snapshot of a node's DERP latencies and connection path
+// as seen from the hsadmin node
+type LatencySample struct {
+	NodeID  uint64          `json:"node_id"`
+	At      time.Time       `json:"at"`
+	Direct  bool            `json:"direct"`             // Whether hsadmin had a direct path to the node
+	CurAddr string          `json:"cur_addr,omitempty"` // Direct endpoint in use, if any
+	Relay   string          `json:"relay,omitempty"`    // Node's home DERP region code
+	Latency map[int]float64 `json:"latency_ms"`         // Best latency per DERP region ID, in milliseconds
+}
+
+// NewLatencySample builds a sample from the current machine state
+func NewLatencySample(m *models.Machine, at time.Time) LatencySample {
+	sample := LatencySample{
+		NodeID:  m.ID(),
+		At:      at,
+		Latency: make(map[int]float64),
+	}
+
+	if m.PeerStatus != nil {
+		sample.CurAddr = m.PeerStatus.CurAddr
+		sample.Direct = m.PeerStatus.CurAddr != ""
+		sample.Relay = m.PeerStatus.Relay
+	}
+
+	for _, l := range m.ProcessedDERPLatencies(nil) {
+		sample.Latency[l.RegionID] = l.LatencyMS
+	}
+
+	return sample
+}
+
+// RecordLatency appends a latency sample for a node
+func (s *Store) RecordLatency(sample LatencySample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := appendLog(s.latencyLog, sample); err != nil {
+		return fmt.Errorf("failed to write latency log: %w", err)
+	}
+
+	s.latency[sample.NodeID] = append(s.latency[sample.NodeID], sample)
+	return nil
+}
+
+// LatencySamples returns a node's samples within [since, until), oldest first
+func (s *Store) LatencySamples(nodeID uint64, since, until time.Time) []LatencySample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	samples := s.latency[nodeID]
+	first := sort.Search(len(samples), func(i int) bool {
+		return !samples[i].At.Before(since)
+	})
+	last := sort.Search(len(samples), func(i int) bool {
+		return !samples[i].At.Before(until)
+	})
+
+	result := make([]LatencySample, last-first)
+	copy(result, samples[first:last])
+	return result
+}
+
+// LatencySeries is the latency history to a single DERP region, ready for charting
+type LatencySeries struct {
+	RegionID   int
+	RegionName string
+	Color      string
+	Path       string // SVG path data in chart coordinates, with a new segment after each gap
+	LatestMS   float64
+	MinMS      float64
+	MaxMS      float64
+}
+
+// PathSpan is a contiguous period during which the connection path stayed the same
+type PathSpan struct {
+	Start  time.Time
+	End    time.Time
+	Direct bool
+	Relay  string
+
+	// Position of the span within the summarized window (0-100), used for rendering timelines
+	OffsetPercent float64
+	WidthPercent  float64
+}
+
+// Text describes the path and how long it was in use
+func (p PathSpan) Text() string {
+	path := "Relay"
+	if p.Direct {
+		path = "Direct"
+	} else if p.Relay != "" {
+		path = "Relay via " + p.Relay
+	}
+	return fmt.Sprintf("%s for %s from %s", path, format.Duration(p.End.Sub(p.Start)), p.Start.Local().Format("Jan 2, 3:04 PM"))
+}
+
+// LatencySummary is a node's latency and connection path history over a time window
+type LatencySummary struct {
+	NodeID  uint64
+	Since   time.Time
+	Until   time.Time
+	Samples int
+	ScaleMS float64 // Latency at the top of the chart
+	Series  []LatencySeries
+	Paths   []PathSpan
+}
+
+// DirectPercent returns the share of covered time spent on a direct path
+func (l LatencySummary) DirectPercent() float64 {
+	var direct, total time.Duration
+	for _, p := range l.Paths {
+		total += p.End.Sub(p.Start)
+		if p.Direct {
+			direct += p.End.Sub(p.Start)
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(direct) / float64(total) * 100
+}
+
+// SummarizeLatency builds chart data for [since, until) from samples sorted oldest first.
+// interval is the expected time between samples; gaps of more than two intervals (e.g. the node was offline)
+// are left blank, both in the latency lines and the connection path timeline.
+// regionName maps DERP region IDs to display names.
+func SummarizeLatency(nodeID uint64, samples []LatencySample, since, until time.Time, interval time.Duration, regionName func(int) string) LatencySummary {
+	summary := LatencySummary{
+		NodeID:  nodeID,
+		Since:   since,
+		Until:   until,
+		Samples: len(samples),
+	}
+
+	window := until.Sub(since)
+	if window <= 0 || len(samples) == 0 {
+		return summary
+	}
+
+	xFor := func(at time.Time) float64 {
+		return float64(at.Sub(since)) / float64(window) * ChartWidth
+	}
+
+	// Scale the y axis to the highest latency, rounded up to a multiple of 50ms
+	for _, sample := range samples {
+		for _, ms := range sample.Latency {
+			summary.ScaleMS = math.Max(summary.ScaleMS, ms)
+		}
+	}
+	summary.ScaleMS = math.Max(50, math.Ceil(summary.ScaleMS/50)*50)
+
+	// Build one series per region, starting a new line segment whenever the region's previous point is too old
+	byRegion := make(map[int]*LatencySeries)
+	points := make(map[int][]string)
+	lastAt := make(map[int]time.Time)
+	for _, sample := range samples {
+		for regionID, ms := range sample.Latency {
+			series, ok := byRegion[regionID]
+			if !ok {
+				series = &LatencySeries{
+					RegionID:   regionID,
+					RegionName: regionName(regionID),
+					MinMS:      ms,
+				}
+				byRegion[regionID] = series
+			}
+			series.LatestMS = ms
+			series.MinMS = math.Min(series.MinMS, ms)
+			series.MaxMS = math.Max(series.MaxMS, ms)
+
+			cmd := "L"
+			if last, ok := lastAt[regionID]; !ok || sample.At.Sub(last) > 2*interval {
+				cmd = "M"
+			}
+			lastAt[regionID] = sample.At
+
+			y := ChartHeight - ms/summary.ScaleMS*ChartHeight
+			points[regionID] = append(points[regionID], fmt.Sprintf("%s%.1f,%.1f", cmd, xFor(sample.At), y))
+		}
+	}
+
+	for regionID, series := range byRegion {
+		series.Path = strings.Join(points[regionID], " ")
+		summary.Series = append(summary.Series, *series)
+	}
+
+	// Order regions by latest latency so the closest relays are listed first
+	sort.Slice(summary.Series, func(i, j int) bool {
+		if summary.Series[i].LatestMS != summary.Series[j].LatestMS {
+			return summary.Series[i].LatestMS < summary.Series[j].LatestMS
+		}
+		return summary.Series[i].RegionID < summary.Series[j].RegionID
+	})
+	for i := range summary.Series {
+		summary.Series[i].Color = seriesColors[i%len(seriesColors)]
+	}
+
+	// Build connection path spans, merging consecutive samples with the same path
+	for i, sample := range samples {
+		start := sample.At
+		end := start.Add(2 * interval)
+		if i+1 < len(samples) && samples[i+1].At.Before(end) {
+			end = samples[i+1].At
+		}
+		if end.After(until) {
+			end = until
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		if n := len(summary.Paths); n > 0 {
+			prev := &summary.Paths[n-1]
+			if prev.End.Equal(start) && prev.Direct == sample.Direct && prev.Relay == sample.Relay {
+				prev.End = end
+				continue
+			}
+		}
+		summary.Paths = append(summary.Paths, PathSpan{
+			Start:  start,
+			End:    end,
+			Direct: sample.Direct,
+			Relay:  sample.Relay,
+		})
+	}
+	for i := range summary.Paths {
+		p := &summary.Paths[i]
+		p.OffsetPercent = float64(p.Start.Sub(since)) / float64(window) * 100
+		p.WidthPercent = float64(p.End.Sub(p.Start)) / float64(window) * 100
+	}
+
+	return summary
+}
@@ -0,0 +1,124 @@
+package history
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSummarizeLatency tests series ordering, y scale and connection path merging
+func TestSummarizeLatency(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+	regionName := func(id int) string { return fmt.Sprintf("region-%d", id) }
+
+	samples := []LatencySample{
+		{At: at(0), Direct: true, Latency: map[int]float64{1: 40, 2: 20}},
+		{At: at(5), Direct: true, Latency: map[int]float64{1: 30, 2: 120}},
+		{At: at(10), Relay: "nyc", Latency: map[int]float64{1: 35, 2: 90}},
+		// Gap longer than two intervals: the node was offline
+		{At: at(40), Direct: true, Latency: map[int]float64{1: 25}},
+	}
+
+	summary := SummarizeLatency(7, samples, at(0), at(60), 5*time.Minute, regionName)
+
+	assert.Equal(t, 4, summary.Samples)
+	assert.Equal(t, 150.0, summary.ScaleMS, "scale should round max latency up to a multiple of 50ms")
+
+	require.Len(t, summary.Series, 2)
+	assert.Equal(t, 1, summary.Series[0].RegionID, "region with lowest latest latency first")
+	assert.Equal(t, "region-1", summary.Series[0].RegionName)
+	assert.Equal(t, 25.0, summary.Series[0].LatestMS)
+	assert.Equal(t, 25.0, summary.Series[0].MinMS)
+	assert.Equal(t, 40.0, summary.Series[0].MaxMS)
+	assert.Equal(t, 90.0, summary.Series[1].LatestMS)
+	assert.NotEqual(t, summary.Series[0].Color, summary.Series[1].Color)
+
+	require.Len(t, summary.Paths, 3)
+	assert.True(t, summary.Paths[0].Direct)
+	assert.Equal(t, at(0), summary.Paths[0].Start)
+	assert.Equal(t, at(10), summary.Paths[0].End, "consecutive direct samples should merge")
+	assert.False(t, summary.Paths[1].Direct)
+	assert.Equal(t, "nyc", summary.Paths[1].Relay)
+	assert.Equal(t, at(20), summary.Paths[1].End, "span should end two intervals after a sample followed by a gap")
+	assert.Equal(t, at(40), summary.Paths[2].Start)
+	assert.Equal(t, at(50), summary.Paths[2].End)
+
+	// 20 minutes direct out of 30 minutes covered
+	assert.InDelta(t, 66.67, summary.DirectPercent(), 0.01)
+}
+
+// TestSummarizeLatency_Gap tests that latency lines break where samples are missing
+func TestSummarizeLatency_Gap(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+
+	samples := []LatencySample{
+		{At: at(0), Latency: map[int]float64{1: 50}},
+		{At: at(6), Latency: map[int]float64{1: 50}}, // Late but within two intervals
+		{At: at(30), Latency: map[int]float64{1: 100, 2: 50}},
+		{At: at(35), Latency: map[int]float64{1: 100}},
+		{At: at(50), Latency: map[int]float64{2: 0}},
+	}
+
+	summary := SummarizeLatency(1, samples, at(0), at(60), 5*time.Minute, func(int) string { return "" })
+
+	require.Len(t, summary.Series, 2)
+	assert.Equal(t, 2, summary.Series[0].RegionID)
+	assert.Equal(t, "M300.0,60.0 M500.0,120.0", summary.Series[0].Path, "region missing from samples in between should not be joined")
+	assert.Equal(t, "M0.0,60.0 L60.0,60.0 M300.0,0.0 L350.0,0.0", summary.Series[1].Path)
+}
+
+// TestSummarizeLatency_NoSamples tests that an empty window produces no chart data
+func TestSummarizeLatency_NoSamples(t *testing.T) {
+	now := time.Now()
+	summary := SummarizeLatency(1, nil, now.Add(-time.Hour), now, 5*time.Minute, func(int) string { return "" })
+
+	assert.Empty(t, summary.Series)
+	assert.Empty(t, summary.Paths)
+	assert.Equal(t, 0.0, summary.DirectPercent())
+}
+
+// TestStore_Prune tests that old records are dropped while current state is preserved
+func TestStore_Prune(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return base.Add(time.Duration(h) * time.Hour) }
+
+	store, err := Open(dir)
+	require.NoError(t, err)
+
+	for i, online := range []bool{true, false, true} {
+		_, err := store.RecordPresence(1, online, at(i))
+		require.NoError(t, err)
+	}
+	for h := 0; h < 4; h++ {
+		require.NoError(t, store.RecordLatency(LatencySample{NodeID: 1, At: at(h), Latency: map[int]float64{1: 10}}))
+	}
+	require.NoError(t, store.RecordLatency(LatencySample{NodeID: 2, At: at(0), Latency: map[int]float64{1: 10}}))
+
+	require.NoError(t, store.Prune(at(2)))
+
+	// The transition at the cutoff is kept so the state from then on is known
+	transitions := store.Transitions(1)
+	require.Len(t, transitions, 1)
+	assert.Equal(t, at(2), transitions[0].At)
+
+	assert.Len(t, store.LatencySamples(1, at(0), at(10)), 2)
+	assert.Empty(t, store.LatencySamples(2, at(0), at(10)))
+
+	// Appends after a prune go to the rewritten log
+	require.NoError(t, store.RecordLatency(LatencySample{NodeID: 1, At: at(5), Latency: map[int]float64{1: 10}}))
+	require.NoError(t, store.Close())
+
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	assert.Len(t, reopened.Transitions(1), 1)
+	assert.Len(t, reopened.LatencySamples(1, at(0), at(10)), 3)
+	assert.Empty(t, reopened.LatencySamples(2, at(0), at(10)))
+}
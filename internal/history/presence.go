@@ -0,0 +1,111 @@
+package history
+
+import (
+	"slices"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/format"
+)
+
+// Span is a contiguous period during which a node was online or offline
+type Span struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Online bool      `json:"online"`
+
+	// Position of the span within the summarized window (0-100), used for rendering timelines
+	OffsetPercent float64 `json:"-"`
+	WidthPercent  float64 `json:"-"`
+}
+
+// Duration returns the length of the span
+func (s Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// DurationText returns the span length formatted for display
+func (s Span) DurationText() string {
+	return format.Duration(s.Duration())
+}
+
+// PresenceSummary describes a node's presence over a time window
+type PresenceSummary struct {
+	NodeID        uint64        `json:"node_id"`
+	Since         time.Time     `json:"since"`
+	Until         time.Time     `json:"until"`
+	Spans         []Span        `json:"spans"`
+	Covered       time.Duration `json:"covered_ns"`     // Portion of the window with known state
+	UptimePercent float64       `json:"uptime_percent"` // Online time as a percentage of Covered
+}
+
+// HasData returns true if any part of the window has a known state
+func (p PresenceSummary) HasData() bool {
+	return p.Covered > 0
+}
+
+// SummarizePresence builds a presence summary for [since, until) from transitions sorted oldest first.
+// Time before the first recorded transition, or outside the recording periods, is treated as unknown
+// and excluded from uptime: a node may have changed state while hsadmin was not running.
+func SummarizePresence(nodeID uint64, transitions []Transition, recording []Period, since, until time.Time) PresenceSummary {
+	summary := PresenceSummary{
+		NodeID: nodeID,
+		Since:  since,
+		Until:  until,
+	}
+
+	window := until.Sub(since)
+	if window <= 0 {
+		return summary
+	}
+
+	var online time.Duration
+	for i, t := range transitions {
+		start := t.At
+		end := until
+		if i+1 < len(transitions) {
+			end = transitions[i+1].At
+		}
+
+		// Clip to the window, and split where the recorder was not running
+		for _, p := range recording {
+			start, end := latest(start, since, p.Start), earliest(end, until, p.End)
+			if !end.After(start) {
+				continue
+			}
+
+			span := Span{
+				Start:         start,
+				End:           end,
+				Online:        t.Online,
+				OffsetPercent: float64(start.Sub(since)) / float64(window) * 100,
+				WidthPercent:  float64(end.Sub(start)) / float64(window) * 100,
+			}
+			summary.Spans = append(summary.Spans, span)
+			summary.Covered += span.Duration()
+			if span.Online {
+				online += span.Duration()
+			}
+		}
+	}
+
+	if summary.Covered > 0 {
+		summary.UptimePercent = float64(online) / float64(summary.Covered) * 100
+	}
+
+	return summary
+}
+
+// latest returns the latest of the given times
+func latest(times ...time.Time) time.Time {
+	return slices.MaxFunc(times, time.Time.Compare)
+}
+
+// earliest returns the earliest of the given times
+func earliest(times ...time.Time) time.Time {
+	return slices.MinFunc(times, time.Time.Compare)
+}
+
+// Presence returns a presence summary for a node over [since, until)
+func (s *Store) Presence(nodeID uint64, since, until time.Time) PresenceSummary {
+	return SummarizePresence(nodeID, s.Transitions(nodeID), s.Recording(), since, until)
+}
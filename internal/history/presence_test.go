@@ -0,0 +1,224 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSummarizePresence tests span clipping and uptime calculation
+func TestSummarizePresence(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return base.Add(time.Duration(h) * time.Hour) }
+	alwaysRunning := []Period{{Start: at(-100), End: at(100)}}
+
+	tests := []struct {
+		name        string
+		transitions []Transition
+		recording   []Period // Defaults to alwaysRunning
+		since       time.Time
+		until       time.Time
+		wantSpans   int
+		wantCovered time.Duration
+		wantUptime  float64
+	}{
+		{
+			name:        "no transitions",
+			transitions: nil,
+			since:       at(0),
+			until:       at(10),
+			wantSpans:   0,
+			wantCovered: 0,
+			wantUptime:  0,
+		},
+		{
+			name: "online before window, still online",
+			transitions: []Transition{
+				{Online: true, At: at(-5)},
+			},
+			since:       at(0),
+			until:       at(10),
+			wantSpans:   1,
+			wantCovered: 10 * time.Hour,
+			wantUptime:  100,
+		},
+		{
+			name: "half online half offline",
+			transitions: []Transition{
+				{Online: true, At: at(0)},
+				{Online: false, At: at(5)},
+			},
+			since:       at(0),
+			until:       at(10),
+			wantSpans:   2,
+			wantCovered: 10 * time.Hour,
+			wantUptime:  50,
+		},
+		{
+			name: "first seen inside window - earlier time is unknown",
+			transitions: []Transition{
+				{Online: true, At: at(6)},
+				{Online: false, At: at(9)},
+			},
+			since:       at(0),
+			until:       at(10),
+			wantSpans:   2,
+			wantCovered: 4 * time.Hour,
+			wantUptime:  75,
+		},
+		{
+			name: "transitions entirely before window collapse to last state",
+			transitions: []Transition{
+				{Online: true, At: at(-10)},
+				{Online: false, At: at(-8)},
+				{Online: true, At: at(-2)},
+			},
+			since:       at(0),
+			until:       at(4),
+			wantSpans:   1,
+			wantCovered: 4 * time.Hour,
+			wantUptime:  100,
+		},
+		{
+			name: "transitions after window are ignored",
+			transitions: []Transition{
+				{Online: false, At: at(0)},
+				{Online: true, At: at(12)},
+			},
+			since:       at(0),
+			until:       at(10),
+			wantSpans:   1,
+			wantCovered: 10 * time.Hour,
+			wantUptime:  0,
+		},
+		{
+			name: "not running - gap is unknown, not credited to the last state",
+			transitions: []Transition{
+				{Online: true, At: at(0)},
+			},
+			recording:   []Period{{Start: at(0), End: at(4)}, {Start: at(6), End: at(10)}},
+			since:       at(0),
+			until:       at(10),
+			wantSpans:   2,
+			wantCovered: 8 * time.Hour,
+			wantUptime:  100,
+		},
+		{
+			name: "went offline while not running - recorded on restart",
+			transitions: []Transition{
+				{Online: true, At: at(0)},
+				{Online: false, At: at(6)},
+			},
+			recording:   []Period{{Start: at(0), End: at(2)}, {Start: at(6), End: at(10)}},
+			since:       at(0),
+			until:       at(10),
+			wantSpans:   2,
+			wantCovered: 6 * time.Hour,
+			wantUptime:  100.0 / 3,
+		},
+		{
+			name: "never running",
+			transitions: []Transition{
+				{Online: true, At: at(0)},
+			},
+			recording:   []Period{},
+			since:       at(0),
+			until:       at(10),
+			wantSpans:   0,
+			wantCovered: 0,
+			wantUptime:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recording := tt.recording
+			if recording == nil {
+				recording = alwaysRunning
+			}
+			summary := SummarizePresence(1, tt.transitions, recording, tt.since, tt.until)
+			assert.Len(t, summary.Spans, tt.wantSpans)
+			assert.Equal(t, tt.wantCovered, summary.Covered)
+			assert.InDelta(t, tt.wantUptime, summary.UptimePercent, 0.001)
+
+			// Spans must stay within the window for rendering
+			var width float64
+			for _, span := range summary.Spans {
+				assert.GreaterOrEqual(t, span.OffsetPercent, 0.0)
+				assert.LessOrEqual(t, span.OffsetPercent+span.WidthPercent, 100.0+1e-9)
+				width += span.WidthPercent
+			}
+			assert.InDelta(t, float64(tt.wantCovered)/float64(tt.until.Sub(tt.since))*100, width, 0.001)
+		})
+	}
+}
+
+// TestStore_RecordPresence tests deduplication and persistence across reopen
+func TestStore_RecordPresence(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store, err := Open(dir)
+	require.NoError(t, err)
+
+	recorded, err := store.RecordPresence(7, true, now)
+	require.NoError(t, err)
+	assert.True(t, recorded, "first observation should be recorded")
+
+	recorded, err = store.RecordPresence(7, true, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, recorded, "unchanged state should not be recorded")
+
+	recorded, err = store.RecordPresence(7, false, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, recorded, "state change should be recorded")
+
+	require.NoError(t, store.Close())
+
+	// Reopen and verify transitions were persisted
+	store, err = Open(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	transitions := store.Transitions(7)
+	require.Len(t, transitions, 2)
+	assert.True(t, transitions[0].Online)
+	assert.False(t, transitions[1].Online)
+	assert.True(t, transitions[1].At.Equal(now.Add(2*time.Minute)))
+}
+
+// TestStore_RecordRunning tests that recording periods are persisted across reopen, with the end of the
+// current period written at most every recordingFlushInterval
+func TestStore_RecordRunning(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.RecordRunning(now, now))
+	require.NoError(t, store.RecordRunning(now, now.Add(recordingFlushInterval)))
+	require.NoError(t, store.RecordRunning(now, now.Add(recordingFlushInterval+time.Second)))
+	assert.Equal(t, []Period{{Start: now, End: now.Add(recordingFlushInterval + time.Second)}}, store.Recording())
+	require.NoError(t, store.Close())
+
+	// Restarted: the unflushed second is lost and a new period begins
+	restart := now.Add(time.Hour)
+	store, err = Open(dir)
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.RecordRunning(restart, restart))
+
+	recording := store.Recording()
+	require.Len(t, recording, 2)
+	assert.True(t, recording[0].Start.Equal(now))
+	assert.True(t, recording[0].End.Equal(now.Add(recordingFlushInterval)))
+	assert.True(t, recording[1].Start.Equal(restart))
+
+	// The hour in between is not credited to the machine's last state
+	_, err = store.RecordPresence(7, true, now)
+	require.NoError(t, err)
+	summary := store.Presence(7, now, restart.Add(time.Hour))
+	assert.Equal(t, recordingFlushInterval, summary.Covered)
+}
@@ -0,0 +1,86 @@
+package history
+
+import (
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/logging"
+	"github.com/anupcshan/hsadmin/internal/models"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+)
+
+var logger = logging.For("history")
+
+// pruneInterval is how often records older than the retention period are dropped
+const pruneInterval = time.Hour
+
+// Recorder records history from watcher updates, independent of connected clients
+type Recorder struct {
+	store *Store
+	cfg   *config.HistoryConfig
+
+	started    time.Time // Time of the first update, identifying the current recording period
+	lastSample time.Time
+	lastPrune  time.Time
+}
+
+// NewRecorder creates a new history recorder
+func NewRecorder(store *Store, cfg *config.HistoryConfig) *Recorder {
+	logger.Info("Recording", "sample_interval", cfg.SampleInterval, "retention", cfg.Retention)
+
+	return &Recorder{
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Record records any presence transitions in an update and that the recorder was running,
+// plus latency samples and pruning when they are due. It is a watcher subscriber, so it is never called concurrently.
+func (r *Recorder) Record(u watcher.Update) {
+	now := u.Snapshot.At
+	if r.started.IsZero() {
+		r.started = now
+	}
+	r.recordPresence(u.Machines, now)
+	if err := r.store.RecordRunning(r.started, now); err != nil {
+		logger.Error("Error recording running period", "error", err)
+	}
+
+	if now.Sub(r.lastSample) >= r.cfg.SampleInterval {
+		r.recordLatency(u.Machines, now)
+		r.lastSample = now
+	}
+
+	if now.Sub(r.lastPrune) >= pruneInterval {
+		if err := r.store.Prune(now.Add(-r.cfg.Retention)); err != nil {
+			logger.Error("Error pruning old records", "error", err)
+		}
+		r.lastPrune = now
+	}
+}
+
+// recordPresence records the online state of each machine
+func (r *Recorder) recordPresence(machines []*models.Machine, now time.Time) {
+	for _, m := range machines {
+		recorded, err := r.store.RecordPresence(m.ID(), m.Online, now)
+		if err != nil {
+			logger.Error("Error recording presence", "machine_id", m.ID(), "error", err)
+			continue
+		}
+		if recorded {
+			logger.Info("Machine status changed", "machine_id", m.ID(), "status", m.StatusText())
+		}
+	}
+}
+
+// recordLatency samples DERP latency and connection path for each online machine
+func (r *Recorder) recordLatency(machines []*models.Machine, now time.Time) {
+	for _, m := range machines {
+		if !m.Online || m.PeerStatus == nil {
+			continue
+		}
+		if err := r.store.RecordLatency(NewLatencySample(m, now)); err != nil {
+			logger.Error("Error recording latency", "machine_id", m.ID(), "error", err)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Log file names within the history directory
+const (
+	presenceFile  = "presence.jsonl"  // Append-only log of online/offline transitions
+	latencyFile   = "latency.jsonl"   // Append-only log of DERP latency and connection path samples
+	recordingFile = "recording.jsonl" // Append-only log of the periods the recorder was running
+)
+
+// recordingFlushInterval is how often the end of the current recording period is written to disk
+// After a crash, up to this much of the period before it is treated as unknown.
+const recordingFlushInterval = time.Minute
+
+// Transition records a node changing between online and offline
+type Transition struct {
+	NodeID uint64    `json:"node_id"`
+	Online bool      `json:"online"`
+	At     time.Time `json:"at"`
+}
+
+// Period is a time range during which the recorder was running, so presence is known
+// A period is logged again each time its end is extended; the latest record for a start wins.
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Store persists machine history to a local directory
+// Records are appended as JSON lines and kept in memory for querying
+type Store struct {
+	dir string
+
+	mu               sync.RWMutex
+	presence         map[uint64][]Transition    // Sorted by At, oldest first
+	latency          map[uint64][]LatencySample // Sorted by At, oldest first
+	recording        []Period                   // Sorted by Start, oldest first
+	recordingFlushed time.Time                  // End of the current period as last written to disk
+	presenceLog      *os.File
+	latencyLog       *os.File
+	recordingLog     *os.File
+}
+
+// Open opens (or creates) a history store in dir and loads existing records
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	s := &Store{
+		dir:      dir,
+		presence: make(map[uint64][]Transition),
+		latency:  make(map[uint64][]LatencySample),
+	}
+
+	err := readLog(filepath.Join(dir, presenceFile), func(t Transition) {
+		s.presence[t.NodeID] = append(s.presence[t.NodeID], t)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read presence log: %w", err)
+	}
+	for _, transitions := range s.presence {
+		sort.Slice(transitions, func(i, j int) bool {
+			return transitions[i].At.Before(transitions[j].At)
+		})
+	}
+
+	err = readLog(filepath.Join(dir, latencyFile), func(sample LatencySample) {
+		s.latency[sample.NodeID] = append(s.latency[sample.NodeID], sample)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read latency log: %w", err)
+	}
+	for _, samples := range s.latency {
+		sort.Slice(samples, func(i, j int) bool {
+			return samples[i].At.Before(samples[j].At)
+		})
+	}
+
+	ends := make(map[time.Time]time.Time)
+	err = readLog(filepath.Join(dir, recordingFile), func(p Period) {
+		start := p.Start.UTC()
+		if p.End.After(ends[start]) {
+			ends[start] = p.End
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording log: %w", err)
+	}
+	for start, end := range ends {
+		s.recording = append(s.recording, Period{Start: start, End: end})
+	}
+	sort.Slice(s.recording, func(i, j int) bool {
+		return s.recording[i].Start.Before(s.recording[j].Start)
+	})
+
+	if s.presenceLog, err = openLog(filepath.Join(dir, presenceFile)); err != nil {
+		return nil, fmt.Errorf("failed to open presence log: %w", err)
+	}
+	if s.latencyLog, err = openLog(filepath.Join(dir, latencyFile)); err != nil {
+		s.presenceLog.Close()
+		return nil, fmt.Errorf("failed to open latency log: %w", err)
+	}
+	if s.recordingLog, err = openLog(filepath.Join(dir, recordingFile)); err != nil {
+		s.presenceLog.Close()
+		s.latencyLog.Close()
+		return nil, fmt.Errorf("failed to open recording log: %w", err)
+	}
+
+	return s, nil
+}
+
+// Close closes the underlying log files
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.presenceLog.Close()
+	if latencyErr := s.latencyLog.Close(); err == nil {
+		err = latencyErr
+	}
+	if recordingErr := s.recordingLog.Close(); err == nil {
+		err = recordingErr
+	}
+	return err
+}
+
+// RecordRunning extends the recording period that began at start to at, starting a new one
+// if start is not the current period. The end is written at most every recordingFlushInterval.
+func (s *Store) RecordRunning(start, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := len(s.recording) - 1
+	if last < 0 || !s.recording[last].Start.Equal(start) {
+		s.recording = append(s.recording, Period{Start: start})
+		s.recordingFlushed = time.Time{}
+		last++
+	}
+	s.recording[last].End = at
+
+	if at.Sub(s.recordingFlushed) < recordingFlushInterval {
+		return nil
+	}
+	if err := appendLog(s.recordingLog, s.recording[last]); err != nil {
+		return fmt.Errorf("failed to write recording log: %w", err)
+	}
+	s.recordingFlushed = at
+	return nil
+}
+
+// Recording returns the periods the recorder was running, oldest first
+func (s *Store) Recording() []Period {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.recording)
+}
+
+// RecordPresence records a node's online state if it differs from the last known state
+// Returns true if a transition was recorded
+func (s *Store) RecordPresence(nodeID uint64, online bool, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transitions := s.presence[nodeID]
+	if len(transitions) > 0 && transitions[len(transitions)-1].Online == online {
+		return false, nil
+	}
+
+	t := Transition{NodeID: nodeID, Online: online, At: at}
+	if err := appendLog(s.presenceLog, t); err != nil {
+		return false, fmt.Errorf("failed to write presence log: %w", err)
+	}
+
+	s.presence[nodeID] = append(transitions, t)
+	return true, nil
+}
+
+// Transitions returns all recorded transitions for a node, oldest first
+func (s *Store) Transitions(nodeID uint64) []Transition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	transitions := s.presence[nodeID]
+	result := make([]Transition, len(transitions))
+	copy(result, transitions)
+	return result
+}
+
+// Prune drops records older than cutoff and rewrites the logs on disk.
+// The last transition before cutoff is kept for each node so its state at cutoff stays known.
+func (s *Store) Prune(cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keptTransitions []Transition
+	for nodeID, transitions := range s.presence {
+		first := 0
+		for first+1 < len(transitions) && !transitions[first+1].At.After(cutoff) {
+			first++
+		}
+		s.presence[nodeID] = transitions[first:]
+		keptTransitions = append(keptTransitions, transitions[first:]...)
+	}
+
+	first := sort.Search(len(s.recording), func(i int) bool {
+		return s.recording[i].End.After(cutoff)
+	})
+	s.recording = s.recording[first:]
+
+	var keptSamples []LatencySample
+	for nodeID, samples := range s.latency {
+		first := sort.Search(len(samples), func(i int) bool {
+			return !samples[i].At.Before(cutoff)
+		})
+		if first == len(samples) {
+			delete(s.latency, nodeID)
+			continue
+		}
+		s.latency[nodeID] = samples[first:]
+		keptSamples = append(keptSamples, samples[first:]...)
+	}
+
+	var err error
+	if s.presenceLog, err = rewriteLog(s.presenceLog, filepath.Join(s.dir, presenceFile), keptTransitions); err != nil {
+		return fmt.Errorf("failed to rewrite presence log: %w", err)
+	}
+	if s.latencyLog, err = rewriteLog(s.latencyLog, filepath.Join(s.dir, latencyFile), keptSamples); err != nil {
+		return fmt.Errorf("failed to rewrite latency log: %w", err)
+	}
+	// Also compacts the log to one record per period
+	if s.recordingLog, err = rewriteLog(s.recordingLog, filepath.Join(s.dir, recordingFile), s.recording); err != nil {
+		return fmt.Errorf("failed to rewrite recording log: %w", err)
+	}
+
+	return nil
+}
+
+// readLog decodes each JSON line in path and passes it to fn
+// A missing file is treated as empty
+func readLog[T any](path string, fn func(T)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record T
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// Skip partially written lines (e.g. after a crash)
+			continue
+		}
+		fn(record)
+	}
+	return scanner.Err()
+}
+
+// openLog opens path for appending, creating it if needed
+func openLog(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+}
+
+// appendLog writes a record as a single JSON line
+func appendLog(f *os.File, record any) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// rewriteLog atomically replaces the log at path with records and returns a new append handle
+// On failure the existing handle is returned unchanged so recording can continue
+func rewriteLog[T any](current *os.File, path string, records []T) (*os.File, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return current, err
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			tmp.Close()
+			return current, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return current, err
+	}
+	if err := tmp.Close(); err != nil {
+		return current, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return current, err
+	}
+
+	current.Close()
+	return openLog(path)
+}
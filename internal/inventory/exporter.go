@@ -0,0 +1,157 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/logging"
+	"github.com/anupcshan/hsadmin/internal/models"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+)
+
+var logger = logging.For("inventory")
+
+const (
+	// filePrefix and fileTimeLayout name exports like machines-20261018T120000Z.csv, which sort by time
+	filePrefix     = "machines-"
+	fileTimeLayout = "20060102T150405Z"
+
+	// retryInterval is how long a failed export waits before the next attempt
+	retryInterval = time.Minute
+)
+
+// Filename returns the name of an export written at the given time
+func Filename(at time.Time, format string) string {
+	return filePrefix + at.UTC().Format(fileTimeLayout) + "." + format
+}
+
+// Exporter writes the inventory to a local directory on a schedule
+type Exporter struct {
+	cfg *config.InventoryConfig
+
+	lastExport time.Time
+}
+
+// NewExporter creates the export directory and an exporter that continues the schedule
+// of any exports already in it, so restarts do not export early
+func NewExporter(cfg *config.InventoryConfig) (*Exporter, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create inventory directory: %w", err)
+	}
+
+	e := &Exporter{cfg: cfg}
+	for _, format := range cfg.Formats {
+		exports, err := e.exports(format)
+		if err != nil {
+			return nil, err
+		}
+		if len(exports) > 0 {
+			at, _ := exportTime(exports[len(exports)-1])
+			if at.After(e.lastExport) {
+				e.lastExport = at
+			}
+		}
+	}
+
+	logger.Info("Exporting", "dir", cfg.Dir, "interval", cfg.Interval, "formats", cfg.Formats, "last_export", e.lastExport)
+	return e, nil
+}
+
+// Export writes the machines in an update when an export is due
+// It is a watcher subscriber, so it is never called concurrently.
+func (e *Exporter) Export(u watcher.Update) {
+	now := u.Snapshot.At
+	if now.Sub(e.lastExport) < e.cfg.Interval {
+		return
+	}
+
+	if err := e.write(u.Machines, now); err != nil {
+		logger.Error("Error exporting inventory", "error", err)
+		e.lastExport = now.Add(retryInterval - e.cfg.Interval)
+		return
+	}
+	e.lastExport = now
+	logger.Info("Exported inventory", "machines", len(u.Machines), "formats", e.cfg.Formats)
+}
+
+// write writes one export per format and prunes old exports
+func (e *Exporter) write(machines []*models.Machine, at time.Time) error {
+	records := Records(machines)
+	for _, format := range e.cfg.Formats {
+		if err := writeFile(filepath.Join(e.cfg.Dir, Filename(at, format)), format, records); err != nil {
+			return err
+		}
+		if err := e.prune(format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes records to path through a temporary file, so readers never see a partial export
+func writeFile(path, format string, records []Record) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := Write(f, format, records); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// prune removes the oldest exports of a format beyond cfg.Keep
+func (e *Exporter) prune(format string) error {
+	if e.cfg.Keep == 0 {
+		return nil
+	}
+	exports, err := e.exports(format)
+	if err != nil {
+		return err
+	}
+	for len(exports) > e.cfg.Keep {
+		if err := os.Remove(filepath.Join(e.cfg.Dir, exports[0])); err != nil {
+			return err
+		}
+		exports = exports[1:]
+	}
+	return nil
+}
+
+// exports returns the names of existing exports of a format, oldest first
+func (e *Exporter) exports(format string) ([]string, error) {
+	entries, err := os.ReadDir(e.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, ok := exportTime(name); ok && strings.HasSuffix(name, "."+format) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// exportTime returns the time an export file was written, from its name
+func exportTime(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(strings.TrimSuffix(name, filepath.Ext(name)), filePrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	at, err := time.Parse(fileTimeLayout, stamp)
+	return at, err == nil
+}
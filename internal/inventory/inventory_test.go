@@ -0,0 +1,161 @@
+package inventory
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/models"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"tailscale.com/tailcfg"
+)
+
+var created = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// testMachines returns a fully known machine and one hsadmin has no WhoIs data for
+func testMachines() []*models.Machine {
+	return []*models.Machine{
+		{
+			Node: &headscale.Node{
+				Id:              1,
+				GivenName:       "router",
+				User:            &headscale.User{Name: "alice"},
+				IpAddresses:     []string{"100.64.0.1", "fd7a:115c:a1e0::1"},
+				ForcedTags:      []string{"tag:router"},
+				AvailableRoutes: []string{"10.0.0.0/8", "0.0.0.0/0", "::/0"},
+				ApprovedRoutes:  []string{"10.0.0.0/8"},
+				NodeKey:         "nodekey:abcd",
+				CreatedAt:       timestamppb.New(created),
+				LastSeen:        timestamppb.New(created.Add(time.Hour)),
+			},
+			Online: true,
+			WhoIsNode: &tailcfg.Node{Hostinfo: (&tailcfg.Hostinfo{
+				Hostname:   "=cmd|' /C calc'!A0",
+				OS:         "linux",
+				IPNVersion: "1.80.2",
+			}).View()},
+		},
+		{Node: &headscale.Node{Id: 2, Name: "laptop", Expiry: timestamppb.New(created.Add(90 * 24 * time.Hour))}},
+	}
+}
+
+// TestRecords tests that machine fields are exported, with unknown values left empty
+func TestRecords(t *testing.T) {
+	records := Records(testMachines())
+	require.Len(t, records, 2)
+
+	router := records[0]
+	assert.Equal(t, "router", router.Name)
+	assert.Equal(t, []string{"100.64.0.1", "fd7a:115c:a1e0::1"}, router.IPs)
+	assert.Equal(t, []string{"0.0.0.0/0", "10.0.0.0/8", "::/0"}, router.AdvertisedRoutes)
+	assert.Equal(t, "Awaiting approval", router.ExitNode)
+	assert.Equal(t, "stable", router.Track)
+	assert.Equal(t, created, *router.Created)
+	assert.Nil(t, router.KeyExpiry)
+
+	laptop := records[1]
+	assert.Equal(t, "", laptop.OS)
+	assert.Equal(t, "", laptop.Version)
+	assert.Equal(t, []string{}, laptop.Tags)
+	assert.Equal(t, created.Add(90*24*time.Hour), *laptop.KeyExpiry)
+	assert.Nil(t, laptop.LastSeen)
+}
+
+// TestWrite tests the CSV, JSON and XLSX exports
+func TestWrite(t *testing.T) {
+	records := Records(testMachines())
+
+	var csv bytes.Buffer
+	require.NoError(t, Write(&csv, config.ExportFormatCSV, records))
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "id,name,hostname,fqdn,user,online,ips,"))
+	// The OS hostname would otherwise be evaluated as a formula
+	assert.Contains(t, lines[1], `1,router,'=cmd|' /C calc'!A0,`)
+	assert.Contains(t, lines[1], "2026-01-02T03:04:05Z")
+
+	var js bytes.Buffer
+	require.NoError(t, Write(&js, config.ExportFormatJSON, records))
+	var decoded []Record
+	require.NoError(t, json.Unmarshal(js.Bytes(), &decoded))
+	assert.Equal(t, records, decoded)
+
+	var xlsx bytes.Buffer
+	require.NoError(t, Write(&xlsx, config.ExportFormatXLSX, records))
+	zr, err := zip.NewReader(bytes.NewReader(xlsx.Bytes()), int64(xlsx.Len()))
+	require.NoError(t, err)
+	var names []string
+	var sheet string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			content, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			sheet = string(content)
+		}
+	}
+	assert.Contains(t, names, "[Content_Types].xml")
+	assert.Contains(t, names, "xl/workbook.xml")
+	assert.Equal(t, 3, strings.Count(sheet, "<row>"))
+	assert.Contains(t, sheet, "<t xml:space=\"preserve\">=cmd|&#39; /C calc&#39;!A0</t>")
+
+	assert.Error(t, Write(io.Discard, "ods", records))
+}
+
+// TestExporter tests that exports follow the interval across restarts and old exports are pruned
+func TestExporter(t *testing.T) {
+	cfg := &config.InventoryConfig{
+		Dir:      filepath.Join(t.TempDir(), "inventory"),
+		Interval: time.Hour,
+		Formats:  []string{config.ExportFormatCSV, config.ExportFormatXLSX},
+		Keep:     2,
+	}
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	update := func(at time.Time) watcher.Update {
+		machines := testMachines()
+		return watcher.Update{Snapshot: watcher.NewSnapshot(machines, nil, at), Machines: machines}
+	}
+	files := func() []string {
+		entries, err := os.ReadDir(cfg.Dir)
+		require.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	e, err := NewExporter(cfg)
+	require.NoError(t, err)
+	e.Export(update(start))
+	e.Export(update(start.Add(30 * time.Minute)))
+	assert.Equal(t, []string{"machines-20261018T120000Z.csv", "machines-20261018T120000Z.xlsx"}, files())
+
+	// A restart continues the schedule instead of exporting immediately
+	e, err = NewExporter(cfg)
+	require.NoError(t, err)
+	e.Export(update(start.Add(59 * time.Minute)))
+	assert.Len(t, files(), 2)
+
+	e.Export(update(start.Add(time.Hour)))
+	e.Export(update(start.Add(2 * time.Hour)))
+	assert.Equal(t, []string{
+		"machines-20261018T130000Z.csv",
+		"machines-20261018T130000Z.xlsx",
+		"machines-20261018T140000Z.csv",
+		"machines-20261018T140000Z.xlsx",
+	}, files())
+}
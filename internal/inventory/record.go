@@ -0,0 +1,103 @@
+package inventory
+
+import (
+	"slices"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/models"
+)
+
+// Record is a machine's entry in the inventory
+// Fields that are unknown are left empty rather than set to the "-" shown in the UI.
+type Record struct {
+	ID               uint64     `json:"id"`
+	Name             string     `json:"name"`
+	Hostname         string     `json:"hostname"` // As reported by the OS
+	FQDN             string     `json:"fqdn"`
+	User             string     `json:"user"`
+	Online           bool       `json:"online"`
+	IPs              []string   `json:"ips"`
+	OS               string     `json:"os"`
+	OSVersion        string     `json:"os_version"`
+	Version          string     `json:"version"`
+	Track            string     `json:"track"`
+	AutoUpdate       string     `json:"auto_update"` // "true", "false" or empty if unknown
+	Tags             []string   `json:"tags"`
+	AdvertisedRoutes []string   `json:"advertised_routes"`
+	ApprovedRoutes   []string   `json:"approved_routes"`
+	ExitNode         string     `json:"exit_node"` // "Allowed", "Awaiting approval" or empty if not advertised
+	Endpoints        []string   `json:"endpoints"`
+	NodeKey          string     `json:"node_key"`
+	Created          *time.Time `json:"created,omitempty"`
+	LastSeen         *time.Time `json:"last_seen,omitempty"`
+	KeyExpiry        *time.Time `json:"key_expiry,omitempty"` // nil if the node key does not expire
+}
+
+// Records returns the inventory records of machines, in order
+func Records(machines []*models.Machine) []Record {
+	records := make([]Record, 0, len(machines))
+	for _, m := range machines {
+		r := Record{
+			ID:         m.ID(),
+			Name:       m.Hostname(),
+			Hostname:   known(m.OSHostname()),
+			FQDN:       known(m.FullDomain()),
+			User:       known(m.User()),
+			Online:     m.Online,
+			IPs:        nonNil(m.TailscaleIPs()),
+			OS:         known(m.OS()),
+			OSVersion:  known(m.OSVersion()),
+			Version:    known(m.TailscaleVersion()),
+			Track:      known(m.ReleaseTrack()),
+			AutoUpdate: known(m.AutoUpdate()),
+			Tags:       nonNil(m.Tags()),
+			ExitNode:   m.ExitNodeStatus(),
+			Endpoints:  nonNil(m.Endpoints()),
+			NodeKey:    known(m.NodeKey()),
+		}
+		if m.Node != nil {
+			r.AdvertisedRoutes = sorted(m.Node.AvailableRoutes)
+			r.ApprovedRoutes = sorted(m.Node.ApprovedRoutes)
+			r.Created = timestamp(m.Node.CreatedAt.AsTime(), m.Node.CreatedAt != nil)
+			r.LastSeen = timestamp(m.Node.LastSeen.AsTime(), m.Node.LastSeen != nil)
+			r.KeyExpiry = timestamp(m.Node.Expiry.AsTime(), m.Node.Expiry.GetSeconds() > 0 && m.Node.Expiry.AsTime().Year() <= 9000)
+		} else {
+			r.AdvertisedRoutes = []string{}
+			r.ApprovedRoutes = []string{}
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// known returns s, or "" for the "-" models.Machine returns for unknown values
+func known(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// nonNil returns items, or an empty slice so JSON exports contain [] instead of null
+func nonNil(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
+
+// sorted returns a sorted copy of items
+func sorted(items []string) []string {
+	result := slices.Clone(nonNil(items))
+	slices.Sort(result)
+	return result
+}
+
+// timestamp returns &t in UTC if ok, or nil
+func timestamp(t time.Time, ok bool) *time.Time {
+	if !ok {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
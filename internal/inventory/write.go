@@ -0,0 +1,196 @@
+package inventory
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+)
+
+// column is a column of the CSV and XLSX exports
+type column struct {
+	name  string
+	value func(Record) string
+}
+
+// columns are the CSV and XLSX columns, in order; list fields are joined with spaces
+var columns = []column{
+	{"id", func(r Record) string { return strconv.FormatUint(r.ID, 10) }},
+	{"name", func(r Record) string { return r.Name }},
+	{"hostname", func(r Record) string { return r.Hostname }},
+	{"fqdn", func(r Record) string { return r.FQDN }},
+	{"user", func(r Record) string { return r.User }},
+	{"online", func(r Record) string { return strconv.FormatBool(r.Online) }},
+	{"ips", func(r Record) string { return strings.Join(r.IPs, " ") }},
+	{"os", func(r Record) string { return r.OS }},
+	{"os_version", func(r Record) string { return r.OSVersion }},
+	{"version", func(r Record) string { return r.Version }},
+	{"track", func(r Record) string { return r.Track }},
+	{"auto_update", func(r Record) string { return r.AutoUpdate }},
+	{"tags", func(r Record) string { return strings.Join(r.Tags, " ") }},
+	{"advertised_routes", func(r Record) string { return strings.Join(r.AdvertisedRoutes, " ") }},
+	{"approved_routes", func(r Record) string { return strings.Join(r.ApprovedRoutes, " ") }},
+	{"exit_node", func(r Record) string { return r.ExitNode }},
+	{"endpoints", func(r Record) string { return strings.Join(r.Endpoints, " ") }},
+	{"node_key", func(r Record) string { return r.NodeKey }},
+	{"created", func(r Record) string { return formatTime(r.Created) }},
+	{"last_seen", func(r Record) string { return formatTime(r.LastSeen) }},
+	{"key_expiry", func(r Record) string { return formatTime(r.KeyExpiry) }},
+}
+
+// header returns the column names
+func header() []string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+	}
+	return names
+}
+
+// formatTime formats t as RFC 3339, or "" if nil
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// ContentType returns the MIME type of an export format
+func ContentType(format string) string {
+	switch format {
+	case config.ExportFormatCSV:
+		return "text/csv; charset=utf-8"
+	case config.ExportFormatJSON:
+		return "application/json"
+	case config.ExportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return ""
+}
+
+// Write writes records in the given format
+func Write(w io.Writer, format string, records []Record) error {
+	switch format {
+	case config.ExportFormatCSV:
+		return WriteCSV(w, records)
+	case config.ExportFormatJSON:
+		return WriteJSON(w, records)
+	case config.ExportFormatXLSX:
+		return WriteXLSX(w, records)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// WriteJSON writes records as an indented JSON array
+func WriteJSON(w io.Writer, records []Record) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// WriteCSV writes a header row and one row per record
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header()); err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+	for _, r := range records {
+		for i, col := range columns {
+			row[i] = escapeFormula(col.value(r))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// escapeFormula prefixes values that spreadsheets would evaluate as formulas with a quote
+// OS hostnames and tags are chosen by whoever controls the machine, so they are untrusted.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// xlsxParts are the fixed parts of a single-sheet workbook
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Machines" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// WriteXLSX writes records as an Excel workbook with a single sheet
+// Every cell is an inline string, so values are never interpreted as formulas or numbers.
+func WriteXLSX(w io.Writer, records []Record) error {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var sheet strings.Builder
+	sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	sheet.WriteString(`<sheetData>`)
+	writeXLSXRow(&sheet, header())
+	row := make([]string, len(columns))
+	for _, r := range records {
+		for i, col := range columns {
+			row[i] = col.value(r)
+		}
+		writeXLSXRow(&sheet, row)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+	if _, err := io.WriteString(f, sheet.String()); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// writeXLSXRow appends a row of inline string cells
+func writeXLSXRow(sheet *strings.Builder, values []string) {
+	sheet.WriteString("<row>")
+	for _, v := range values {
+		sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		xml.EscapeText(sheet, []byte(v))
+		sheet.WriteString(`</t></is></c>`)
+	}
+	sheet.WriteString("</row>")
+}
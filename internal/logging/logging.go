@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Subsystems are the names accepted in logging.levels, each with its own logger from For
+var Subsystems = []string{
+	"alerts",
+	"auth",
+	"email",
+	"handlers",
+	"history",
+	"http",
+	"inventory",
+	"sse",
+	"watcher",
+	"webhooks",
+}
+
+// settings is the output handler and levels installed by Setup
+type settings struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+}
+
+// levelFor returns the minimum level logged for a subsystem ("" for the default logger)
+func (s *settings) levelFor(subsystem string) slog.Level {
+	if level, ok := s.levels[subsystem]; ok {
+		return level
+	}
+	return s.level
+}
+
+var current atomic.Pointer[settings]
+
+func init() {
+	current.Store(&settings{
+		handler: slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		level:   slog.LevelInfo,
+	})
+}
+
+// Setup configures the format and levels of all loggers, including ones already returned by For,
+// and routes the default slog logger and the standard log package through them
+func Setup(cfg config.LoggingConfig) error {
+	return setup(cfg, os.Stderr)
+}
+
+// setup configures logging to write to w
+func setup(cfg config.LoggingConfig, w io.Writer) error {
+	s := &settings{levels: make(map[string]slog.Level)}
+
+	if err := s.level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("logging.level: %w", err)
+	}
+	for subsystem, level := range cfg.Levels {
+		if !slices.Contains(Subsystems, subsystem) {
+			return fmt.Errorf("logging.levels: unknown subsystem %q (known: %s)", subsystem, strings.Join(Subsystems, ", "))
+		}
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("logging.levels.%s: %w", subsystem, err)
+		}
+		s.levels[subsystem] = l
+	}
+
+	// Levels are filtered per subsystem before records reach the output handler
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if cfg.Format == config.LogFormatJSON {
+		s.handler = slog.NewJSONHandler(w, opts)
+	} else {
+		s.handler = slog.NewTextHandler(w, opts)
+	}
+
+	current.Store(s)
+	slog.SetDefault(slog.New(&handler{}))
+	return nil
+}
+
+// For returns the logger of a subsystem; records carry a subsystem attribute and are filtered
+// by the subsystem's level. It can be called before Setup, e.g. for package-level loggers.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&handler{subsystem: subsystem})
+}
+
+// handler resolves the current settings on every record, so loggers created before Setup follow it
+// Records logged with a request context carry its request ID and trace ID.
+type handler struct {
+	subsystem string
+	ops       []func(slog.Handler) slog.Handler // WithAttrs and WithGroup calls, in order
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= current.Load().levelFor(h.subsystem)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	out := current.Load().handler
+	if h.subsystem != "" {
+		out = out.WithAttrs([]slog.Attr{slog.String("subsystem", h.subsystem)})
+	}
+	if info := requestInfoFrom(ctx); info != nil {
+		out = out.WithAttrs([]slog.Attr{slog.String("request_id", info.id)})
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() && spanContext.IsSampled() {
+		out = out.WithAttrs([]slog.Attr{slog.String("trace_id", spanContext.TraceID().String())})
+	}
+	for _, op := range h.ops {
+		out = op(out)
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithGroup(name) })
+}
+
+func (h *handler) with(op func(slog.Handler) slog.Handler) *handler {
+	return &handler{subsystem: h.subsystem, ops: append(slices.Clip(h.ops), op)}
+}
@@ -0,0 +1,158 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capture sets up logging with cfg and returns the buffer log output is written to
+func capture(t *testing.T, cfg config.LoggingConfig) *bytes.Buffer {
+	t.Helper()
+	previous, previousDefault := current.Load(), slog.Default()
+	t.Cleanup(func() {
+		current.Store(previous)
+		slog.SetDefault(previousDefault)
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, setup(cfg, &buf))
+	return &buf
+}
+
+// records decodes JSON log output, one record per line
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		out = append(out, record)
+	}
+	return out
+}
+
+// TestFor_Levels tests that each subsystem is filtered by its own level, falling back to the default
+func TestFor_Levels(t *testing.T) {
+	// Created before setup, like package-level loggers
+	sse := For("sse")
+	auth := For("auth").With("method", "whois")
+
+	buf := capture(t, config.LoggingConfig{
+		Format: config.LogFormatJSON,
+		Level:  "warn",
+		Levels: map[string]string{"sse": "debug"},
+	})
+
+	sse.Debug("Broadcasting machines table update", "machines", 3)
+	auth.Info("WhoIs auth successful")
+	auth.Warn("Failed to initialize OIDC authenticator")
+
+	got := records(t, buf)
+	require.Len(t, got, 2)
+	assert.Equal(t, "sse", got[0]["subsystem"])
+	assert.Equal(t, "DEBUG", got[0]["level"])
+	assert.Equal(t, float64(3), got[0]["machines"])
+	assert.Equal(t, "auth", got[1]["subsystem"])
+	assert.Equal(t, "whois", got[1]["method"])
+}
+
+// TestSetup_Errors tests that unknown subsystems and levels are rejected
+func TestSetup_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.LoggingConfig
+		wantErr string
+	}{
+		{
+			name:    "unknown level",
+			cfg:     config.LoggingConfig{Level: "verbose"},
+			wantErr: "logging.level",
+		},
+		{
+			name:    "unknown subsystem",
+			cfg:     config.LoggingConfig{Level: "info", Levels: map[string]string{"ssh": "debug"}},
+			wantErr: `unknown subsystem "ssh"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setup(tt.cfg, &bytes.Buffer{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestMiddleware tests that requests are logged with their ID, route, status and actor,
+// and that handler logs carry the same request ID
+func TestMiddleware(t *testing.T) {
+	buf := capture(t, config.LoggingConfig{Format: config.LogFormatJSON, Level: "info"})
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetActor(r.Context(), "alice@example.com")
+		For("handlers").InfoContext(r.Context(), "Approving routes")
+		if r.URL.Path == "/machines/42/fail" {
+			http.Error(w, "Failed to approve routes", http.StatusInternalServerError)
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/machines/42/fail", nil))
+	requestID := rec.Header().Get(RequestIDHeader)
+	require.Len(t, requestID, 16)
+
+	got := records(t, buf)
+	require.Len(t, got, 2)
+	assert.Equal(t, "handlers", got[0]["subsystem"])
+	assert.Equal(t, requestID, got[0]["request_id"])
+
+	assert.Equal(t, "http", got[1]["subsystem"])
+	assert.Equal(t, "ERROR", got[1]["level"])
+	assert.Equal(t, requestID, got[1]["request_id"])
+	assert.Equal(t, "POST", got[1]["method"])
+	assert.Equal(t, "/machines/{id}/fail", got[1]["route"])
+	assert.Equal(t, float64(http.StatusInternalServerError), got[1]["status"])
+	assert.Equal(t, "alice@example.com", got[1]["actor"])
+	assert.Contains(t, got[1], "latency")
+
+	// A request ID set by a proxy is kept
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "from-proxy")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "from-proxy", rec.Header().Get(RequestIDHeader))
+}
+
+// TestRouteName tests that IDs in paths are collapsed so routes stay low-cardinality
+func TestRouteName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"/machines", "/machines"},
+		{"/machines/42", "/machines/{id}"},
+		{"/machines/42/routes/subnets/approve", "/machines/{id}/routes/subnets/approve"},
+		{"/users/7/delete", "/users/{id}/delete"},
+		{"/static/js/htmx-1.9.10.min.js", "/static/js/htmx-1.9.10.min.js"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, RouteName(tt.path))
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestIDHeader is set on every response, and reused from the request when a proxy already set it
+const RequestIDHeader = "X-Request-Id"
+
+var httpLogger = For("http")
+
+// requestInfo is shared by the middleware and the handlers of one request
+type requestInfo struct {
+	id string
+
+	mu    sync.Mutex
+	actor string
+}
+
+type requestInfoKey struct{}
+
+// requestInfoFrom returns the request info in ctx, or nil outside a request
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// RequestID returns the ID of the request in ctx, or "" outside a request
+func RequestID(ctx context.Context) string {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// SetActor records the authenticated user of the request in ctx, for its access log line
+func SetActor(ctx context.Context, actor string) {
+	if info := requestInfoFrom(ctx); info != nil {
+		info.mu.Lock()
+		info.actor = actor
+		info.mu.Unlock()
+	}
+}
+
+// Middleware assigns each request an ID and logs it once served, with its route, status,
+// latency and authenticated actor. Server errors are logged at error level.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{id: r.Header.Get(RequestIDHeader)}
+		if info.id == "" {
+			info.id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, info.id)
+
+		ctx := context.WithValue(r.Context(), requestInfoKey{}, info)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		info.mu.Lock()
+		actor := info.actor
+		info.mu.Unlock()
+
+		httpLogger.Log(ctx, level, "Request served",
+			"method", r.Method,
+			"route", RouteName(r.URL.Path),
+			"status", status,
+			"latency", time.Since(start),
+			"actor", actor,
+			"remote", r.RemoteAddr)
+	})
+}
+
+// RouteName returns path with numeric segments replaced by {id}, so requests for different
+// machines and users share a route: /machines/42/routes becomes /machines/{id}/routes
+func RouteName(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment != "" && strings.Trim(segment, "0123456789") == "" {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// newRequestID returns a random 16 character hex ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusWriter records the response status
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses (SSE, diagnostics) working through the wrapper
+func (w *statusWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
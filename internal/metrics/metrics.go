@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/events"
+	"github.com/anupcshan/hsadmin/internal/models"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics holds hsadmin's Prometheus registry and its internal instruments
+type Metrics struct {
+	registry   *prometheus.Registry
+	registerer prometheus.Registerer // registry, adding a tailnet label to a tailnet's metrics
+
+	rpcDuration  *prometheus.HistogramVec
+	rpcErrors    *prometheus.CounterVec
+	pollDuration prometheus.Histogram
+	pollErrors   prometheus.Counter
+}
+
+// New creates a registry with Go runtime, process and hsadmin internal metrics
+// Tailnet and SSE metrics are added with WatchTailnet and WatchBroker once those exist.
+func New() *Metrics {
+	m := NewShared()
+	m.instrument()
+	return m
+}
+
+// NewShared creates a registry with Go runtime and process metrics for several tailnets
+// Each tailnet's metrics come from ForTailnet; the shared Metrics only serves them.
+func NewShared() *Metrics {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return &Metrics{registry: registry, registerer: registry}
+}
+
+// ForTailnet returns the metrics of one of several tailnets, served by m's handler with a tailnet label
+func (m *Metrics) ForTailnet(name string) *Metrics {
+	t := &Metrics{
+		registry:   m.registry,
+		registerer: prometheus.WrapRegistererWith(prometheus.Labels{"tailnet": name}, m.registry),
+	}
+	t.instrument()
+	return t
+}
+
+// instrument creates and registers the internal instruments
+func (m *Metrics) instrument() {
+	m.rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hsadmin_headscale_rpc_duration_seconds",
+		Help:    "Duration of Headscale gRPC calls.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+	m.rpcErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hsadmin_headscale_rpc_errors_total",
+		Help: "Headscale gRPC calls that failed, by status code.",
+	}, []string{"method", "code"})
+	m.pollDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "hsadmin_watcher_poll_duration_seconds",
+		Help:    "Time taken to fetch the tailnet state on each watcher poll.",
+		Buckets: prometheus.DefBuckets,
+	})
+	m.pollErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hsadmin_watcher_poll_errors_total",
+		Help: "Watcher polls that failed to fetch the tailnet state.",
+	})
+
+	m.registerer.MustRegister(
+		m.rpcDuration,
+		m.rpcErrors,
+		m.pollDuration,
+		m.pollErrors,
+	)
+}
+
+// Handler returns the HTTP handler serving the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// UnaryClientInterceptor records the latency and errors of every Headscale gRPC call
+func (m *Metrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		// "/headscale.v1.HeadscaleService/ListNodes" is recorded as "ListNodes"
+		name := method[strings.LastIndex(method, "/")+1:]
+		m.rpcDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.rpcErrors.WithLabelValues(name, status.Code(err).String()).Inc()
+		}
+		return err
+	}
+}
+
+// TimeFetch wraps a watcher fetch function to record how long each poll takes and whether it failed
+func (m *Metrics) TimeFetch(fetch watcher.FetchFunc) watcher.FetchFunc {
+	return func(ctx context.Context) ([]*models.Machine, []*headscale.User, error) {
+		start := time.Now()
+		machines, users, err := fetch(ctx)
+		m.pollDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.pollErrors.Inc()
+		}
+		return machines, users, err
+	}
+}
+
+// WatchBroker exports the number of connected SSE clients and the events they dropped
+func (m *Metrics) WatchBroker(broker *events.Broker) {
+	m.registerer.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "hsadmin_sse_clients",
+			Help: "Connected live update (SSE) clients.",
+		}, func() float64 { return float64(broker.ClientCount()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "hsadmin_sse_dropped_events_total",
+			Help: "Live update events that did not fit in a slow client's buffer.",
+		}, func() float64 { return float64(broker.Dropped()) }),
+	)
+}
+
+// WatchTailnet exports tailnet gauges computed from the latest watcher update at scrape time
+func (m *Metrics) WatchTailnet(latest func() *watcher.Update) {
+	m.registerer.MustRegister(newTailnetCollector(latest))
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/events"
+	"github.com/anupcshan/hsadmin/internal/models"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"tailscale.com/tailcfg"
+)
+
+// scrape returns the metrics page served by m
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+// machine builds a machine for tailnet metric tests
+func machine(id uint64, user, version string, online bool, tags ...string) *models.Machine {
+	hostinfo := &tailcfg.Hostinfo{OS: "linux", IPNVersion: version}
+	return &models.Machine{
+		Node: &headscale.Node{
+			Id:         id,
+			GivenName:  "node",
+			User:       &headscale.User{Name: user},
+			ForcedTags: tags,
+		},
+		WhoIsNode: &tailcfg.Node{Hostinfo: hostinfo.View()},
+		Online:    online,
+	}
+}
+
+// TestTailnetCollector tests the tailnet gauges computed from the latest watcher update
+func TestTailnetCollector(t *testing.T) {
+	now := time.Now()
+	router := machine(3, "bob", "1.80.0", true, "tag:router")
+	router.Node.AvailableRoutes = []string{"10.0.0.0/24", "0.0.0.0/0", "::/0"}
+	router.Node.ApprovedRoutes = []string{"10.0.0.0/24"}
+	router.Node.Expiry = timestamppb.New(now.Add(24 * time.Hour))
+
+	machines := []*models.Machine{
+		machine(1, "alice", "1.80.0", true),
+		machine(2, "alice", "1.80.0", false),
+		router,
+	}
+
+	var latest *watcher.Update
+	m := New()
+	m.WatchTailnet(func() *watcher.Update { return latest })
+
+	// Nothing is exported before the first poll
+	assert.NotContains(t, scrape(t, m), "hsadmin_nodes")
+
+	latest = &watcher.Update{
+		Snapshot: watcher.NewSnapshot(machines, nil, now),
+		Machines: machines,
+	}
+	body := scrape(t, m)
+
+	for _, want := range []string{
+		`hsadmin_nodes{os="linux",user="alice",version="1.80.0"} 2`,
+		`hsadmin_nodes_online{os="linux",user="alice",version="1.80.0"} 1`,
+		`hsadmin_nodes{os="linux",user="bob",version="1.80.0"} 1`,
+		`hsadmin_tagged_nodes{tag="tag:router"} 1`,
+		`hsadmin_tagged_nodes_online{tag="tag:router"} 1`,
+		`hsadmin_pending_routes 2`,
+		`hsadmin_nodes_key_expiring 1`,
+	} {
+		assert.Contains(t, body, want)
+	}
+}
+
+// TestUnaryClientInterceptor tests that Headscale RPC latency and errors are recorded per method
+func TestUnaryClientInterceptor(t *testing.T) {
+	m := New()
+	interceptor := m.UnaryClientInterceptor()
+
+	invoke := func(err error) grpc.UnaryInvoker {
+		return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return err
+		}
+	}
+
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	ctx := context.Background()
+	require.NoError(t, interceptor(ctx, "/headscale.v1.HeadscaleService/ListNodes", nil, nil, nil, invoke(nil)))
+	require.Equal(t, unavailable, interceptor(ctx, "/headscale.v1.HeadscaleService/ListNodes", nil, nil, nil, invoke(unavailable)))
+	require.Error(t, interceptor(ctx, "/headscale.v1.HeadscaleService/ListUsers", nil, nil, nil, invoke(errors.New("boom"))))
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `hsadmin_headscale_rpc_duration_seconds_count{method="ListNodes"} 2`)
+	assert.Contains(t, body, `hsadmin_headscale_rpc_errors_total{code="Unavailable",method="ListNodes"} 1`)
+	assert.Contains(t, body, `hsadmin_headscale_rpc_errors_total{code="Unknown",method="ListUsers"} 1`)
+}
+
+// TestTimeFetch tests that watcher polls and their failures are recorded
+func TestTimeFetch(t *testing.T) {
+	m := New()
+	var err error
+	fetch := m.TimeFetch(func(ctx context.Context) ([]*models.Machine, []*headscale.User, error) {
+		return nil, nil, err
+	})
+
+	_, _, _ = fetch(context.Background())
+	err = errors.New("headscale unavailable")
+	_, _, _ = fetch(context.Background())
+
+	body := scrape(t, m)
+	assert.Contains(t, body, "hsadmin_watcher_poll_duration_seconds_count 2")
+	assert.Contains(t, body, "hsadmin_watcher_poll_errors_total 1")
+}
+
+// TestWatchBroker tests the SSE client and dropped event metrics
+func TestWatchBroker(t *testing.T) {
+	broker := events.NewBroker()
+	defer broker.Close()
+
+	m := New()
+	m.WatchBroker(broker)
+
+	broker.Subscribe(events.TopicMachines)
+	for i := 0; i < 8; i++ {
+		broker.Broadcast(events.Event{Topic: events.TopicMachines, Type: "tick"})
+	}
+
+	body := scrape(t, m)
+	assert.Contains(t, body, "hsadmin_sse_clients 1")
+	assert.Contains(t, body, "hsadmin_sse_dropped_events_total 3")
+}
+
+// TestForTailnet tests that the metrics of several tailnets are served together, told apart by a tailnet label
+func TestForTailnet(t *testing.T) {
+	m := NewShared()
+	for _, name := range []string{"prod", "lab"} {
+		tm := m.ForTailnet(name)
+		fetch := tm.TimeFetch(func(ctx context.Context) ([]*models.Machine, []*headscale.User, error) {
+			return nil, nil, nil
+		})
+		_, _, err := fetch(context.Background())
+		require.NoError(t, err)
+		machines := []*models.Machine{machine(1, "alice", "1.80.0", true)}
+		update := &watcher.Update{Snapshot: watcher.NewSnapshot(machines, nil, time.Now()), Machines: machines}
+		tm.WatchTailnet(func() *watcher.Update { return update })
+	}
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `hsadmin_watcher_poll_duration_seconds_count{tailnet="prod"} 1`)
+	assert.Contains(t, body, `hsadmin_watcher_poll_duration_seconds_count{tailnet="lab"} 1`)
+	assert.Contains(t, body, `hsadmin_nodes{os="linux",tailnet="lab",user="alice",version="1.80.0"} 1`)
+	assert.Contains(t, body, "go_goroutines ")
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/watcher"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	nodesDesc = prometheus.NewDesc(
+		"hsadmin_nodes",
+		"Machines in the tailnet, by user, OS and Tailscale version.",
+		[]string{"user", "os", "version"}, nil)
+	nodesOnlineDesc = prometheus.NewDesc(
+		"hsadmin_nodes_online",
+		"Online machines in the tailnet, by user, OS and Tailscale version.",
+		[]string{"user", "os", "version"}, nil)
+	taggedNodesDesc = prometheus.NewDesc(
+		"hsadmin_tagged_nodes",
+		"Machines with each tag; a machine with several tags is counted once per tag.",
+		[]string{"tag"}, nil)
+	taggedNodesOnlineDesc = prometheus.NewDesc(
+		"hsadmin_tagged_nodes_online",
+		"Online machines with each tag.",
+		[]string{"tag"}, nil)
+	pendingRoutesDesc = prometheus.NewDesc(
+		"hsadmin_pending_routes",
+		"Advertised routes awaiting approval, including exit routes.",
+		nil, nil)
+	keyExpiringDesc = prometheus.NewDesc(
+		"hsadmin_nodes_key_expiring",
+		"Machines whose node key expires within the key expiry warning window.",
+		nil, nil)
+	lastPollDesc = prometheus.NewDesc(
+		"hsadmin_watcher_last_poll_timestamp_seconds",
+		"Time of the last successful watcher poll, which the tailnet metrics reflect.",
+		nil, nil)
+)
+
+// nodeLabels are the label values of the hsadmin_nodes metrics
+type nodeLabels struct {
+	user, os, version string
+}
+
+// tailnetCollector computes tailnet gauges from the latest watcher update on every scrape
+// Nothing is exported before the first successful poll.
+type tailnetCollector struct {
+	latest func() *watcher.Update
+	now    func() time.Time
+}
+
+func newTailnetCollector(latest func() *watcher.Update) *tailnetCollector {
+	return &tailnetCollector{latest: latest, now: time.Now}
+}
+
+// Describe implements prometheus.Collector
+func (c *tailnetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nodesDesc
+	ch <- nodesOnlineDesc
+	ch <- taggedNodesDesc
+	ch <- taggedNodesOnlineDesc
+	ch <- pendingRoutesDesc
+	ch <- keyExpiringDesc
+	ch <- lastPollDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *tailnetCollector) Collect(ch chan<- prometheus.Metric) {
+	u := c.latest()
+	if u == nil {
+		return
+	}
+
+	now := c.now()
+	nodes := make(map[nodeLabels]int)
+	online := make(map[nodeLabels]int)
+	tagged := make(map[string]int)
+	taggedOnline := make(map[string]int)
+	var pendingRoutes, keyExpiring int
+
+	for _, m := range u.Machines {
+		labels := nodeLabels{user: m.User(), os: m.OS(), version: m.TailscaleVersion()}
+		nodes[labels]++
+		if m.Online {
+			online[labels]++
+		}
+		for _, tag := range m.Tags() {
+			tagged[tag]++
+			if m.Online {
+				taggedOnline[tag]++
+			}
+		}
+
+		state := u.Snapshot.Nodes[m.ID()]
+		pendingRoutes += len(state.PendingRoutes)
+		if state.KeyExpiry != nil {
+			if remaining := state.KeyExpiry.Sub(now); remaining > 0 && remaining <= watcher.KeyExpiryWarning {
+				keyExpiring++
+			}
+		}
+	}
+
+	// Label sets with no online machines are exported as 0 so series do not disappear
+	for labels, count := range nodes {
+		ch <- prometheus.MustNewConstMetric(nodesDesc, prometheus.GaugeValue, float64(count), labels.user, labels.os, labels.version)
+		ch <- prometheus.MustNewConstMetric(nodesOnlineDesc, prometheus.GaugeValue, float64(online[labels]), labels.user, labels.os, labels.version)
+	}
+	for tag, count := range tagged {
+		ch <- prometheus.MustNewConstMetric(taggedNodesDesc, prometheus.GaugeValue, float64(count), tag)
+		ch <- prometheus.MustNewConstMetric(taggedNodesOnlineDesc, prometheus.GaugeValue, float64(taggedOnline[tag]), tag)
+	}
+	ch <- prometheus.MustNewConstMetric(pendingRoutesDesc, prometheus.GaugeValue, float64(pendingRoutes))
+	ch <- prometheus.MustNewConstMetric(keyExpiringDesc, prometheus.GaugeValue, float64(keyExpiring))
+	ch <- prometheus.MustNewConstMetric(lastPollDesc, prometheus.GaugeValue, float64(u.Snapshot.At.UnixNano())/1e9)
+}
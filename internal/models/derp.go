@@ -0,0 +1,230 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"tailscale.com/tailcfg"
+)
+
+// Default ports used when a DERP node leaves them unset
+const (
+	defaultDERPPort = 443
+	defaultSTUNPort = 3478
+)
+
+// latencyBuckets are the upper bounds (in ms) of the latency distribution buckets.
+// The final bucket is open-ended.
+var latencyBuckets = []float64{25, 50, 100, 200}
+
+// DERPNodeInfo describes a single DERP server within a region
+type DERPNodeInfo struct {
+	Name     string
+	HostName string
+	IPv4     string
+	IPv6     string
+	DERPPort int // 0 if the node is STUN-only
+	STUNPort int // 0 if STUN is disabled
+	STUNOnly bool
+}
+
+// LatencyBucket counts how many machines fall into a latency range
+type LatencyBucket struct {
+	Label   string
+	Count   int
+	Percent float64 // Share of machines that reported a latency to the region (0-100)
+}
+
+// DERPRegionSummary describes a DERP region along with how the tailnet uses it
+type DERPRegionSummary struct {
+	RegionID   int
+	RegionCode string
+	RegionName string
+	Custom     bool // Not one of Tailscale's default regions
+	Avoid      bool
+	NoHome     bool // Region is not measured and never used as a home DERP
+	Nodes      []DERPNodeInfo
+
+	HomeCount int // Machines using this region as their home DERP
+
+	// Latency from all machines that reported one to this region
+	Reporting int
+	MinMS     float64
+	MedianMS  float64
+	P90MS     float64
+	MaxMS     float64
+	Buckets   []LatencyBucket
+}
+
+// HomeDERPRegionID returns the region ID of the machine's home DERP, or 0 if unknown.
+// derpMap is used to resolve the relay region code reported by tsnet when the node
+// itself does not report a home region.
+func (m *Machine) HomeDERPRegionID(derpMap *tailcfg.DERPMap) int {
+	if m.WhoIsNode != nil {
+		if m.WhoIsNode.HomeDERP != 0 {
+			return m.WhoIsNode.HomeDERP
+		}
+		if m.WhoIsNode.Hostinfo.Valid() {
+			if netInfo := m.WhoIsNode.Hostinfo.NetInfo(); netInfo.Valid() && netInfo.PreferredDERP() != 0 {
+				return netInfo.PreferredDERP()
+			}
+		}
+	}
+
+	if m.PeerStatus != nil && m.PeerStatus.Relay != "" && derpMap != nil {
+		for id, region := range derpMap.Regions {
+			if region != nil && region.RegionCode == m.PeerStatus.Relay {
+				return id
+			}
+		}
+	}
+
+	return 0
+}
+
+// SummarizeDERPMap describes every region in derpMap, counting home DERP usage and
+// collecting the latency distribution from machines to each region.
+// Regions are sorted by ID.
+func SummarizeDERPMap(derpMap *tailcfg.DERPMap, machines []*Machine) []DERPRegionSummary {
+	if derpMap == nil {
+		return nil
+	}
+
+	homeCounts := make(map[int]int)
+	latencies := make(map[int][]float64)
+	for _, m := range machines {
+		if id := m.HomeDERPRegionID(derpMap); id != 0 {
+			homeCounts[id]++
+		}
+		for _, l := range m.ProcessedDERPLatencies(nil) {
+			latencies[l.RegionID] = append(latencies[l.RegionID], l.LatencyMS)
+		}
+	}
+
+	var result []DERPRegionSummary
+	for id, region := range derpMap.Regions {
+		if region == nil {
+			continue
+		}
+
+		summary := DERPRegionSummary{
+			RegionID:   id,
+			RegionCode: region.RegionCode,
+			RegionName: region.RegionName,
+			Custom:     isCustomDERPRegion(region),
+			Avoid:      region.Avoid,
+			NoHome:     region.NoMeasureNoHome,
+			HomeCount:  homeCounts[id],
+		}
+		if summary.RegionName == "" {
+			summary.RegionName = fmt.Sprintf("%d", id)
+		}
+
+		for _, node := range region.Nodes {
+			if node == nil {
+				continue
+			}
+			summary.Nodes = append(summary.Nodes, newDERPNodeInfo(node))
+		}
+
+		summary.setLatencies(latencies[id])
+		result = append(result, summary)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].RegionID < result[j].RegionID
+	})
+
+	return result
+}
+
+// setLatencies fills in the latency statistics and distribution from unsorted samples
+func (s *DERPRegionSummary) setLatencies(samples []float64) {
+	s.Reporting = len(samples)
+
+	s.Buckets = make([]LatencyBucket, len(latencyBuckets)+1)
+	lower := 0.0
+	for i, upper := range latencyBuckets {
+		s.Buckets[i].Label = fmt.Sprintf("%.0f–%.0f ms", lower, upper)
+		lower = upper
+	}
+	s.Buckets[len(latencyBuckets)].Label = fmt.Sprintf("≥%.0f ms", lower)
+
+	if len(samples) == 0 {
+		return
+	}
+
+	sorted := make([]float64, len(samples))
+	copy(sorted, samples)
+	sort.Float64s(sorted)
+
+	s.MinMS = sorted[0]
+	s.MaxMS = sorted[len(sorted)-1]
+	s.MedianMS = percentile(sorted, 50)
+	s.P90MS = percentile(sorted, 90)
+
+	for _, ms := range sorted {
+		bucket := sort.SearchFloat64s(latencyBuckets, ms)
+		// SearchFloat64s returns the index of an equal bound; bounds are exclusive
+		if bucket < len(latencyBuckets) && latencyBuckets[bucket] == ms {
+			bucket++
+		}
+		s.Buckets[bucket].Count++
+	}
+	for i := range s.Buckets {
+		s.Buckets[i].Percent = float64(s.Buckets[i].Count) / float64(len(sorted)) * 100
+	}
+}
+
+// percentile returns the nearest-rank percentile p (0-100) of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// newDERPNodeInfo resolves default ports for a DERP node
+func newDERPNodeInfo(node *tailcfg.DERPNode) DERPNodeInfo {
+	info := DERPNodeInfo{
+		Name:     node.Name,
+		HostName: node.HostName,
+		IPv4:     node.IPv4,
+		IPv6:     node.IPv6,
+		STUNOnly: node.STUNOnly,
+	}
+
+	if !node.STUNOnly {
+		info.DERPPort = node.DERPPort
+		if info.DERPPort == 0 {
+			info.DERPPort = defaultDERPPort
+		}
+	}
+
+	// STUNPort: 0 means the default port, negative means STUN is disabled
+	switch {
+	case node.STUNPort == 0:
+		info.STUNPort = defaultSTUNPort
+	case node.STUNPort > 0:
+		info.STUNPort = node.STUNPort
+	}
+
+	return info
+}
+
+// isCustomDERPRegion reports whether a region is operator-provided rather than one of
+// Tailscale's default regions, which are all served from tailscale.com hostnames
+func isCustomDERPRegion(region *tailcfg.DERPRegion) bool {
+	if len(region.Nodes) == 0 {
+		return true
+	}
+	for _, node := range region.Nodes {
+		if node == nil || !strings.HasSuffix(node.HostName, ".tailscale.com") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+// TestHomeDERPRegionID tests the fallbacks used to determine a machine's home region
+func TestHomeDERPRegionID(t *testing.T) {
+	derpMap := &tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			1:   {RegionID: 1, RegionCode: "nyc"},
+			999: {RegionID: 999, RegionCode: "headscale"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		machine *Machine
+		want    int
+	}{
+		{
+			name:    "no data",
+			machine: &Machine{},
+			want:    0,
+		},
+		{
+			name:    "node home DERP",
+			machine: &Machine{WhoIsNode: &tailcfg.Node{HomeDERP: 999}},
+			want:    999,
+		},
+		{
+			name: "preferred DERP from net info",
+			machine: &Machine{WhoIsNode: &tailcfg.Node{
+				Hostinfo: (&tailcfg.Hostinfo{NetInfo: &tailcfg.NetInfo{PreferredDERP: 1}}).View(),
+			}},
+			want: 1,
+		},
+		{
+			name:    "relay region code from peer status",
+			machine: &Machine{PeerStatus: &ipnstate.PeerStatus{Relay: "headscale"}},
+			want:    999,
+		},
+		{
+			name:    "unknown relay region code",
+			machine: &Machine{PeerStatus: &ipnstate.PeerStatus{Relay: "fra"}},
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.machine.HomeDERPRegionID(derpMap))
+		})
+	}
+}
+
+// TestSummarizeDERPMap tests region details, home counts and latency distribution
+func TestSummarizeDERPMap(t *testing.T) {
+	derpMap := &tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			999: {
+				RegionID:   999,
+				RegionCode: "headscale",
+				RegionName: "Headscale Embedded DERP",
+				Nodes: []*tailcfg.DERPNode{
+					{Name: "999a", RegionID: 999, HostName: "derp.example.com", STUNPort: -1, DERPPort: 8443},
+				},
+			},
+			1: {
+				RegionID:   1,
+				RegionCode: "nyc",
+				RegionName: "New York City",
+				Nodes: []*tailcfg.DERPNode{
+					{Name: "1f", RegionID: 1, HostName: "derp1f.tailscale.com", IPv4: "199.38.181.104"},
+				},
+			},
+		},
+	}
+
+	machines := []*Machine{
+		createMachineWithDERPLatency(t, map[string]float64{"1-v4": 0.010, "999-v4": 0.120}),
+		createMachineWithDERPLatency(t, map[string]float64{"1-v4": 0.050, "999-v4": 0.030}),
+		createMachineWithDERPLatency(t, map[string]float64{"1-v4": 0.300}),
+	}
+	machines[0].WhoIsNode.HomeDERP = 1
+	machines[1].WhoIsNode.HomeDERP = 999
+	machines[2].WhoIsNode.HomeDERP = 999
+
+	regions := SummarizeDERPMap(derpMap, machines)
+	require.Len(t, regions, 2)
+
+	nyc := regions[0]
+	assert.Equal(t, 1, nyc.RegionID, "regions should be sorted by ID")
+	assert.False(t, nyc.Custom)
+	assert.Equal(t, 1, nyc.HomeCount)
+	require.Len(t, nyc.Nodes, 1)
+	assert.Equal(t, 443, nyc.Nodes[0].DERPPort, "unset DERP port defaults to 443")
+	assert.Equal(t, 3478, nyc.Nodes[0].STUNPort, "unset STUN port defaults to 3478")
+
+	assert.Equal(t, 3, nyc.Reporting)
+	assert.Equal(t, 10.0, nyc.MinMS)
+	assert.Equal(t, 50.0, nyc.MedianMS)
+	assert.Equal(t, 300.0, nyc.MaxMS)
+	require.Len(t, nyc.Buckets, 5)
+	assert.Equal(t, 1, nyc.Buckets[0].Count, "10ms falls in the first bucket")
+	assert.Equal(t, 1, nyc.Buckets[2].Count, "50ms falls in the 50-100ms bucket")
+	assert.Equal(t, 1, nyc.Buckets[4].Count, "300ms falls in the open-ended bucket")
+
+	custom := regions[1]
+	assert.Equal(t, 999, custom.RegionID)
+	assert.True(t, custom.Custom)
+	assert.Equal(t, 2, custom.HomeCount)
+	require.Len(t, custom.Nodes, 1)
+	assert.Equal(t, 8443, custom.Nodes[0].DERPPort)
+	assert.Equal(t, 0, custom.Nodes[0].STUNPort, "negative STUN port means disabled")
+	assert.Equal(t, 2, custom.Reporting)
+	assert.Equal(t, 30.0, custom.MinMS)
+	assert.Equal(t, 120.0, custom.MaxMS)
+}
+
+// TestSummarizeDERPMap_NilMap tests that a missing DERP map yields no regions
+func TestSummarizeDERPMap_NilMap(t *testing.T) {
+	assert.Nil(t, SummarizeDERPMap(nil, []*Machine{{}}))
+}
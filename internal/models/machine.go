@@ -340,26 +340,32 @@ func (m *Machine) OSVersion() string {
 	return "-"
 }
 
-// AutoUpdate returns whether auto-update is enabled
+// AutoUpdate returns whether the client applies updates automatically: "true", "false" or "-" if unknown
+// Clients report this as Hostinfo.AllowsUpdate, which is set when the auto-update pref is on.
 func (m *Machine) AutoUpdate() string {
 	if m.WhoIsNode != nil && m.WhoIsNode.Hostinfo.Valid() {
-		if m.WhoIsNode.Hostinfo.GoArch() != "" {
-			// This is a heuristic - need to check actual field if available
-			return "false"
-		}
+		return strconv.FormatBool(m.WhoIsNode.Hostinfo.AllowsUpdate())
 	}
-	return "false"
+	return "-"
 }
 
-// ReleaseTrack returns the Tailscale release track
+// ReleaseTrack returns the Tailscale release track of the client version, or "-" if unknown
 func (m *Machine) ReleaseTrack() string {
-	// This info may not be directly available - would need to check hostinfo
-	return "stable"
+	v, err := ParseVersion(m.TailscaleVersion())
+	if err != nil {
+		return "-"
+	}
+	return v.Track()
 }
 
-// StateEncrypted returns whether state is encrypted
+// StateEncrypted returns whether the client stores its state encrypted at rest
+// Clients before capability version 118 do not report it, and are shown as "false".
 func (m *Machine) StateEncrypted() string {
-	// This info may not be directly available
+	if m.WhoIsNode != nil && m.WhoIsNode.Hostinfo.Valid() {
+		if encrypted, ok := m.WhoIsNode.Hostinfo.StateEncrypted().Get(); ok {
+			return strconv.FormatBool(encrypted)
+		}
+	}
 	return "false"
 }
 
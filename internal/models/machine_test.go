@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"tailscale.com/tailcfg"
+	"tailscale.com/types/opt"
 )
 
 // TestProcessedDERPLatencies_EmptyData tests handling of machines with no DERP latency data
@@ -369,3 +370,31 @@ func createMachineWithRoutes(approved, available []string) *Machine {
 		},
 	}
 }
+
+// TestMachine_AutoUpdateAndTrack tests reading the auto-update setting, release track and state encryption from Hostinfo
+func TestMachine_AutoUpdateAndTrack(t *testing.T) {
+	tests := []struct {
+		name               string
+		hostinfo           *tailcfg.Hostinfo
+		wantAutoUpdate     string
+		wantTrack          string
+		wantStateEncrypted string
+	}{
+		{name: "unknown", wantAutoUpdate: "-", wantTrack: "-", wantStateEncrypted: "false"},
+		{name: "stable with auto-update", hostinfo: &tailcfg.Hostinfo{IPNVersion: "1.80.2-t0f0b2c4a1", AllowsUpdate: true}, wantAutoUpdate: "true", wantTrack: TrackStable, wantStateEncrypted: "false"},
+		{name: "unstable", hostinfo: &tailcfg.Hostinfo{IPNVersion: "1.81.44"}, wantAutoUpdate: "false", wantTrack: TrackUnstable, wantStateEncrypted: "false"},
+		{name: "encrypted state", hostinfo: &tailcfg.Hostinfo{IPNVersion: "1.86.0", StateEncrypted: opt.NewBool(true)}, wantAutoUpdate: "false", wantTrack: TrackStable, wantStateEncrypted: "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Machine{}
+			if tt.hostinfo != nil {
+				m.WhoIsNode = &tailcfg.Node{Hostinfo: tt.hostinfo.View()}
+			}
+			assert.Equal(t, tt.wantAutoUpdate, m.AutoUpdate())
+			assert.Equal(t, tt.wantTrack, m.ReleaseTrack())
+			assert.Equal(t, tt.wantStateEncrypted, m.StateEncrypted())
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"fmt"
+
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+// PingAttempt is the outcome of a single ping from the hsadmin node to a machine
+type PingAttempt struct {
+	Type      tailcfg.PingType
+	Seq       int // 1-based attempt number within Type
+	LatencyMS float64
+	Endpoint  string // Direct UDP endpoint ("ip:port"), if used
+	PeerRelay string // Peer relay address, if used
+	DERP      string // DERP region code, if relayed via DERP
+	Err       string
+}
+
+// NewPingAttempt converts a LocalClient ping result (or error) into an attempt
+func NewPingAttempt(pingType tailcfg.PingType, seq int, result *ipnstate.PingResult, err error) PingAttempt {
+	attempt := PingAttempt{Type: pingType, Seq: seq}
+	if err != nil {
+		attempt.Err = err.Error()
+		return attempt
+	}
+	if result == nil {
+		attempt.Err = "no response"
+		return attempt
+	}
+
+	attempt.Err = result.Err
+	attempt.LatencyMS = result.LatencySeconds * 1000
+	attempt.Endpoint = result.Endpoint
+	attempt.PeerRelay = result.PeerRelay
+	attempt.DERP = result.DERPRegionCode
+	if attempt.DERP == "" && result.DERPRegionID != 0 {
+		attempt.DERP = fmt.Sprintf("%d", result.DERPRegionID)
+	}
+	return attempt
+}
+
+// OK returns true if the ping got a reply
+func (p PingAttempt) OK() bool {
+	return p.Err == ""
+}
+
+// PathText describes how the ping reached the machine
+func (p PingAttempt) PathText() string {
+	switch {
+	case p.Endpoint != "":
+		return "Direct"
+	case p.PeerRelay != "":
+		return "Peer relay"
+	case p.DERP != "":
+		return "DERP (" + p.DERP + ")"
+	case p.Type == tailcfg.PingTSMP && p.OK():
+		// TSMP replies do not report the path taken
+		return "Tunnel"
+	}
+	return "-"
+}
+
+// Address returns the endpoint or relay used, if known
+func (p PingAttempt) Address() string {
+	if p.Endpoint != "" {
+		return p.Endpoint
+	}
+	return p.PeerRelay
+}
+
+// PingSummary aggregates the attempts of one ping type
+type PingSummary struct {
+	Type     tailcfg.PingType
+	Sent     int
+	Received int
+	MinMS    float64
+	AvgMS    float64
+	MaxMS    float64
+	Path     string // Path of the most recent successful attempt
+	Address  string // Endpoint or relay of the most recent successful attempt
+	Err      string // Error from the most recent failed attempt, if none succeeded
+}
+
+// SummarizePings groups attempts by type, preserving the order in which types first appear
+func SummarizePings(attempts []PingAttempt) []PingSummary {
+	var result []PingSummary
+	index := make(map[tailcfg.PingType]int)
+
+	for _, a := range attempts {
+		i, ok := index[a.Type]
+		if !ok {
+			i = len(result)
+			index[a.Type] = i
+			result = append(result, PingSummary{Type: a.Type})
+		}
+		s := &result[i]
+
+		s.Sent++
+		if !a.OK() {
+			if s.Received == 0 {
+				s.Err = a.Err
+			}
+			continue
+		}
+
+		if s.Received == 0 || a.LatencyMS < s.MinMS {
+			s.MinMS = a.LatencyMS
+		}
+		if a.LatencyMS > s.MaxMS {
+			s.MaxMS = a.LatencyMS
+		}
+		s.AvgMS = (s.AvgMS*float64(s.Received) + a.LatencyMS) / float64(s.Received+1)
+		s.Received++
+		s.Path = a.PathText()
+		s.Address = a.Address()
+		s.Err = ""
+	}
+
+	return result
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+)
+
+// TestNewPingAttempt tests conversion of LocalClient ping results and path detection
+func TestNewPingAttempt(t *testing.T) {
+	tests := []struct {
+		name     string
+		pingType tailcfg.PingType
+		result   *ipnstate.PingResult
+		err      error
+		wantOK   bool
+		wantPath string
+		wantAddr string
+	}{
+		{
+			name:     "direct disco",
+			pingType: tailcfg.PingDisco,
+			result:   &ipnstate.PingResult{LatencySeconds: 0.012, Endpoint: "192.0.2.10:41641"},
+			wantOK:   true,
+			wantPath: "Direct",
+			wantAddr: "192.0.2.10:41641",
+		},
+		{
+			name:     "relayed via DERP",
+			pingType: tailcfg.PingDisco,
+			result:   &ipnstate.PingResult{LatencySeconds: 0.080, DERPRegionID: 999, DERPRegionCode: "headscale"},
+			wantOK:   true,
+			wantPath: "DERP (headscale)",
+		},
+		{
+			name:     "TSMP does not report a path",
+			pingType: tailcfg.PingTSMP,
+			result:   &ipnstate.PingResult{LatencySeconds: 0.020},
+			wantOK:   true,
+			wantPath: "Tunnel",
+		},
+		{
+			name:     "error in result",
+			pingType: tailcfg.PingICMP,
+			result:   &ipnstate.PingResult{Err: "no matching peer"},
+			wantOK:   false,
+			wantPath: "-",
+		},
+		{
+			name:     "client error",
+			pingType: tailcfg.PingICMP,
+			err:      errors.New("context deadline exceeded"),
+			wantOK:   false,
+			wantPath: "-",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempt := NewPingAttempt(tt.pingType, 1, tt.result, tt.err)
+			assert.Equal(t, tt.wantOK, attempt.OK())
+			assert.Equal(t, tt.wantPath, attempt.PathText())
+			assert.Equal(t, tt.wantAddr, attempt.Address())
+		})
+	}
+}
+
+// TestSummarizePings tests per-type aggregation of ping attempts
+func TestSummarizePings(t *testing.T) {
+	attempts := []PingAttempt{
+		{Type: tailcfg.PingDisco, Seq: 1, LatencyMS: 90, DERP: "nyc"},
+		{Type: tailcfg.PingDisco, Seq: 2, LatencyMS: 10, Endpoint: "192.0.2.10:41641"},
+		{Type: tailcfg.PingDisco, Seq: 3, LatencyMS: 20, Endpoint: "192.0.2.10:41641"},
+		{Type: tailcfg.PingICMP, Seq: 1, Err: "timed out after 5s"},
+	}
+
+	summaries := SummarizePings(attempts)
+	require.Len(t, summaries, 2)
+
+	disco := summaries[0]
+	assert.Equal(t, tailcfg.PingDisco, disco.Type)
+	assert.Equal(t, 3, disco.Sent)
+	assert.Equal(t, 3, disco.Received)
+	assert.Equal(t, 10.0, disco.MinMS)
+	assert.Equal(t, 40.0, disco.AvgMS)
+	assert.Equal(t, 90.0, disco.MaxMS)
+	assert.Equal(t, "Direct", disco.Path, "path should come from the latest reply")
+	assert.Equal(t, "192.0.2.10:41641", disco.Address)
+
+	icmp := summaries[1]
+	assert.Equal(t, 1, icmp.Sent)
+	assert.Equal(t, 0, icmp.Received)
+	assert.Equal(t, "timed out after 5s", icmp.Err)
+}
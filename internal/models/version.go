@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tailscale release tracks
+const (
+	TrackStable   = "stable"
+	TrackUnstable = "unstable"
+)
+
+// Version is a parsed Tailscale client version (major, minor, patch)
+type Version [3]int
+
+// ParseVersion parses versions like "1.76.1", "v1.76" or "1.76.1-t0f0b2c4a1-g1234abcd",
+// ignoring any pre-release or build suffix
+func ParseVersion(s string) (Version, error) {
+	var v Version
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, fmt.Errorf("invalid version %q: want major.minor[.patch]", s)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q: %q is not a number", s, part)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// Less returns true if v is an older version than other
+func (v Version) Less(other Version) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] < other[i]
+		}
+	}
+	return false
+}
+
+// String returns the version as major.minor.patch
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// Track returns the release track of the version: Tailscale's unstable builds have odd minor versions
+func (v Version) Track() string {
+	if v[1]%2 == 1 {
+		return TrackUnstable
+	}
+	return TrackStable
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseVersion tests parsing and comparing client versions
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Version
+		wantErr bool
+	}{
+		{input: "1.76.1", want: Version{1, 76, 1}},
+		{input: "v1.60", want: Version{1, 60, 0}},
+		{input: "1.58.2-t1234abcd-g5678", want: Version{1, 58, 2}},
+		{input: "-", wantErr: true},
+		{input: "1", wantErr: true},
+		{input: "1.x.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseVersion(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	assert.True(t, Version{1, 58, 2}.Less(Version{1, 60, 0}))
+	assert.False(t, Version{1, 60, 0}.Less(Version{1, 60, 0}))
+	assert.False(t, Version{2, 0, 0}.Less(Version{1, 99, 99}))
+}
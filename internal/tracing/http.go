@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/anupcshan/hsadmin/internal/logging"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// TraceIDHeader is set on every traced response, so a failing request can be found in the tracing backend
+const TraceIDHeader = "X-Trace-Id"
+
+// Handler traces every request to next as a span named after its route
+// The trace ID of a server error is appended to plain text error pages.
+func Handler(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(withTraceID(next), "http",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + logging.RouteName(r.URL.Path)
+		}))
+}
+
+// withTraceID exposes the request's trace ID in the response and in server error pages
+func withTraceID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID := TraceID(r.Context())
+		if traceID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(TraceIDHeader, traceID)
+		tw := &traceIDWriter{ResponseWriter: w}
+		next.ServeHTTP(tw, r)
+
+		if tw.status >= http.StatusInternalServerError && tw.plainText {
+			fmt.Fprintf(w, "Trace ID: %s\n", traceID)
+		}
+	})
+}
+
+// traceIDWriter records the response status, and whether the body is plain text as written by http.Error
+type traceIDWriter struct {
+	http.ResponseWriter
+	status    int
+	plainText bool
+}
+
+func (w *traceIDWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.plainText = strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *traceIDWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses (SSE, diagnostics) working through the wrapper
+func (w *traceIDWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *traceIDWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// TestHandler_TraceID tests that responses carry their trace ID and server error pages show it
+func TestHandler_TraceID(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	defer provider.Shutdown(t.Context())
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fail":
+			http.Error(w, "Failed to fetch machines: unavailable", http.StatusInternalServerError)
+		case "/stream":
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+
+	tests := []struct {
+		name      string
+		path      string
+		wantCode  int
+		wantTrace bool // Trace ID appended to the body
+	}{
+		{name: "success", path: "/machines", wantCode: http.StatusOK},
+		{name: "server error", path: "/fail", wantCode: http.StatusInternalServerError, wantTrace: true},
+		{name: "streaming", path: "/stream", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+
+			require.Equal(t, tt.wantCode, rec.Code)
+			traceID := rec.Header().Get(TraceIDHeader)
+			require.Len(t, traceID, 32)
+			if tt.wantTrace {
+				assert.Equal(t, "Failed to fetch machines: unavailable\nTrace ID: "+traceID+"\n", rec.Body.String())
+			} else {
+				assert.NotContains(t, rec.Body.String(), "Trace ID")
+			}
+		})
+	}
+}
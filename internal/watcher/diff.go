@@ -0,0 +1,215 @@
+package watcher
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// KeyExpiryWarning is how long before a node key expires that a node.key_expiring event is sent
+const KeyExpiryWarning = 7 * 24 * time.Hour
+
+// Diff returns the events that turn prev into curr.
+// Node events come first in node ID order (removals last), followed by user events (deletions last).
+// A nil prev is treated as a baseline and only produces warnings for keys already expiring soon,
+// so they are still sent after a restart.
+func Diff(prev, curr *Snapshot) []Event {
+	if curr == nil {
+		return nil
+	}
+	if prev == nil {
+		return expiringKeys(curr)
+	}
+
+	var events []Event
+	newEvent := func(eventType EventType) Event {
+		return NewEvent(eventType, curr.At)
+	}
+
+	for _, id := range sortedKeys(curr.Nodes) {
+		node := curr.Nodes[id]
+		old, existed := prev.Nodes[id]
+
+		if !existed {
+			e := newEvent(NodeAdded)
+			e.Node = &node
+			events = append(events, e)
+
+			if len(node.PendingRoutes) > 0 {
+				e := newEvent(NodeRoutesPending)
+				e.Node = &node
+				e.Routes = node.PendingRoutes
+				events = append(events, e)
+			}
+
+			if expiringSoon(node.KeyExpiry, curr.At) {
+				e := newEvent(NodeKeyExpiring)
+				e.Node = &node
+				events = append(events, e)
+			}
+			continue
+		}
+
+		if node.Name != old.Name {
+			e := newEvent(NodeRenamed)
+			e.Node = &node
+			e.Previous = old.Name
+			events = append(events, e)
+		}
+
+		if node.User != old.User {
+			e := newEvent(NodeUserChanged)
+			e.Node = &node
+			e.Previous = old.User
+			events = append(events, e)
+		}
+
+		if node.Online != old.Online {
+			e := newEvent(NodeOffline)
+			if node.Online {
+				e = newEvent(NodeOnline)
+			}
+			e.Node = &node
+			events = append(events, e)
+		}
+
+		if added := difference(node.PendingRoutes, old.PendingRoutes); len(added) > 0 {
+			e := newEvent(NodeRoutesPending)
+			e.Node = &node
+			e.Routes = added
+			events = append(events, e)
+		}
+
+		if !slices.Equal(node.ApprovedRoutes, old.ApprovedRoutes) {
+			e := newEvent(NodeRoutesChanged)
+			e.Node = &node
+			e.Routes = node.ApprovedRoutes
+			events = append(events, e)
+		}
+
+		added, removed := difference(node.Tags, old.Tags), difference(old.Tags, node.Tags)
+		if len(added) > 0 || len(removed) > 0 {
+			e := newEvent(NodeTagsChanged)
+			e.Node = &node
+			e.TagsAdded = added
+			e.TagsRemoved = removed
+			events = append(events, e)
+		}
+
+		// Warn once when the key enters the warning window, and again if it is renewed
+		// to an expiry that later enters the window
+		if expiringSoon(node.KeyExpiry, curr.At) &&
+			!(expiringSoon(old.KeyExpiry, prev.At) && old.KeyExpiry.Equal(*node.KeyExpiry)) {
+			e := newEvent(NodeKeyExpiring)
+			e.Node = &node
+			events = append(events, e)
+		}
+	}
+
+	for _, id := range sortedKeys(prev.Nodes) {
+		if _, exists := curr.Nodes[id]; !exists {
+			node := prev.Nodes[id]
+			e := newEvent(NodeRemoved)
+			e.Node = &node
+			events = append(events, e)
+		}
+	}
+
+	for _, id := range sortedKeys(curr.Users) {
+		user := curr.Users[id]
+		old, existed := prev.Users[id]
+
+		if !existed {
+			e := newEvent(UserCreated)
+			e.User = &user
+			events = append(events, e)
+		} else if user.Name != old.Name {
+			e := newEvent(UserRenamed)
+			e.User = &user
+			e.Previous = old.Name
+			events = append(events, e)
+		}
+	}
+
+	for _, id := range sortedKeys(prev.Users) {
+		if _, exists := curr.Users[id]; !exists {
+			user := prev.Users[id]
+			e := newEvent(UserDeleted)
+			e.User = &user
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+// Changed returns the IDs of the machines and users present in both snapshots whose
+// fields shown in the UI differ, in ascending order. Unlike Diff it covers fields that
+// have no event, such as IPs, client versions and endpoints; added and removed
+// machines and users are reported by Diff only.
+func Changed(prev, curr *Snapshot) (nodes, users []uint64) {
+	if prev == nil || curr == nil {
+		return nil, nil
+	}
+	return changedKeys(prev.nodeHashes, curr.nodeHashes), changedKeys(prev.userHashes, curr.userHashes)
+}
+
+// changedKeys returns the keys present in both prev and curr with different hashes, in ascending order
+func changedKeys(prev, curr map[uint64]stateHash) []uint64 {
+	var changed []uint64
+	for _, id := range sortedKeys(curr) {
+		if old, existed := prev[id]; existed && old != curr[id] {
+			changed = append(changed, id)
+		}
+	}
+	return changed
+}
+
+// expiringKeys returns a NodeKeyExpiring event for each node whose key is inside the warning window, in node ID order
+func expiringKeys(s *Snapshot) []Event {
+	var events []Event
+	for _, id := range sortedKeys(s.Nodes) {
+		node := s.Nodes[id]
+		if expiringSoon(node.KeyExpiry, s.At) {
+			e := NewEvent(NodeKeyExpiring, s.At)
+			e.Node = &node
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// expiringSoon returns true if expiry is set and falls within KeyExpiryWarning after at
+func expiringSoon(expiry *time.Time, at time.Time) bool {
+	if expiry == nil {
+		return false
+	}
+	remaining := expiry.Sub(at)
+	return remaining > 0 && remaining <= KeyExpiryWarning
+}
+
+// difference returns the items in a that are not in b, preserving order
+func difference(a, b []string) []string {
+	seen := make(map[string]bool, len(b))
+	for _, item := range b {
+		seen[item] = true
+	}
+
+	var result []string
+	for _, item := range a {
+		if !seen[item] {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys[V any](m map[uint64]V) []uint64 {
+	keys := make([]uint64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,240 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// snapshot builds a snapshot from nodes and users for tests
+func snapshot(nodes []NodeState, users []UserState) *Snapshot {
+	s := &Snapshot{
+		At:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Nodes: make(map[uint64]NodeState),
+		Users: make(map[uint64]UserState),
+	}
+	for _, n := range nodes {
+		s.Nodes[n.ID] = n
+	}
+	for _, u := range users {
+		s.Users[u.ID] = u
+	}
+	return s
+}
+
+// later returns s with its time moved forward by d
+func later(s *Snapshot, d time.Duration) *Snapshot {
+	s.At = s.At.Add(d)
+	return s
+}
+
+// TestDiff tests the events produced between two snapshots
+func TestDiff(t *testing.T) {
+	laptop := NodeState{ID: 1, Name: "laptop", User: "alice", Online: true}
+	router := NodeState{ID: 2, Name: "router", User: "bob", Online: true, Tags: []string{"tag:router"}}
+	alice := UserState{ID: 1, Name: "alice"}
+
+	with := func(n NodeState, modify func(*NodeState)) NodeState {
+		modify(&n)
+		return n
+	}
+	expires := func(d time.Duration) func(*NodeState) {
+		expiry := snapshot(nil, nil).At.Add(d)
+		return func(n *NodeState) { n.KeyExpiry = &expiry }
+	}
+
+	tests := []struct {
+		name      string
+		prev      *Snapshot
+		curr      *Snapshot
+		wantTypes []EventType
+		wantCheck func(t *testing.T, events []Event)
+	}{
+		{
+			name:      "baseline produces no events",
+			prev:      nil,
+			curr:      snapshot([]NodeState{laptop}, []UserState{alice}),
+			wantTypes: nil,
+		},
+		{
+			name:      "baseline warns about keys already in warning window",
+			prev:      nil,
+			curr:      snapshot([]NodeState{with(laptop, expires(5*24*time.Hour)), with(router, expires(30*24*time.Hour))}, nil),
+			wantTypes: []EventType{NodeKeyExpiring},
+			wantCheck: func(t *testing.T, events []Event) {
+				assert.Equal(t, "laptop", events[0].Node.Name)
+			},
+		},
+		{
+			name:      "no changes",
+			prev:      snapshot([]NodeState{laptop, router}, []UserState{alice}),
+			curr:      snapshot([]NodeState{laptop, router}, []UserState{alice}),
+			wantTypes: nil,
+		},
+		{
+			name:      "node added and removed",
+			prev:      snapshot([]NodeState{laptop}, nil),
+			curr:      snapshot([]NodeState{router}, nil),
+			wantTypes: []EventType{NodeAdded, NodeRemoved},
+			wantCheck: func(t *testing.T, events []Event) {
+				assert.Equal(t, "router", events[0].Node.Name)
+				assert.Equal(t, "laptop", events[1].Node.Name)
+			},
+		},
+		{
+			name: "added node with pending routes",
+			prev: snapshot(nil, nil),
+			curr: snapshot([]NodeState{with(router, func(n *NodeState) {
+				n.PendingRoutes = []string{"10.0.0.0/24"}
+			})}, nil),
+			wantTypes: []EventType{NodeAdded, NodeRoutesPending},
+		},
+		{
+			name: "node goes offline",
+			prev: snapshot([]NodeState{laptop}, nil),
+			curr: snapshot([]NodeState{with(laptop, func(n *NodeState) {
+				n.Online = false
+			})}, nil),
+			wantTypes: []EventType{NodeOffline},
+		},
+		{
+			name: "node comes online",
+			prev: snapshot([]NodeState{with(laptop, func(n *NodeState) {
+				n.Online = false
+			})}, nil),
+			curr:      snapshot([]NodeState{laptop}, nil),
+			wantTypes: []EventType{NodeOnline},
+		},
+		{
+			name: "only newly pending routes are reported",
+			prev: snapshot([]NodeState{with(router, func(n *NodeState) {
+				n.PendingRoutes = []string{"10.0.0.0/24"}
+			})}, nil),
+			curr: snapshot([]NodeState{with(router, func(n *NodeState) {
+				n.PendingRoutes = []string{"0.0.0.0/0", "10.0.0.0/24"}
+			})}, nil),
+			wantTypes: []EventType{NodeRoutesPending},
+			wantCheck: func(t *testing.T, events []Event) {
+				assert.Equal(t, []string{"0.0.0.0/0"}, events[0].Routes)
+			},
+		},
+		{
+			name: "approving routes",
+			prev: snapshot([]NodeState{with(router, func(n *NodeState) {
+				n.PendingRoutes = []string{"10.0.0.0/24"}
+			})}, nil),
+			curr: snapshot([]NodeState{with(router, func(n *NodeState) {
+				n.ApprovedRoutes = []string{"10.0.0.0/24"}
+			})}, nil),
+			wantTypes: []EventType{NodeRoutesChanged},
+			wantCheck: func(t *testing.T, events []Event) {
+				assert.Equal(t, []string{"10.0.0.0/24"}, events[0].Routes)
+			},
+		},
+		{
+			name: "renamed and moved",
+			prev: snapshot([]NodeState{laptop}, nil),
+			curr: snapshot([]NodeState{with(laptop, func(n *NodeState) {
+				n.Name = "work-laptop"
+				n.User = "bob"
+			})}, nil),
+			wantTypes: []EventType{NodeRenamed, NodeUserChanged},
+			wantCheck: func(t *testing.T, events []Event) {
+				assert.Equal(t, "Machine laptop was renamed to work-laptop", events[0].Message())
+				assert.Equal(t, "Machine work-laptop (bob) was moved from user alice", events[1].Message())
+			},
+		},
+		{
+			name: "tags changed",
+			prev: snapshot([]NodeState{router}, nil),
+			curr: snapshot([]NodeState{with(router, func(n *NodeState) {
+				n.Tags = []string{"tag:exit"}
+			})}, nil),
+			wantTypes: []EventType{NodeTagsChanged},
+			wantCheck: func(t *testing.T, events []Event) {
+				assert.Equal(t, []string{"tag:exit"}, events[0].TagsAdded)
+				assert.Equal(t, []string{"tag:router"}, events[0].TagsRemoved)
+				assert.Equal(t, "Machine router (bob) tags changed: +tag:exit -tag:router", events[0].Message())
+			},
+		},
+		{
+			name:      "key enters expiry warning window",
+			prev:      snapshot([]NodeState{with(laptop, expires(8*24*time.Hour))}, nil),
+			curr:      later(snapshot([]NodeState{with(laptop, expires(8*24*time.Hour))}, nil), 2*24*time.Hour),
+			wantTypes: []EventType{NodeKeyExpiring},
+			wantCheck: func(t *testing.T, events []Event) {
+				assert.Equal(t, "Machine laptop (alice) key expires Jan 9, 2025 at 00:00 UTC (in 6d 0h)", events[0].Message())
+			},
+		},
+		{
+			name:      "key already in warning window",
+			prev:      snapshot([]NodeState{with(laptop, expires(5*24*time.Hour))}, nil),
+			curr:      later(snapshot([]NodeState{with(laptop, expires(5*24*time.Hour))}, nil), time.Hour),
+			wantTypes: nil,
+		},
+		{
+			name:      "key renewed into a new expiry inside the window",
+			prev:      snapshot([]NodeState{with(laptop, expires(time.Hour))}, nil),
+			curr:      snapshot([]NodeState{with(laptop, expires(3*24*time.Hour))}, nil),
+			wantTypes: []EventType{NodeKeyExpiring},
+		},
+		{
+			name:      "expired key is not expiring",
+			prev:      snapshot([]NodeState{with(laptop, expires(time.Hour))}, nil),
+			curr:      later(snapshot([]NodeState{with(laptop, expires(time.Hour))}, nil), 2*time.Hour),
+			wantTypes: nil,
+		},
+		{
+			name:      "user created",
+			prev:      snapshot(nil, nil),
+			curr:      snapshot(nil, []UserState{alice}),
+			wantTypes: []EventType{UserCreated},
+			wantCheck: func(t *testing.T, events []Event) {
+				assert.Equal(t, "User alice was created", events[0].Message())
+			},
+		},
+		{
+			name:      "user renamed and deleted",
+			prev:      snapshot(nil, []UserState{alice, {ID: 2, Name: "bob"}}),
+			curr:      snapshot(nil, []UserState{{ID: 1, Name: "alice2"}}),
+			wantTypes: []EventType{UserRenamed, UserDeleted},
+			wantCheck: func(t *testing.T, events []Event) {
+				assert.Equal(t, "User alice was renamed to alice2", events[0].Message())
+				assert.Equal(t, "User bob was deleted", events[1].Message())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := Diff(tt.prev, tt.curr)
+
+			var types []EventType
+			for _, e := range events {
+				types = append(types, e.Type)
+				assert.NotEmpty(t, e.ID)
+				assert.Equal(t, tt.curr.At, e.Time)
+			}
+			require.Equal(t, tt.wantTypes, types)
+
+			if tt.wantCheck != nil {
+				tt.wantCheck(t, events)
+			}
+		})
+	}
+}
+
+// TestInTailnet tests that events from one of several tailnets name it, without changing the originals
+func TestInTailnet(t *testing.T) {
+	events := Diff(snapshot(nil, nil), snapshot(nil, []UserState{{ID: 1, Name: "alice"}}))
+	require.Len(t, events, 1)
+
+	assert.Equal(t, events, InTailnet("", events))
+
+	attributed := InTailnet("prod", events)
+	assert.Equal(t, "prod", attributed[0].Tailnet)
+	assert.Equal(t, "[prod] User alice was created", attributed[0].Message())
+	assert.Equal(t, "User alice was created", events[0].Message())
+}
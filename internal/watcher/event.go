@@ -0,0 +1,211 @@
+package watcher
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/format"
+)
+
+// EventType identifies a kind of tailnet change
+type EventType string
+
+// Tailnet change event types
+const (
+	NodeAdded         EventType = "node.added"
+	NodeRemoved       EventType = "node.removed"
+	NodeRenamed       EventType = "node.renamed"
+	NodeUserChanged   EventType = "node.user_changed"
+	NodeOnline        EventType = "node.online"
+	NodeOffline       EventType = "node.offline"
+	NodeRoutesPending EventType = "node.routes_pending" // New routes advertised and awaiting approval
+	NodeRoutesChanged EventType = "node.routes_changed" // Approved routes changed
+	NodeTagsChanged   EventType = "node.tags_changed"
+	NodeKeyExpiring   EventType = "node.key_expiring" // Node key expires within KeyExpiryWarning
+	UserCreated       EventType = "user.created"
+	UserRenamed       EventType = "user.renamed"
+	UserDeleted       EventType = "user.deleted"
+
+	// Alert events are produced by the alert engine rather than Diff
+	AlertFiring   EventType = "alert.firing"
+	AlertResolved EventType = "alert.resolved"
+
+	// Test is sent on demand to check an endpoint and is never produced by Diff
+	Test EventType = "test"
+)
+
+// EventTypes lists the event types produced by Diff, in display order
+var EventTypes = []EventType{
+	NodeAdded,
+	NodeRemoved,
+	NodeRenamed,
+	NodeUserChanged,
+	NodeOnline,
+	NodeOffline,
+	NodeRoutesPending,
+	NodeRoutesChanged,
+	NodeTagsChanged,
+	NodeKeyExpiring,
+	UserCreated,
+	UserRenamed,
+	UserDeleted,
+}
+
+// AlertEventTypes lists the event types produced by the alert engine
+var AlertEventTypes = []EventType{
+	AlertFiring,
+	AlertResolved,
+}
+
+// IsValidEventType returns true if t is a known event type
+func IsValidEventType(t string) bool {
+	eventType := EventType(t)
+	return slices.Contains(EventTypes, eventType) || slices.Contains(AlertEventTypes, eventType) || eventType == Test
+}
+
+// Event describes a single change to the tailnet
+type Event struct {
+	ID    string      `json:"id"`
+	Type  EventType   `json:"type"`
+	Time  time.Time   `json:"time"`
+	Node  *NodeState  `json:"node,omitempty"`
+	User  *UserState  `json:"user,omitempty"`
+	Alert *AlertState `json:"alert,omitempty"` // alert.firing, alert.resolved
+
+	Tailnet string `json:"tailnet,omitempty"` // Set when hsadmin serves several tailnets
+
+	Routes      []string `json:"routes,omitempty"`       // node.routes_pending: newly advertised; node.routes_changed: all approved
+	TagsAdded   []string `json:"tags_added,omitempty"`   // node.tags_changed
+	TagsRemoved []string `json:"tags_removed,omitempty"` // node.tags_changed
+	Previous    string   `json:"previous,omitempty"`     // node.renamed, user.renamed: old name; node.user_changed: old user
+}
+
+// AlertState describes the alert an alert event is about
+type AlertState struct {
+	Rule        string    `json:"rule"`
+	Kind        string    `json:"kind"`
+	Subject     string    `json:"subject"`
+	MachineID   uint64    `json:"machine_id,omitempty"` // 0 if the alert is not about a single machine
+	Summary     string    `json:"summary"`
+	ActiveSince time.Time `json:"active_since"` // When the condition started holding
+}
+
+// NewEvent creates an event with a fresh random ID
+func NewEvent(eventType EventType, at time.Time) Event {
+	return Event{
+		ID:   newEventID(),
+		Type: eventType,
+		Time: at,
+	}
+}
+
+// InTailnet returns copies of events attributed to the named tailnet, or events unchanged for ""
+func InTailnet(name string, events []Event) []Event {
+	if name == "" || len(events) == 0 {
+		return events
+	}
+	attributed := make([]Event, len(events))
+	for i, e := range events {
+		e.Tailnet = name
+		attributed[i] = e
+	}
+	return attributed
+}
+
+// Message returns a one-line human readable description of the event, prefixed with its tailnet if set
+func (e Event) Message() string {
+	if e.Tailnet != "" {
+		return fmt.Sprintf("[%s] %s", e.Tailnet, e.describe())
+	}
+	return e.describe()
+}
+
+// describe returns a one-line human readable description of what happened
+func (e Event) describe() string {
+	node := "unknown machine"
+	if e.Node != nil {
+		node = fmt.Sprintf("Machine %s (%s)", e.Node.Name, e.Node.User)
+	}
+
+	switch e.Type {
+	case NodeAdded:
+		return node + " was added"
+	case NodeRemoved:
+		return node + " was removed"
+	case NodeRenamed:
+		if e.Node != nil {
+			return fmt.Sprintf("Machine %s was renamed to %s", e.Previous, e.Node.Name)
+		}
+		return "A machine was renamed"
+	case NodeUserChanged:
+		return fmt.Sprintf("%s was moved from user %s", node, e.Previous)
+	case NodeOnline:
+		return node + " is online"
+	case NodeOffline:
+		return node + " is offline"
+	case NodeRoutesPending:
+		return fmt.Sprintf("%s advertised routes awaiting approval: %s", node, strings.Join(e.Routes, ", "))
+	case NodeRoutesChanged:
+		if len(e.Routes) == 0 {
+			return node + " has no approved routes"
+		}
+		return fmt.Sprintf("%s approved routes changed: %s", node, strings.Join(e.Routes, ", "))
+	case NodeTagsChanged:
+		var changes []string
+		for _, tag := range e.TagsAdded {
+			changes = append(changes, "+"+tag)
+		}
+		for _, tag := range e.TagsRemoved {
+			changes = append(changes, "-"+tag)
+		}
+		return fmt.Sprintf("%s tags changed: %s", node, strings.Join(changes, " "))
+	case NodeKeyExpiring:
+		if e.Node != nil && e.Node.KeyExpiry != nil {
+			return fmt.Sprintf("%s key expires %s (in %s)", node,
+				e.Node.KeyExpiry.Format("Jan 2, 2006 at 15:04 MST"), format.Duration(e.Node.KeyExpiry.Sub(e.Time)))
+		}
+		return node + " key expires soon"
+	case UserCreated:
+		if e.User != nil {
+			return fmt.Sprintf("User %s was created", e.User.Name)
+		}
+		return "A user was created"
+	case UserRenamed:
+		if e.User != nil {
+			return fmt.Sprintf("User %s was renamed to %s", e.Previous, e.User.Name)
+		}
+		return "A user was renamed"
+	case UserDeleted:
+		if e.User != nil {
+			return fmt.Sprintf("User %s was deleted", e.User.Name)
+		}
+		return "A user was deleted"
+	case AlertFiring:
+		if e.Alert != nil {
+			return fmt.Sprintf("Alert %s is firing: %s", e.Alert.Rule, e.Alert.Summary)
+		}
+		return "An alert is firing"
+	case AlertResolved:
+		if e.Alert != nil {
+			return fmt.Sprintf("Alert %s resolved: %s", e.Alert.Rule, e.Alert.Summary)
+		}
+		return "An alert was resolved"
+	case Test:
+		return "Test notification from hsadmin"
+	}
+	return string(e.Type)
+}
+
+// newEventID returns a random identifier for an event
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms; fall back to the clock just in case
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
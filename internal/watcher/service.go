@@ -0,0 +1,286 @@
+package watcher
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/logging"
+	"github.com/anupcshan/hsadmin/internal/models"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+)
+
+var logger = logging.For("watcher")
+
+// subscriberBuffer is the number of updates queued per subscriber before further updates are merged
+const subscriberBuffer = 16
+
+// Update is published to subscribers after every successful poll
+// Machines and Users are shared between subscribers and must be treated as read-only.
+// Changes are relative to the previous update the subscriber received, which is the previous poll
+// unless the subscriber fell behind and polls were merged.
+type Update struct {
+	Snapshot *Snapshot
+	Machines []*models.Machine
+	Users    []*headscale.User
+	Events   []Event // Changes since the previous update, oldest first; only expiring keys for the baseline
+	Baseline bool    // First update, with nothing to compare against
+
+	ChangedNodes []uint64 // Machines whose fields shown in the UI changed since the previous update, see Changed
+	ChangedUsers []uint64 // Users whose fields shown in the UI changed since the previous update
+}
+
+// merge returns a single update equivalent to receiving u and then next
+// Events are concatenated so none are lost; change sets are combined and limited to what still exists.
+func (u Update) merge(next Update) Update {
+	if u.Baseline {
+		// The subscriber has not seen any state yet, so next becomes its baseline
+		next.Baseline = true
+		next.Events = Diff(nil, next.Snapshot)
+		next.ChangedNodes = nil
+		next.ChangedUsers = nil
+		return next
+	}
+
+	next.Events = append(append([]Event(nil), u.Events...), next.Events...)
+	next.ChangedNodes = mergeIDs(u.ChangedNodes, next.ChangedNodes, func(id uint64) bool {
+		_, ok := next.Snapshot.Nodes[id]
+		return ok
+	})
+	next.ChangedUsers = mergeIDs(u.ChangedUsers, next.ChangedUsers, func(id uint64) bool {
+		_, ok := next.Snapshot.Users[id]
+		return ok
+	})
+	return next
+}
+
+// mergeIDs returns the sorted union of a and b, keeping only IDs for which exists returns true
+func mergeIDs(a, b []uint64, exists func(uint64) bool) []uint64 {
+	var result []uint64
+	for _, id := range append(append([]uint64(nil), a...), b...) {
+		if exists(id) && !slices.Contains(result, id) {
+			result = append(result, id)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+// Status is the outcome of the watcher's polls of Headscale
+type Status struct {
+	LastPoll    time.Time // Latest attempt; zero before the first
+	LastSuccess time.Time // Latest successful poll; zero before the first
+	Err         error     // Error of the latest poll, nil if it succeeded
+}
+
+// Connected returns true if the latest poll succeeded
+func (s Status) Connected() bool {
+	return !s.LastSuccess.IsZero() && s.Err == nil
+}
+
+// subscriber receives updates on its own goroutine, so a slow subscriber cannot delay the others
+type subscriber struct {
+	name  string
+	ready chan struct{} // Signalled when updates are queued; closed when the service stops
+
+	mu    sync.Mutex
+	queue []Update // At most subscriberBuffer; while full, new updates are merged into the last one
+}
+
+// push queues u without blocking, merging it into the last queued update if the queue is full
+// Returns false if u was merged.
+func (sub *subscriber) push(u Update) bool {
+	sub.mu.Lock()
+	queued := len(sub.queue) < subscriberBuffer
+	if queued {
+		sub.queue = append(sub.queue, u)
+	} else {
+		last := &sub.queue[len(sub.queue)-1]
+		*last = last.merge(u)
+	}
+	sub.mu.Unlock()
+
+	select {
+	case sub.ready <- struct{}{}:
+	default:
+	}
+	return queued
+}
+
+// pop removes and returns the oldest queued update, or false if there is none
+func (sub *subscriber) pop() (Update, bool) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if len(sub.queue) == 0 {
+		return Update{}, false
+	}
+	u := sub.queue[0]
+	sub.queue[0] = Update{} // Release the snapshot for garbage collection
+	sub.queue = sub.queue[1:]
+	return u, true
+}
+
+// Service polls the tailnet and publishes typed change events to subscribers
+// It runs whether or not any browser is connected, so notifiers and recorders see every change.
+type Service struct {
+	fetch    FetchFunc
+	interval time.Duration
+
+	mu              sync.Mutex
+	subscribers     []*subscriber
+	latest          *Update
+	status          Status
+	statusListeners []func(Status)
+}
+
+// NewService creates a watcher that fetches the tailnet state every interval
+func NewService(fetch FetchFunc, interval time.Duration) *Service {
+	return &Service{
+		fetch:    fetch,
+		interval: interval,
+	}
+}
+
+// Subscribe registers fn to be called with every update, in order, on a dedicated goroutine
+// If fn falls more than subscriberBuffer updates behind, further updates are merged into one until it
+// catches up, so it sees fewer snapshots but every event.
+func (s *Service) Subscribe(name string, fn func(Update)) {
+	sub := &subscriber{
+		name:  name,
+		ready: make(chan struct{}, 1),
+	}
+
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, sub)
+	s.mu.Unlock()
+
+	go func() {
+		for range sub.ready {
+			for {
+				u, ok := sub.pop()
+				if !ok {
+					break
+				}
+				fn(u)
+			}
+		}
+	}()
+}
+
+// OnStatusChange registers fn to be called when polls start failing, fail differently or recover
+// fn is called on the polling goroutine and must not block.
+func (s *Service) OnStatusChange(fn func(Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusListeners = append(s.statusListeners, fn)
+}
+
+// Status returns the outcome of the latest poll
+func (s *Service) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Latest returns the most recent update, or nil before the first successful poll
+func (s *Service) Latest() *Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest
+}
+
+// Run polls every interval until ctx is cancelled, then stops all subscribers
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	logger.Info("Starting", "interval", s.interval)
+
+	var prev *Snapshot
+	prev = s.poll(ctx, prev)
+	for {
+		select {
+		case <-ticker.C:
+			prev = s.poll(ctx, prev)
+
+		case <-ctx.Done():
+			s.mu.Lock()
+			for _, sub := range s.subscribers {
+				close(sub.ready)
+			}
+			s.subscribers = nil
+			s.mu.Unlock()
+			logger.Info("Stopped")
+			return
+		}
+	}
+}
+
+// poll fetches the tailnet state once and publishes the changes since prev
+// Returns the snapshot to compare the next poll against; on error prev is kept.
+func (s *Service) poll(ctx context.Context, prev *Snapshot) *Snapshot {
+	machines, users, err := s.fetch(ctx)
+	now := time.Now()
+	s.setStatus(err, now)
+	if err != nil {
+		logger.ErrorContext(ctx, "Error fetching tailnet state", "error", err)
+		return prev
+	}
+
+	curr := NewSnapshot(machines, users, now)
+	changedNodes, changedUsers := Changed(prev, curr)
+	s.publish(Update{
+		Snapshot:     curr,
+		Machines:     machines,
+		Users:        users,
+		Events:       Diff(prev, curr),
+		Baseline:     prev == nil,
+		ChangedNodes: changedNodes,
+		ChangedUsers: changedUsers,
+	})
+	return curr
+}
+
+// setStatus records the outcome of a poll and notifies status listeners if it changed
+func (s *Service) setStatus(err error, at time.Time) {
+	s.mu.Lock()
+	prev := s.status
+	s.status.LastPoll = at
+	s.status.Err = err
+	if err == nil {
+		s.status.LastSuccess = at
+	}
+	status := s.status
+	listeners := s.statusListeners
+	s.mu.Unlock()
+
+	// The first poll always counts as a change, so listeners learn the initial state
+	if !prev.LastPoll.IsZero() && errorText(prev.Err) == errorText(err) {
+		return
+	}
+	for _, fn := range listeners {
+		fn(status)
+	}
+}
+
+// errorText returns err's message, or "" if err is nil
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// publish delivers an update to every subscriber without blocking
+func (s *Service) publish(u Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latest = &u
+	for _, sub := range s.subscribers {
+		if !sub.push(u) {
+			logger.Warn("Subscriber is behind, merging update", "subscriber", sub.name, "events", len(u.Events))
+		}
+	}
+}
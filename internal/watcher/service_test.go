@@ -0,0 +1,219 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/models"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeTailnet is a FetchFunc whose state tests can change between polls
+type fakeTailnet struct {
+	mu       sync.Mutex
+	machines []*models.Machine
+	err      error
+}
+
+func (f *fakeTailnet) fetch(ctx context.Context) ([]*models.Machine, []*headscale.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.machines, nil, f.err
+}
+
+func (f *fakeTailnet) set(machines []*models.Machine, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.machines, f.err = machines, err
+}
+
+// TestService_Publish tests that every subscriber sees the baseline and later changes
+func TestService_Publish(t *testing.T) {
+	tailnet := &fakeTailnet{}
+	tailnet.set([]*models.Machine{{Node: &headscale.Node{Id: 1, GivenName: "laptop"}}}, nil)
+
+	s := NewService(tailnet.fetch, time.Hour)
+	var mu sync.Mutex
+	received := make(map[string][]Update)
+	for _, name := range []string{"a", "b"} {
+		s.Subscribe(name, func(u Update) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[name] = append(received[name], u)
+		})
+	}
+	count := func(name string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received[name])
+	}
+
+	ctx := context.Background()
+	prev := s.poll(ctx, nil)
+
+	// A failed fetch publishes nothing and keeps the previous snapshot
+	tailnet.set(nil, errors.New("headscale unavailable"))
+	assert.Same(t, prev, s.poll(ctx, prev))
+
+	tailnet.set([]*models.Machine{{Node: &headscale.Node{Id: 1, GivenName: "laptop"}, Online: true}}, nil)
+	s.poll(ctx, prev)
+
+	for _, name := range []string{"a", "b"} {
+		require.Eventually(t, func() bool { return count(name) == 2 }, time.Second, time.Millisecond)
+
+		mu.Lock()
+		updates := received[name]
+		mu.Unlock()
+		assert.True(t, updates[0].Baseline)
+		assert.Empty(t, updates[0].Events)
+		assert.False(t, updates[1].Baseline)
+		require.Len(t, updates[1].Events, 1)
+		assert.Equal(t, NodeOnline, updates[1].Events[0].Type)
+		assert.Len(t, updates[1].Machines, 1)
+	}
+
+	require.NotNil(t, s.Latest())
+	assert.True(t, s.Latest().Snapshot.Nodes[1].Online)
+}
+
+// TestService_RestartWithKeyExpiring tests that keys already inside the warning window when hsadmin
+// starts are reported on the baseline, since no later poll sees them enter it
+func TestService_RestartWithKeyExpiring(t *testing.T) {
+	tailnet := &fakeTailnet{}
+	tailnet.set([]*models.Machine{
+		{Node: &headscale.Node{Id: 1, GivenName: "laptop", Expiry: timestamppb.New(time.Now().Add(3 * 24 * time.Hour))}},
+		{Node: &headscale.Node{Id: 2, GivenName: "router"}},
+	}, nil)
+
+	s := NewService(tailnet.fetch, time.Hour)
+	var mu sync.Mutex
+	var received []Update
+	s.Subscribe("email", func(u Update) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, u)
+	})
+
+	ctx := context.Background()
+	s.poll(ctx, s.poll(ctx, nil))
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2
+	}, time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.True(t, received[0].Baseline)
+	require.Len(t, received[0].Events, 1)
+	assert.Equal(t, NodeKeyExpiring, received[0].Events[0].Type)
+	assert.Equal(t, uint64(1), received[0].Events[0].Node.ID)
+	assert.Empty(t, received[1].Events, "the warning is not repeated while the service keeps running")
+}
+
+// TestService_SlowSubscriber tests that a blocked subscriber does not delay the others, and that it
+// still sees every event once it catches up
+func TestService_SlowSubscriber(t *testing.T) {
+	s := NewService((&fakeTailnet{}).fetch, time.Hour)
+
+	block := make(chan struct{})
+	var slowMu sync.Mutex
+	var slow []Update
+	s.Subscribe("slow", func(u Update) {
+		<-block
+		slowMu.Lock()
+		defer slowMu.Unlock()
+		slow = append(slow, u)
+	})
+
+	var mu sync.Mutex
+	fast := 0
+	s.Subscribe("fast", func(u Update) {
+		mu.Lock()
+		defer mu.Unlock()
+		fast++
+	})
+
+	// Publish well past the slow subscriber's buffer, letting the fast one keep up.
+	// Machine i changes in update i and machine 1 is removed halfway.
+	published := subscriberBuffer * 2
+	for i := 1; i <= published; i++ {
+		machines := []*models.Machine{{Node: &headscale.Node{Id: uint64(i)}}}
+		if i < published/2 {
+			machines = append(machines, &models.Machine{Node: &headscale.Node{Id: 1}})
+		}
+		u := Update{Snapshot: NewSnapshot(machines, nil, time.Now()), Baseline: true}
+		if i > 1 {
+			u.Baseline = false
+			u.Events = []Event{NewEvent(NodeOnline, time.Now())}
+			u.ChangedNodes = []uint64{1, uint64(i)}
+		}
+		s.publish(u)
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return fast == i
+		}, time.Second, time.Millisecond)
+	}
+
+	close(block)
+	var events int
+	var last Update
+	require.Eventually(t, func() bool {
+		slowMu.Lock()
+		defer slowMu.Unlock()
+		events = 0
+		for _, u := range slow {
+			events += len(u.Events)
+		}
+		if len(slow) > 0 {
+			last = slow[len(slow)-1]
+		}
+		return events == published-1
+	}, time.Second, time.Millisecond, "every event after the baseline should be delivered")
+
+	slowMu.Lock()
+	defer slowMu.Unlock()
+	assert.LessOrEqual(t, len(slow), subscriberBuffer+1, "updates beyond the buffer should be merged")
+	assert.True(t, slow[0].Baseline)
+	assert.False(t, last.Baseline)
+	assert.NotContains(t, last.ChangedNodes, uint64(1), "removed machines should be dropped from merged changes")
+	assert.Contains(t, last.ChangedNodes, uint64(published))
+	assert.Len(t, last.Snapshot.Nodes, 1, "the merged update should carry the latest snapshot")
+}
+
+// TestService_Status tests that status listeners hear about the first poll, failures and recovery only
+func TestService_Status(t *testing.T) {
+	tailnet := &fakeTailnet{}
+	s := NewService(tailnet.fetch, time.Hour)
+
+	var changes []Status
+	s.OnStatusChange(func(st Status) { changes = append(changes, st) })
+
+	ctx := context.Background()
+	prev := s.poll(ctx, nil)
+	s.poll(ctx, prev)
+	require.Len(t, changes, 1)
+	assert.True(t, changes[0].Connected())
+
+	unavailable := errors.New("headscale unavailable")
+	tailnet.set(nil, unavailable)
+	s.poll(ctx, prev)
+	s.poll(ctx, prev)
+	require.Len(t, changes, 2)
+	assert.False(t, changes[1].Connected())
+	assert.Equal(t, unavailable, changes[1].Err)
+	assert.False(t, changes[1].LastSuccess.IsZero())
+
+	tailnet.set(nil, nil)
+	s.poll(ctx, prev)
+	require.Len(t, changes, 3)
+	assert.True(t, changes[2].Connected())
+	assert.Equal(t, changes[2], s.Status())
+}
@@ -0,0 +1,240 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/models"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+)
+
+// NodeState is the subset of a machine's state that change events are derived from
+type NodeState struct {
+	ID             uint64     `json:"id"`
+	Name           string     `json:"name"`
+	User           string     `json:"user"`
+	IPs            []string   `json:"ips,omitempty"`
+	Online         bool       `json:"online"`
+	Tags           []string   `json:"tags,omitempty"`
+	PendingRoutes  []string   `json:"pending_routes,omitempty"`  // Advertised but not yet approved, including exit routes
+	ApprovedRoutes []string   `json:"approved_routes,omitempty"` // Including exit routes
+	KeyExpiry      *time.Time `json:"key_expiry,omitempty"`      // nil if the node key does not expire
+}
+
+// UserState is the subset of a user's state that change events are derived from
+// It holds every user field shown in the UI, so it doubles as the user's projection for change detection.
+type UserState struct {
+	ID            uint64 `json:"id"`
+	Name          string `json:"name"`
+	DisplayName   string `json:"display_name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	Provider      string `json:"provider,omitempty"`
+	ProfilePicURL string `json:"profile_pic_url,omitempty"`
+}
+
+// Snapshot is the state of the tailnet at a point in time
+type Snapshot struct {
+	At    time.Time
+	Nodes map[uint64]NodeState
+	Users map[uint64]UserState
+
+	nodeHashes map[uint64]stateHash // Hash of each machine's machineView
+	userHashes map[uint64]stateHash // Hash of each user's UserState
+}
+
+// stateHash is the hash of a canonical projection of a machine or user
+type stateHash [sha256.Size]byte
+
+// machineView is the canonical projection of the machine fields shown in the UI
+// Relay latencies and the current connection path are left out: they change with every
+// netcheck and are sampled by history, and the detail page compares its rendering instead.
+type machineView struct {
+	Hostname           string            `json:"hostname"`
+	OSHostname         string            `json:"os_hostname"`
+	User               string            `json:"user"`
+	IPs                []string          `json:"ips"`
+	Online             bool              `json:"online"`
+	LastSeen           int64             `json:"last_seen"` // Unix seconds; the rendered text is relative to now
+	OS                 string            `json:"os"`
+	OSVersion          string            `json:"os_version"`
+	Version            string            `json:"version"`
+	AutoUpdate         string            `json:"auto_update"`
+	ReleaseTrack       string            `json:"release_track"`
+	StateEncrypted     string            `json:"state_encrypted"`
+	Tags               []string          `json:"tags"`
+	AvailableRoutes    []string          `json:"available_routes"`
+	ApprovedRoutes     []string          `json:"approved_routes"`
+	KeyExpiry          string            `json:"key_expiry"`
+	NodeKey            string            `json:"node_key"`
+	Created            string            `json:"created"`
+	ShortDomain        string            `json:"short_domain"`
+	FullDomain         string            `json:"full_domain"`
+	Endpoints          []string          `json:"endpoints"`
+	ClientConnectivity map[string]string `json:"client_connectivity"` // Marshalled with sorted keys
+}
+
+// newMachineView projects the fields of m shown in the UI, with lists sorted
+func newMachineView(m *models.Machine) machineView {
+	v := machineView{
+		Hostname:           m.Hostname(),
+		OSHostname:         m.OSHostname(),
+		User:               m.User(),
+		IPs:                sortedCopy(m.TailscaleIPs()),
+		Online:             m.Online,
+		OS:                 m.OS(),
+		OSVersion:          m.OSVersion(),
+		Version:            m.TailscaleVersion(),
+		AutoUpdate:         m.AutoUpdate(),
+		ReleaseTrack:       m.ReleaseTrack(),
+		StateEncrypted:     m.StateEncrypted(),
+		Tags:               sortedCopy(m.Tags()),
+		KeyExpiry:          m.KeyExpiry(),
+		NodeKey:            m.NodeKey(),
+		Created:            m.Created(),
+		ShortDomain:        m.ShortDomain(),
+		FullDomain:         m.FullDomain(),
+		Endpoints:          sortedCopy(m.Endpoints()),
+		ClientConnectivity: m.ClientConnectivity(),
+	}
+	if m.Node != nil {
+		v.AvailableRoutes = sortedCopy(m.Node.AvailableRoutes)
+		v.ApprovedRoutes = sortedCopy(m.Node.ApprovedRoutes)
+		if m.Node.LastSeen != nil {
+			v.LastSeen = m.Node.LastSeen.GetSeconds()
+		}
+	}
+	return v
+}
+
+// hashState returns the hash of v's JSON encoding, which is canonical for structs of
+// plain fields, sorted slices and maps
+func hashState(v any) stateHash {
+	data, err := json.Marshal(v)
+	if err != nil {
+		// Unreachable for the projection types; treat the state as always changed
+		return stateHash{}
+	}
+	return sha256.Sum256(data)
+}
+
+// FetchFunc returns the current machines and users of the tailnet
+type FetchFunc func(ctx context.Context) ([]*models.Machine, []*headscale.User, error)
+
+// MachineSource provides the current list of machines (implemented by handlers.MachinesHandler)
+type MachineSource interface {
+	FetchMachines(ctx context.Context) ([]*models.Machine, error)
+}
+
+// Fetcher returns a FetchFunc that fetches machines from source and users from Headscale
+func Fetcher(source MachineSource, hsClient headscale.HeadscaleServiceClient) FetchFunc {
+	return func(ctx context.Context) ([]*models.Machine, []*headscale.User, error) {
+		machines, err := source.FetchMachines(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		usersResp, err := hsClient.ListUsers(ctx, &headscale.ListUsersRequest{})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return machines, usersResp.Users, nil
+	}
+}
+
+// NewSnapshot builds a snapshot from machines and users fetched at the given time
+func NewSnapshot(machines []*models.Machine, users []*headscale.User, at time.Time) *Snapshot {
+	s := &Snapshot{
+		At:    at,
+		Nodes: make(map[uint64]NodeState, len(machines)),
+		Users: make(map[uint64]UserState, len(users)),
+
+		nodeHashes: make(map[uint64]stateHash, len(machines)),
+		userHashes: make(map[uint64]stateHash, len(users)),
+	}
+
+	for _, m := range machines {
+		s.Nodes[m.ID()] = NodeState{
+			ID:             m.ID(),
+			Name:           m.Hostname(),
+			User:           m.User(),
+			IPs:            m.TailscaleIPs(),
+			Online:         m.Online,
+			Tags:           sortedCopy(m.Tags()),
+			PendingRoutes:  pendingRoutes(m),
+			ApprovedRoutes: approvedRoutes(m),
+			KeyExpiry:      keyExpiry(m),
+		}
+		s.nodeHashes[m.ID()] = hashState(newMachineView(m))
+	}
+
+	for _, u := range users {
+		user := UserState{
+			ID:            u.Id,
+			Name:          u.Name,
+			DisplayName:   u.DisplayName,
+			Email:         u.Email,
+			Provider:      u.Provider,
+			ProfilePicURL: u.ProfilePicUrl,
+		}
+		s.Users[u.Id] = user
+		s.userHashes[u.Id] = hashState(user)
+	}
+
+	return s
+}
+
+// pendingRoutes returns the routes a machine advertises that have not been approved, sorted
+func pendingRoutes(m *models.Machine) []string {
+	if m.Node == nil {
+		return nil
+	}
+
+	approved := make(map[string]bool, len(m.Node.ApprovedRoutes))
+	for _, route := range m.Node.ApprovedRoutes {
+		approved[route] = true
+	}
+
+	var pending []string
+	for _, route := range m.Node.AvailableRoutes {
+		if !approved[route] {
+			pending = append(pending, route)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// approvedRoutes returns the routes approved for a machine, sorted
+func approvedRoutes(m *models.Machine) []string {
+	if m.Node == nil {
+		return nil
+	}
+	return sortedCopy(m.Node.ApprovedRoutes)
+}
+
+// keyExpiry returns when a machine's node key expires, or nil if it never does
+func keyExpiry(m *models.Machine) *time.Time {
+	if m.Node == nil || m.Node.Expiry == nil || m.Node.Expiry.GetSeconds() <= 0 {
+		return nil
+	}
+	expiry := m.Node.Expiry.AsTime()
+	if expiry.Year() > 9000 {
+		return nil
+	}
+	return &expiry
+}
+
+// sortedCopy returns a sorted copy of items, or nil if empty
+func sortedCopy(items []string) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	result := make([]string, len(items))
+	copy(result, items)
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,196 @@
+package watcher
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/models"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/opt"
+)
+
+// machineParts holds the sources a test machine is built from, so tests can change any of them
+type machineParts struct {
+	node     *headscale.Node
+	peer     *ipnstate.PeerStatus
+	whoIs    *tailcfg.Node
+	hostinfo *tailcfg.Hostinfo
+	online   bool
+}
+
+// testMachine builds a fully populated machine, applying modify to its parts first
+func testMachine(modify func(p *machineParts)) *models.Machine {
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &machineParts{
+		node: &headscale.Node{
+			Id:              1,
+			GivenName:       "router",
+			User:            &headscale.User{Id: 1, Name: "alice"},
+			IpAddresses:     []string{"100.64.0.1", "fd7a:115c:a1e0::1"},
+			LastSeen:        timestamppb.New(created.Add(time.Hour)),
+			ForcedTags:      []string{"tag:router", "tag:server"},
+			AvailableRoutes: []string{"10.0.0.0/24", "0.0.0.0/0", "::/0"},
+			ApprovedRoutes:  []string{"10.0.0.0/24"},
+			Expiry:          timestamppb.New(created.Add(180 * 24 * time.Hour)),
+			NodeKey:         "nodekey:0123456789abcdef",
+			CreatedAt:       timestamppb.New(created),
+		},
+		peer: &ipnstate.PeerStatus{HostName: "router-os"},
+		whoIs: &tailcfg.Node{
+			ComputedName:         "router",
+			ComputedNameWithHost: "router.tailnet.example.com",
+			Endpoints:            []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:41641")},
+		},
+		hostinfo: &tailcfg.Hostinfo{
+			OS:         "linux",
+			OSVersion:  "6.1",
+			IPNVersion: "1.80.0",
+			NetInfo:    &tailcfg.NetInfo{WorkingUDP: opt.NewBool(true), DERPLatency: map[string]float64{"1-v4": 0.02}},
+		},
+		online: true,
+	}
+	if modify != nil {
+		modify(p)
+	}
+
+	p.whoIs.Hostinfo = p.hostinfo.View()
+	return &models.Machine{Node: p.node, PeerStatus: p.peer, WhoIsNode: p.whoIs, Online: p.online}
+}
+
+// TestChanged_Machines tests that a change to each machine field shown in the UI is detected
+func TestChanged_Machines(t *testing.T) {
+	tests := []struct {
+		name        string
+		modify      func(p *machineParts)
+		wantChanged bool
+	}{
+		{name: "nothing", modify: func(p *machineParts) {}, wantChanged: false},
+		{name: "renamed", modify: func(p *machineParts) { p.node.GivenName = "gateway" }, wantChanged: true},
+		{name: "OS hostname", modify: func(p *machineParts) { p.peer.HostName = "gateway-os" }, wantChanged: true},
+		{name: "moved to another user", modify: func(p *machineParts) { p.node.User = &headscale.User{Id: 2, Name: "bob"} }, wantChanged: true},
+		{name: "IP address", modify: func(p *machineParts) { p.node.IpAddresses = []string{"100.64.0.2"} }, wantChanged: true},
+		{name: "online", modify: func(p *machineParts) { p.online = false }, wantChanged: true},
+		{name: "last seen", modify: func(p *machineParts) {
+			p.node.LastSeen = timestamppb.New(p.node.LastSeen.AsTime().Add(time.Minute))
+		}, wantChanged: true},
+		{name: "OS", modify: func(p *machineParts) { p.hostinfo.OS = "freebsd" }, wantChanged: true},
+		{name: "OS version", modify: func(p *machineParts) { p.hostinfo.OSVersion = "6.6" }, wantChanged: true},
+		{name: "client version upgrade", modify: func(p *machineParts) { p.hostinfo.IPNVersion = "1.82.0" }, wantChanged: true},
+		{name: "auto-update enabled", modify: func(p *machineParts) { p.hostinfo.AllowsUpdate = true }, wantChanged: true},
+		{name: "release track (unstable build)", modify: func(p *machineParts) { p.hostinfo.IPNVersion = "1.81.0" }, wantChanged: true},
+		{name: "state encrypted", modify: func(p *machineParts) { p.hostinfo.StateEncrypted = opt.NewBool(true) }, wantChanged: true},
+		{name: "tags", modify: func(p *machineParts) { p.node.ForcedTags = []string{"tag:router"} }, wantChanged: true},
+		{name: "new advertised route", modify: func(p *machineParts) {
+			p.node.AvailableRoutes = append(p.node.AvailableRoutes, "10.1.0.0/24")
+		}, wantChanged: true},
+		{name: "approved routes", modify: func(p *machineParts) {
+			p.node.ApprovedRoutes = []string{"10.0.0.0/24", "0.0.0.0/0", "::/0"}
+		}, wantChanged: true},
+		{name: "key expiry", modify: func(p *machineParts) {
+			p.node.Expiry = timestamppb.New(p.node.Expiry.AsTime().Add(24 * time.Hour))
+		}, wantChanged: true},
+		{name: "node key", modify: func(p *machineParts) { p.node.NodeKey = "nodekey:fedcba9876543210" }, wantChanged: true},
+		{name: "created", modify: func(p *machineParts) {
+			p.node.CreatedAt = timestamppb.New(p.node.CreatedAt.AsTime().Add(-24 * time.Hour))
+		}, wantChanged: true},
+		{name: "MagicDNS name", modify: func(p *machineParts) { p.whoIs.ComputedName = "router-1" }, wantChanged: true},
+		{name: "full domain", modify: func(p *machineParts) {
+			p.whoIs.ComputedNameWithHost = "router-1.tailnet.example.com"
+		}, wantChanged: true},
+		{name: "endpoints", modify: func(p *machineParts) {
+			p.whoIs.Endpoints = []netip.AddrPort{netip.MustParseAddrPort("198.51.100.1:41641")}
+		}, wantChanged: true},
+		{name: "client connectivity", modify: func(p *machineParts) { p.hostinfo.NetInfo.WorkingUDP = opt.NewBool(false) }, wantChanged: true},
+		{name: "relay latency is ignored", modify: func(p *machineParts) {
+			p.hostinfo.NetInfo.DERPLatency = map[string]float64{"1-v4": 0.05}
+		}, wantChanged: false},
+		{name: "list order is ignored", modify: func(p *machineParts) {
+			p.node.ForcedTags = []string{"tag:server", "tag:router"}
+			p.node.AvailableRoutes = []string{"::/0", "0.0.0.0/0", "10.0.0.0/24"}
+		}, wantChanged: false},
+	}
+
+	at := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	prev := NewSnapshot([]*models.Machine{testMachine(nil)}, nil, at)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			curr := NewSnapshot([]*models.Machine{testMachine(tt.modify)}, nil, at.Add(time.Second))
+
+			nodes, users := Changed(prev, curr)
+			if tt.wantChanged {
+				assert.Equal(t, []uint64{1}, nodes)
+			} else {
+				assert.Empty(t, nodes)
+			}
+			assert.Empty(t, users)
+		})
+	}
+}
+
+// TestChanged_Users tests that a change to each user field shown in the UI is detected
+func TestChanged_Users(t *testing.T) {
+	base := func() *headscale.User {
+		return &headscale.User{
+			Id:            1,
+			Name:          "alice",
+			DisplayName:   "Alice",
+			Email:         "alice@example.com",
+			Provider:      "oidc",
+			ProfilePicUrl: "https://example.com/alice.png",
+		}
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(u *headscale.User)
+		wantChanged bool
+	}{
+		{name: "nothing", modify: func(u *headscale.User) {}, wantChanged: false},
+		{name: "renamed", modify: func(u *headscale.User) { u.Name = "alice2" }, wantChanged: true},
+		{name: "display name", modify: func(u *headscale.User) { u.DisplayName = "Alice Smith" }, wantChanged: true},
+		{name: "email", modify: func(u *headscale.User) { u.Email = "alice@example.org" }, wantChanged: true},
+		{name: "provider", modify: func(u *headscale.User) { u.Provider = "" }, wantChanged: true},
+		{name: "profile picture", modify: func(u *headscale.User) { u.ProfilePicUrl = "" }, wantChanged: true},
+	}
+
+	at := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	prev := NewSnapshot(nil, []*headscale.User{base()}, at)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := base()
+			tt.modify(user)
+			curr := NewSnapshot(nil, []*headscale.User{user}, at.Add(time.Second))
+
+			nodes, users := Changed(prev, curr)
+			if tt.wantChanged {
+				assert.Equal(t, []uint64{1}, users)
+			} else {
+				assert.Empty(t, users)
+			}
+			assert.Empty(t, nodes)
+		})
+	}
+}
+
+// TestChanged_AddedAndRemoved tests that machines and users appearing or disappearing are left to Diff
+func TestChanged_AddedAndRemoved(t *testing.T) {
+	at := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	prev := NewSnapshot([]*models.Machine{testMachine(nil)}, []*headscale.User{{Id: 1, Name: "alice"}}, at)
+	curr := NewSnapshot([]*models.Machine{testMachine(func(p *machineParts) { p.node.Id = 2 })},
+		[]*headscale.User{{Id: 2, Name: "bob"}}, at.Add(time.Second))
+
+	nodes, users := Changed(prev, curr)
+	assert.Empty(t, nodes)
+	assert.Empty(t, users)
+
+	nodes, users = Changed(nil, curr)
+	assert.Nil(t, nodes)
+	assert.Nil(t, users)
+}
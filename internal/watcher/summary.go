@@ -0,0 +1,147 @@
+package watcher
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anupcshan/hsadmin/internal/models"
+)
+
+// Machine filters, as accepted by the machines list and linked from the dashboard
+const (
+	FilterOnline        = "online"
+	FilterOffline       = "offline"
+	FilterRoutesPending = "routes-pending" // Advertising routes that are not approved
+	FilterKeyExpiring   = "key-expiring"   // Node key expires within KeyExpiryWarning
+	FilterOutdated      = "outdated"       // Client older than the newest minor version in the tailnet
+)
+
+// IsValidFilter returns true if filter is one of the machine filters
+func IsValidFilter(filter string) bool {
+	switch filter {
+	case FilterOnline, FilterOffline, FilterRoutesPending, FilterKeyExpiring, FilterOutdated:
+		return true
+	}
+	return false
+}
+
+// OSCount is the number of machines running an operating system
+type OSCount struct {
+	OS    string
+	Count int
+}
+
+// Summary is an overview of the tailnet at a snapshot
+type Summary struct {
+	Machines      int
+	Online        int
+	Offline       int
+	Users         int
+	RoutesPending int       // Machines with routes awaiting approval
+	KeyExpiring   int       // Machines whose node key expires within KeyExpiryWarning
+	Outdated      int       // Machines running an older client than NewestVersion
+	NewestVersion string    // Newest minor client version in the tailnet, e.g. "1.80"; empty if none is known
+	OS            []OSCount // Most common first
+}
+
+// Summarize returns the overview of the tailnet in an update
+func Summarize(u *Update) Summary {
+	s := Summary{
+		Machines: len(u.Machines),
+		Users:    len(u.Users),
+	}
+
+	newest, known := newestVersion(u.Machines)
+	if known {
+		s.NewestVersion = formatMinor(newest)
+	}
+
+	osCounts := make(map[string]int)
+	for _, m := range u.Machines {
+		if m.Online {
+			s.Online++
+		} else {
+			s.Offline++
+		}
+		osCounts[m.OS()]++
+
+		if matches(m, u.Snapshot, FilterRoutesPending, newest) {
+			s.RoutesPending++
+		}
+		if matches(m, u.Snapshot, FilterKeyExpiring, newest) {
+			s.KeyExpiring++
+		}
+		if known && matches(m, u.Snapshot, FilterOutdated, newest) {
+			s.Outdated++
+		}
+	}
+
+	for os, count := range osCounts {
+		s.OS = append(s.OS, OSCount{OS: os, Count: count})
+	}
+	sort.Slice(s.OS, func(i, j int) bool {
+		if s.OS[i].Count != s.OS[j].Count {
+			return s.OS[i].Count > s.OS[j].Count
+		}
+		return s.OS[i].OS < s.OS[j].OS
+	})
+
+	return s
+}
+
+// FilterMachines returns the machines in snapshot matching filter, or all of them if filter is ""
+func FilterMachines(machines []*models.Machine, snapshot *Snapshot, filter string) []*models.Machine {
+	if filter == "" {
+		return machines
+	}
+
+	newest, _ := newestVersion(machines)
+	var filtered []*models.Machine
+	for _, m := range machines {
+		if matches(m, snapshot, filter, newest) {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
+
+// matches returns true if m matches filter; newest is the newest client version in the tailnet
+func matches(m *models.Machine, snapshot *Snapshot, filter string, newest models.Version) bool {
+	node := snapshot.Nodes[m.ID()]
+	switch filter {
+	case FilterOnline:
+		return m.Online
+	case FilterOffline:
+		return !m.Online
+	case FilterRoutesPending:
+		return len(node.PendingRoutes) > 0
+	case FilterKeyExpiring:
+		return expiringSoon(node.KeyExpiry, snapshot.At)
+	case FilterOutdated:
+		v, err := models.ParseVersion(m.TailscaleVersion())
+		return err == nil && v.Less(models.Version{newest[0], newest[1], 0})
+	}
+	return false
+}
+
+// newestVersion returns the newest client version run by any machine, if any version is known
+func newestVersion(machines []*models.Machine) (models.Version, bool) {
+	var newest models.Version
+	known := false
+	for _, m := range machines {
+		v, err := models.ParseVersion(m.TailscaleVersion())
+		if err != nil {
+			continue
+		}
+		if !known || newest.Less(v) {
+			newest = v
+			known = true
+		}
+	}
+	return newest, known
+}
+
+// formatMinor returns v as major.minor
+func formatMinor(v models.Version) string {
+	return fmt.Sprintf("%d.%d", v[0], v[1])
+}
@@ -0,0 +1,68 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/models"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"tailscale.com/tailcfg"
+)
+
+// summaryMachine builds a machine running version on os
+func summaryMachine(id uint64, os, version string, online bool) *models.Machine {
+	hostinfo := &tailcfg.Hostinfo{OS: os, IPNVersion: version}
+	return &models.Machine{
+		Node:      &headscale.Node{Id: id, GivenName: "node", User: &headscale.User{Name: "alice"}},
+		WhoIsNode: &tailcfg.Node{Hostinfo: hostinfo.View()},
+		Online:    online,
+	}
+}
+
+// TestSummarize tests the dashboard counts and that filters select the machines they count
+func TestSummarize(t *testing.T) {
+	now := time.Now()
+
+	router := summaryMachine(1, "linux", "1.80.2", true)
+	router.Node.AvailableRoutes = []string{"10.0.0.0/24"}
+	laptop := summaryMachine(2, "macOS", "1.78.1", false)
+	laptop.Node.Expiry = timestamppb.New(now.Add(48 * time.Hour))
+	server := summaryMachine(3, "linux", "1.80.0", true)
+	unknown := &models.Machine{Node: &headscale.Node{Id: 4, GivenName: "printer"}}
+
+	machines := []*models.Machine{router, laptop, server, unknown}
+	u := &Update{
+		Snapshot: NewSnapshot(machines, nil, now),
+		Machines: machines,
+		Users:    []*headscale.User{{Id: 1, Name: "alice"}},
+	}
+
+	s := Summarize(u)
+	assert.Equal(t, Summary{
+		Machines:      4,
+		Online:        2,
+		Offline:       2,
+		Users:         1,
+		RoutesPending: 1,
+		KeyExpiring:   1,
+		Outdated:      1,
+		NewestVersion: "1.80",
+		OS:            []OSCount{{OS: "linux", Count: 2}, {OS: "-", Count: 1}, {OS: "macOS", Count: 1}},
+	}, s)
+
+	ids := func(machines []*models.Machine) []uint64 {
+		var out []uint64
+		for _, m := range machines {
+			out = append(out, m.ID())
+		}
+		return out
+	}
+	assert.Equal(t, []uint64{1, 3}, ids(FilterMachines(machines, u.Snapshot, FilterOnline)))
+	assert.Equal(t, []uint64{2, 4}, ids(FilterMachines(machines, u.Snapshot, FilterOffline)))
+	assert.Equal(t, []uint64{1}, ids(FilterMachines(machines, u.Snapshot, FilterRoutesPending)))
+	assert.Equal(t, []uint64{2}, ids(FilterMachines(machines, u.Snapshot, FilterKeyExpiring)))
+	assert.Equal(t, []uint64{2}, ids(FilterMachines(machines, u.Snapshot, FilterOutdated)))
+	assert.Len(t, FilterMachines(machines, u.Snapshot, ""), 4)
+}
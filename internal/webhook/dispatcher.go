@@ -0,0 +1,327 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/logging"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+)
+
+var logger = logging.For("webhooks")
+
+// Headers set on every delivery
+const (
+	HeaderEvent     = "X-Hsadmin-Event"
+	HeaderDelivery  = "X-Hsadmin-Delivery"  // Event ID, stable across retries
+	HeaderTimestamp = "X-Hsadmin-Timestamp" // Unix seconds, included in the signature
+	HeaderSignature = "X-Hsadmin-Signature" // "sha256=" + hex HMAC of "{timestamp}.{body}"
+)
+
+// Delivery settings
+const (
+	queueSize      = 100              // Events buffered per endpoint
+	requestTimeout = 10 * time.Second // Per attempt
+	initialBackoff = 2 * time.Second  // Doubled after each failed attempt
+	maxBackoff     = 5 * time.Minute
+)
+
+// Dispatcher delivers tailnet events to configured webhook endpoints
+// Each endpoint has its own queue and worker, so a slow endpoint does not delay the others
+// and events reach each endpoint in order.
+type Dispatcher struct {
+	endpoints   []*endpoint
+	log         *DeliveryLog
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// endpoint is a configured destination with its queue
+type endpoint struct {
+	cfg    config.WebhookEndpoint
+	events map[watcher.EventType]bool // nil delivers all events
+	queue  chan queuedEvent
+
+	// URL and secret, replaced when secrets are reloaded
+	mu     sync.Mutex
+	url    string
+	secret string
+}
+
+// credentials returns the endpoint's current URL and secret
+func (e *endpoint) credentials() (string, string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.url, e.secret
+}
+
+// queuedEvent is an event waiting for delivery
+type queuedEvent struct {
+	event  watcher.Event
+	queued time.Time
+}
+
+// EndpointInfo describes an endpoint for display, without its secret or full URL
+type EndpointInfo struct {
+	Name   string
+	Host   string
+	Format string
+	Events []string // Empty means all events
+	Signed bool
+}
+
+// New creates a dispatcher for the configured endpoints
+func New(cfg *config.WebhooksConfig) (*Dispatcher, error) {
+	d := &Dispatcher{
+		log:         newDeliveryLog(),
+		client:      &http.Client{Timeout: requestTimeout},
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     initialBackoff,
+	}
+
+	for _, endpointCfg := range cfg.Endpoints {
+		e := &endpoint{
+			cfg:    endpointCfg,
+			queue:  make(chan queuedEvent, queueSize),
+			url:    endpointCfg.URL,
+			secret: endpointCfg.Secret,
+		}
+		if len(endpointCfg.Events) > 0 {
+			e.events = make(map[watcher.EventType]bool)
+			for _, eventType := range endpointCfg.Events {
+				if !watcher.IsValidEventType(eventType) {
+					return nil, fmt.Errorf("webhook %q: unknown event type %q", endpointCfg.Name, eventType)
+				}
+				e.events[watcher.EventType(eventType)] = true
+			}
+		}
+		d.endpoints = append(d.endpoints, e)
+	}
+
+	return d, nil
+}
+
+// Run delivers queued events until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	logger.Info("Starting dispatcher", "endpoints", len(d.endpoints))
+
+	for _, e := range d.endpoints {
+		go d.work(ctx, e)
+	}
+
+	<-ctx.Done()
+	logger.Info("Dispatcher stopped")
+}
+
+// Notify queues events for every endpoint that subscribes to them
+func (d *Dispatcher) Notify(events []watcher.Event) {
+	for _, event := range events {
+		for _, e := range d.endpoints {
+			if e.events != nil && !e.events[event.Type] {
+				continue
+			}
+			d.enqueue(e, event)
+		}
+	}
+}
+
+// SetSecrets replaces the URL and secret of each configured endpoint with those of the endpoint
+// with the same name, e.g. after the configuration is reloaded
+// Endpoints added to the configuration are ignored until restart.
+func (d *Dispatcher) SetSecrets(endpoints []config.WebhookEndpoint) {
+	for _, endpointCfg := range endpoints {
+		i := slices.IndexFunc(d.endpoints, func(e *endpoint) bool { return e.cfg.Name == endpointCfg.Name })
+		if i < 0 {
+			logger.Warn("Ignoring new endpoint until restart", "endpoint", endpointCfg.Name)
+			continue
+		}
+		e := d.endpoints[i]
+		e.mu.Lock()
+		e.url, e.secret = endpointCfg.URL, endpointCfg.Secret
+		e.mu.Unlock()
+	}
+}
+
+// SendTest queues a test event for the named endpoint, regardless of its event filter
+func (d *Dispatcher) SendTest(name string) error {
+	for _, e := range d.endpoints {
+		if e.cfg.Name == name {
+			d.enqueue(e, watcher.NewEvent(watcher.Test, time.Now()))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown webhook %q", name)
+}
+
+// Endpoints describes the configured endpoints, in configuration order
+func (d *Dispatcher) Endpoints() []EndpointInfo {
+	var result []EndpointInfo
+	for _, e := range d.endpoints {
+		endpointURL, secret := e.credentials()
+		info := EndpointInfo{
+			Name:   e.cfg.Name,
+			Format: e.cfg.Format,
+			Events: e.cfg.Events,
+			Signed: secret != "",
+		}
+		if u, err := url.Parse(endpointURL); err == nil {
+			// Only show the host: paths of chat webhooks embed credentials
+			info.Host = u.Host
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// Log returns the delivery log
+func (d *Dispatcher) Log() *DeliveryLog {
+	return d.log
+}
+
+// enqueue adds an event to an endpoint's queue, recording it as dropped if the queue is full
+func (d *Dispatcher) enqueue(e *endpoint, event watcher.Event) {
+	now := time.Now()
+	select {
+	case e.queue <- queuedEvent{event: event, queued: now}:
+	default:
+		logger.Warn("Queue full, dropping event", "endpoint", e.cfg.Name, "event_type", event.Type, "event_id", event.ID)
+		d.log.add(Delivery{
+			Endpoint:  e.cfg.Name,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Message:   event.Message(),
+			Queued:    now,
+			Finished:  now,
+			Err:       "dropped: delivery queue full",
+		})
+	}
+}
+
+// work delivers an endpoint's queued events one at a time
+func (d *Dispatcher) work(ctx context.Context, e *endpoint) {
+	for {
+		select {
+		case q := <-e.queue:
+			delivery := d.deliver(ctx, e, q)
+			d.log.add(delivery)
+			if !delivery.Delivered {
+				logger.Warn("Failed to deliver event", "endpoint", e.cfg.Name, "event_type", q.event.Type,
+					"event_id", q.event.ID, "attempts", delivery.Attempts, "error", delivery.Err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver sends an event to an endpoint, retrying with exponential backoff on failure
+func (d *Dispatcher) deliver(ctx context.Context, e *endpoint, q queuedEvent) Delivery {
+	delivery := Delivery{
+		Endpoint:  e.cfg.Name,
+		EventID:   q.event.ID,
+		EventType: q.event.Type,
+		Message:   q.event.Message(),
+		Queued:    q.queued,
+	}
+
+	body, err := encodePayload(e.cfg.Format, q.event)
+	if err != nil {
+		delivery.Err = err.Error()
+		delivery.Finished = time.Now()
+		return delivery
+	}
+
+	backoff := d.backoff
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		delivery.Attempts = attempt
+
+		statusCode, retry, err := d.post(ctx, e, q.event, body)
+		delivery.StatusCode = statusCode
+		if err == nil {
+			delivery.Err = ""
+			delivery.Delivered = true
+			break
+		}
+		delivery.Err = err.Error()
+		if !retry || attempt == d.maxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			delivery.Err = "cancelled: " + delivery.Err
+			delivery.Finished = time.Now()
+			return delivery
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+
+	delivery.Finished = time.Now()
+	return delivery
+}
+
+// post makes a single delivery attempt
+// Returns the response status (0 if none), whether a failure is worth retrying, and any error
+func (d *Dispatcher) post(ctx context.Context, e *endpoint, event watcher.Event, body []byte) (int, bool, error) {
+	endpointURL, secret := e.credentials()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpointURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hsadmin-webhook")
+	req.Header.Set(HeaderEvent, string(event.Type))
+	req.Header.Set(HeaderDelivery, event.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if secret != "" {
+		req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// Drop the URL from the error, since chat webhook URLs contain credentials and errors are logged and shown
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = fmt.Errorf("%s: %w", urlErr.Op, urlErr.Err)
+		}
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, false, nil
+	}
+
+	// Retry server errors and rate limiting; other client errors will not succeed on retry
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return resp.StatusCode, retry, fmt.Errorf("endpoint returned %s", resp.Status)
+}
+
+// Sign returns the signature header value for a payload: "sha256=" followed by the hex
+// HMAC-SHA256 of "{timestamp}.{body}" keyed with secret
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,294 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is a test webhook endpoint that records requests and replies with queued status codes
+type recorder struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	statuses []int // Status codes to return in order; 200 once exhausted
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.requests = append(rec.requests, r)
+	rec.bodies = append(rec.bodies, body)
+
+	status := http.StatusOK
+	if len(rec.statuses) > 0 {
+		status, rec.statuses = rec.statuses[0], rec.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// startDispatcher creates and runs a dispatcher with a short backoff for tests
+func startDispatcher(t *testing.T, cfg *config.WebhooksConfig) *Dispatcher {
+	t.Helper()
+
+	d, err := New(cfg)
+	require.NoError(t, err)
+	d.backoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go d.Run(ctx)
+	return d
+}
+
+// waitForDeliveries waits until the delivery log has n entries
+func waitForDeliveries(t *testing.T, d *Dispatcher, n int) []Delivery {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return len(d.Log().Entries()) >= n
+	}, 5*time.Second, 5*time.Millisecond)
+	return d.Log().Entries()
+}
+
+// testEvent returns a node.offline event for a test machine
+func testEvent() watcher.Event {
+	e := watcher.NewEvent(watcher.NodeOffline, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	e.Node = &watcher.NodeState{ID: 7, Name: "laptop", User: "alice"}
+	return e
+}
+
+// TestDispatcher_SignedJSON tests JSON delivery with headers and a verifiable signature
+func TestDispatcher_SignedJSON(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	d := startDispatcher(t, &config.WebhooksConfig{
+		MaxAttempts: 1,
+		Endpoints: []config.WebhookEndpoint{
+			{Name: "ops", URL: server.URL, Format: config.WebhookFormatJSON, Secret: "s3cret"},
+		},
+	})
+
+	event := testEvent()
+	d.Notify([]watcher.Event{event})
+	deliveries := waitForDeliveries(t, d, 1)
+
+	assert.True(t, deliveries[0].Delivered)
+	assert.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	req, body := rec.requests[0], rec.bodies[0]
+
+	assert.Equal(t, "node.offline", req.Header.Get(HeaderEvent))
+	assert.Equal(t, event.ID, req.Header.Get(HeaderDelivery))
+	assert.Equal(t, Sign("s3cret", req.Header.Get(HeaderTimestamp), body), req.Header.Get(HeaderSignature))
+
+	var decoded watcher.Event
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, event.ID, decoded.ID)
+	assert.Equal(t, "laptop", decoded.Node.Name)
+}
+
+// TestDispatcher_SetSecrets tests that deliveries use an endpoint's replaced URL and secret
+func TestDispatcher_SetSecrets(t *testing.T) {
+	oldRec, newRec := &recorder{}, &recorder{}
+	oldServer, newServer := httptest.NewServer(oldRec), httptest.NewServer(newRec)
+	defer oldServer.Close()
+	defer newServer.Close()
+
+	d := startDispatcher(t, &config.WebhooksConfig{
+		MaxAttempts: 1,
+		Endpoints: []config.WebhookEndpoint{
+			{Name: "ops", URL: oldServer.URL, Format: config.WebhookFormatJSON, Secret: "s3cret"},
+		},
+	})
+
+	d.SetSecrets([]config.WebhookEndpoint{
+		{Name: "ops", URL: newServer.URL, Secret: "rotated"},
+		{Name: "added", URL: oldServer.URL},
+	})
+	require.Len(t, d.Endpoints(), 1, "new endpoints wait for a restart")
+
+	d.Notify([]watcher.Event{testEvent()})
+	deliveries := waitForDeliveries(t, d, 1)
+	assert.True(t, deliveries[0].Delivered)
+
+	oldRec.mu.Lock()
+	assert.Empty(t, oldRec.requests)
+	oldRec.mu.Unlock()
+
+	newRec.mu.Lock()
+	defer newRec.mu.Unlock()
+	require.Len(t, newRec.requests, 1)
+	req, body := newRec.requests[0], newRec.bodies[0]
+	assert.Equal(t, Sign("rotated", req.Header.Get(HeaderTimestamp), body), req.Header.Get(HeaderSignature))
+}
+
+// TestDispatcher_Retry tests that server errors are retried and client errors are not
+func TestDispatcher_Retry(t *testing.T) {
+	tests := []struct {
+		name          string
+		statuses      []int
+		wantAttempts  int
+		wantDelivered bool
+	}{
+		{
+			name:          "succeeds after server errors",
+			statuses:      []int{http.StatusBadGateway, http.StatusTooManyRequests},
+			wantAttempts:  3,
+			wantDelivered: true,
+		},
+		{
+			name:          "gives up after max attempts",
+			statuses:      []int{500, 500, 500, 500},
+			wantAttempts:  3,
+			wantDelivered: false,
+		},
+		{
+			name:          "client error is not retried",
+			statuses:      []int{http.StatusNotFound},
+			wantAttempts:  1,
+			wantDelivered: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{statuses: tt.statuses}
+			server := httptest.NewServer(rec)
+			defer server.Close()
+
+			d := startDispatcher(t, &config.WebhooksConfig{
+				MaxAttempts: 3,
+				Endpoints: []config.WebhookEndpoint{
+					{Name: "ops", URL: server.URL, Format: config.WebhookFormatJSON},
+				},
+			})
+
+			d.Notify([]watcher.Event{testEvent()})
+			deliveries := waitForDeliveries(t, d, 1)
+
+			assert.Equal(t, tt.wantAttempts, deliveries[0].Attempts)
+			assert.Equal(t, tt.wantDelivered, deliveries[0].Delivered)
+			if !tt.wantDelivered {
+				assert.NotEmpty(t, deliveries[0].Err)
+			}
+		})
+	}
+}
+
+// TestDispatcher_EventFilter tests that endpoints only receive subscribed events, except test events
+func TestDispatcher_EventFilter(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	d := startDispatcher(t, &config.WebhooksConfig{
+		MaxAttempts: 1,
+		Endpoints: []config.WebhookEndpoint{
+			{Name: "ops", URL: server.URL, Format: config.WebhookFormatJSON, Events: []string{"node.added"}},
+		},
+	})
+
+	d.Notify([]watcher.Event{testEvent()})
+	require.NoError(t, d.SendTest("ops"))
+	deliveries := waitForDeliveries(t, d, 1)
+
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, watcher.Test, deliveries[0].EventType)
+	assert.Error(t, d.SendTest("missing"))
+}
+
+// TestNew_UnknownEventType tests that unknown event names are rejected
+func TestNew_UnknownEventType(t *testing.T) {
+	_, err := New(&config.WebhooksConfig{
+		Endpoints: []config.WebhookEndpoint{
+			{Name: "ops", URL: "https://example.com", Events: []string{"node.exploded"}},
+		},
+	})
+	assert.ErrorContains(t, err, `unknown event type "node.exploded"`)
+}
+
+// TestEncodePayload tests the chat formats
+func TestEncodePayload(t *testing.T) {
+	event := testEvent()
+
+	body, err := encodePayload(config.WebhookFormatSlack, event)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text":"*hsadmin*: Machine laptop (alice) is offline"}`, string(body))
+
+	body, err = encodePayload(config.WebhookFormatMatrix, event)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"text": "Machine laptop (alice) is offline",
+		"html": "<b>hsadmin</b>: Machine laptop (alice) is offline",
+		"username": "hsadmin"
+	}`, string(body))
+
+	_, err = encodePayload("teams", event)
+	assert.Error(t, err)
+}
+
+// TestEndpoints_HidesURLPath tests that endpoint info only exposes the URL host
+func TestEndpoints_HidesURLPath(t *testing.T) {
+	d, err := New(&config.WebhooksConfig{
+		Endpoints: []config.WebhookEndpoint{
+			{Name: "slack", URL: "https://hooks.slack.com/services/T000/B000/XXXX", Format: config.WebhookFormatSlack},
+		},
+	})
+	require.NoError(t, err)
+
+	endpoints := d.Endpoints()
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, "hooks.slack.com", endpoints[0].Host)
+	assert.False(t, endpoints[0].Signed)
+}
+
+// TestDispatcher_ErrorHidesURL tests that connection errors do not expose the endpoint URL
+func TestDispatcher_ErrorHidesURL(t *testing.T) {
+	server := httptest.NewServer(&recorder{})
+	webhookURL := server.URL + "/services/T000/B000/XXXX"
+	server.Close()
+
+	d := startDispatcher(t, &config.WebhooksConfig{
+		MaxAttempts: 1,
+		Endpoints: []config.WebhookEndpoint{
+			{Name: "slack", URL: webhookURL, Format: config.WebhookFormatSlack},
+		},
+	})
+
+	d.Notify([]watcher.Event{testEvent()})
+	deliveries := waitForDeliveries(t, d, 1)
+
+	assert.False(t, deliveries[0].Delivered)
+	assert.Contains(t, deliveries[0].Err, "Post: ")
+	assert.NotContains(t, deliveries[0].Err, "XXXX")
+}
+
+// TestDeliveryLog_Wraps tests that the log keeps the newest entries, newest first
+func TestDeliveryLog_Wraps(t *testing.T) {
+	l := newDeliveryLog()
+	for i := 0; i < logCapacity+5; i++ {
+		l.add(Delivery{Attempts: i})
+	}
+
+	entries := l.Entries()
+	require.Len(t, entries, logCapacity)
+	assert.Equal(t, logCapacity+4, entries[0].Attempts)
+	assert.Equal(t, 5, entries[len(entries)-1].Attempts)
+}
@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/watcher"
+)
+
+// logCapacity is the number of deliveries kept in the delivery log
+const logCapacity = 200
+
+// Delivery records the outcome of sending one event to one endpoint
+type Delivery struct {
+	Endpoint   string
+	EventID    string
+	EventType  watcher.EventType
+	Message    string
+	Queued     time.Time
+	Finished   time.Time
+	Attempts   int
+	StatusCode int    // HTTP status of the last attempt, 0 if no response
+	Err        string // Error from the last attempt, empty on success
+	Delivered  bool
+}
+
+// Duration returns how long delivery took, including retries
+func (d Delivery) Duration() time.Duration {
+	return d.Finished.Sub(d.Queued)
+}
+
+// DeliveryLog keeps the most recent deliveries in memory
+type DeliveryLog struct {
+	mu      sync.RWMutex
+	entries []Delivery // Ring buffer
+	next    int        // Index of the slot to write next
+	full    bool
+}
+
+// newDeliveryLog creates an empty delivery log
+func newDeliveryLog() *DeliveryLog {
+	return &DeliveryLog{
+		entries: make([]Delivery, logCapacity),
+	}
+}
+
+// add records a finished delivery, evicting the oldest entry if the log is full
+func (l *DeliveryLog) add(d Delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = d
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Entries returns the logged deliveries, newest first
+func (l *DeliveryLog) Entries() []Delivery {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+
+	result := make([]Delivery, 0, count)
+	for i := 1; i <= count; i++ {
+		result = append(result, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return result
+}
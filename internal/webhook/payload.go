@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+)
+
+// slackPayload is compatible with Slack incoming webhooks (and Mattermost, Discord's /slack endpoint)
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+// matrixPayload is compatible with matrix-hookshot generic webhooks
+type matrixPayload struct {
+	Text     string `json:"text"`
+	HTML     string `json:"html"`
+	Username string `json:"username"`
+}
+
+// encodePayload renders an event in the given endpoint format
+func encodePayload(format string, e watcher.Event) ([]byte, error) {
+	switch format {
+	case config.WebhookFormatJSON:
+		return json.Marshal(e)
+
+	case config.WebhookFormatSlack:
+		return json.Marshal(slackPayload{
+			Text: fmt.Sprintf("*hsadmin*: %s", e.Message()),
+		})
+
+	case config.WebhookFormatMatrix:
+		return json.Marshal(matrixPayload{
+			Text:     e.Message(),
+			HTML:     fmt.Sprintf("<b>hsadmin</b>: %s", html.EscapeString(e.Message())),
+			Username: "hsadmin",
+		})
+	}
+
+	return nil, fmt.Errorf("unknown webhook format %q", format)
+}
@@ -2,26 +2,37 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"embed"
 	"flag"
+	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
+	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/compliance"
 	"github.com/anupcshan/hsadmin/internal/config"
-	"github.com/anupcshan/hsadmin/internal/events"
+	"github.com/anupcshan/hsadmin/internal/email"
 	"github.com/anupcshan/hsadmin/internal/handlers"
-	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/anupcshan/hsadmin/internal/health"
+	"github.com/anupcshan/hsadmin/internal/logging"
+	"github.com/anupcshan/hsadmin/internal/metrics"
+	"github.com/anupcshan/hsadmin/internal/tracing"
+	"github.com/anupcshan/hsadmin/internal/webhook"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
-	"google.golang.org/protobuf/types/known/timestamppb"
-	"tailscale.com/tsnet"
+	"google.golang.org/grpc/credentials/local"
 )
 
 //go:embed web/templates/*.html
@@ -31,15 +42,122 @@ var templatesFS embed.FS
 var staticFS embed.FS
 
 type apiKeyAuth struct {
-	key string
+	key      atomic.Pointer[string] // Replaced when secrets are reloaded
+	insecure bool                   // Allow sending the key over plaintext loopback connections
+}
+
+// newAPIKeyAuth returns per-RPC credentials for the configured API key, or nil without one
+func newAPIKeyAuth(cfg config.HeadscaleConfig) *apiKeyAuth {
+	if cfg.APIKey == "" {
+		return nil
+	}
+	a := &apiKeyAuth{insecure: cfg.Insecure}
+	a.set(cfg.APIKey)
+	return a
+}
+
+// set replaces the API key sent with later calls
+func (a *apiKeyAuth) set(key string) {
+	a.key.Store(&key)
 }
 
 func (a *apiKeyAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
-	return map[string]string{"authorization": "Bearer " + a.key}, nil
+	return map[string]string{"authorization": "Bearer " + *a.key.Load()}, nil
 }
 
 func (a *apiKeyAuth) RequireTransportSecurity() bool {
-	return true
+	return !a.insecure
+}
+
+// headscaleTarget returns the gRPC target and dial options for the configured connection to Headscale:
+// TLS to api_hostport (optionally with a custom CA, client certificate and server name), plaintext to a
+// loopback api_hostport, or Headscale's unix socket. apiKey, if not nil, is sent with every call.
+func headscaleTarget(cfg config.HeadscaleConfig, apiKey *apiKeyAuth) (string, []grpc.DialOption, error) {
+	var opts []grpc.DialOption
+	if apiKey != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(apiKey))
+	}
+
+	// Local credentials refuse to connect anywhere but a unix socket or a loopback address
+	if cfg.APISocket != "" {
+		return "unix:" + cfg.APISocket, append(opts, grpc.WithTransportCredentials(local.NewCredentials())), nil
+	}
+	if cfg.Insecure {
+		return cfg.APIHostPort, append(opts, grpc.WithTransportCredentials(local.NewCredentials())), nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLS != nil {
+		tlsConfig.ServerName = cfg.TLS.ServerName
+		if cfg.TLS.CACert != "" {
+			pem, err := os.ReadFile(cfg.TLS.CACert)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to read headscale.tls.ca_cert: %w", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return "", nil, fmt.Errorf("headscale.tls.ca_cert contains no PEM certificates: %s", cfg.TLS.CACert)
+			}
+		}
+		if cfg.TLS.ClientCert != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.TLS.ClientCert, cfg.TLS.ClientKey)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to load headscale.tls client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+	return cfg.APIHostPort, append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))), nil
+}
+
+// secretReloader re-reads the configuration and hands its secrets to the running components that use
+// them, so secrets rotated in files or environment variables take effect without a restart
+type secretReloader struct {
+	path         string
+	apiKeys      map[string]*apiKeyAuth // By tailnet name, "" for the headscale block
+	oidc         []*auth.OIDCAuthenticator
+	metricsToken *auth.BearerToken
+	email        *email.Notifier
+	webhooks     *webhook.Dispatcher
+}
+
+// reload loads the configuration and replaces the secrets of running components
+// Other settings, and sections or tailnets added since startup, take effect on restart. If the
+// configuration is invalid, the current secrets are kept.
+func (r *secretReloader) reload() error {
+	cfg, err := config.Load(r.path)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Tailnets) == 0 {
+		r.setAPIKey("", cfg.Headscale.APIKey)
+	}
+	for _, t := range cfg.Tailnets {
+		r.setAPIKey(t.Name, t.Headscale.APIKey)
+	}
+	if cfg.Listeners.HTTP != nil && cfg.Listeners.HTTP.OIDC != nil {
+		for _, o := range r.oidc {
+			o.SetSecrets(cfg.Listeners.HTTP.OIDC.ClientSecret, cfg.Listeners.HTTP.OIDC.SessionSecret)
+		}
+	}
+	if r.metricsToken != nil && cfg.Metrics != nil {
+		r.metricsToken.Set(cfg.Metrics.BearerToken)
+	}
+	if r.email != nil && cfg.Email != nil {
+		r.email.SetSMTPPassword(cfg.Email.SMTP.Password)
+	}
+	if r.webhooks != nil && cfg.Webhooks != nil {
+		r.webhooks.SetSecrets(cfg.Webhooks.Endpoints)
+	}
+	return nil
+}
+
+// setAPIKey replaces the API key of the named tailnet, if it was connected with one at startup
+func (r *secretReloader) setAPIKey(tailnet, key string) {
+	if a := r.apiKeys[tailnet]; a != nil {
+		a.set(key)
+	}
 }
 
 func main() {
@@ -56,88 +174,129 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Connect to Headscale
-	conn, err := grpc.NewClient(
-		cfg.Headscale.APIHostPort,
-		grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(nil, "")),
-		grpc.WithPerRPCCredentials(&apiKeyAuth{key: cfg.Headscale.APIKey}),
-	)
-	if err != nil {
-		log.Fatal(err)
+	// Setup structured logging; loggers created at package init follow it too
+	if err := logging.Setup(cfg.Logging); err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
 	}
-	defer conn.Close()
 
-	headscaleClient := headscale.NewHeadscaleServiceClient(conn)
+	// Setup tracing (if enabled) before connecting, so every Headscale call is traced
+	if cfg.Tracing != nil {
+		shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+		if err != nil {
+			log.Fatalf("Failed to configure tracing: %v", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				slog.Error("Failed to flush spans", "error", err)
+			}
+		}()
+		slog.Info("Tracing enabled", "protocol", cfg.Tracing.Protocol, "endpoint", cfg.Tracing.Endpoint)
+	}
 
-	// Create pre-auth key for hsadmin agent
-	key, err := headscaleClient.CreatePreAuthKey(context.Background(), &headscale.CreatePreAuthKeyRequest{
-		Ephemeral:  true,
-		Reusable:   false,
-		Expiration: timestamppb.New(time.Now().Add(1 * time.Hour)),
-		AclTags:    cfg.Headscale.AgentTags,
-		User:       cfg.Headscale.AgentUserID,
-	})
-	if err != nil {
-		log.Fatal(err)
+	// Setup Prometheus metrics (if enabled) before connecting, so every Headscale call is recorded
+	var promMetrics *metrics.Metrics
+	if cfg.Metrics != nil {
+		if len(cfg.Tailnets) > 0 {
+			promMetrics = metrics.NewShared()
+		} else {
+			promMetrics = metrics.New()
+		}
+	}
+
+	// Parse templates from embedded filesystem
+	funcMap := template.FuncMap{
+		"sub": func(a, b int) int { return a - b },
+		"mul": func(a, b float64) float64 { return a * b },
 	}
+	maps.Copy(funcMap, handlers.TemplateFuncs())
+	tmpl := template.Must(template.New("").Funcs(funcMap).ParseFS(templatesFS, "web/templates/*.html"))
 
-	// Start tsnet server
-	tsnetSrv := &tsnet.Server{
-		Hostname:   "hsadmin",
-		Ephemeral:  true,
-		AuthKey:    key.PreAuthKey.Key,
-		ControlURL: cfg.Headscale.ServerURL,
+	// Setup webhook notifications (if enabled)
+	var notify notifiers
+	if cfg.Webhooks != nil {
+		notify.webhooks, err = webhook.New(cfg.Webhooks)
+		if err != nil {
+			log.Fatalf("Failed to configure webhooks: %v", err)
+		}
+		slog.Info("Webhook notifications enabled", "endpoints", len(cfg.Webhooks.Endpoints))
 	}
-	defer tsnetSrv.Close()
 
-	// tsnet listener for Tailscale network access
-	tsnetLn, err := tsnetSrv.Listen("tcp", ":80")
-	if err != nil {
-		log.Fatal(err)
+	// Setup email notifications (if enabled)
+	if cfg.Email != nil {
+		notify.email, err = email.New(cfg.Email)
+		if err != nil {
+			log.Fatalf("Failed to configure email: %v", err)
+		}
+		slog.Info("Email notifications enabled", "recipients", len(cfg.Email.To))
 	}
-	defer tsnetLn.Close()
 
-	localClient, err := tsnetSrv.LocalClient()
+	// Client version policy, checked by the compliance report and noncompliant alert rules
+	compliancePolicy, err := compliance.NewPolicy(cfg.Compliance)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Failed to configure compliance: %v", err)
 	}
 
-	// Parse templates from embedded filesystem
-	funcMap := template.FuncMap{
-		"sub": func(a, b int) int { return a - b },
-		"mul": func(a, b float64) float64 { return a * b },
+	// Connect to the Headscale server, or to each of several tailnets
+	var tailnets []*tailnet
+	if len(cfg.Tailnets) == 0 {
+		t, err := newTailnet(cfg, "", tmpl, promMetrics, compliancePolicy, notify)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tailnets = append(tailnets, t)
+	} else {
+		names := make([]string, len(cfg.Tailnets))
+		for i, tc := range cfg.Tailnets {
+			names[i] = tc.Name
+		}
+		for _, tc := range cfg.Tailnets {
+			tailnetTmpl, err := handlers.TailnetTemplates(tmpl, tc.Name, names)
+			if err != nil {
+				log.Fatal(err)
+			}
+			var tailnetMetrics *metrics.Metrics
+			if promMetrics != nil {
+				tailnetMetrics = promMetrics.ForTailnet(tc.Name)
+			}
+			t, err := newTailnet(cfg.ForTailnet(tc), tc.Name, tailnetTmpl, tailnetMetrics, compliancePolicy, notify)
+			if err != nil {
+				log.Fatalf("Failed to set up tailnet %s: %v", tc.Name, err)
+			}
+			tailnets = append(tailnets, t)
+		}
+		slog.Info("Serving several tailnets", "tailnets", names)
 	}
-	tmpl := template.Must(template.New("").Funcs(funcMap).ParseFS(templatesFS, "web/templates/*.html"))
+	for _, t := range tailnets {
+		defer t.close()
+	}
+	authMiddleware := tailnetAuth(tailnets)
 
-	// Setup auth middleware (if enabled)
-	var authMiddleware *auth.Middleware
+	// Setup auth (if enabled); with several tailnets, sign-in is shared and each tailnet authorizes
+	// its own admins
+	var loginAuth *auth.OIDCAuthenticator
 	var authHandlers *auth.AuthHandlers
 	hasAuth := cfg.Listeners.Tailscale != nil || cfg.Listeners.HTTP != nil
 	if hasAuth {
-		authMiddleware = auth.NewMiddleware(cfg, localClient)
-		log.Printf("Authentication enabled (Tailscale: %v, HTTP: %v)",
-			cfg.Listeners.Tailscale != nil,
-			cfg.Listeners.HTTP != nil)
+		slog.Info("Authentication enabled",
+			"tailscale", cfg.Listeners.Tailscale != nil,
+			"http", cfg.Listeners.HTTP != nil)
 
 		// Setup OIDC auth handlers if HTTP listener with OIDC is configured
 		if cfg.Listeners.HTTP != nil && cfg.Listeners.HTTP.OIDC != nil {
-			authHandlers = auth.NewAuthHandlers(authMiddleware.GetOIDCAuth(), tmpl)
-			log.Printf("OIDC authentication configured with provider: %s", cfg.Listeners.HTTP.OIDC.ProviderURL)
+			if len(cfg.Tailnets) == 0 {
+				loginAuth = tailnets[0].auth.GetOIDCAuth()
+			} else if loginAuth, err = auth.NewOIDCAuthenticator(cfg); err != nil {
+				slog.Warn("Failed to initialize OIDC authenticator, OIDC authentication will not be available", "error", err)
+			}
+			authHandlers = auth.NewAuthHandlers(loginAuth, tmpl)
+			slog.Info("OIDC authentication configured", "provider", cfg.Listeners.HTTP.OIDC.ProviderURL)
 		}
 	} else {
-		log.Printf("Warning: No authentication configured - all users will have access")
+		slog.Warn("No authentication configured, all users will have access")
 	}
 
-	// Setup handlers
-	machinesHandler := handlers.NewMachinesHandler(tmpl, headscaleClient, localClient)
-	machineActionsHandler := handlers.NewMachineActionsHandler(tmpl, headscaleClient, localClient)
-	usersHandler := handlers.NewUsersHandler(tmpl, headscaleClient, localClient, machinesHandler)
-
-	// Setup SSE
-	broker := events.NewBroker()
-	defer broker.Close()
-	sseHandler := handlers.NewSSEHandler(tmpl, headscaleClient, localClient, broker, machinesHandler, usersHandler)
-
 	// Setup routes
 	mux := http.NewServeMux()
 
@@ -146,7 +305,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	mux.Handle("/static/", http.FileServer(http.FS(staticContent)))
+	var staticHandler http.Handler = http.FileServer(http.FS(staticContent))
 
 	// Auth routes (public, no auth required)
 	if authHandlers != nil {
@@ -156,14 +315,88 @@ func main() {
 	}
 
 	// Protected routes
-	handlers.SetupRoutes(mux, machinesHandler, machineActionsHandler, usersHandler, sseHandler)
-
-	// Wrap with auth middleware if enabled
 	var handler http.Handler = mux
-	if authMiddleware != nil {
-		handler = authMiddleware.RequireAuth(mux)
+	if len(cfg.Tailnets) == 0 {
+		mux.Handle("/static/", staticHandler)
+		mux.Handle("/", tailnets[0].routes)
+
+		// Wrap with auth middleware if enabled
+		if tailnets[0].auth != nil {
+			handler = tailnets[0].auth.RequireAuth(mux)
+		}
+	} else {
+		if authMiddleware != nil {
+			staticHandler = auth.RequireAnyAuth(authMiddleware, staticHandler)
+		}
+		mux.Handle("/static/", staticHandler)
+		serveTailnets(mux, tailnets)
+	}
+
+	// requireAdmin allows admins of any tailnet, or everyone without auth
+	requireAdmin := func(next http.Handler) http.Handler {
+		switch {
+		case authMiddleware == nil:
+			return next
+		case len(cfg.Tailnets) == 0:
+			return authMiddleware[0].RequireAuth(next)
+		default:
+			return auth.RequireAnyAuth(authMiddleware, next)
+		}
+	}
+
+	// Metrics route, outside the web UI's auth so scrapers can use a bearer token
+	var metricsToken *auth.BearerToken
+	if promMetrics != nil {
+		var metricsHandler http.Handler
+		switch cfg.Metrics.Auth {
+		case config.MetricsAuthBearer:
+			metricsToken = auth.NewBearerToken(cfg.Metrics.BearerToken)
+			metricsHandler = metricsToken.Require(promMetrics.Handler())
+		case config.MetricsAuthNone:
+			metricsHandler = promMetrics.Handler()
+		default:
+			metricsHandler = requireAdmin(promMetrics.Handler())
+		}
+
+		root := http.NewServeMux()
+		root.Handle("/metrics", metricsHandler)
+		root.Handle("/", handler)
+		handler = root
+		slog.Info("Prometheus metrics enabled at /metrics", "auth", cfg.Metrics.Auth)
 	}
 
+	// Log every request with its ID, route, status, latency and authenticated user
+	handler = logging.Middleware(handler)
+
+	// Trace every request, including authentication
+	if cfg.Tracing != nil {
+		handler = tracing.Handler(handler)
+	}
+
+	// Health probes, outside auth, request logging and tracing so frequent probes stay cheap and quiet
+	// Authenticated admins (everyone, without auth) get a JSON breakdown of each check.
+	var healthChecks []health.Check
+	for _, t := range tailnets {
+		healthChecks = append(healthChecks, t.checks...)
+	}
+	if cfg.Listeners.HTTP != nil && cfg.Listeners.HTTP.OIDC != nil {
+		healthChecks = append(healthChecks, health.OIDCCheck(cfg.Listeners.HTTP.OIDC.ProviderURL, loginAuth != nil))
+	}
+	healthChecker := health.NewChecker(healthChecks...)
+	isAdmin := func(r *http.Request) bool {
+		if authMiddleware == nil {
+			return true
+		}
+		return slices.ContainsFunc(authMiddleware, func(m *auth.Middleware) bool {
+			return m.Authenticate(r) != nil
+		})
+	}
+	probes := http.NewServeMux()
+	probes.Handle("/healthz", healthChecker.Healthz(isAdmin))
+	probes.Handle("/readyz", healthChecker.Readyz(isAdmin))
+	probes.Handle("/", handler)
+	handler = probes
+
 	// Signal handling
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	sigs := make(chan os.Signal, 1)
@@ -171,38 +404,79 @@ func main() {
 
 	go func() {
 		<-sigs
-		log.Println("Shutting down...")
+		slog.Info("Shutting down")
 		cancelFunc()
 	}()
 
-	// Start SSE polling loop
-	go sseHandler.StartPolling(ctx)
+	// SIGHUP re-reads secrets from the configuration, its secret files and the environment
+	reloader := &secretReloader{
+		path:         *configPath,
+		apiKeys:      make(map[string]*apiKeyAuth),
+		metricsToken: metricsToken,
+		email:        notify.email,
+		webhooks:     notify.webhooks,
+	}
+	for _, t := range tailnets {
+		reloader.apiKeys[t.name] = t.apiKey
+		if t.auth != nil && t.auth.GetOIDCAuth() != nil {
+			reloader.oidc = append(reloader.oidc, t.auth.GetOIDCAuth())
+		}
+	}
+	if loginAuth != nil && len(cfg.Tailnets) > 0 {
+		reloader.oidc = append(reloader.oidc, loginAuth)
+	}
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	go func() {
+		for range hups {
+			if err := reloader.reload(); err != nil {
+				slog.Error("Failed to reload secrets, keeping the current ones", "error", err)
+				continue
+			}
+			slog.Info("Reloaded secrets")
+		}
+	}()
+
+	if notify.email != nil {
+		go notify.email.Run(ctx)
+	}
+	if notify.webhooks != nil {
+		go notify.webhooks.Run(ctx)
+	}
+
+	// Start the change watchers
+	for _, t := range tailnets {
+		go t.watcher.Run(ctx)
+	}
 
 	// Start HTTP servers
-	log.Println("Starting hsadmin server...")
+	slog.Info("Starting hsadmin server")
 
-	// Start tsnet listener (always - required for tsnet functionality)
+	// Start tsnet listeners (always - required for tsnet functionality)
 	tsnetPort := 80
 	if cfg.Listeners.Tailscale != nil && cfg.Listeners.Tailscale.Port != 0 {
 		tsnetPort = cfg.Listeners.Tailscale.Port
 	}
-	log.Printf("Listening on Tailscale network (tsnet :%d)", tsnetPort)
-	go func() {
-		if err := http.Serve(tsnetLn, handler); err != nil {
-			log.Printf("tsnet listener error: %v", err)
-		}
-	}()
+	for _, t := range tailnets {
+		slog.Info("Listening on Tailscale network", "port", tsnetPort, "tailnet", t.name)
+		ln, tailnetHandler := t.tsnetLn, auth.WithListener(t.name, handler)
+		go func() {
+			if err := http.Serve(ln, tailnetHandler); err != nil {
+				slog.Error("tsnet listener error", "error", err)
+			}
+		}()
+	}
 
 	// Start regular HTTP listener if configured
 	if cfg.Listeners.HTTP != nil {
-		log.Printf("Listening on %s for external access", cfg.Listeners.HTTP.ListenAddr)
+		slog.Info("Listening for external access", "addr", cfg.Listeners.HTTP.ListenAddr)
 		go func() {
 			if err := http.ListenAndServe(cfg.Listeners.HTTP.ListenAddr, handler); err != nil {
-				log.Printf("HTTP listener error: %v", err)
+				slog.Error("HTTP listener error", "error", err)
 			}
 		}()
 	}
 
 	<-ctx.Done()
-	log.Println("Shutdown complete")
+	slog.Info("Shutdown complete")
 }
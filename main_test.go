@@ -1,11 +1,35 @@
 package main
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/webhook"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 )
 
 // TestMain_InvalidConfig tests that the application exits with clear error messages for invalid configs
@@ -68,6 +92,17 @@ func TestMain_InvalidConfig(t *testing.T) {
 `,
 			wantErrMsg: "api_key is required",
 		},
+		{
+			name: "plaintext to non-loopback address",
+			configYAML: `headscale:
+  agent_userid: 1
+  api_hostport: headscale.example.com:50443
+  api_key: test-key
+  insecure: true
+  server_url: https://headscale.example.com
+`,
+			wantErrMsg: "insecure is only allowed",
+		},
 		{
 			name: "missing server_url",
 			configYAML: `headscale:
@@ -189,3 +224,535 @@ func TestMain_ValidConfigButConnectionFailure(t *testing.T) {
 
 	t.Logf("✓ Config validation passed, connection failed as expected")
 }
+
+// testPKI is a certificate authority with certificate files for a test Headscale server and client
+type testPKI struct {
+	caCert     string
+	serverCert tls.Certificate
+	clientCert string
+	clientKey  string
+	pool       *x509.CertPool
+}
+
+// newTestPKI creates a CA, a server certificate valid only for serverName and a client certificate
+func newTestPKI(t *testing.T, serverName string) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "hsadmin test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	p := &testPKI{pool: x509.NewCertPool()}
+	p.pool.AddCert(ca)
+	p.caCert = write("ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+
+	serverPEM, serverKey := issue(2, serverName, x509.ExtKeyUsageServerAuth)
+	if p.serverCert, err = tls.X509KeyPair(serverPEM, serverKey); err != nil {
+		t.Fatal(err)
+	}
+	clientPEM, clientKey := issue(3, "hsadmin", x509.ExtKeyUsageClientAuth)
+	p.clientCert = write("client.pem", clientPEM)
+	p.clientKey = write("client-key.pem", clientKey)
+	return p
+}
+
+// startHealthServer serves the gRPC health service on ln and returns a function reporting the
+// authorization header of the last request
+func startHealthServer(t *testing.T, ln net.Listener, opts ...grpc.ServerOption) func() string {
+	t.Helper()
+	var mu sync.Mutex
+	var authorization string
+	opts = append(opts, grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		mu.Lock()
+		authorization = strings.Join(md.Get("authorization"), ",")
+		mu.Unlock()
+		return handler(ctx, req)
+	}))
+
+	srv := grpc.NewServer(opts...)
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	return func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return authorization
+	}
+}
+
+// remoteAddrConn reports a different remote address than the one it is connected to
+type remoteAddrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c remoteAddrConn) RemoteAddr() net.Addr { return c.remote }
+
+// TestHeadscaleTarget tests connecting to a Headscale gRPC API in each supported mode, and that
+// connections without TLS are refused unless they stay on the machine
+func TestHeadscaleTarget(t *testing.T) {
+	pki := newTestPKI(t, "headscale.internal")
+	serverTLS := func(clientAuth tls.ClientAuthType) grpc.ServerOption {
+		return grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{pki.serverCert},
+			ClientAuth:   clientAuth,
+			ClientCAs:    pki.pool,
+		}))
+	}
+
+	tests := []struct {
+		name string
+		// listen returns the listener for the test server and the headscale settings to reach it
+		listen     func(t *testing.T) (net.Listener, config.HeadscaleConfig)
+		serverOpts []grpc.ServerOption
+		dialOpts   []grpc.DialOption // Added after headscaleTarget's options
+		wantErr    string            // Expected from headscaleTarget
+		wantRPCErr string            // Expected from the health check
+	}{
+		{
+			name: "unix socket",
+			listen: func(t *testing.T) (net.Listener, config.HeadscaleConfig) {
+				path := filepath.Join(t.TempDir(), "headscale.sock")
+				ln, err := net.Listen("unix", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return ln, config.HeadscaleConfig{APISocket: path}
+			},
+		},
+		{
+			name:   "plaintext loopback",
+			listen: listenLoopback(config.HeadscaleConfig{APIKey: "test-key", Insecure: true}),
+		},
+		{
+			name:       "custom CA with server name override",
+			listen:     listenLoopback(config.HeadscaleConfig{APIKey: "test-key", TLS: &config.HeadscaleTLSConfig{CACert: pki.caCert, ServerName: "headscale.internal"}}),
+			serverOpts: []grpc.ServerOption{serverTLS(tls.NoClientCert)},
+		},
+		{
+			name:       "custom CA without server name override",
+			listen:     listenLoopback(config.HeadscaleConfig{APIKey: "test-key", TLS: &config.HeadscaleTLSConfig{CACert: pki.caCert}}),
+			serverOpts: []grpc.ServerOption{serverTLS(tls.NoClientCert)},
+			wantRPCErr: "doesn't contain any IP SANs",
+		},
+		{
+			name:       "system CAs do not trust a private CA",
+			listen:     listenLoopback(config.HeadscaleConfig{APIKey: "test-key", TLS: &config.HeadscaleTLSConfig{ServerName: "headscale.internal"}}),
+			serverOpts: []grpc.ServerOption{serverTLS(tls.NoClientCert)},
+			wantRPCErr: "certificate signed by unknown authority",
+		},
+		{
+			name: "client certificate",
+			listen: listenLoopback(config.HeadscaleConfig{APIKey: "test-key", TLS: &config.HeadscaleTLSConfig{
+				CACert: pki.caCert, ServerName: "headscale.internal", ClientCert: pki.clientCert, ClientKey: pki.clientKey,
+			}}),
+			serverOpts: []grpc.ServerOption{serverTLS(tls.RequireAndVerifyClientCert)},
+		},
+		{
+			name:       "server requires a client certificate",
+			listen:     listenLoopback(config.HeadscaleConfig{APIKey: "test-key", TLS: &config.HeadscaleTLSConfig{CACert: pki.caCert, ServerName: "headscale.internal"}}),
+			serverOpts: []grpc.ServerOption{serverTLS(tls.RequireAndVerifyClientCert)},
+			wantRPCErr: "certificate required",
+		},
+		{
+			name:       "TLS to a plaintext server",
+			listen:     listenLoopback(config.HeadscaleConfig{APIKey: "test-key"}),
+			wantRPCErr: "Unavailable",
+		},
+		{
+			name:   "plaintext to a non-loopback address is refused",
+			listen: listenLoopback(config.HeadscaleConfig{APIKey: "test-key", Insecure: true}),
+			dialOpts: []grpc.DialOption{grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+				if err != nil {
+					return nil, err
+				}
+				return remoteAddrConn{conn, &net.TCPAddr{IP: net.ParseIP("203.0.113.1"), Port: 50443}}, nil
+			})},
+			wantRPCErr: "local credentials rejected connection to non-local address",
+		},
+		{
+			name:    "CA file without certificates",
+			listen:  listenLoopback(config.HeadscaleConfig{TLS: &config.HeadscaleTLSConfig{CACert: pki.clientKey}}),
+			wantErr: "contains no PEM certificates",
+		},
+		{
+			name:    "client certificate without its key",
+			listen:  listenLoopback(config.HeadscaleConfig{TLS: &config.HeadscaleTLSConfig{ClientCert: pki.clientCert, ClientKey: pki.caCert}}),
+			wantErr: "failed to load headscale.tls client certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, cfg := tt.listen(t)
+			authorization := startHealthServer(t, ln, tt.serverOpts...)
+
+			target, opts, err := headscaleTarget(cfg, newAPIKeyAuth(cfg))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("headscaleTarget() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("headscaleTarget() failed: %v", err)
+			}
+
+			conn, err := grpc.NewClient(target, append(opts, tt.dialOpts...)...)
+			if err != nil {
+				t.Fatalf("grpc.NewClient() failed: %v", err)
+			}
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+			if tt.wantRPCErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantRPCErr) {
+					t.Fatalf("Check() error = %v, want %q", err, tt.wantRPCErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() failed: %v", err)
+			}
+
+			wantAuthorization := ""
+			if cfg.APIKey != "" {
+				wantAuthorization = "Bearer " + cfg.APIKey
+			}
+			if got := authorization(); got != wantAuthorization {
+				t.Errorf("authorization = %q, want %q", got, wantAuthorization)
+			}
+		})
+	}
+}
+
+// listenLoopback returns a listen function for TestHeadscaleTarget that serves on 127.0.0.1 and
+// points cfg's api_hostport at it
+func listenLoopback(cfg config.HeadscaleConfig) func(t *testing.T) (net.Listener, config.HeadscaleConfig) {
+	return func(t *testing.T) (net.Listener, config.HeadscaleConfig) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.APIHostPort = ln.Addr().String()
+		return ln, cfg
+	}
+}
+
+// TestSecretReloader tests that a reload picks up secrets rotated in secret files and environment
+// variables, and keeps the current secrets when the configuration has become invalid
+func TestSecretReloader(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	apiKeyFile := write("api_key", "old-api-key\n")
+	webhookURLFile := write("webhook_url", "https://old.example.com/hook")
+	webhookSecretFile := write("webhook_secret", "old-webhook-secret")
+	t.Setenv("HSADMIN_TEST_METRICS_TOKEN", "old-metrics-token")
+	configPath := write("hsadmin.yaml", `headscale:
+  agent_userid: 1
+  api_hostport: localhost:50443
+  api_key_file: `+apiKeyFile+`
+  server_url: https://localhost:8080
+  agent_tags:
+    - tag:hsadmin
+metrics:
+  auth: bearer
+  bearer_token: "${HSADMIN_TEST_METRICS_TOKEN}"
+webhooks:
+  endpoints:
+    - name: ops
+      url_file: `+webhookURLFile+`
+      secret_file: `+webhookSecretFile+`
+`)
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load() failed: %v", err)
+	}
+	dispatcher, err := webhook.New(cfg.Webhooks)
+	if err != nil {
+		t.Fatalf("webhook.New() failed: %v", err)
+	}
+	r := &secretReloader{
+		path:         configPath,
+		apiKeys:      map[string]*apiKeyAuth{"": newAPIKeyAuth(cfg.Headscale)},
+		metricsToken: auth.NewBearerToken(cfg.Metrics.BearerToken),
+		webhooks:     dispatcher,
+	}
+	metricsStatus := func(token string) int {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		r.metricsToken.Require(http.NotFoundHandler()).ServeHTTP(rec, req)
+		return rec.Code
+	}
+	checkAPIKey := func(want string) {
+		t.Helper()
+		md, err := r.apiKeys[""].GetRequestMetadata(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := md["authorization"]; got != "Bearer "+want {
+			t.Errorf("authorization = %q, want %q", got, "Bearer "+want)
+		}
+	}
+
+	// Rotate every secret, then reload
+	write("api_key", "new-api-key\n")
+	write("webhook_url", "https://new.example.com/hook")
+	write("webhook_secret", "")
+	t.Setenv("HSADMIN_TEST_METRICS_TOKEN", "new-metrics-token")
+	if err := r.reload(); err == nil || !strings.Contains(err.Error(), "secret_file") {
+		t.Fatalf("reload() with an empty secret file: error = %v", err)
+	}
+	checkAPIKey("old-api-key")
+
+	write("webhook_secret", "new-webhook-secret")
+	if err := r.reload(); err != nil {
+		t.Fatalf("reload() failed: %v", err)
+	}
+	checkAPIKey("new-api-key")
+	if got := metricsStatus("new-metrics-token"); got != http.StatusNotFound {
+		t.Errorf("metrics with new token: status = %d, want %d", got, http.StatusNotFound)
+	}
+	if got := metricsStatus("old-metrics-token"); got != http.StatusUnauthorized {
+		t.Errorf("metrics with old token: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if endpoints := dispatcher.Endpoints(); endpoints[0].Host != "new.example.com" || !endpoints[0].Signed {
+		t.Errorf("webhook endpoint = %+v, want host new.example.com, signed", endpoints[0])
+	}
+}
+
+// TestSecretReloader_Tailnets tests that a reload replaces each tailnet's API key by name
+func TestSecretReloader_Tailnets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HSADMIN_TEST_OFFICE_KEY", "old-office-key")
+	t.Setenv("HSADMIN_TEST_LAB_KEY", "old-lab-key")
+	configPath := filepath.Join(dir, "hsadmin.yaml")
+	content := `tailnets:
+  - name: office
+    headscale:
+      agent_userid: 1
+      api_hostport: localhost:50443
+      api_key: "${HSADMIN_TEST_OFFICE_KEY}"
+      server_url: https://office.example.com
+  - name: lab
+    headscale:
+      agent_userid: 1
+      api_hostport: localhost:50444
+      api_key: "${HSADMIN_TEST_LAB_KEY}"
+      server_url: https://lab.example.com
+`
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &secretReloader{path: configPath, apiKeys: make(map[string]*apiKeyAuth)}
+	for _, name := range []string{"office", "lab"} {
+		r.apiKeys[name] = newAPIKeyAuth(configHeadscale(t, configPath, name))
+	}
+
+	t.Setenv("HSADMIN_TEST_LAB_KEY", "new-lab-key")
+	if err := r.reload(); err != nil {
+		t.Fatalf("reload() failed: %v", err)
+	}
+	for name, want := range map[string]string{"office": "old-office-key", "lab": "new-lab-key"} {
+		md, err := r.apiKeys[name].GetRequestMetadata(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := md["authorization"]; got != "Bearer "+want {
+			t.Errorf("%s authorization = %q, want %q", name, got, "Bearer "+want)
+		}
+	}
+}
+
+// configHeadscale loads the configuration at path and returns the named tailnet's headscale block
+func configHeadscale(t *testing.T, path, name string) config.HeadscaleConfig {
+	t.Helper()
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("config.Load() failed: %v", err)
+	}
+	for _, tc := range cfg.Tailnets {
+		if tc.Name == name {
+			return tc.Headscale
+		}
+	}
+	t.Fatalf("no tailnet %q", name)
+	return config.HeadscaleConfig{}
+}
+
+// TestServeTailnets tests that each tailnet's routes are served under its own path, and that
+// other paths are sent to the first tailnet
+func TestServeTailnets(t *testing.T) {
+	mux := http.NewServeMux()
+	var tailnets []*tailnet
+	for _, name := range []string{"office", "lab"} {
+		tailnets = append(tailnets, &tailnet{
+			name: name,
+			routes: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(name + " " + r.URL.Path))
+			}),
+		})
+	}
+	serveTailnets(mux, tailnets)
+
+	tests := []struct {
+		path         string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{path: "/t/office/", wantCode: http.StatusOK, wantBody: "office /"},
+		{path: "/t/lab/machines/42", wantCode: http.StatusOK, wantBody: "lab /machines/42"},
+		{path: "/t/lab", wantCode: http.StatusTemporaryRedirect, wantLocation: "/t/lab/"},
+		{path: "/", wantCode: http.StatusSeeOther, wantLocation: "/t/office/"},
+		{path: "/machines?filter=online", wantCode: http.StatusSeeOther, wantLocation: "/t/office/machines?filter=online"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// TestServeTailnets_Authorization tests that requests outside any tailnet go to a tailnet the user
+// administers, and never to an empty page for users who administer none
+func TestServeTailnets_Authorization(t *testing.T) {
+	var provider *httptest.Server
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.URL,
+			"authorization_endpoint": provider.URL + "/authorize",
+			"token_endpoint":         provider.URL + "/token",
+			"jwks_uri":               provider.URL + "/keys",
+		})
+	}))
+	defer provider.Close()
+
+	mux := http.NewServeMux()
+	var tailnets []*tailnet
+	for _, tn := range []struct{ name, admin string }{{"office", "alice@example.com"}, {"lab", "bob@example.com"}} {
+		cfg := &config.Config{Listeners: config.ListenersConfig{HTTP: &config.HTTPListener{OIDC: &config.OIDCConfig{
+			ProviderURL:   provider.URL,
+			AdminEmails:   []string{tn.admin},
+			SessionSecret: "0123456789abcdef0123456789abcdef",
+		}}}}
+		middleware := auth.NewTailnetMiddleware(cfg, tn.name, nil)
+		if middleware.GetOIDCAuth() == nil {
+			t.Fatal("OIDC authenticator was not initialized")
+		}
+		tailnets = append(tailnets, &tailnet{name: tn.name, auth: middleware, routes: http.NotFoundHandler()})
+	}
+	serveTailnets(mux, tailnets)
+
+	tests := []struct {
+		email        string
+		accept       string
+		wantCode     int
+		wantLocation string
+	}{
+		{email: "alice@example.com", wantCode: http.StatusSeeOther, wantLocation: "/t/office/machines"},
+		{email: "bob@example.com", wantCode: http.StatusSeeOther, wantLocation: "/t/lab/machines"},
+		{email: "mallory@example.com", wantCode: http.StatusSeeOther, wantLocation: "/auth/login"},
+		{email: "mallory@example.com", accept: "application/json", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email+" "+tt.accept, func(t *testing.T) {
+			cookie, err := tailnets[0].auth.GetOIDCAuth().CreateSessionCookie(&auth.SessionData{Email: tt.email, ExpiresAt: time.Now().Add(time.Hour)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", "/machines", nil)
+			req.AddCookie(cookie)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
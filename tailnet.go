@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/anupcshan/hsadmin/internal/alerting"
+	"github.com/anupcshan/hsadmin/internal/auth"
+	"github.com/anupcshan/hsadmin/internal/compliance"
+	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/email"
+	"github.com/anupcshan/hsadmin/internal/events"
+	"github.com/anupcshan/hsadmin/internal/handlers"
+	"github.com/anupcshan/hsadmin/internal/health"
+	"github.com/anupcshan/hsadmin/internal/history"
+	"github.com/anupcshan/hsadmin/internal/inventory"
+	"github.com/anupcshan/hsadmin/internal/metrics"
+	"github.com/anupcshan/hsadmin/internal/tracing"
+	"github.com/anupcshan/hsadmin/internal/watcher"
+	"github.com/anupcshan/hsadmin/internal/webhook"
+	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"tailscale.com/tsnet"
+)
+
+// notifiers are shared by every tailnet; their messages name the tailnet when there are several
+type notifiers struct {
+	email    *email.Notifier
+	webhooks *webhook.Dispatcher
+}
+
+// tailnet is one Headscale server and everything hsadmin runs against it: the gRPC connection,
+// the tsnet node, the web UI routes and the watcher feeding them
+type tailnet struct {
+	name    string // Empty for the headscale block, served at /
+	apiKey  *apiKeyAuth
+	auth    *auth.Middleware // nil without authentication
+	routes  http.Handler     // Web UI routes, without authentication
+	checks  []health.Check
+	watcher *watcher.Service
+	tsnetLn net.Listener
+	closers []func() error
+}
+
+// newTailnet connects to the Headscale server in cfg and sets up its tsnet node, web UI and watcher
+// name is empty for the headscale block; otherwise cfg comes from config.Config.ForTailnet and tmpl
+// from handlers.TailnetTemplates. promMetrics may be nil.
+func newTailnet(cfg *config.Config, name string, tmpl *template.Template, promMetrics *metrics.Metrics, policy compliance.Policy, notify notifiers) (*tailnet, error) {
+	t := &tailnet{name: name}
+	logger := slog.Default()
+	if name != "" {
+		logger = logger.With("tailnet", name)
+	}
+
+	// Connect to Headscale
+	t.apiKey = newAPIKeyAuth(cfg.Headscale)
+	target, dialOptions, err := headscaleTarget(cfg.Headscale, t.apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if promMetrics != nil {
+		dialOptions = append(dialOptions, grpc.WithUnaryInterceptor(promMetrics.UnaryClientInterceptor()))
+	}
+	if cfg.Tracing != nil {
+		dialOptions = append(dialOptions, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+	}
+	conn, err := grpc.NewClient(target, dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	t.closers = append(t.closers, conn.Close)
+
+	headscaleClient := headscale.NewHeadscaleServiceClient(conn)
+
+	// Create pre-auth key for hsadmin agent
+	key, err := headscaleClient.CreatePreAuthKey(context.Background(), &headscale.CreatePreAuthKeyRequest{
+		Ephemeral:  true,
+		Reusable:   false,
+		Expiration: timestamppb.New(time.Now().Add(1 * time.Hour)),
+		AclTags:    cfg.Headscale.AgentTags,
+		User:       cfg.Headscale.AgentUserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Start tsnet server
+	tsnetSrv := &tsnet.Server{
+		Hostname:   "hsadmin",
+		Ephemeral:  true,
+		AuthKey:    key.PreAuthKey.Key,
+		ControlURL: cfg.Headscale.ServerURL,
+	}
+	if name != "" {
+		// tsnet keeps its state in a directory named after the program; each tailnet's node needs its own
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		tsnetSrv.Dir = filepath.Join(configDir, "tsnet-hsadmin-"+name)
+	}
+	t.closers = append(t.closers, tsnetSrv.Close)
+
+	// tsnet listener for Tailscale network access
+	t.tsnetLn, err = tsnetSrv.Listen("tcp", ":80")
+	if err != nil {
+		return nil, err
+	}
+	t.closers = append(t.closers, t.tsnetLn.Close)
+
+	localClient, err := tsnetSrv.LocalClient()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Tracing != nil {
+		tracing.InstrumentLocalClient(localClient)
+	}
+
+	// Setup auth middleware (if enabled)
+	if cfg.Listeners.Tailscale != nil || cfg.Listeners.HTTP != nil {
+		t.auth = auth.NewTailnetMiddleware(cfg, name, localClient)
+	}
+
+	// Setup handlers
+	machinesHandler := handlers.NewMachinesHandler(tmpl, headscaleClient, localClient)
+	machineActionsHandler := handlers.NewMachineActionsHandler(tmpl, headscaleClient, localClient)
+	usersHandler := handlers.NewUsersHandler(tmpl, headscaleClient, localClient, machinesHandler)
+
+	// Setup SSE
+	broker := events.NewBroker()
+	t.closers = append(t.closers, func() error {
+		broker.Close()
+		return nil
+	})
+	sseHandler := handlers.NewSSEHandler(tmpl, headscaleClient, localClient, broker, machinesHandler, usersHandler)
+
+	// Setup history recording (if enabled)
+	var historyStore *history.Store
+	var sampleInterval time.Duration
+	if cfg.History != nil {
+		historyStore, err = history.Open(cfg.History.Dir)
+		if err != nil {
+			return nil, err
+		}
+		t.closers = append(t.closers, historyStore.Close)
+		sampleInterval = cfg.History.SampleInterval
+		logger.Info("History recording enabled", "dir", cfg.History.Dir)
+	}
+	historyHandler := handlers.NewHistoryHandler(tmpl, localClient, historyStore, sampleInterval)
+	derpHandler := handlers.NewDERPHandler(tmpl, localClient, machinesHandler)
+	diagnosticsHandler := handlers.NewDiagnosticsHandler(tmpl, localClient)
+	webhooksHandler := handlers.NewWebhooksHandler(tmpl, notify.webhooks)
+	complianceHandler := handlers.NewComplianceHandler(tmpl, machinesHandler, policy)
+	backupHandler := handlers.NewBackupHandler(tmpl, headscaleClient)
+
+	// Setup alert rules (if enabled)
+	var alertEngine *alerting.Engine
+	if cfg.Alerts != nil {
+		alertEngine, err = alerting.NewEngine(cfg.Alerts, policy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure alerts: %w", err)
+		}
+		logger.Info("Alerts enabled", "rules", len(cfg.Alerts.Rules), "silences_file", cfg.Alerts.SilencesFile)
+	}
+	alertingHandler := handlers.NewAlertingHandler(tmpl, alertEngine, broker)
+	dashboardHandler := handlers.NewDashboardHandler(tmpl, broker)
+
+	mux := http.NewServeMux()
+	handlers.SetupRoutes(mux, dashboardHandler, machinesHandler, machineActionsHandler, usersHandler, sseHandler, historyHandler, derpHandler, diagnosticsHandler, webhooksHandler, alertingHandler, complianceHandler, backupHandler)
+	t.routes = mux
+
+	t.checks = []health.Check{
+		health.HeadscaleCheck(headscaleClient, cfg.Headscale.AgentUserID),
+		health.TailscaleCheck(localClient),
+	}
+	if name != "" {
+		for i := range t.checks {
+			t.checks[i].Name = name + "/" + t.checks[i].Name
+		}
+	}
+
+	// Setup the change watcher; live updates, history, alerts and notifications all
+	// subscribe to its polls instead of polling Headscale themselves
+	fetch := watcher.Fetcher(machinesHandler, headscaleClient)
+	if promMetrics != nil {
+		fetch = promMetrics.TimeFetch(fetch)
+	}
+	if cfg.Tracing != nil {
+		fetch = tracing.TraceFetch(fetch)
+	}
+	t.watcher = watcher.NewService(fetch, cfg.Watcher.PollInterval)
+	t.watcher.Subscribe("SSE", sseHandler.HandleUpdate)
+	t.watcher.Subscribe("Dashboard", dashboardHandler.Observe)
+	t.watcher.OnStatusChange(dashboardHandler.ObserveStatus)
+
+	if promMetrics != nil {
+		promMetrics.WatchTailnet(t.watcher.Latest)
+		promMetrics.WatchBroker(broker)
+	}
+
+	if historyStore != nil {
+		recorder := history.NewRecorder(historyStore, cfg.History)
+		t.watcher.Subscribe("History", recorder.Record)
+	}
+
+	if alertEngine != nil {
+		if notify.email != nil {
+			alertEngine.OnChange(func(events []watcher.Event) {
+				notify.email.Notify(watcher.InTailnet(name, events))
+			})
+		}
+		if notify.webhooks != nil {
+			alertEngine.OnChange(func(events []watcher.Event) {
+				notify.webhooks.Notify(watcher.InTailnet(name, events))
+			})
+		}
+		t.watcher.Subscribe("Alerts", alertingHandler.Observe)
+	}
+
+	if cfg.Inventory != nil {
+		exporter, err := inventory.NewExporter(cfg.Inventory)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure inventory exports: %w", err)
+		}
+		t.watcher.Subscribe("Inventory", exporter.Export)
+	}
+
+	if notify.email != nil {
+		t.watcher.Subscribe("Email", func(u watcher.Update) {
+			notify.email.Notify(watcher.InTailnet(name, u.Events))
+		})
+	}
+
+	if notify.webhooks != nil {
+		t.watcher.Subscribe("Webhooks", func(u watcher.Update) {
+			notify.webhooks.Notify(watcher.InTailnet(name, u.Events))
+		})
+	}
+
+	return t, nil
+}
+
+// close shuts down the tailnet's connections in the reverse order they were opened
+func (t *tailnet) close() {
+	for _, c := range slices.Backward(t.closers) {
+		c()
+	}
+}
+
+// serveTailnets routes each of several tailnets' web UI under handlers.TailnetPath, behind its own
+// authorization, and sends requests elsewhere to the first tailnet the user may administer
+func serveTailnets(mux *http.ServeMux, tailnets []*tailnet) {
+	for _, t := range tailnets {
+		prefix := handlers.TailnetPath(t.name)
+		routes := t.routes
+		if t.auth != nil {
+			routes = t.auth.RequireAuth(routes)
+		}
+		mux.Handle(prefix+"/", handlers.Mount(prefix, routes))
+	}
+
+	var open http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, t := range tailnets {
+			if t.auth == nil || t.auth.Authenticate(r) != nil {
+				http.Redirect(w, r, handlers.TailnetPath(t.name)+r.URL.RequestURI(), http.StatusSeeOther)
+				return
+			}
+		}
+		http.Error(w, "You do not have permission to administer any tailnet", http.StatusForbidden)
+	})
+	if middleware := tailnetAuth(tailnets); middleware != nil {
+		open = auth.RequireAnyAuth(middleware, open)
+	}
+	mux.Handle("/", open)
+}
+
+// tailnetAuth returns the tailnets' auth middleware, or nil without authentication
+func tailnetAuth(tailnets []*tailnet) []*auth.Middleware {
+	var middleware []*auth.Middleware
+	for _, t := range tailnets {
+		if t.auth != nil {
+			middleware = append(middleware, t.auth)
+		}
+	}
+	return middleware
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"html/template"
+	"maps"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
@@ -240,6 +241,7 @@ func setupRealHandlerWithClient(t *testing.T, testEnv *TestEnv, hostname string)
 		"sub": func(a, b int) int { return a - b },
 		"mul": func(a, b float64) float64 { return a * b },
 	}
+	maps.Copy(funcMap, handlers.TemplateFuncs())
 	tmpl := template.Must(template.New("").Funcs(funcMap).ParseGlob(templatesPath))
 
 	return handlers.NewMachinesHandler(tmpl, headscaleClient, tsnetClient), tsnetClient
@@ -263,6 +265,7 @@ func setupRealUsersHandler(t *testing.T, testEnv *TestEnv) (*handlers.UsersHandl
 		"sub": func(a, b int) int { return a - b },
 		"mul": func(a, b float64) float64 { return a * b },
 	}
+	maps.Copy(funcMap, handlers.TemplateFuncs())
 	tmpl := template.Must(template.New("").Funcs(funcMap).ParseGlob(templatesPath))
 
 	// Create machines handler first (needed by users handler for deduplication)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/anupcshan/hsadmin/internal/auth"
 	"github.com/anupcshan/hsadmin/internal/config"
+	"github.com/anupcshan/hsadmin/internal/handlers"
 	"github.com/oauth2-proxy/mockoidc"
 	"github.com/stretchr/testify/require"
 )
@@ -363,6 +365,7 @@ func startHTTPServerWithConfig(t *testing.T, cfg *config.Config) (*httptest.Serv
 		"sub": func(a, b int) int { return a - b },
 		"mul": func(a, b float64) float64 { return a * b },
 	}
+	maps.Copy(funcMap, handlers.TemplateFuncs())
 	tmpl := template.Must(template.New("").Funcs(funcMap).ParseGlob(templatesPath))
 
 	// Create auth middleware (no tsnet client needed for OIDC-only tests)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -12,9 +13,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/anupcshan/hsadmin/internal/compliance"
 	"github.com/anupcshan/hsadmin/internal/events"
 	"github.com/anupcshan/hsadmin/internal/handlers"
 	"github.com/anupcshan/hsadmin/internal/sets"
+	"github.com/anupcshan/hsadmin/internal/watcher"
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
 	headscale "github.com/juanfont/headscale/gen/go/headscale/v1"
@@ -1127,23 +1130,37 @@ func startTestServer(t *testing.T, testEnv *TestEnv) (*httptest.Server, string)
 		"sub": func(a, b int) int { return a - b },
 		"mul": func(a, b float64) float64 { return a * b },
 	}
+	maps.Copy(funcMap, handlers.TemplateFuncs())
 	tmpl := template.Must(template.New("").Funcs(funcMap).ParseGlob(templatesPath))
 
 	// Create handlers
 	machinesHandler := handlers.NewMachinesHandler(tmpl, headscaleClient, localClient)
 	machineActionsHandler := handlers.NewMachineActionsHandler(tmpl, headscaleClient, localClient)
 	usersHandler := handlers.NewUsersHandler(tmpl, headscaleClient, localClient, machinesHandler)
+	historyHandler := handlers.NewHistoryHandler(tmpl, localClient, nil, 0)
+	derpHandler := handlers.NewDERPHandler(tmpl, localClient, machinesHandler)
+	diagnosticsHandler := handlers.NewDiagnosticsHandler(tmpl, localClient)
+	webhooksHandler := handlers.NewWebhooksHandler(tmpl, nil)
 
 	// Setup SSE (matching main.go)
 	broker := events.NewBroker()
 	t.Cleanup(func() { broker.Close() })
 
+	alertingHandler := handlers.NewAlertingHandler(tmpl, nil, broker)
+	dashboardHandler := handlers.NewDashboardHandler(tmpl, broker)
+	complianceHandler := handlers.NewComplianceHandler(tmpl, machinesHandler, compliance.Policy{})
+	backupHandler := handlers.NewBackupHandler(tmpl, headscaleClient)
+
 	sseHandler := handlers.NewSSEHandler(tmpl, headscaleClient, localClient, broker, machinesHandler, usersHandler)
 
-	// Start SSE polling loop
+	// Start the change watcher feeding SSE updates
 	ctx, cancel := context.WithCancel(context.Background())
 	t.Cleanup(cancel)
-	go sseHandler.StartPolling(ctx)
+	watcherService := watcher.NewService(watcher.Fetcher(machinesHandler, headscaleClient), 500*time.Millisecond)
+	watcherService.Subscribe("SSE", sseHandler.HandleUpdate)
+	watcherService.Subscribe("Dashboard", dashboardHandler.Observe)
+	watcherService.OnStatusChange(dashboardHandler.ObserveStatus)
+	go watcherService.Run(ctx)
 
 	// Setup routes
 	mux := http.NewServeMux()
@@ -1152,7 +1169,7 @@ func startTestServer(t *testing.T, testEnv *TestEnv) (*httptest.Server, string)
 	staticPath := filepath.Join(repoRoot, "web", "static")
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(staticPath))))
 
-	handlers.SetupRoutes(mux, machinesHandler, machineActionsHandler, usersHandler, sseHandler)
+	handlers.SetupRoutes(mux, dashboardHandler, machinesHandler, machineActionsHandler, usersHandler, sseHandler, historyHandler, derpHandler, diagnosticsHandler, webhooksHandler, alertingHandler, complianceHandler, backupHandler)
 
 	// Create test server
 	server := httptest.NewServer(mux)